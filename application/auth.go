@@ -0,0 +1,146 @@
+package application
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/domain/model"
+	"github.com/sioncojp/famili-api/domain/repository"
+	httpresponse "github.com/sioncojp/famili-api/utils/http_response"
+	"github.com/sioncojp/famili-api/utils/log"
+	"github.com/sioncojp/famili-api/utils/secure"
+)
+
+const (
+	ErrorMessageInvalidAPIKey     = "invalid_api_key"
+	ErrorMessageInvalidSession    = "invalid_session"
+	ErrorMessageInsufficientScope = "insufficient_scope"
+	ErrorMessageAPIKeyNotAllowed  = "api_key_not_allowed"
+	ErrorMessageAdminOnly         = "admin_only"
+	ErrorMessageAuthRequired      = "authentication_required"
+
+	// HeaderAdminToken...管理用endpointで使うtoken
+	HeaderAdminToken = "X-Famili-Admin-Token"
+
+	bearerPrefix = "Bearer "
+)
+
+// bearerAuth...Authorization: Bearer を検証してCallerをcontextに格納する. Callerは検証したcredentialからしか作らない
+// fam_ で始まればAPI key、それ以外はlogin sessionとして扱う. Authorizationが無いリクエストは匿名のCallerのまま通す
+func bearerAuth(apiKeys repository.APIKeyRepository, signer *secure.Signer) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authorization := r.Header.Get("Authorization")
+			if authorization == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			raw := strings.TrimPrefix(authorization, bearerPrefix)
+			if raw == authorization {
+				httpresponse.Error(w, r, http.StatusUnauthorized, ErrorMessageInvalidAPIKey, "")
+				return
+			}
+
+			if strings.HasPrefix(raw, model.APIKeyPrefix) {
+				apiKeyAuth(apiKeys, raw, w, r, next)
+				return
+			}
+			sessionAuth(signer, raw, w, r, next)
+		})
+	}
+}
+
+// apiKeyAuth...API keyのメンバーとscopeをcontextに格納する
+func apiKeyAuth(repo repository.APIKeyRepository, raw string, w http.ResponseWriter, r *http.Request, next http.Handler) {
+	prefix, ok := model.ParseAPIKeyPrefix(raw)
+	if !ok {
+		httpresponse.Error(w, r, http.StatusUnauthorized, ErrorMessageInvalidAPIKey, "")
+		return
+	}
+
+	key, err := repo.GetByPrefix(prefix)
+	if err != nil || key.Revoked() || !key.Matches(raw) {
+		httpresponse.Error(w, r, http.StatusUnauthorized, ErrorMessageInvalidAPIKey, "")
+		return
+	}
+
+	now := time.Now()
+	key.LastUsedAt = &now
+	if err := repo.TouchLastUsed(&key); err != nil {
+		log.Log.Warnf("could not record api key last used: %v", err)
+	}
+
+	ctx := domain.NewCallerContext(r.Context(), domain.Caller{MemberId: key.MemberId, FamilyId: key.FamilyId})
+	ctx = domain.NewScopesContext(ctx, key.Scopes)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// sessionAuth...login sessionのaccountとメンバーをcontextに格納する
+func sessionAuth(signer *secure.Signer, raw string, w http.ResponseWriter, r *http.Request, next http.Handler) {
+	claims, err := signer.Verify(raw, secure.PurposeSession)
+	if err != nil {
+		httpresponse.Error(w, r, http.StatusUnauthorized, ErrorMessageInvalidSession, "")
+		return
+	}
+
+	ctx := domain.NewCallerContext(r.Context(), domain.Caller{
+		MemberId:  domain.Id(claims.MemberId),
+		FamilyId:  domain.Id(claims.FamilyId),
+		AccountId: domain.Id(strconv.FormatUint(uint64(claims.AccountId), 10)),
+	})
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// requireCaller...bearerAuthで認証できていない匿名のリクエストには401を返す
+func requireCaller(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if domain.CallerFromContext(r.Context()).MemberId == "" {
+			httpresponse.Error(w, r, http.StatusUnauthorized, ErrorMessageAuthRequired, "")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireScope...API keyで認証している場合、scopeを持っていなければ403を返す
+func requireScope(scope string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if scopes, ok := domain.ScopesFromContext(r.Context()); ok && !model.Scopes(scopes).Has(scope) {
+				httpresponse.Error(w, r, http.StatusForbidden, ErrorMessageInsufficientScope, scope)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// denyAPIKey...API keyの管理などkeyからは触らせたくないルートで使う
+func denyAPIKey(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := domain.ScopesFromContext(r.Context()); ok {
+			httpresponse.Error(w, r, http.StatusForbidden, ErrorMessageAPIKeyNotAllowed, "")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireAdmin...configのadminTokenと一致しなければ403を返す. adminTokenが空なら常に403
+func requireAdmin(adminToken string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := r.Header.Get(HeaderAdminToken)
+			if adminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+				httpresponse.Error(w, r, http.StatusForbidden, ErrorMessageAdminOnly, "")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package application
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/domain/model"
+	"github.com/sioncojp/famili-api/utils/secure"
+)
+
+const (
+	validKey   = "fam_abcdefgh_valid-secret"
+	revokedKey = "fam_revoked1_revoked-secret"
+)
+
+var testSigningKey = base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+
+// headerCallerMember...テストのhandlerがcontextのCallerのメンバーIDを返すheader
+const headerCallerMember = "X-Test-Caller-Member-Id"
+
+func newAuthRouter(m *MockAPIKeyService, signer *secure.Signer) *chi.Mux {
+	r := chi.NewRouter()
+	r.Use(bearerAuth(m, signer))
+	r.With(requireScope(model.ScopeTodosRead)).Get("/todos", func(w http.ResponseWriter, r *http.Request) {
+		caller := domain.CallerFromContext(r.Context())
+		w.Header().Set(headerCallerMember, string(caller.MemberId))
+		w.WriteHeader(http.StatusOK)
+	})
+	r.With(requireScope(model.ScopeTodosWrite)).Post("/todos", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})
+	r.With(denyAPIKey).Get("/api-keys", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	return r
+}
+
+func TestAPIKeyAuth(t *testing.T) {
+	t.Parallel()
+	signer, _ := secure.NewSigner(testSigningKey)
+	session, _ := signer.Sign(secure.Claims{AccountId: 1, MemberId: "20", FamilyId: "f1", Purpose: secure.PurposeSession}, time.Hour)
+	mfa, _ := signer.Sign(secure.Claims{AccountId: 1, MemberId: "20", FamilyId: "f1", Purpose: secure.PurposeMFA}, time.Hour)
+	revokedAt := time.Now()
+	m := new(MockAPIKeyService)
+	m.On("GetByPrefix", "abcdefgh").Return(model.APIKey{
+		Hash:     model.HashAPIKey(validKey),
+		Scopes:   model.Scopes{model.ScopeTodosRead},
+		MemberId: "10",
+		FamilyId: "f1",
+	}, nil)
+	m.On("GetByPrefix", "revoked1").Return(model.APIKey{
+		Hash:      model.HashAPIKey(revokedKey),
+		Scopes:    model.Scopes{model.ScopeTodosRead},
+		RevokedAt: &revokedAt,
+	}, nil)
+	m.On("GetByPrefix", mock.Anything).Return(model.APIKey{}, errors.New("record not found"))
+	m.On("TouchLastUsed", mock.MatchedBy(func(key *model.APIKey) bool { return key.LastUsedAt != nil })).Return(nil)
+	r := newAuthRouter(m, signer)
+
+	cases := []struct {
+		name           string
+		method         string
+		path           string
+		authorization  string
+		httpStatusCode int
+		memberId       string
+	}{
+		{"no authorization", http.MethodGet, "/todos", "", http.StatusOK, ""},
+		{"valid key", http.MethodGet, "/todos", "Bearer " + validKey, http.StatusOK, "10"},
+		{"missing scope", http.MethodPost, "/todos", "Bearer " + validKey, http.StatusForbidden, ""},
+		{"wrong secret", http.MethodGet, "/todos", "Bearer fam_abcdefgh_wrong-secret", http.StatusUnauthorized, ""},
+		{"unknown prefix", http.MethodGet, "/todos", "Bearer fam_unknown0_secret", http.StatusUnauthorized, ""},
+		{"revoked key", http.MethodGet, "/todos", "Bearer " + revokedKey, http.StatusUnauthorized, ""},
+		{"not bearer", http.MethodGet, "/todos", "Basic " + validKey, http.StatusUnauthorized, ""},
+		{"api key management", http.MethodGet, "/api-keys", "Bearer " + validKey, http.StatusForbidden, ""},
+		{"session", http.MethodPost, "/todos", "Bearer " + session, http.StatusCreated, ""},
+		{"session member", http.MethodGet, "/todos", "Bearer " + session, http.StatusOK, "20"},
+		{"session api key management", http.MethodGet, "/api-keys", "Bearer " + session, http.StatusOK, ""},
+		{"mfa token is not session", http.MethodGet, "/todos", "Bearer " + mfa, http.StatusUnauthorized, ""},
+	}
+
+	for _, v := range cases {
+		v := v
+		t.Run(
+			v.name,
+			func(tt *testing.T) {
+				tt.Parallel()
+				req := httptest.NewRequest(v.method, v.path, nil)
+				// headerではメンバーを名乗れない
+				req.Header.Set("X-Famili-Member-Id", "1")
+				req.Header.Set("X-Famili-Family-Id", "f1")
+				if v.authorization != "" {
+					req.Header.Set("Authorization", v.authorization)
+				}
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, req)
+
+				assert.Equal(tt, v.httpStatusCode, w.Result().StatusCode)
+				assert.Equal(tt, v.memberId, w.Result().Header.Get(headerCallerMember))
+			},
+		)
+	}
+}
+
+func TestRequireAdmin(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		name           string
+		adminToken     string
+		header         string
+		httpStatusCode int
+	}{
+		{"ok", "admin-secret", "admin-secret", http.StatusOK},
+		{"wrong token", "admin-secret", "nope", http.StatusForbidden},
+		{"missing header", "admin-secret", "", http.StatusForbidden},
+		{"disabled", "", "", http.StatusForbidden},
+	}
+
+	for _, v := range cases {
+		r := chi.NewRouter()
+		r.With(requireAdmin(v.adminToken)).Post("/admin/unlock", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})
+
+		req := httptest.NewRequest(http.MethodPost, "/admin/unlock", nil)
+		if v.header != "" {
+			req.Header.Set(HeaderAdminToken, v.header)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, v.httpStatusCode, w.Result().StatusCode, v.name)
+	}
+}
@@ -0,0 +1,35 @@
+package application
+
+import (
+	"context"
+	"sync"
+)
+
+// Background...outboxのrelayやreplicaのhealth checkなど、serverの裏で動くloop
+// RunServerのgraceful shutdownでcancelし、終わるのを待ってからDBを閉じる
+type Background struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewBackground...Stopするまでcancelされないcontextで始める
+func NewBackground() *Background {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Background{ctx: ctx, cancel: cancel}
+}
+
+// Go...runをgoroutineで動かす. runはctxがcancelされたらreturnする
+func (b *Background) Go(run func(ctx context.Context)) {
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		run(b.ctx)
+	}()
+}
+
+// Stop...全てのloopをcancelして、終わるのを待つ
+func (b *Background) Stop() {
+	b.cancel()
+	b.wg.Wait()
+}
@@ -0,0 +1,26 @@
+package application
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackgroundStop(t *testing.T) {
+	t.Parallel()
+	b := NewBackground()
+
+	var stopped int32
+	for i := 0; i < 3; i++ {
+		b.Go(func(ctx context.Context) {
+			<-ctx.Done()
+			atomic.AddInt32(&stopped, 1)
+		})
+	}
+
+	// Stopは全てのloopが終わるまで返らない
+	b.Stop()
+	assert.EqualValues(t, 3, atomic.LoadInt32(&stopped))
+}
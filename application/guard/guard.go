@@ -0,0 +1,183 @@
+package guard
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/sioncojp/famili-api/domain/model"
+	"github.com/sioncojp/famili-api/domain/repository"
+)
+
+// ErrLocked...backoff中、またはlockout中
+var ErrLocked = errors.New("too many failed attempts")
+
+var (
+	// DefaultAccountPolicy...accountごと. 3回までは待たせず、10回で15分lockする
+	DefaultAccountPolicy = model.LoginPolicy{
+		FreeAttempts:     3,
+		BaseDelay:        time.Second,
+		MaxDelay:         time.Minute,
+		LockoutThreshold: 10,
+		LockoutDuration:  15 * time.Minute,
+		ResetAfter:       time.Hour,
+	}
+
+	// DefaultIPPolicy...IPごと. 家族でNATを共有するのでaccountより緩くする
+	DefaultIPPolicy = model.LoginPolicy{
+		FreeAttempts:     10,
+		BaseDelay:        time.Second,
+		MaxDelay:         time.Minute,
+		LockoutThreshold: 50,
+		LockoutDuration:  15 * time.Minute,
+		ResetAfter:       time.Hour,
+	}
+)
+
+// Guard...loginなど認証情報を確認するendpointをbrute-forceから守る
+// muでGetからSaveまでを1つにするので、1台の中では同時に来たrequestも全て数える
+type Guard struct {
+	mu            sync.Mutex
+	store         repository.LoginAttemptRepository
+	logger        *zap.Logger
+	accountPolicy model.LoginPolicy
+	ipPolicy      model.LoginPolicy
+	now           func() time.Time
+}
+
+// NewGuard...storeはMySQLかメモリの実装を渡す
+func NewGuard(store repository.LoginAttemptRepository, logger *zap.Logger, accountPolicy, ipPolicy model.LoginPolicy) *Guard {
+	return &Guard{
+		store:         store,
+		logger:        logger,
+		accountPolicy: accountPolicy,
+		ipPolicy:      ipPolicy,
+		now:           time.Now,
+	}
+}
+
+// AccountKey...accountごとのkey. emailの大文字小文字は区別しない
+func AccountKey(account string) string {
+	return "account:" + strings.ToLower(account)
+}
+
+// IPKey...IPごとのkey. RemoteAddrにportがついていれば外す
+func IPKey(remoteAddr string) string {
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		remoteAddr = host
+	}
+	return "ip:" + remoteAddr
+}
+
+// Check...accountとIPのどちらかが待ち中ならErrLockedと待ち時間を返す
+// 試せるなら結果を待たずに失敗として数えておき、同時に来たrequestがbcryptの間に通り抜けられないようにする
+// 認証が通ったらRelease, Succeedで取り消す
+func (g *Guard) Check(account, ip string) (time.Duration, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	keys := g.keys(account, ip)
+	attempts := make([]model.LoginAttempt, 0, len(keys))
+	var retryAfter time.Duration
+	for _, v := range keys {
+		attempt, err := g.store.Get(v.key)
+		if err != nil {
+			return 0, errors.Wrap(err, "get login attempt")
+		}
+		if d := attempt.RetryAfter(now); d > retryAfter {
+			retryAfter = d
+		}
+		attempts = append(attempts, attempt)
+	}
+	if retryAfter > 0 {
+		return retryAfter, ErrLocked
+	}
+
+	for i, v := range keys {
+		attempt := attempts[i]
+		if attempt.RecordFailure(now, v.policy) {
+			g.logger.Warn("login locked out",
+				zap.String("key", v.key),
+				zap.Int("failures", attempt.Failures),
+				zap.Time("locked_until", attempt.LockedUntil),
+			)
+		}
+		if err := g.store.Save(&attempt); err != nil {
+			return 0, errors.Wrap(err, "save login attempt")
+		}
+	}
+	return 0, nil
+}
+
+// Release...passwordは合っていてTOTPを待つときなど、Checkで数えた1回をaccountとIPから取り消す
+func (g *Guard) Release(account, ip string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, v := range g.keys(account, ip) {
+		if err := g.release(v.key, v.policy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Succeed...accountの失敗を忘れ、IPはCheckで数えた1回だけ取り消す. IPは他のaccountへの攻撃もあるので自然に忘れるのを待つ
+func (g *Guard) Succeed(account, ip string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if err := g.store.Delete(AccountKey(account)); err != nil {
+		return err
+	}
+	return g.release(IPKey(ip), g.ipPolicy)
+}
+
+type guardKey struct {
+	key    string
+	policy model.LoginPolicy
+}
+
+func (g *Guard) keys(account, ip string) []guardKey {
+	return []guardKey{
+		{AccountKey(account), g.accountPolicy},
+		{IPKey(ip), g.ipPolicy},
+	}
+}
+
+func (g *Guard) release(key string, policy model.LoginPolicy) error {
+	attempt, err := g.store.Get(key)
+	if err != nil {
+		return errors.Wrap(err, "get login attempt")
+	}
+	if attempt.Failures == 0 {
+		return nil
+	}
+	attempt.ReleaseFailure(policy)
+	return errors.Wrap(g.store.Save(&attempt), "save login attempt")
+}
+
+// Unlock...管理者がlockを解除する. 空の値は無視する
+func (g *Guard) Unlock(account, ip string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if account != "" {
+		if err := g.store.Delete(AccountKey(account)); err != nil {
+			return err
+		}
+		g.logger.Info("login unlocked", zap.String("key", AccountKey(account)))
+	}
+	if ip != "" {
+		if err := g.store.Delete(IPKey(ip)); err != nil {
+			return err
+		}
+		g.logger.Info("login unlocked", zap.String("key", IPKey(ip)))
+	}
+	return nil
+}
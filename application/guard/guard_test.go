@@ -0,0 +1,145 @@
+package guard
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/sioncojp/famili-api/domain/model"
+	"github.com/sioncojp/famili-api/infrastructure/memory"
+)
+
+var testPolicy = model.LoginPolicy{
+	FreeAttempts:     2,
+	BaseDelay:        time.Second,
+	MaxDelay:         4 * time.Second,
+	LockoutThreshold: 5,
+	LockoutDuration:  time.Minute,
+	ResetAfter:       time.Hour,
+}
+
+func newTestGuard(now *time.Time) *Guard {
+	g := NewGuard(memory.NewLoginAttemptRepository(), zap.NewNop(), testPolicy, testPolicy)
+	g.now = func() time.Time { return *now }
+	return g
+}
+
+func TestGuardBackoffAndLockout(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	g := newTestGuard(&now)
+
+	// 試した時点で失敗として数えるので、FreeAttemptsを超えた次から待たされる
+	for i := 0; i <= testPolicy.FreeAttempts; i++ {
+		_, err := g.Check("Papa@example.com", "192.0.2.1:1234")
+		require.NoError(t, err, "attempt %d", i+1)
+	}
+
+	for i, v := range []time.Duration{time.Second, 2 * time.Second, time.Minute} {
+		d, err := g.Check("papa@example.com", "192.0.2.1:5678")
+		assert.ErrorIs(t, err, ErrLocked, "wait %d", i+1)
+		assert.Equal(t, v, d, "wait %d", i+1)
+
+		now = now.Add(d)
+		_, err = g.Check("papa@example.com", "192.0.2.1")
+		assert.NoError(t, err, "wait %d should expire", i+1)
+	}
+}
+
+// TestGuardConcurrentCheck...同時に来たrequestもCheckの時点で数えるので、FreeAttemptsを超えては通らない
+func TestGuardConcurrentCheck(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	g := newTestGuard(&now)
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		allowed int
+	)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := g.Check("papa@example.com", "192.0.2.1"); err == nil {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, testPolicy.FreeAttempts+1, allowed)
+}
+
+func TestGuardResetAfter(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	g := newTestGuard(&now)
+
+	for i := 0; i <= testPolicy.FreeAttempts; i++ {
+		_, err := g.Check("papa@example.com", "192.0.2.1")
+		require.NoError(t, err)
+	}
+	now = now.Add(2 * time.Hour)
+	_, err := g.Check("papa@example.com", "192.0.2.1")
+	require.NoError(t, err)
+
+	_, err = g.Check("papa@example.com", "192.0.2.1")
+	assert.NoError(t, err, "failures should be forgotten after ResetAfter")
+}
+
+func TestGuardReleaseAndSucceed(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	g := newTestGuard(&now)
+
+	for i := 0; i <= testPolicy.FreeAttempts; i++ {
+		_, err := g.Check("papa@example.com", "192.0.2.1")
+		require.NoError(t, err)
+	}
+	_, err := g.Check("papa@example.com", "192.0.2.1")
+	require.ErrorIs(t, err, ErrLocked)
+
+	// 取り消せばbackoffも計算し直す
+	require.NoError(t, g.Release("papa@example.com", "192.0.2.1"))
+	_, err = g.Check("papa@example.com", "192.0.2.1")
+	require.NoError(t, err)
+
+	// accountは忘れ、IPは1回だけ取り消す
+	require.NoError(t, g.Succeed("papa@example.com", "192.0.2.1"))
+	account, err := g.store.Get(AccountKey("papa@example.com"))
+	require.NoError(t, err)
+	assert.Equal(t, 0, account.Failures)
+	ip, err := g.store.Get(IPKey("192.0.2.1"))
+	require.NoError(t, err)
+	assert.Equal(t, testPolicy.FreeAttempts, ip.Failures)
+}
+
+func TestGuardUnlock(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	g := newTestGuard(&now)
+	require.NoError(t, g.store.Save(&model.LoginAttempt{Key: IPKey("192.0.2.1"), Failures: 5, LastFailedAt: now, LockedUntil: now.Add(time.Minute)}))
+
+	// accountを忘れてもIPはlockされたまま
+	require.NoError(t, g.Succeed("papa@example.com", "192.0.2.1"))
+	_, err := g.Check("papa@example.com", "192.0.2.1")
+	assert.ErrorIs(t, err, ErrLocked)
+
+	require.NoError(t, g.Unlock("", "192.0.2.1"))
+	_, err = g.Check("papa@example.com", "192.0.2.1")
+	assert.NoError(t, err)
+}
+
+func TestIPKey(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, "ip:192.0.2.1", IPKey("192.0.2.1:1234"))
+	assert.Equal(t, "ip:192.0.2.1", IPKey("192.0.2.1"))
+	assert.Equal(t, "ip:::1", IPKey("[::1]:1234"))
+	assert.Equal(t, "account:papa@example.com", AccountKey("Papa@Example.com"))
+}
@@ -0,0 +1,24 @@
+package application
+
+import (
+	"net/http"
+
+	"github.com/sioncojp/famili-api/utils/i18n"
+)
+
+// HeaderLocale...appで選んだ表示言語. Accept-Languageより優先する
+const HeaderLocale = "X-Famili-Locale"
+
+// localeCtx...errorのmessageの言語を決めてcontextに格納する
+// X-Famili-Locale, Accept-Languageの順に見て、どちらも対応していなければi18n.Default
+func localeCtx(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lang, ok := i18n.Supported(r.Header.Get(HeaderLocale))
+		if !ok {
+			if lang, ok = i18n.ParseAcceptLanguage(r.Header.Get("Accept-Language")); !ok {
+				lang = i18n.Default
+			}
+		}
+		next.ServeHTTP(w, r.WithContext(i18n.NewContext(r.Context(), lang)))
+	})
+}
@@ -0,0 +1,45 @@
+package application
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sioncojp/famili-api/utils/i18n"
+)
+
+func TestLocaleCtx(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		name           string
+		locale         string
+		acceptLanguage string
+		want           i18n.Lang
+	}{
+		{"default", "", "", i18n.En},
+		{"accept-language", "", "ja-JP,ja;q=0.9,en;q=0.8", i18n.Ja},
+		{"q-value", "", "en;q=0.5, ja;q=0.8", i18n.Ja},
+		{"unsupported", "", "fr-FR", i18n.En},
+		{"preference wins", "en", "ja", i18n.En},
+		{"unsupported preference", "fr", "ja", i18n.Ja},
+	}
+
+	for _, v := range cases {
+		var got i18n.Lang
+		h := localeCtx(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = i18n.FromContext(r.Context())
+		}))
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if v.locale != "" {
+			req.Header.Set(HeaderLocale, v.locale)
+		}
+		if v.acceptLanguage != "" {
+			req.Header.Set("Accept-Language", v.acceptLanguage)
+		}
+		h.ServeHTTP(httptest.NewRecorder(), req)
+		assert.Equal(t, v.want, got, v.name)
+	}
+}
@@ -0,0 +1,76 @@
+package application
+
+import (
+	"net/http"
+
+	"github.com/stretchr/testify/mock"
+
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/domain/model"
+)
+
+type MockAPIKeyService struct {
+	mock.Mock
+}
+
+func (m *MockAPIKeyService) GetById(id domain.Id) (model.APIKey, error) {
+	r := m.Called(id)
+	return r.Get(0).(model.APIKey), r.Error(1)
+}
+
+func (m *MockAPIKeyService) GetByPrefix(prefix string) (model.APIKey, error) {
+	r := m.Called(prefix)
+	return r.Get(0).(model.APIKey), r.Error(1)
+}
+
+func (m *MockAPIKeyService) List(memberId domain.Id) ([]model.APIKey, error) {
+	r := m.Called(memberId)
+	return r.Get(0).([]model.APIKey), r.Error(1)
+}
+
+func (m *MockAPIKeyService) Create(key *model.APIKey) error {
+	r := m.Called(key)
+	return r.Error(0)
+}
+
+func (m *MockAPIKeyService) Update(key *model.APIKey) error {
+	r := m.Called(key)
+	return r.Error(0)
+}
+
+func (m *MockAPIKeyService) TouchLastUsed(key *model.APIKey) error {
+	r := m.Called(key)
+	return r.Error(0)
+}
+
+// stubHandler...V1の全てのHandlerの代わり. routerのroute一覧を見るためだけに使い、呼ばれたら200を返す
+type stubHandler struct{}
+
+func (stubHandler) Ctx(next http.Handler) http.Handler { return next }
+func (stubHandler) Shutdown()                          {}
+
+func (stubHandler) List(w http.ResponseWriter, r *http.Request)        { w.WriteHeader(http.StatusOK) }
+func (stubHandler) Create(w http.ResponseWriter, r *http.Request)      { w.WriteHeader(http.StatusOK) }
+func (stubHandler) Bootstrap(w http.ResponseWriter, r *http.Request)   { w.WriteHeader(http.StatusOK) }
+func (stubHandler) Get(w http.ResponseWriter, r *http.Request)         { w.WriteHeader(http.StatusOK) }
+func (stubHandler) Update(w http.ResponseWriter, r *http.Request)      { w.WriteHeader(http.StatusOK) }
+func (stubHandler) Delete(w http.ResponseWriter, r *http.Request)      { w.WriteHeader(http.StatusOK) }
+func (stubHandler) Assign(w http.ResponseWriter, r *http.Request)      { w.WriteHeader(http.StatusOK) }
+func (stubHandler) Shared(w http.ResponseWriter, r *http.Request)      { w.WriteHeader(http.StatusOK) }
+func (stubHandler) Todos(w http.ResponseWriter, r *http.Request)       { w.WriteHeader(http.StatusOK) }
+func (stubHandler) Serve(w http.ResponseWriter, r *http.Request)       { w.WriteHeader(http.StatusOK) }
+func (stubHandler) Changes(w http.ResponseWriter, r *http.Request)     { w.WriteHeader(http.StatusOK) }
+func (stubHandler) Push(w http.ResponseWriter, r *http.Request)        { w.WriteHeader(http.StatusOK) }
+func (stubHandler) Me(w http.ResponseWriter, r *http.Request)          { w.WriteHeader(http.StatusOK) }
+func (stubHandler) Login(w http.ResponseWriter, r *http.Request)       { w.WriteHeader(http.StatusOK) }
+func (stubHandler) LoginTOTP(w http.ResponseWriter, r *http.Request)   { w.WriteHeader(http.StatusOK) }
+func (stubHandler) EnrollTOTP(w http.ResponseWriter, r *http.Request)  { w.WriteHeader(http.StatusOK) }
+func (stubHandler) VerifyTOTP(w http.ResponseWriter, r *http.Request)  { w.WriteHeader(http.StatusOK) }
+func (stubHandler) DisableTOTP(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+func (stubHandler) Unlock(w http.ResponseWriter, r *http.Request)      { w.WriteHeader(http.StatusOK) }
+func (stubHandler) Cache(w http.ResponseWriter, r *http.Request)       { w.WriteHeader(http.StatusOK) }
+func (stubHandler) DB(w http.ResponseWriter, r *http.Request)          { w.WriteHeader(http.StatusOK) }
+func (stubHandler) Revoke(w http.ResponseWriter, r *http.Request)      { w.WriteHeader(http.StatusOK) }
+func (stubHandler) Rotate(w http.ResponseWriter, r *http.Request)      { w.WriteHeader(http.StatusOK) }
+func (stubHandler) Test(w http.ResponseWriter, r *http.Request)        { w.WriteHeader(http.StatusOK) }
+func (stubHandler) Deliveries(w http.ResponseWriter, r *http.Request)  { w.WriteHeader(http.StatusOK) }
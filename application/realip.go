@@ -0,0 +1,64 @@
+package application
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// realIP...接続元が[security] trustedProxiesのproxyのときだけ、X-Forwarded-For, X-Real-IPのclientのIPをRemoteAddrにする
+// chiのmiddleware.RealIPは誰が送ったheaderでも信じるので、loginのguardのIPを偽れてしまう
+func realIP(trusted []*net.IPNet) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if ip := clientIP(r, trusted); ip != "" {
+				r.RemoteAddr = ip
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// clientIP...X-Forwarded-Forを右から見て、最初の信じるproxyではないIPを返す. 接続元を信じないなら空
+func clientIP(r *http.Request, trusted []*net.IPNet) string {
+	peer := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(peer); err == nil {
+		peer = host
+	}
+	if !isTrusted(net.ParseIP(peer), trusted) {
+		return ""
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	var leftmost string
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(forwarded[i]))
+		if ip == nil {
+			break
+		}
+		if !isTrusted(ip, trusted) {
+			return ip.String()
+		}
+		leftmost = ip.String()
+	}
+	if leftmost != "" {
+		return leftmost
+	}
+
+	if ip := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); ip != nil {
+		return ip.String()
+	}
+	return ""
+}
+
+func isTrusted(ip net.IP, trusted []*net.IPNet) bool {
+	if ip == nil {
+		return false
+	}
+	for _, v := range trusted {
+		if v.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
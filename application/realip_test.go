@@ -0,0 +1,55 @@
+package application
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRealIP(t *testing.T) {
+	t.Parallel()
+	_, proxies, _ := net.ParseCIDR("10.0.0.0/8")
+	trusted := []*net.IPNet{proxies}
+
+	cases := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		realIP     string
+		want       string
+	}{
+		{name: "no proxy", remoteAddr: "192.0.2.1:1234", want: "192.0.2.1:1234"},
+		{name: "spoofed header from client", remoteAddr: "192.0.2.1:1234", forwarded: []string{"198.51.100.1"}, realIP: "198.51.100.2", want: "192.0.2.1:1234"},
+		{name: "trusted proxy", remoteAddr: "10.0.0.1:1234", forwarded: []string{"192.0.2.1"}, want: "192.0.2.1"},
+		{name: "client prepends a fake hop", remoteAddr: "10.0.0.1:1234", forwarded: []string{"198.51.100.1, 192.0.2.1, 10.0.0.2"}, want: "192.0.2.1"},
+		{name: "multiple headers", remoteAddr: "10.0.0.1:1234", forwarded: []string{"198.51.100.1", "192.0.2.1"}, want: "192.0.2.1"},
+		{name: "only proxies", remoteAddr: "10.0.0.1:1234", forwarded: []string{"10.0.0.3, 10.0.0.2"}, want: "10.0.0.3"},
+		{name: "x-real-ip", remoteAddr: "10.0.0.1:1234", realIP: "192.0.2.1", want: "192.0.2.1"},
+		{name: "trusted proxy without header", remoteAddr: "10.0.0.1:1234", want: "10.0.0.1:1234"},
+	}
+
+	for _, v := range cases {
+		v := v
+		t.Run(v.name, func(tt *testing.T) {
+			tt.Parallel()
+			var got string
+			h := realIP(trusted)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.RemoteAddr
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = v.remoteAddr
+			for _, f := range v.forwarded {
+				r.Header.Add("X-Forwarded-For", f)
+			}
+			if v.realIP != "" {
+				r.Header.Set("X-Real-IP", v.realIP)
+			}
+			h.ServeHTTP(httptest.NewRecorder(), r)
+			assert.Equal(tt, v.want, got)
+		})
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 
+	"github.com/sioncojp/famili-api/openapi"
 	"github.com/sioncojp/famili-api/utils/config"
+	httpresponse "github.com/sioncojp/famili-api/utils/http_response"
 	"github.com/sioncojp/famili-api/utils/log"
 )
 
@@ -13,17 +15,23 @@ func (s *HttpHandler) NewRouter() {
 	r := chi.NewRouter()
 	newMiddlewares(r, s.AppConfig)
 
-	r.Route("/v1", func(r chi.Router) {
-		r.Route("/todos", func(r chi.Router) {
-			r.Get("/", s.Router.V1.TodosHandler.List)
-			r.Post("/", s.Router.V1.TodosHandler.Create)
-			r.Route("/{id}", func(r chi.Router) {
-				r.Use(s.Router.V1.TodosHandler.Ctx)
-				r.Put("/", s.Router.V1.TodosHandler.Update)
-				r.Delete("/", s.Router.V1.TodosHandler.Delete)
-			})
+	spec := openapi.New()
+	r.Get(openapi.Path, openapi.Handler(spec))
+	if s.AppConfig.Service.SwaggerUI {
+		r.Get(openapi.SwaggerUIPath, openapi.SwaggerUI())
+	}
+
+	// versionごとに同じmiddlewareを付ける. 認証のerrorもversionの形で返すので、formatを最初に決める
+	for _, v := range s.versions {
+		v := v
+		r.Route("/"+v.Name(), func(r chi.Router) {
+			r.Use(httpresponse.WithFormat(v.ErrorFormat()))
+			r.Use(deprecation(s.AppConfig.Versions[v.Name()]))
+			r.Use(bearerAuth(s.APIKeyRepository, s.SessionSigner))
+			r.Use(validateRequest(spec))
+			v.Route(r, s)
 		})
-	})
+	}
 
 	s.ServeMux = r
 }
@@ -32,9 +40,12 @@ func (s *HttpHandler) NewRouter() {
 func newMiddlewares(r *chi.Mux, c *config.AppConfig) {
 	r.Use(middleware.GetHead)
 	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
+	// trustedProxiesはconfigのvalidateで確かめている
+	trusted, _ := c.Security.TrustedProxyNets()
+	r.Use(realIP(trusted))
 	r.Use(middleware.Recoverer)
 	r.Use(log.NewChiLogger(c.Server.Name, c.Service.Env))
+	r.Use(localeCtx)
 
 	// healthcheckはhealthz。k8sを想定してこのネーミングにしている
 	r.Use(middleware.Heartbeat("/healthz"))
@@ -0,0 +1,353 @@
+package application
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sioncojp/famili-api/application/todoservice"
+	v1members "github.com/sioncojp/famili-api/application/v1/members"
+	v1sync "github.com/sioncojp/famili-api/application/v1/sync"
+	v1todos "github.com/sioncojp/famili-api/application/v1/todos"
+	v2todos "github.com/sioncojp/famili-api/application/v2/todos"
+	"github.com/sioncojp/famili-api/domain/repository"
+	"github.com/sioncojp/famili-api/infrastructure/memory"
+	"github.com/sioncojp/famili-api/openapi"
+	"github.com/sioncojp/famili-api/utils/config"
+	httpresponse "github.com/sioncojp/famili-api/utils/http_response"
+	"github.com/sioncojp/famili-api/utils/i18n"
+	"github.com/sioncojp/famili-api/utils/secure"
+)
+
+func newTestServer(service config.ServiceConfig) *HttpHandler {
+	s, _, _ := newStubServer(service)
+	s.NewRouter()
+	return s
+}
+
+// newStubServer...全てのHandlerがstubHandlerのserver. NewRouterの前に返したversionのHandlerを本物に差し替えられる
+func newStubServer(service config.ServiceConfig) (*HttpHandler, *V1, *V2) {
+	h := stubHandler{}
+	v1 := &V1{
+		TodosHandler:    h,
+		MembersHandler:  h,
+		APIKeysHandler:  h,
+		AccountsHandler: h,
+		AdminHandler:    h,
+		WebhooksHandler: h,
+		StreamHandler:   h,
+		WsHandler:       h,
+		SyncHandler:     h,
+	}
+	v2 := &V2{TodosHandler: h}
+	signer, _ := secure.NewSigner(testSigningKey)
+	s := &HttpHandler{
+		AppConfig:     &config.AppConfig{Server: config.ServerConfig{Name: "test"}, Service: service},
+		SessionSigner: signer,
+	}
+	s.Register(v1, v2)
+	return s, v1, v2
+}
+
+// authorize...family 1のメンバー1のlogin sessionをrequestに付ける
+func authorize(s *HttpHandler, r *http.Request) *http.Request {
+	token, _ := s.SessionSigner.Sign(secure.Claims{AccountId: 1, MemberId: "1", FamilyId: "1", Purpose: secure.PurposeSession}, time.Hour)
+	r.Header.Set("Authorization", bearerPrefix+token)
+	return r
+}
+
+// TestOpenAPIRoutes...routerとopenapi.Newの/v1, /v2のrouteが一致しているか. routeを足したらopenapi/spec.goにも足す
+func TestOpenAPIRoutes(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(config.ServiceConfig{Env: "test"})
+
+	routes := []string{}
+	err := chi.Walk(s.ServeMux, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		if !strings.HasPrefix(route, "/v1/") && !strings.HasPrefix(route, "/v2/") {
+			return nil
+		}
+		if len(route) > 1 {
+			route = strings.TrimSuffix(route, "/")
+		}
+		routes = append(routes, method+" "+route)
+		return nil
+	})
+	assert.NoError(t, err)
+	sort.Strings(routes)
+
+	assert.Equal(t, openapi.New().Routes(), routes)
+}
+
+func TestOpenAPIHandler(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		service config.ServiceConfig
+		path    string
+		status  int
+	}{
+		{name: "document", service: config.ServiceConfig{Env: "development"}, path: openapi.Path, status: http.StatusOK},
+		{name: "swagger ui", service: config.ServiceConfig{Env: "development", SwaggerUI: true}, path: openapi.SwaggerUIPath, status: http.StatusOK},
+		{name: "swagger ui disabled", service: config.ServiceConfig{Env: "development"}, path: openapi.SwaggerUIPath, status: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			s := newTestServer(tt.service)
+			w := httptest.NewRecorder()
+			s.ServeMux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			assert.Equal(t, tt.status, w.Code)
+		})
+	}
+}
+
+func TestValidateRequest(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(config.ServiceConfig{Env: "test"})
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		locale string
+		status int
+		errors []httpresponse.FieldError
+	}{
+		{name: "valid", method: http.MethodPost, path: "/v1/todos", body: `{"title": "a", "description": "b"}`, status: http.StatusOK},
+		{
+			name: "unknown field", method: http.MethodPost, path: "/v1/todos", body: `{"titel": "a", "description": "b"}`,
+			status: http.StatusBadRequest,
+			errors: []httpresponse.FieldError{
+				{In: openapi.InBody, Field: "title", Reason: "is required", Code: i18n.Required},
+				{In: openapi.InBody, Field: "titel", Reason: "is unknown field", Code: i18n.UnknownField},
+			},
+		},
+		{
+			name: "path", method: http.MethodDelete, path: "/v1/todos/abc",
+			status: http.StatusBadRequest,
+			errors: []httpresponse.FieldError{{In: openapi.InPath, Field: "id", Reason: "must be of type integer", Code: i18n.TypeInvalid}},
+		},
+		{
+			name: "query", method: http.MethodGet, path: "/v1/sync?limit=0",
+			status: http.StatusBadRequest,
+			errors: []httpresponse.FieldError{{In: openapi.InQuery, Field: "limit", Reason: "must be no less than 1", Code: i18n.Min}},
+		},
+		{
+			name: "ja", method: http.MethodGet, path: "/v1/sync?limit=0", locale: "ja-JP,ja;q=0.9",
+			status: http.StatusBadRequest,
+			errors: []httpresponse.FieldError{{In: openapi.InQuery, Field: "limit", Reason: "1以上にしてください", Code: i18n.Min}},
+		},
+		{name: "not in document", method: http.MethodGet, path: "/v1/unknown", status: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			authorize(s, req)
+			req.Header.Set("Accept-Language", tt.locale)
+			s.ServeMux.ServeHTTP(w, req)
+			assert.Equal(t, tt.status, w.Code)
+			if tt.errors == nil {
+				return
+			}
+			var res struct {
+				Error  string                    `json:"error"`
+				Errors []httpresponse.FieldError `json:"errors"`
+			}
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+			assert.Equal(t, httpresponse.ErrorMessageInvalidRequest, res.Error)
+			assert.Equal(t, tt.errors, res.Errors)
+		})
+	}
+}
+
+// TestRequireCaller...Authorizationが無ければshared, login, admin以外は401になり、headerではメンバーを名乗れない
+func TestRequireCaller(t *testing.T) {
+	t.Parallel()
+	s, _, _ := newStubServer(config.ServiceConfig{Env: "test"})
+	s.AppConfig.Security.AdminToken = "admin-secret"
+	s.NewRouter()
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{http.MethodGet, "/v1/todos", "", http.StatusUnauthorized},
+		{http.MethodPost, "/v1/todos", `{"title": "a", "description": "b"}`, http.StatusUnauthorized},
+		{http.MethodGet, "/v1/members", "", http.StatusUnauthorized},
+		{http.MethodPost, "/v1/accounts", `{"member_id": "2", "email": "mama@example.com", "password": "password"}`, http.StatusUnauthorized},
+		{http.MethodGet, "/v1/api-keys", "", http.StatusUnauthorized},
+		{http.MethodGet, "/v1/webhooks", "", http.StatusUnauthorized},
+		{http.MethodGet, "/v1/sync", "", http.StatusUnauthorized},
+		{http.MethodGet, "/v2/todos", "", http.StatusUnauthorized},
+		{http.MethodGet, "/v1/shared/abc", "", http.StatusOK},
+		{http.MethodPost, "/v1/login", `{"email": "papa@example.com", "password": "password"}`, http.StatusOK},
+		{http.MethodGet, "/v1/admin/cache", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			t.Parallel()
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			r.Header.Set("X-Famili-Member-Id", "1")
+			r.Header.Set("X-Famili-Family-Id", "1")
+			r.Header.Set(HeaderAdminToken, "admin-secret")
+			w := httptest.NewRecorder()
+			s.ServeMux.ServeHTTP(w, r)
+			assert.Equal(t, tt.status, w.Code, w.Body.String())
+			if tt.status == http.StatusUnauthorized {
+				assert.Contains(t, w.Body.String(), ErrorMessageAuthRequired)
+			}
+		})
+	}
+}
+
+// TestOpenAPIResponses...本物のhandlerのresponseがdocumentのschemaに合うか
+func TestOpenAPIResponses(t *testing.T) {
+	t.Parallel()
+	repos := repository.Repositories{
+		Todos:         memory.NewTodoRepository(),
+		Members:       memory.NewMemberRepository(),
+		Outbox:        memory.NewOutboxRepository(),
+		Changes:       memory.NewTodoChangeRepository(),
+		SyncMutations: memory.NewSyncMutationRepository(),
+	}
+	tx := memory.NewTxManager(repos)
+	s, v1, v2 := newStubServer(config.ServiceConfig{Env: "test"})
+	todos := todoservice.NewService(repos.Todos, tx)
+	v1.TodosHandler = v1todos.NewHandler(repos.Todos, todos)
+	v1.MembersHandler = v1members.NewHandler(repos.Members)
+	v1.SyncHandler = v1sync.NewHandler(repos.Todos, repos.Changes, tx)
+	v2.TodosHandler = v2todos.NewHandler(repos.Todos, todos)
+	s.NewRouter()
+	spec := openapi.New()
+
+	steps := []struct {
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{http.MethodPost, "/v1/members", `{"name": "taro"}`, http.StatusCreated},
+		{http.MethodGet, "/v1/members", "", http.StatusOK},
+		{http.MethodPost, "/v1/todos", `{"title": "牛乳", "description": "2本"}`, http.StatusCreated},
+		{http.MethodPost, "/v1/todos", `{"title": "", "description": "2本"}`, http.StatusBadRequest},
+		{http.MethodGet, "/v1/todos", "", http.StatusOK},
+		{http.MethodPut, "/v1/todos/1", `{"title": "牛乳", "description": "3本", "completed": true}`, http.StatusOK},
+		{http.MethodPut, "/v1/todos/1/assignees", `{"assignee_ids": [1]}`, http.StatusOK},
+		{http.MethodPut, "/v1/todos/9", `{"title": "a", "description": "b"}`, http.StatusNotFound},
+		{http.MethodGet, "/v1/sync", "", http.StatusOK},
+		{http.MethodPost, "/v1/sync", `{"mutations": [{"client_id": "c1", "op": "create", "title": "卵", "description": "1パック"}]}`, http.StatusOK},
+		{http.MethodDelete, "/v1/todos/1", "", http.StatusOK},
+		{http.MethodPost, "/v2/todos", `{"title": "パン", "description": "1斤", "position": 1}`, http.StatusCreated},
+		{http.MethodPost, "/v2/todos", `{"title": "", "description": "1斤"}`, http.StatusBadRequest},
+		{http.MethodGet, "/v2/todos", "", http.StatusOK},
+		{http.MethodGet, "/v2/todos/3", "", http.StatusOK},
+		{http.MethodPut, "/v2/todos/3", `{"title": "パン", "description": "2斤", "completed": true}`, http.StatusOK},
+		{http.MethodGet, "/v2/todos/abc", "", http.StatusNotFound},
+		{http.MethodDelete, "/v2/todos/9", "", http.StatusNotFound},
+		{http.MethodDelete, "/v2/todos/3", "", http.StatusNoContent},
+	}
+	for _, v := range steps {
+		r := httptest.NewRequest(v.method, v.path, strings.NewReader(v.body))
+		authorize(s, r)
+		w := httptest.NewRecorder()
+		s.ServeMux.ServeHTTP(w, r)
+
+		name := v.method + " " + v.path
+		assert.Equal(t, v.status, w.Code, name+": "+w.Body.String())
+		o, _ := spec.Find(v.method, r.URL.Path)
+		if assert.NotNil(t, o, name) {
+			assert.Empty(t, spec.ValidateResponse(o, w.Code, w.Header().Get("Content-Type"), w.Body.Bytes()), name+": "+w.Body.String())
+		}
+	}
+
+	// Accept: application/problem+json ならv1でもRFC 7807で返り、instanceはrequest ID
+	for _, v := range []struct {
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{http.MethodPost, "/v1/members", `{"name": ""}`, http.StatusBadRequest},
+		{http.MethodPost, "/v1/members", `{"nmae": "taro"}`, http.StatusBadRequest},
+		{http.MethodDelete, "/v1/todos/9", "", http.StatusNotFound},
+	} {
+		r := httptest.NewRequest(v.method, v.path, strings.NewReader(v.body))
+		authorize(s, r)
+		r.Header.Set("Accept", httpresponse.ContentTypeProblem)
+		w := httptest.NewRecorder()
+		s.ServeMux.ServeHTTP(w, r)
+
+		name := v.method + " " + v.path
+		assert.Equal(t, v.status, w.Code, name)
+		assert.Equal(t, httpresponse.ContentTypeProblem, w.Header().Get("Content-Type"), name)
+		var problem httpresponse.Problem
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+		assert.NotEmpty(t, problem.Instance, name)
+		if v.status == http.StatusBadRequest {
+			assert.NotEmpty(t, problem.Errors, name)
+		}
+		o, _ := spec.Find(v.method, r.URL.Path)
+		assert.Empty(t, spec.ValidateResponse(o, w.Code, w.Header().Get("Content-Type"), w.Body.Bytes()), name+": "+w.Body.String())
+	}
+}
+
+// TestVersionHeaders...[versions]に書いたversionだけDeprecation, Sunsetが付き、v2のerrorはproblemで返る
+func TestVersionHeaders(t *testing.T) {
+	t.Parallel()
+	s, _, _ := newStubServer(config.ServiceConfig{Env: "test"})
+	s.AppConfig.Versions = map[string]config.VersionConfig{
+		"v1": {Deprecation: "2026-10-19T00:00:00Z", Sunset: "2027-10-19T00:00:00Z"},
+	}
+	s.NewRouter()
+
+	tests := []struct {
+		name          string
+		path          string
+		authorization string
+		status        int
+		deprecation   string
+		sunset        string
+		contentType   string
+	}{
+		{name: "v1", path: "/v1/todos", status: http.StatusOK, deprecation: "@1792368000", sunset: "Tue, 19 Oct 2027 00:00:00 GMT"},
+		{
+			name: "v1 error", path: "/v1/todos", authorization: "Basic abc", status: http.StatusUnauthorized,
+			deprecation: "@1792368000", sunset: "Tue, 19 Oct 2027 00:00:00 GMT", contentType: "application/json; charset=utf-8",
+		},
+		{name: "v2", path: "/v2/todos", status: http.StatusOK},
+		{name: "v2 error", path: "/v2/todos", authorization: "Basic abc", status: http.StatusUnauthorized, contentType: httpresponse.ContentTypeProblem},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			authorize(s, r)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			s.ServeMux.ServeHTTP(w, r)
+			assert.Equal(t, tt.status, w.Code)
+			assert.Equal(t, tt.deprecation, w.Header().Get("Deprecation"))
+			assert.Equal(t, tt.sunset, w.Header().Get("Sunset"))
+			if tt.contentType != "" {
+				assert.Equal(t, tt.contentType, w.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package application
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -11,27 +12,35 @@ import (
 
 	"github.com/go-chi/chi/v5"
 
-	v1todos "github.com/sioncojp/famili-api/application/v1/todos"
+	v1stream "github.com/sioncojp/famili-api/application/v1/stream"
+	"github.com/sioncojp/famili-api/domain/repository"
 	"github.com/sioncojp/famili-api/utils/config"
 	"github.com/sioncojp/famili-api/utils/log"
+	"github.com/sioncojp/famili-api/utils/secure"
 )
 
 // HttpHandler...http_response serverを立ち上げるため必要なstruct
 type HttpHandler struct {
 	AppConfig *config.AppConfig
+	// APIKeyRepository...Authorization: Bearer fam_... の認証で利用する
+	APIKeyRepository repository.APIKeyRepository
+	// SessionSigner...loginで発行したsession tokenの検証で利用する
+	SessionSigner *secure.Signer
+	// Background...outboxのrelayなど裏で動くloop. shutdownで止める
+	Background *Background
 	Router
 	// ServeMux...HTTP request multiplexer. リクエストを登録済みのURLパターンリストと照合して、マッチしたHandlerを呼び出す
 	ServeMux *chi.Mux
 }
 
-// Router...ルーティング情報
+// Router...API versionの一覧. Registerで足したversionをNewRouterが /{Name} の下に登録する
 type Router struct {
-	V1
+	versions []Version
 }
 
-// V1Handler.../v1 で利用するstructを格納
-type V1 struct {
-	TodosHandler v1todos.Handler
+// Register...API versionを足す. 同じNameを2回足すとNewRouterがpanicする
+func (r *Router) Register(versions ...Version) {
+	r.versions = append(r.versions, versions...)
 }
 
 // RunServer...サーバ起動
@@ -41,16 +50,30 @@ func (s *HttpHandler) RunServer() {
 	r := chi.NewRouter()
 	r.Mount("/", s.ServeMux)
 
+	// 全requestのcontextの親. shutdownが間に合わなければcancelして実行中のqueryを止める
+	baseCtx, cancelBase := context.WithCancel(context.Background())
+	defer cancelBase()
+
 	server := &http.Server{
 		Addr:         fmt.Sprintf(":" + s.AppConfig.Server.Port),
 		Handler:      r,
 		ReadTimeout:  5 * time.Second,
 		WriteTimeout: 10 * time.Second,
 		IdleTimeout:  15 * time.Second,
+		BaseContext:  func(net.Listener) context.Context { return baseCtx },
+		// SSEのstreamはWriteTimeoutを超えて開き続けるので、handlerで書き込みの期限を延ばせるようにする
+		ConnContext: v1stream.ConnContext,
+	}
+	// Shutdownは実行中のrequestを待つので、終わらないstreamやWebSocketを持つversionは先に閉じる
+	for _, v := range s.versions {
+		if v, ok := v.(shutdowner); ok {
+			server.RegisterOnShutdown(v.Shutdown)
+		}
 	}
 
 	go func() {
-		if err := server.ListenAndServe(); err != nil {
+		// Shutdownを呼ぶとErrServerClosedが返るので、実行中のrequestを待たずに落ちないようにする
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			log.Log.Fatalf("could not start server: %v", err)
 		}
 	}()
@@ -65,13 +88,18 @@ func (s *HttpHandler) RunServer() {
 
 	// graceful shutdown http.Server
 	if err := server.Shutdown(ctx); err != nil {
+		cancelBase()
 		log.Log.Fatalf("Could not gracefully shutdown the server:%v", err)
 	}
 	log.Log.Info("server is graceful shutdown now, new request will be rejected.")
 
+	// requestが終わってから裏のloopを止める. RunServerから戻るとDBを閉じるので、終わるまで待つ
+	if s.Background != nil {
+		s.Background.Stop()
+	}
+
 	// waiting for ctx.Done(). timeout of 30 seconds.
 	<-ctx.Done()
 
 	log.Log.Info("server shutdown")
-	// TODO: swagger分岐欲しい
 }
@@ -0,0 +1,18 @@
+package todoservice
+
+import (
+	"context"
+
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/domain/model"
+)
+
+// Service...todoの一覧と書き込み. /v1, /v2のtodo, /v1/ws, /v1/syncが同じ処理を使い、requestとresponseの形だけをhandlerで変える
+type Service interface {
+	List(ctx context.Context, caller domain.Caller, assignee string) ([]model.Todo, error)
+	Create(ctx context.Context, caller domain.Caller, todo *model.Todo) error
+	Update(ctx context.Context, todo *model.Todo, next model.Todo) error
+	Delete(ctx context.Context, todo *model.Todo) error
+	Assign(ctx context.Context, todo *model.Todo, assigneeIds []uint) error
+	Reorder(ctx context.Context, caller domain.Caller, order []uint) ([]model.Todo, error)
+}
@@ -0,0 +1,206 @@
+package todoservice
+
+import (
+	"context"
+	"strconv"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pkg/errors"
+
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/domain/model"
+	"github.com/sioncojp/famili-api/domain/repository"
+)
+
+// AssigneeMe...?assignee=me のときはcallerのメンバーIDに読み替える
+const AssigneeMe = "me"
+
+// ErrUnidentified...assignee=meで絞り込もうとしたが、callerのメンバーが分からない
+var ErrUnidentified = errors.New("caller not identified")
+
+var cv = &domain.CustomValidator{}
+
+type service struct {
+	repo repository.TodoRepository
+	tx   repository.TxManager
+}
+
+// NewService create a instance of this service
+func NewService(repo repository.TodoRepository, tx repository.TxManager) Service {
+	return &service{repo: repo, tx: tx}
+}
+
+// List...callerが見れるtodoを返す. assigneeがあれば、そのメンバーがassigneeのtodoに絞り込む
+func (s *service) List(ctx context.Context, caller domain.Caller, assignee string) ([]model.Todo, error) {
+	if assignee == "" {
+		return s.repo.List(ctx, caller)
+	}
+
+	memberId := domain.Id(assignee)
+	if assignee == AssigneeMe {
+		if caller.MemberId == "" {
+			return nil, ErrUnidentified
+		}
+		memberId = caller.MemberId
+	}
+	return s.repo.ListByAssignee(ctx, caller, memberId)
+}
+
+// Create...todoを作る. 未完了で作り、作成者とfamilyはcallerにする
+func (s *service) Create(ctx context.Context, caller domain.Caller, todo *model.Todo) error {
+	return s.tx.Do(ctx, func(ctx context.Context, repos repository.Repositories) error {
+		return NewWriter(repos).Create(ctx, caller, todo)
+	})
+}
+
+// Update...todoをnextの値に変える
+func (s *service) Update(ctx context.Context, todo *model.Todo, next model.Todo) error {
+	return s.tx.Do(ctx, func(ctx context.Context, repos repository.Repositories) error {
+		return NewWriter(repos).Update(ctx, todo, next)
+	})
+}
+
+// Delete...todoを削除する
+func (s *service) Delete(ctx context.Context, todo *model.Todo) error {
+	return s.tx.Do(ctx, func(ctx context.Context, repos repository.Repositories) error {
+		return NewWriter(repos).Delete(ctx, todo)
+	})
+}
+
+// Assign...todoのassigneeを置き換える. 存在しない、または別familyのメンバーならmodel.ErrAssigneeNotFound
+func (s *service) Assign(ctx context.Context, todo *model.Todo, assigneeIds []uint) error {
+	return s.tx.Do(ctx, func(ctx context.Context, repos repository.Repositories) error {
+		return NewWriter(repos).Assign(ctx, todo, assigneeIds)
+	})
+}
+
+// Reorder...orderのtodoのpositionを先頭から1, 2, ...にし、並べたtodoを返す. 1つでも見れなければ何も変えない
+// orderに無いtodoのpositionは変えないので、position 0の新しいtodoは先頭に並ぶ
+func (s *service) Reorder(ctx context.Context, caller domain.Caller, order []uint) ([]model.Todo, error) {
+	todos := make([]model.Todo, 0, len(order))
+	err := s.tx.Do(ctx, func(ctx context.Context, repos repository.Repositories) error {
+		todos = todos[:0]
+		w := NewWriter(repos)
+		for i, id := range order {
+			todo, err := Visible(ctx, repos.Todos, caller, id)
+			if err != nil {
+				return err
+			}
+			if err := w.Move(ctx, &todo, i+1); err != nil {
+				return err
+			}
+			todos = append(todos, todo)
+		}
+		return nil
+	})
+	return todos, err
+}
+
+// Writer...transactionのrepositoryにtodoを書き込む. todoと一緒にoutboxのeventと/v1/syncの変更も書き込み、eventだけ消えることを防ぐ
+// /v1/syncのように他の書き込みと同じtransactionにしたいときは、tx.Doのrepositoriesから直接作る
+type Writer struct {
+	repos repository.Repositories
+}
+
+// NewWriter...reposはtx.Doに渡されたもの
+func NewWriter(repos repository.Repositories) Writer {
+	return Writer{repos: repos}
+}
+
+// Create...todoを作る. visibilityが無ければfamilyにする. Validateを通らなければ何も書き込まない
+func (w Writer) Create(ctx context.Context, caller domain.Caller, todo *model.Todo) error {
+	if todo.Visibility == "" {
+		todo.Visibility = model.VisibilityFamily
+	}
+	if err := cv.Validate(todo); err != nil {
+		return err
+	}
+	todo.Completed = false
+	todo.CreatedBy = caller.MemberId
+	todo.FamilyId = caller.FamilyId
+	if err := todo.SetShareToken(); err != nil {
+		return err
+	}
+
+	if err := w.repos.Todos.Create(ctx, todo); err != nil {
+		return err
+	}
+	return w.record(ctx, *todo, false, model.EventTodoCreated)
+}
+
+// Update...todoをnextの値に変える. 並び順の変更はChangeのupdatedに含まれる
+func (w Writer) Update(ctx context.Context, todo *model.Todo, next model.Todo) error {
+	if err := cv.Validate(next); err != nil {
+		return err
+	}
+	events := todo.Change(next)
+	todo.Move(next.Position)
+	if err := todo.SetShareToken(); err != nil {
+		return err
+	}
+
+	if err := w.repos.Todos.Update(ctx, todo); err != nil {
+		return err
+	}
+	return w.record(ctx, *todo, false, events...)
+}
+
+// Move...todoのpositionを変える. 変わらなければ何も書き込まない
+func (w Writer) Move(ctx context.Context, todo *model.Todo, position int) error {
+	if todo.Position == position {
+		return nil
+	}
+	events := todo.Move(position)
+	if err := w.repos.Todos.Update(ctx, todo); err != nil {
+		return err
+	}
+	return w.record(ctx, *todo, false, events...)
+}
+
+// Delete...todoを削除する
+func (w Writer) Delete(ctx context.Context, todo *model.Todo) error {
+	if err := w.repos.Todos.Delete(ctx, todo); err != nil {
+		return err
+	}
+	return w.record(ctx, *todo, true, model.EventTodoDeleted)
+}
+
+// Assign...メンバーの存在を確かめてassigneeを置き換える. assigneeはeventにしないので/v1/syncの変更だけ書き込む
+func (w Writer) Assign(ctx context.Context, todo *model.Todo, assigneeIds []uint) error {
+	members, err := w.repos.Members.ListByIds(ctx, assigneeIds)
+	if err != nil {
+		return err
+	}
+	if err := todo.Assign(assigneeIds, members); err != nil {
+		return err
+	}
+	if err := w.repos.Todos.SetAssignees(ctx, todo); err != nil {
+		return err
+	}
+	change := model.NewTodoChange(*todo, false)
+	return w.repos.Changes.Record(ctx, &change)
+}
+
+// record...todoの変更をoutboxのeventと/v1/syncの変更に書き込む
+func (w Writer) record(ctx context.Context, todo model.Todo, deleted bool, events ...model.EventType) error {
+	if err := w.repos.Outbox.Add(ctx, todo.Events(events...)...); err != nil {
+		return err
+	}
+	change := model.NewTodoChange(todo, deleted)
+	return w.repos.Changes.Record(ctx, &change)
+}
+
+// Visible...callerが見れるtodoを取得する. 見れないtodoは存在自体を隠すためnot foundにする
+func Visible(ctx context.Context, repo repository.TodoRepository, caller domain.Caller, id uint) (model.Todo, error) {
+	if id == 0 {
+		return model.Todo{}, domain.NewValidationError(validation.Errors{"todo_id": validation.ErrRequired})
+	}
+	todo, err := repo.GetById(ctx, domain.Id(strconv.FormatUint(uint64(id), 10)))
+	if err != nil {
+		return model.Todo{}, err
+	}
+	if !todo.VisibleTo(caller) {
+		return model.Todo{}, errors.Wrapf(domain.ErrNotFound, "todo %d", id)
+	}
+	return todo, nil
+}
@@ -0,0 +1,171 @@
+package todoservice_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sioncojp/famili-api/application/todoservice"
+	"github.com/sioncojp/famili-api/application/todoservice/todotest"
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/domain/model"
+)
+
+var (
+	ctx                    = context.Background()
+	caller, sibling, other = todotest.Caller, todotest.Sibling, todotest.Other
+)
+
+func TestList(t *testing.T) {
+	t.Parallel()
+	f := todotest.NewFixture()
+	s := f.Service
+	mine := model.Todo{Title: "1", Description: "1", CreatedBy: "1", FamilyId: "f1", Visibility: model.VisibilityFamily, AssigneeIds: []uint{1}}
+	theirs := model.Todo{Title: "2", Description: "2", CreatedBy: "2", FamilyId: "f1", Visibility: model.VisibilityFamily, AssigneeIds: []uint{2}}
+	for _, v := range []*model.Todo{&mine, &theirs} {
+		require.NoError(t, f.Todos.Create(ctx, v))
+		require.NoError(t, f.Todos.SetAssignees(ctx, v))
+	}
+
+	cases := []struct {
+		name     string
+		caller   domain.Caller
+		assignee string
+		want     []uint
+		err      error
+	}{
+		{"all", caller, "", []uint{mine.ID, theirs.ID}, nil},
+		{"me", caller, todoservice.AssigneeMe, []uint{mine.ID}, nil},
+		{"member id", caller, "2", []uint{theirs.ID}, nil},
+		{"me without identity", domain.Caller{FamilyId: "f1"}, todoservice.AssigneeMe, nil, todoservice.ErrUnidentified},
+	}
+	for _, v := range cases {
+		v := v
+		t.Run(v.name, func(tt *testing.T) {
+			tt.Parallel()
+			out, err := s.List(ctx, v.caller, v.assignee)
+			if v.err != nil {
+				assert.True(tt, errors.Is(err, v.err))
+				return
+			}
+			require.NoError(tt, err)
+			ids := make([]uint, 0, len(out))
+			for _, todo := range out {
+				ids = append(ids, todo.ID)
+			}
+			assert.ElementsMatch(tt, v.want, ids)
+		})
+	}
+}
+
+func TestCreateUpdateDelete(t *testing.T) {
+	t.Parallel()
+	f := todotest.NewFixture()
+	s := f.Service
+
+	// 未完了で作り、作成者とfamilyはcallerにする
+	todo := &model.Todo{Title: "牛乳", Description: "2本", Completed: true, CreatedBy: "9", FamilyId: "f9"}
+	require.NoError(t, s.Create(ctx, caller, todo))
+	assert.False(t, todo.Completed)
+	assert.Equal(t, caller.MemberId, todo.CreatedBy)
+	assert.Equal(t, caller.FamilyId, todo.FamilyId)
+	assert.Equal(t, model.VisibilityFamily, todo.Visibility)
+
+	next := *todo
+	next.Completed = true
+	next.Position = 3
+	next.Visibility = model.VisibilityPublic
+	require.NoError(t, s.Update(ctx, todo, next))
+	assert.True(t, todo.Completed)
+	assert.Equal(t, 3, todo.Position)
+	assert.NotEmpty(t, todo.ShareToken)
+
+	require.NoError(t, s.Delete(ctx, todo))
+	_, err := f.Todos.GetById(ctx, domain.Id("1"))
+	assert.True(t, errors.Is(err, domain.ErrNotFound))
+
+	assert.Equal(t, []model.EventType{
+		model.EventTodoCreated, model.EventTodoUpdated, model.EventTodoCompleted, model.EventTodoDeleted,
+	}, f.EventTypes(t))
+	changes, err := f.Changes.Since(ctx, caller, 0, 10)
+	require.NoError(t, err)
+	if assert.Len(t, changes, 1) {
+		assert.True(t, changes[0].Deleted)
+	}
+}
+
+func TestValidationWritesNothing(t *testing.T) {
+	t.Parallel()
+	f := todotest.NewFixture()
+	s := f.Service
+
+	err := s.Create(ctx, caller, &model.Todo{Title: "牛乳"})
+	assert.True(t, domain.IsValidation(err))
+
+	todo := &model.Todo{Title: "牛乳", Description: "2本"}
+	require.NoError(t, s.Create(ctx, caller, todo))
+	next := *todo
+	next.Visibility = "secret"
+	err = s.Update(ctx, todo, next)
+	assert.True(t, domain.IsValidation(err))
+	assert.Equal(t, model.VisibilityFamily, todo.Visibility)
+
+	assert.Equal(t, []model.EventType{model.EventTodoCreated}, f.EventTypes(t))
+}
+
+func TestAssign(t *testing.T) {
+	t.Parallel()
+	f := todotest.NewFixture()
+	s := f.Service
+	for _, v := range []model.Member{{Name: "a", FamilyId: "f1"}, {Name: "b", FamilyId: "f2"}} {
+		v := v
+		require.NoError(t, f.Members.Create(ctx, &v))
+	}
+	todo := &model.Todo{Title: "牛乳", Description: "2本"}
+	require.NoError(t, s.Create(ctx, caller, todo))
+
+	require.NoError(t, s.Assign(ctx, todo, []uint{1}))
+	assert.Equal(t, []uint{1}, todo.AssigneeIds)
+
+	// 別familyのメンバーはassigneeにできない
+	err := s.Assign(ctx, todo, []uint{2})
+	assert.True(t, errors.Is(err, model.ErrAssigneeNotFound))
+
+	// assigneeはeventにしない
+	assert.Equal(t, []model.EventType{model.EventTodoCreated}, f.EventTypes(t))
+}
+
+func TestReorder(t *testing.T) {
+	t.Parallel()
+	f := todotest.NewFixture()
+	s := f.Service
+	todos := make([]*model.Todo, 0, 3)
+	for _, c := range []domain.Caller{caller, caller, other} {
+		todo := &model.Todo{Title: "牛乳", Description: "2本"}
+		require.NoError(t, s.Create(ctx, c, todo))
+		todos = append(todos, todo)
+	}
+
+	// 見れないtodoが含まれていれば何も変えない
+	_, err := s.Reorder(ctx, caller, []uint{todos[1].ID, todos[2].ID})
+	assert.True(t, errors.Is(err, domain.ErrNotFound))
+	_, err = s.Reorder(ctx, caller, []uint{0})
+	assert.True(t, domain.IsValidation(err))
+
+	out, err := s.Reorder(ctx, sibling, []uint{todos[1].ID, todos[0].ID})
+	require.NoError(t, err)
+	if assert.Len(t, out, 2) {
+		assert.Equal(t, todos[1].ID, out[0].ID)
+		assert.Equal(t, 1, out[0].Position)
+		assert.Equal(t, 2, out[1].Position)
+	}
+
+	// 並び順が変わらなければ書き込まない
+	_, err = s.Reorder(ctx, sibling, []uint{todos[1].ID, todos[0].ID})
+	require.NoError(t, err)
+	created := []model.EventType{model.EventTodoCreated, model.EventTodoCreated, model.EventTodoCreated}
+	assert.Equal(t, append(created, model.EventTodoUpdated, model.EventTodoUpdated), f.EventTypes(t))
+}
@@ -0,0 +1,79 @@
+// Package todotest...todoを書き込むhandlerのtestで共有するfixture. memoryのrepositoryで動かす
+package todotest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sioncojp/famili-api/application/todoservice"
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/domain/model"
+	"github.com/sioncojp/famili-api/domain/repository"
+	"github.com/sioncojp/famili-api/infrastructure/memory"
+)
+
+var (
+	// Caller, Sibling...同じfamilyの2人
+	Caller  = domain.Caller{MemberId: "1", FamilyId: "f1"}
+	Sibling = domain.Caller{MemberId: "2", FamilyId: "f1"}
+	// Other...別familyのメンバー
+	Other = domain.Caller{MemberId: "3", FamilyId: "f2"}
+)
+
+// Fixture...memoryのrepositoryと、それを使うTxManager, Service
+type Fixture struct {
+	repository.Repositories
+	Tx      repository.TxManager
+	Service todoservice.Service
+}
+
+// NewFixture...repositoryは全て空で作る
+func NewFixture() *Fixture {
+	f := &Fixture{Repositories: repository.Repositories{
+		Todos:         memory.NewTodoRepository(),
+		Members:       memory.NewMemberRepository(),
+		Outbox:        memory.NewOutboxRepository(),
+		Changes:       memory.NewTodoChangeRepository(),
+		SyncMutations: memory.NewSyncMutationRepository(),
+	}}
+	f.Tx = memory.NewTxManager(f.Repositories)
+	f.Service = todoservice.NewService(f.Todos, f.Tx)
+	return f
+}
+
+// Create...cのtodoをrepositoryに直接作る. eventは書き込まない. titleはdescriptionにも使う
+func (f *Fixture) Create(t testing.TB, c domain.Caller, title string, visibility model.Visibility) model.Todo {
+	todo := model.Todo{Title: title, Description: title, CreatedBy: c.MemberId, FamilyId: c.FamilyId, Visibility: visibility}
+	require.NoError(t, f.Todos.Create(context.Background(), &todo))
+	return todo
+}
+
+// Events...outboxに書き込まれた未配信のeventを古い順に返す
+func (f *Fixture) Events(t testing.TB) []model.Event {
+	events, err := f.Outbox.Pending(context.Background(), time.Now().Add(time.Minute), 100)
+	require.NoError(t, err)
+	return events
+}
+
+// EventTypes...Eventsのtypeだけを返す
+func (f *Fixture) EventTypes(t testing.TB) []model.EventType {
+	var out []model.EventType
+	for _, v := range f.Events(t) {
+		out = append(out, v.Type)
+	}
+	return out
+}
+
+// Do...cとしてhにrequestする
+func Do(h http.Handler, c domain.Caller, method, path, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r.WithContext(domain.NewCallerContext(r.Context(), c)))
+	return w
+}
@@ -0,0 +1,115 @@
+package application
+
+import (
+	"github.com/go-chi/chi/v5"
+
+	v1accounts "github.com/sioncojp/famili-api/application/v1/accounts"
+	v1admin "github.com/sioncojp/famili-api/application/v1/admin"
+	v1apikeys "github.com/sioncojp/famili-api/application/v1/apikeys"
+	v1members "github.com/sioncojp/famili-api/application/v1/members"
+	v1stream "github.com/sioncojp/famili-api/application/v1/stream"
+	v1sync "github.com/sioncojp/famili-api/application/v1/sync"
+	v1todos "github.com/sioncojp/famili-api/application/v1/todos"
+	v1webhooks "github.com/sioncojp/famili-api/application/v1/webhooks"
+	v1ws "github.com/sioncojp/famili-api/application/v1/ws"
+	"github.com/sioncojp/famili-api/domain/model"
+	"github.com/sioncojp/famili-api/utils/config"
+	httpresponse "github.com/sioncojp/famili-api/utils/http_response"
+)
+
+// V1.../v1 で利用するstructを格納
+type V1 struct {
+	TodosHandler    v1todos.Handler
+	MembersHandler  v1members.Handler
+	APIKeysHandler  v1apikeys.Handler
+	AccountsHandler v1accounts.Handler
+	AdminHandler    v1admin.Handler
+	WebhooksHandler v1webhooks.Handler
+	StreamHandler   v1stream.Handler
+	WsHandler       v1ws.Handler
+	SyncHandler     v1sync.Handler
+}
+
+func (v *V1) Name() string { return config.VersionV1 }
+
+// ErrorFormat...v1は{"ok": false, "error": ...}のまま
+func (v *V1) ErrorFormat() httpresponse.Format { return httpresponse.FormatLegacy }
+
+// Shutdown...SSEのstreamを閉じ、hijackしていてserver.Shutdownが待たないWebSocketにはclose frameを送って閉じる
+func (v *V1) Shutdown() {
+	v.StreamHandler.Shutdown()
+	v.WsHandler.Shutdown()
+}
+
+// Route.../v1のroute. shared、login、adminの他はbearerで認証したCallerが必要
+func (v *V1) Route(r chi.Router, s *HttpHandler) {
+	r.Get("/shared/{token}", v.TodosHandler.Shared)
+	r.Route("/login", func(r chi.Router) {
+		r.Use(denyAPIKey)
+		r.Post("/", v.AccountsHandler.Login)
+		r.Post("/totp", v.AccountsHandler.LoginTOTP)
+	})
+	r.Route("/admin", func(r chi.Router) {
+		r.Use(denyAPIKey)
+		r.Use(requireAdmin(s.AppConfig.Security.AdminToken))
+		r.Post("/accounts", v.AccountsHandler.Bootstrap)
+		r.Post("/unlock", v.AdminHandler.Unlock)
+		r.Get("/cache", v.AdminHandler.Cache)
+		r.Get("/db", v.AdminHandler.DB)
+	})
+
+	r.Group(func(r chi.Router) {
+		r.Use(requireCaller)
+		r.Route("/todos", func(r chi.Router) {
+			r.With(requireScope(model.ScopeTodosRead)).Get("/", v.TodosHandler.List)
+			r.With(requireScope(model.ScopeTodosWrite)).Post("/", v.TodosHandler.Create)
+			r.With(requireScope(model.ScopeTodosRead)).Get("/stream", v.StreamHandler.Todos)
+			r.Route("/{id}", func(r chi.Router) {
+				r.Use(requireScope(model.ScopeTodosRead))
+				r.Use(v.TodosHandler.Ctx)
+				r.With(requireScope(model.ScopeTodosWrite)).Put("/", v.TodosHandler.Update)
+				r.With(requireScope(model.ScopeTodosWrite)).Delete("/", v.TodosHandler.Delete)
+				r.With(requireScope(model.ScopeTodosWrite)).Put("/assignees", v.TodosHandler.Assign)
+			})
+		})
+		r.With(requireScope(model.ScopeTodosRead)).Get("/ws", v.WsHandler.Serve)
+		r.Route("/sync", func(r chi.Router) {
+			r.With(requireScope(model.ScopeTodosRead)).Get("/", v.SyncHandler.Changes)
+			r.With(requireScope(model.ScopeTodosWrite)).Post("/", v.SyncHandler.Push)
+		})
+		r.Route("/members", func(r chi.Router) {
+			r.With(requireScope(model.ScopeMembersRead)).Get("/", v.MembersHandler.List)
+			r.With(requireScope(model.ScopeMembersWrite)).Post("/", v.MembersHandler.Create)
+		})
+		r.Route("/accounts", func(r chi.Router) {
+			r.Use(denyAPIKey)
+			r.Post("/", v.AccountsHandler.Create)
+			r.Route("/me", func(r chi.Router) {
+				r.Get("/", v.AccountsHandler.Me)
+				r.Post("/totp", v.AccountsHandler.EnrollTOTP)
+				r.Post("/totp/verify", v.AccountsHandler.VerifyTOTP)
+				r.Delete("/totp", v.AccountsHandler.DisableTOTP)
+			})
+		})
+		r.Route("/api-keys", func(r chi.Router) {
+			r.Use(denyAPIKey)
+			r.Get("/", v.APIKeysHandler.List)
+			r.Post("/", v.APIKeysHandler.Create)
+			r.Delete("/{id}", v.APIKeysHandler.Revoke)
+		})
+		r.Route("/webhooks", func(r chi.Router) {
+			r.Use(denyAPIKey)
+			r.Get("/", v.WebhooksHandler.List)
+			r.Post("/", v.WebhooksHandler.Create)
+			r.Route("/{id}", func(r chi.Router) {
+				r.Use(v.WebhooksHandler.Ctx)
+				r.Get("/", v.WebhooksHandler.Get)
+				r.Put("/", v.WebhooksHandler.Update)
+				r.Delete("/", v.WebhooksHandler.Delete)
+				r.Post("/rotate", v.WebhooksHandler.Rotate)
+				r.Post("/test", v.WebhooksHandler.Test)
+				r.Get("/deliveries", v.WebhooksHandler.Deliveries)
+			})
+		})
+	})
+}
@@ -0,0 +1,585 @@
+package v1accounts
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pkg/errors"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/sioncojp/famili-api/application/guard"
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/domain/model"
+	"github.com/sioncojp/famili-api/domain/repository"
+	"github.com/sioncojp/famili-api/utils"
+	httpresponse "github.com/sioncojp/famili-api/utils/http_response"
+	"github.com/sioncojp/famili-api/utils/secure"
+)
+
+const (
+	ErrorMessageNotFound           = "account_not_found"
+	ErrorMessageInvalidProvided    = "invalid_account_provided"
+	ErrorMessageMissingArgument    = "missing_argument"
+	ErrorMessageMemberNotFound     = "member_not_found"
+	ErrorMessageUnauthenticated    = "login_required"
+	ErrorMessageInvalidCredentials = "invalid_credentials"
+	ErrorMessageInvalidTOTP        = "invalid_totp_code"
+	ErrorMessageTOTPAlreadyEnabled = "totp_already_enabled"
+	ErrorMessageTOTPNotEnrolled    = "totp_not_enrolled"
+	ErrorMessageInvalidMFAToken    = "invalid_mfa_token"
+	ErrorMessageEmailAlreadyTaken  = "email_already_taken"
+	ErrorMessageTooManyAttempts    = "too_many_attempts"
+	ErrorMessageGuardUnavailable   = "login_temporarily_unavailable"
+	ErrorValidation                = "missing_validation"
+
+	// sessionTTL...login sessionの有効期限
+	sessionTTL = 24 * time.Hour
+	// mfaTTL...passwordを確認してからTOTPを入力するまでの猶予
+	mfaTTL = 5 * time.Minute
+
+	passwordMinLength = 8
+	// passwordMaxLength...bcryptは72byteまでしか見ない
+	passwordMaxLength = 72
+
+	recoveryCodeCount = 10
+	recoveryCodeBytes = 8
+
+	// totpPeriod...TOTPのcodeが変わる秒数. 認証アプリに合わせて30秒
+	totpPeriod = 30
+)
+
+var totpOpts = totp.ValidateOpts{Period: totpPeriod, Digits: otp.DigitsSix, Algorithm: otp.AlgorithmSHA1}
+
+var cv = &domain.CustomValidator{}
+
+// dummyPasswordHash...存在しないemailでも同じだけ時間をかけて、アカウントの有無を推測させない
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("famili-api-dummy-password"), bcrypt.DefaultCost)
+
+// handler...
+type handler struct {
+	repo    repository.AccountRepository
+	members repository.MemberRepository
+	// tx...Bootstrapでメンバーとaccountを一緒に作る
+	tx     repository.TxManager
+	cipher *secure.Cipher
+	signer *secure.Signer
+	// issuer...認証アプリに表示されるサービス名
+	issuer string
+	guard  *guard.Guard
+}
+
+// credentialsRequest...loginのbody
+type credentialsRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// createRequest...accountを作成するbody. member_idはloginしているaccountと同じfamilyのメンバー
+type createRequest struct {
+	MemberId domain.Id `json:"member_id"`
+	Email    string    `json:"email"`
+	Password string    `json:"password"`
+}
+
+// bootstrapRequest...familyの最初のメンバーとaccountを作成するbody
+type bootstrapRequest struct {
+	FamilyId domain.Id `json:"family_id"`
+	Name     string    `json:"name"`
+	Email    string    `json:"email"`
+	Password string    `json:"password"`
+}
+
+// totpRequest...TOTPの確認で使うbody. step-upではmfa_tokenも使う
+type totpRequest struct {
+	MFAToken     string `json:"mfa_token"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// loginResponse...loginの結果. TOTPが有効ならmfa_tokenを返してstep-upさせる
+type loginResponse struct {
+	SessionToken string `json:"session_token,omitempty"`
+	MFARequired  bool   `json:"mfa_required"`
+	MFAToken     string `json:"mfa_token,omitempty"`
+}
+
+// enrollResponse...認証アプリに登録するための情報. provisioning_uriをQRコードにする
+type enrollResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// NewHandler create a instance of this handler
+func NewHandler(repo repository.AccountRepository, members repository.MemberRepository, tx repository.TxManager, cipher *secure.Cipher, signer *secure.Signer, issuer string, g *guard.Guard) Handler {
+	return &handler{repo, members, tx, cipher, signer, issuer, g}
+}
+
+// Create...loginしているaccountのfamilyのメンバーにaccountを作成してhttpを返す
+func (s *handler) Create(w http.ResponseWriter, r *http.Request) {
+	caller := domain.CallerFromContext(r.Context())
+	if caller.AccountId == "" {
+		httpresponse.Error(w, r, http.StatusUnauthorized, ErrorMessageUnauthenticated, "")
+		return
+	}
+
+	req := &createRequest{}
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpresponse.Error(w, r, http.StatusBadRequest, ErrorMessageMissingArgument, "")
+		return
+	}
+
+	result := &model.Account{
+		Email:    strings.ToLower(req.Email),
+		MemberId: req.MemberId,
+		FamilyId: caller.FamilyId,
+	}
+	if !s.validate(w, r, result, req.Password) {
+		return
+	}
+	if !s.inFamily(r.Context(), req.MemberId, caller.FamilyId) {
+		httpresponse.Error(w, r, http.StatusNotFound, ErrorMessageMemberNotFound, "")
+		return
+	}
+	s.create(w, r, result, req.Password)
+}
+
+// Bootstrap...管理用. familyの最初のメンバーとaccountを作成してhttpを返す. 以降はこのaccountでloginして増やす
+// accountを作れなければメンバーも作らない
+func (s *handler) Bootstrap(w http.ResponseWriter, r *http.Request) {
+	req := &bootstrapRequest{}
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpresponse.Error(w, r, http.StatusBadRequest, ErrorMessageMissingArgument, "")
+		return
+	}
+
+	member := &model.Member{Name: req.Name, FamilyId: req.FamilyId}
+	if err := cv.Validate(member); err != nil {
+		httpresponse.Validation(w, r, ErrorValidation, err)
+		return
+	}
+	if req.FamilyId == "" {
+		httpresponse.Validation(w, r, ErrorValidation, validation.Errors{"family_id": validation.ErrRequired})
+		return
+	}
+	result := &model.Account{Email: strings.ToLower(req.Email), FamilyId: req.FamilyId}
+	if !s.validate(w, r, result, req.Password) {
+		return
+	}
+
+	if err := setPassword(result, req.Password); err != nil {
+		httpresponse.Error(w, r, http.StatusInternalServerError, ErrorMessageInvalidProvided, "")
+		return
+	}
+
+	err := s.tx.Do(r.Context(), func(ctx context.Context, repos repository.Repositories) error {
+		if err := repos.Members.Create(ctx, member); err != nil {
+			return err
+		}
+		result.MemberId = domain.Id(strconv.FormatUint(uint64(member.ID), 10))
+		return repos.Accounts.Create(result)
+	})
+	if err != nil {
+		httpresponse.Error(w, r, http.StatusInternalServerError, ErrorMessageInvalidProvided, "")
+		return
+	}
+	httpresponse.OK(w, r, http.StatusCreated, "account", result)
+}
+
+// validate...accountとpasswordを確認し、emailが使われていればhttpを返してfalse
+func (s *handler) validate(w http.ResponseWriter, r *http.Request, account *model.Account, password string) bool {
+	if err := cv.Validate(account); err != nil {
+		httpresponse.Validation(w, r, ErrorValidation, err)
+		return false
+	}
+	if len(password) < passwordMinLength || len(password) > passwordMaxLength {
+		httpresponse.Validation(w, r, ErrorValidation, validation.Errors{
+			"password": validation.ErrLengthOutOfRange.SetParams(map[string]interface{}{"min": passwordMinLength, "max": passwordMaxLength}),
+		})
+		return false
+	}
+
+	if _, err := s.repo.GetByEmail(account.Email); err == nil {
+		httpresponse.Error(w, r, http.StatusConflict, ErrorMessageEmailAlreadyTaken, "")
+		return false
+	}
+	return true
+}
+
+// inFamily...memberIdがfamilyIdのメンバーならtrue
+func (s *handler) inFamily(ctx context.Context, memberId, familyId domain.Id) bool {
+	id, err := strconv.ParseUint(string(memberId), 10, 64)
+	if err != nil || id == 0 {
+		return false
+	}
+	members, err := s.members.ListByIds(ctx, []uint{uint(id)})
+	if err != nil {
+		return false
+	}
+	for _, v := range members {
+		if v.FamilyId == familyId {
+			return true
+		}
+	}
+	return false
+}
+
+// create...passwordをhashにしてaccountを保存し、httpを返す
+func (s *handler) create(w http.ResponseWriter, r *http.Request, account *model.Account, password string) {
+	if err := setPassword(account, password); err != nil {
+		httpresponse.Error(w, r, http.StatusInternalServerError, ErrorMessageInvalidProvided, "")
+		return
+	}
+
+	if err := s.repo.Create(account); err != nil {
+		httpresponse.Error(w, r, http.StatusNotFound, ErrorMessageInvalidProvided, "")
+		return
+	}
+	httpresponse.OK(w, r, http.StatusCreated, "account", account)
+}
+
+// setPassword...passwordのhashをaccountに入れる
+func setPassword(account *model.Account, password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	account.PasswordHash = string(hash)
+	return nil
+}
+
+// Me...loginしているaccountを返す
+func (s *handler) Me(w http.ResponseWriter, r *http.Request) {
+	account, ok := s.currentAccount(w, r)
+	if !ok {
+		return
+	}
+	httpresponse.OK(w, r, http.StatusOK, "account", account)
+}
+
+// Login...email, passwordを確認する. TOTPが有効ならstep-up用のmfa_tokenを返す
+func (s *handler) Login(w http.ResponseWriter, r *http.Request) {
+	req := &credentialsRequest{}
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpresponse.Error(w, r, http.StatusBadRequest, ErrorMessageMissingArgument, "")
+		return
+	}
+
+	email := strings.ToLower(req.Email)
+	if !s.checkGuard(w, r, email) {
+		return
+	}
+
+	account, err := s.repo.GetByEmail(email)
+	if err != nil {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(req.Password))
+		httpresponse.Error(w, r, http.StatusUnauthorized, ErrorMessageInvalidCredentials, "")
+		return
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(account.PasswordHash), []byte(req.Password)); err != nil {
+		httpresponse.Error(w, r, http.StatusUnauthorized, ErrorMessageInvalidCredentials, "")
+		return
+	}
+
+	if account.TOTPEnabled {
+		// passwordは合っているので数えた1回は取り消す. TOTPの失敗はLoginTOTPで数える
+		if err := s.guard.Release(email, r.RemoteAddr); err != nil {
+			httpresponse.Error(w, r, http.StatusServiceUnavailable, ErrorMessageGuardUnavailable, "")
+			return
+		}
+		token, err := s.signer.Sign(claims(account, secure.PurposeMFA), mfaTTL)
+		if err != nil {
+			httpresponse.Error(w, r, http.StatusInternalServerError, ErrorMessageInvalidProvided, "")
+			return
+		}
+		httpresponse.OK(w, r, http.StatusOK, "login", loginResponse{MFARequired: true, MFAToken: token})
+		return
+	}
+
+	s.respondSession(w, r, account)
+}
+
+// LoginTOTP...step-up. mfa_tokenとTOTPのcode、またはrecovery codeでsessionを発行する
+func (s *handler) LoginTOTP(w http.ResponseWriter, r *http.Request) {
+	req := &totpRequest{}
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpresponse.Error(w, r, http.StatusBadRequest, ErrorMessageMissingArgument, "")
+		return
+	}
+
+	c, err := s.signer.Verify(req.MFAToken, secure.PurposeMFA)
+	if err != nil {
+		httpresponse.Error(w, r, http.StatusUnauthorized, ErrorMessageInvalidMFAToken, "")
+		return
+	}
+	account, err := s.repo.GetById(domain.Id(fmt.Sprint(c.AccountId)))
+	if err != nil || !account.TOTPEnabled {
+		httpresponse.Error(w, r, http.StatusUnauthorized, ErrorMessageInvalidMFAToken, "")
+		return
+	}
+	if !s.checkGuard(w, r, account.Email) {
+		return
+	}
+
+	if req.RecoveryCode != "" {
+		ok, err := s.repo.UseRecoveryCode(&account, hashRecoveryCode(req.RecoveryCode))
+		if err != nil || !ok {
+			httpresponse.Error(w, r, http.StatusUnauthorized, ErrorMessageInvalidTOTP, "")
+			return
+		}
+	} else if !s.validateCode(&account, req.Code) {
+		httpresponse.Error(w, r, http.StatusUnauthorized, ErrorMessageInvalidTOTP, "")
+		return
+	}
+
+	s.respondSession(w, r, account)
+}
+
+// EnrollTOTP...TOTPのsecretを発行する. verifyされるまでは有効にしない
+func (s *handler) EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	account, ok := s.currentAccount(w, r)
+	if !ok {
+		return
+	}
+	if account.TOTPEnabled {
+		httpresponse.Error(w, r, http.StatusConflict, ErrorMessageTOTPAlreadyEnabled, "")
+		return
+	}
+
+	key, err := totp.Generate(totp.GenerateOpts{Issuer: s.issuer, AccountName: account.Email})
+	if err != nil {
+		httpresponse.Error(w, r, http.StatusInternalServerError, ErrorMessageInvalidProvided, "")
+		return
+	}
+	encrypted, err := s.cipher.Encrypt(key.Secret())
+	if err != nil {
+		httpresponse.Error(w, r, http.StatusInternalServerError, ErrorMessageInvalidProvided, "")
+		return
+	}
+
+	account.TOTPSecret = encrypted
+	if err := s.repo.Update(&account); err != nil {
+		httpresponse.Error(w, r, http.StatusNotFound, ErrorMessageInvalidProvided, "")
+		return
+	}
+
+	httpresponse.OK(w, r, http.StatusOK, "totp", enrollResponse{Secret: key.Secret(), ProvisioningURI: key.URL()})
+}
+
+// VerifyTOTP...認証アプリのcodeを確認してTOTPを有効にし、recovery codeを返す
+func (s *handler) VerifyTOTP(w http.ResponseWriter, r *http.Request) {
+	account, ok := s.currentAccount(w, r)
+	if !ok {
+		return
+	}
+
+	req := &totpRequest{}
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpresponse.Error(w, r, http.StatusBadRequest, ErrorMessageMissingArgument, "")
+		return
+	}
+	if account.TOTPEnabled {
+		httpresponse.Error(w, r, http.StatusConflict, ErrorMessageTOTPAlreadyEnabled, "")
+		return
+	}
+	if account.TOTPSecret == "" {
+		httpresponse.Error(w, r, http.StatusBadRequest, ErrorMessageTOTPNotEnrolled, "")
+		return
+	}
+	if !s.checkGuard(w, r, account.Email) {
+		return
+	}
+	if !s.validateCode(&account, req.Code) {
+		httpresponse.Error(w, r, http.StatusUnauthorized, ErrorMessageInvalidTOTP, "")
+		return
+	}
+	if !s.succeedGuard(w, r, account.Email) {
+		return
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		httpresponse.Error(w, r, http.StatusInternalServerError, ErrorMessageInvalidProvided, "")
+		return
+	}
+	if err := s.repo.ReplaceRecoveryCodes(&account, hashes); err != nil {
+		httpresponse.Error(w, r, http.StatusNotFound, ErrorMessageInvalidProvided, "")
+		return
+	}
+
+	account.TOTPEnabled = true
+	if err := s.repo.Update(&account); err != nil {
+		httpresponse.Error(w, r, http.StatusNotFound, ErrorMessageInvalidProvided, "")
+		return
+	}
+
+	httpresponse.OK(w, r, http.StatusOK, "recovery_codes", codes)
+}
+
+// DisableTOTP...現在のcodeを確認してTOTPを無効にする
+func (s *handler) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	account, ok := s.currentAccount(w, r)
+	if !ok {
+		return
+	}
+
+	req := &totpRequest{}
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpresponse.Error(w, r, http.StatusBadRequest, ErrorMessageMissingArgument, "")
+		return
+	}
+	if !account.TOTPEnabled {
+		httpresponse.Error(w, r, http.StatusBadRequest, ErrorMessageTOTPNotEnrolled, "")
+		return
+	}
+	// sessionを盗まれてもcodeを総当たりで2FAを外せないように、loginと同じく数える
+	if !s.checkGuard(w, r, account.Email) {
+		return
+	}
+	if !s.validateCode(&account, req.Code) {
+		httpresponse.Error(w, r, http.StatusUnauthorized, ErrorMessageInvalidTOTP, "")
+		return
+	}
+	if !s.succeedGuard(w, r, account.Email) {
+		return
+	}
+
+	if err := s.repo.ReplaceRecoveryCodes(&account, nil); err != nil {
+		httpresponse.Error(w, r, http.StatusNotFound, ErrorMessageInvalidProvided, "")
+		return
+	}
+	account.TOTPSecret = ""
+	account.TOTPEnabled = false
+	if err := s.repo.Update(&account); err != nil {
+		httpresponse.Error(w, r, http.StatusNotFound, ErrorMessageInvalidProvided, "")
+		return
+	}
+
+	httpresponse.OK(w, r, http.StatusOK, "", nil)
+}
+
+// currentAccount...login sessionのaccountを取得する. 取得できなければhttpを返してfalse
+func (s *handler) currentAccount(w http.ResponseWriter, r *http.Request) (model.Account, bool) {
+	caller := domain.CallerFromContext(r.Context())
+	if caller.AccountId == "" {
+		httpresponse.Error(w, r, http.StatusUnauthorized, ErrorMessageUnauthenticated, "")
+		return model.Account{}, false
+	}
+
+	account, err := s.repo.GetById(caller.AccountId)
+	if err != nil {
+		httpresponse.Error(w, r, http.StatusNotFound, ErrorMessageNotFound, "")
+		return model.Account{}, false
+	}
+	return account, true
+}
+
+// validateCode...暗号化されたsecretを復号してTOTPのcodeを確認する. 前後1stepまで許し、通ったstepは使用済みにする
+func (s *handler) validateCode(account *model.Account, code string) bool {
+	if code == "" || account.TOTPSecret == "" {
+		return false
+	}
+	secret, err := s.cipher.Decrypt(account.TOTPSecret)
+	if err != nil {
+		return false
+	}
+
+	now := time.Now()
+	for _, skew := range []int64{-1, 0, 1} {
+		at := now.Add(time.Duration(skew*totpPeriod) * time.Second)
+		expected, err := totp.GenerateCodeCustom(secret, at, totpOpts)
+		if err != nil {
+			return false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) != 1 {
+			continue
+		}
+		ok, err := s.repo.UseTOTPStep(account, at.Unix()/totpPeriod)
+		return err == nil && ok
+	}
+	return false
+}
+
+// checkGuard...brute-force対策. 待ち中なら429とRetry-Afterを返してfalse. 通ったら失敗として1回数えておく
+func (s *handler) checkGuard(w http.ResponseWriter, r *http.Request, email string) bool {
+	retryAfter, err := s.guard.Check(email, r.RemoteAddr)
+	if errors.Is(err, guard.ErrLocked) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		httpresponse.Error(w, r, http.StatusTooManyRequests, ErrorMessageTooManyAttempts, "")
+		return false
+	}
+	if err != nil {
+		httpresponse.Error(w, r, http.StatusServiceUnavailable, ErrorMessageGuardUnavailable, "")
+		return false
+	}
+	return true
+}
+
+// succeedGuard...accountの失敗の記録は消し、IPはcheckGuardで数えた1回を取り消す. 失敗したらhttpを返してfalse
+func (s *handler) succeedGuard(w http.ResponseWriter, r *http.Request, email string) bool {
+	if err := s.guard.Succeed(email, r.RemoteAddr); err != nil {
+		httpresponse.Error(w, r, http.StatusServiceUnavailable, ErrorMessageGuardUnavailable, "")
+		return false
+	}
+	return true
+}
+
+// respondSession...guardの記録を成功にして、sessionを発行してhttpを返す
+func (s *handler) respondSession(w http.ResponseWriter, r *http.Request, account model.Account) {
+	if !s.succeedGuard(w, r, account.Email) {
+		return
+	}
+
+	token, err := s.signer.Sign(claims(account, secure.PurposeSession), sessionTTL)
+	if err != nil {
+		httpresponse.Error(w, r, http.StatusInternalServerError, ErrorMessageInvalidProvided, "")
+		return
+	}
+	httpresponse.OK(w, r, http.StatusOK, "login", loginResponse{SessionToken: token})
+}
+
+func claims(account model.Account, purpose string) secure.Claims {
+	return secure.Claims{
+		AccountId: account.ID,
+		MemberId:  string(account.MemberId),
+		FamilyId:  string(account.FamilyId),
+		Purpose:   purpose,
+	}
+}
+
+// generateRecoveryCodes...平文のcodeと保存用のhashを返す
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := utils.MakeSecureToken(recoveryCodeBytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(code)))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,449 @@
+package v1accounts
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pquerna/otp/totp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/sioncojp/famili-api/application/guard"
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/domain/model"
+	"github.com/sioncojp/famili-api/domain/repository"
+	"github.com/sioncojp/famili-api/infrastructure/memory"
+	"github.com/sioncojp/famili-api/utils/secure"
+)
+
+type TestCase struct {
+	name           string
+	parameter      string
+	httpStatusCode int
+}
+
+var (
+	testKey    = base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+	caller     = domain.Caller{MemberId: "1", FamilyId: "f1", AccountId: "1"}
+	password   = "correct horse battery"
+	totpSecret = "JBSWY3DPEHPK3PXP"
+)
+
+func newTestHandler(t *testing.T, m *MockAccountService) (Handler, *secure.Cipher, *secure.Signer) {
+	c, err := secure.NewCipher(testKey)
+	require.NoError(t, err)
+	s, err := secure.NewSigner(testKey)
+	require.NoError(t, err)
+	g := guard.NewGuard(memory.NewLoginAttemptRepository(), zap.NewNop(), guard.DefaultAccountPolicy, guard.DefaultIPPolicy)
+	members := newMembers(t)
+	return NewHandler(m, members, newTx(m, members), c, s, "famili-api", g), c, s
+}
+
+// newTx...accountとメンバーを一緒にrollbackするTxManager. mockのaccountはrollbackされない
+func newTx(accounts repository.AccountRepository, members repository.MemberRepository) repository.TxManager {
+	return memory.NewTxManager(repository.Repositories{Members: members, Accounts: accounts})
+}
+
+// newMembers...1, 2はcallerと同じfamily, 3は別のfamily
+func newMembers(t *testing.T) repository.MemberRepository {
+	members := memory.NewMemberRepository()
+	for _, v := range []model.Member{{Name: "papa", FamilyId: "f1"}, {Name: "mama", FamilyId: "f1"}, {Name: "other", FamilyId: "f2"}} {
+		v := v
+		require.NoError(t, members.Create(context.Background(), &v))
+	}
+	return members
+}
+
+func newAccount(t *testing.T, c *secure.Cipher, totpEnabled bool) model.Account {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	require.NoError(t, err)
+	account := model.Account{
+		Model:        model.Model{ID: 1},
+		Email:        "papa@example.com",
+		PasswordHash: string(hash),
+		MemberId:     "1",
+		FamilyId:     "f1",
+	}
+	if totpEnabled {
+		account.TOTPSecret, err = c.Encrypt(totpSecret)
+		require.NoError(t, err)
+		account.TOTPEnabled = true
+	}
+	return account
+}
+
+func decodeLogin(t *testing.T, w *httptest.ResponseRecorder) loginResponse {
+	var body struct {
+		Login loginResponse `json:"login"`
+	}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&body))
+	return body.Login
+}
+
+func TestAccountCreate(t *testing.T) {
+	t.Parallel()
+	cases := []TestCase{
+		{"ok", `{"member_id":"2","email":"Papa@example.com","password":"correct horse battery"}`, http.StatusCreated},
+		{"taken", `{"member_id":"2","email":"mama@example.com","password":"correct horse battery"}`, http.StatusConflict},
+		{"invalid email", `{"member_id":"2","email":"papa","password":"correct horse battery"}`, http.StatusBadRequest},
+		{"short password", `{"member_id":"2","email":"papa@example.com","password":"short"}`, http.StatusBadRequest},
+		{"other family", `{"member_id":"3","email":"papa@example.com","password":"correct horse battery"}`, http.StatusNotFound},
+		{"missing member", `{"email":"papa@example.com","password":"correct horse battery"}`, http.StatusNotFound},
+	}
+
+	m := new(MockAccountService)
+	m.On("GetByEmail", "papa@example.com").Return(model.Account{}, errors.New("record not found"))
+	m.On("GetByEmail", "mama@example.com").Return(model.Account{}, nil)
+	m.On("Create", mock.MatchedBy(func(a *model.Account) bool {
+		return a.Email == "papa@example.com" && a.MemberId == "2" && a.FamilyId == caller.FamilyId &&
+			bcrypt.CompareHashAndPassword([]byte(a.PasswordHash), []byte(password)) == nil
+	})).Return(nil)
+	s, _, _ := newTestHandler(t, m)
+
+	for _, v := range cases {
+		v := v
+		t.Run(
+			v.name,
+			func(tt *testing.T) {
+				tt.Parallel()
+				r := httptest.NewRequest(http.MethodPost, "/v1/accounts", strings.NewReader(v.parameter))
+				w := httptest.NewRecorder()
+				s.Create(w, r.WithContext(domain.NewCallerContext(r.Context(), caller)))
+
+				assert.Equal(tt, v.httpStatusCode, w.Result().StatusCode)
+				assert.NotContains(tt, w.Body.String(), "password_hash")
+			},
+		)
+	}
+
+	// API keyのcallerのようにsessionが無ければ作れない
+	r := httptest.NewRequest(http.MethodPost, "/v1/accounts", strings.NewReader(cases[0].parameter))
+	w := httptest.NewRecorder()
+	s.Create(w, r.WithContext(domain.NewCallerContext(r.Context(), domain.Caller{MemberId: "1", FamilyId: "f1"})))
+	assert.Equal(t, http.StatusUnauthorized, w.Result().StatusCode)
+	assert.Contains(t, w.Body.String(), ErrorMessageUnauthenticated)
+}
+
+func TestAccountBootstrap(t *testing.T) {
+	t.Parallel()
+	cases := []TestCase{
+		{"ok", `{"family_id":"f9","name":"papa","email":"Papa@example.com","password":"correct horse battery"}`, http.StatusCreated},
+		{"taken", `{"family_id":"f9","name":"mama","email":"mama@example.com","password":"correct horse battery"}`, http.StatusConflict},
+		{"missing family", `{"name":"papa","email":"papa@example.com","password":"correct horse battery"}`, http.StatusBadRequest},
+		{"missing name", `{"family_id":"f9","email":"papa@example.com","password":"correct horse battery"}`, http.StatusBadRequest},
+		{"broken json", `{`, http.StatusBadRequest},
+	}
+
+	m := new(MockAccountService)
+	m.On("GetByEmail", "papa@example.com").Return(model.Account{}, errors.New("record not found"))
+	m.On("GetByEmail", "mama@example.com").Return(model.Account{}, nil)
+	m.On("Create", mock.MatchedBy(func(a *model.Account) bool {
+		// newMembersの3人の次に作られる
+		return a.Email == "papa@example.com" && a.MemberId == "4" && a.FamilyId == "f9"
+	})).Return(nil)
+	s, _, _ := newTestHandler(t, m)
+
+	for _, v := range cases {
+		v := v
+		t.Run(
+			v.name,
+			func(tt *testing.T) {
+				r := httptest.NewRequest(http.MethodPost, "/v1/admin/accounts", strings.NewReader(v.parameter))
+				w := httptest.NewRecorder()
+				s.Bootstrap(w, r)
+
+				assert.Equal(tt, v.httpStatusCode, w.Result().StatusCode, w.Body.String())
+			},
+		)
+	}
+	m.AssertNumberOfCalls(t, "Create", 1)
+}
+
+// TestAccountBootstrapRollback...accountを作れなければメンバーも残さない
+func TestAccountBootstrapRollback(t *testing.T) {
+	t.Parallel()
+	m := new(MockAccountService)
+	m.On("GetByEmail", "papa@example.com").Return(model.Account{}, errors.New("record not found"))
+	m.On("Create", mock.Anything).Return(errors.New("duplicate email"))
+	h, _, _ := newTestHandler(t, m)
+	s := h.(*handler)
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/admin/accounts",
+		strings.NewReader(`{"family_id":"f9","name":"papa","email":"papa@example.com","password":"correct horse battery"}`))
+	w := httptest.NewRecorder()
+	s.Bootstrap(w, r)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Result().StatusCode)
+	members, err := s.members.List(context.Background(), "f9")
+	require.NoError(t, err)
+	assert.Empty(t, members)
+}
+
+func TestAccountLogin(t *testing.T) {
+	t.Parallel()
+	m := new(MockAccountService)
+	s, c, signer := newTestHandler(t, m)
+	m.On("GetByEmail", "papa@example.com").Return(newAccount(t, c, false), nil)
+	m.On("GetByEmail", "mama@example.com").Return(newAccount(t, c, true), nil)
+	m.On("GetByEmail", mock.Anything).Return(model.Account{}, errors.New("record not found"))
+
+	cases := []struct {
+		name           string
+		parameter      string
+		httpStatusCode int
+		mfaRequired    bool
+	}{
+		{"ok", `{"email":"papa@example.com","password":"correct horse battery"}`, http.StatusOK, false},
+		{"totp enabled", `{"email":"mama@example.com","password":"correct horse battery"}`, http.StatusOK, true},
+		{"wrong password", `{"email":"papa@example.com","password":"wrong"}`, http.StatusUnauthorized, false},
+		{"unknown email", `{"email":"nobody@example.com","password":"correct horse battery"}`, http.StatusUnauthorized, false},
+	}
+
+	for _, v := range cases {
+		r := httptest.NewRequest(http.MethodPost, "/v1/login", strings.NewReader(v.parameter))
+		w := httptest.NewRecorder()
+		s.Login(w, r)
+
+		require.Equal(t, v.httpStatusCode, w.Result().StatusCode, v.name)
+		if v.httpStatusCode != http.StatusOK {
+			continue
+		}
+
+		res := decodeLogin(t, w)
+		assert.Equal(t, v.mfaRequired, res.MFARequired, v.name)
+		if v.mfaRequired {
+			assert.Empty(t, res.SessionToken, v.name)
+			_, err := signer.Verify(res.MFAToken, secure.PurposeMFA)
+			assert.NoError(t, err, v.name)
+			continue
+		}
+		_, err := signer.Verify(res.SessionToken, secure.PurposeSession)
+		assert.NoError(t, err, v.name)
+	}
+}
+
+func TestAccountLoginLockout(t *testing.T) {
+	t.Parallel()
+	m := new(MockAccountService)
+	s, c, _ := newTestHandler(t, m)
+	m.On("GetByEmail", "papa@example.com").Return(newAccount(t, c, false), nil)
+
+	login := func(password string) *httptest.ResponseRecorder {
+		body := `{"email":"papa@example.com","password":"` + password + `"}`
+		r := httptest.NewRequest(http.MethodPost, "/v1/login", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		s.Login(w, r)
+		return w
+	}
+
+	// 成功したloginは数えた1回を取り消すので、続けても待たされない
+	for i := 0; i <= guard.DefaultAccountPolicy.FreeAttempts+1; i++ {
+		require.Equal(t, http.StatusOK, login(password).Result().StatusCode, "success %d", i+1)
+	}
+
+	for i := 0; i <= guard.DefaultAccountPolicy.FreeAttempts; i++ {
+		require.Equal(t, http.StatusUnauthorized, login("wrong").Result().StatusCode, "failure %d", i+1)
+	}
+
+	// 正しいpasswordでもbackoff中は試せない
+	w := login(password)
+	require.Equal(t, http.StatusTooManyRequests, w.Result().StatusCode)
+	assert.Equal(t, "1", w.Result().Header.Get("Retry-After"))
+	assert.Contains(t, w.Body.String(), ErrorMessageTooManyAttempts)
+}
+
+func TestAccountLoginTOTP(t *testing.T) {
+	t.Parallel()
+	m := new(MockAccountService)
+	s, c, signer := newTestHandler(t, m)
+	account := newAccount(t, c, true)
+	m.On("GetById", domain.Id("1")).Return(account, nil)
+	m.On("UseRecoveryCode", mock.Anything, hashRecoveryCode("recovery-ok")).Return(true, nil)
+	m.On("UseRecoveryCode", mock.Anything, mock.Anything).Return(false, nil)
+	m.On("UseTOTPStep", mock.Anything, mock.Anything).Return(true, nil).Once()
+	m.On("UseTOTPStep", mock.Anything, mock.Anything).Return(false, nil)
+
+	mfaToken, _ := signer.Sign(claims(account, secure.PurposeMFA), time.Minute)
+	sessionToken, _ := signer.Sign(claims(account, secure.PurposeSession), time.Minute)
+	code, err := totp.GenerateCode(totpSecret, time.Now())
+	require.NoError(t, err)
+
+	cases := []struct {
+		name           string
+		request        totpRequest
+		httpStatusCode int
+	}{
+		{"ok", totpRequest{MFAToken: mfaToken, Code: code}, http.StatusOK},
+		{"replayed code", totpRequest{MFAToken: mfaToken, Code: code}, http.StatusUnauthorized},
+		{"recovery code", totpRequest{MFAToken: mfaToken, RecoveryCode: "recovery-ok"}, http.StatusOK},
+		{"used recovery code", totpRequest{MFAToken: mfaToken, RecoveryCode: "recovery-used"}, http.StatusUnauthorized},
+		{"wrong code", totpRequest{MFAToken: mfaToken, Code: "000000x"}, http.StatusUnauthorized},
+		{"session token is not mfa token", totpRequest{MFAToken: sessionToken, Code: code}, http.StatusUnauthorized},
+	}
+
+	for _, v := range cases {
+		body, _ := json.Marshal(v.request)
+		r := httptest.NewRequest(http.MethodPost, "/v1/login/totp", strings.NewReader(string(body)))
+		w := httptest.NewRecorder()
+		s.LoginTOTP(w, r)
+
+		require.Equal(t, v.httpStatusCode, w.Result().StatusCode, v.name)
+		if v.httpStatusCode == http.StatusOK {
+			_, err := signer.Verify(decodeLogin(t, w).SessionToken, secure.PurposeSession)
+			assert.NoError(t, err, v.name)
+		}
+	}
+}
+
+// TestAccountTOTPReplay...同じcodeは1回しか通らず、次のstepのcodeは通る
+func TestAccountTOTPReplay(t *testing.T) {
+	t.Parallel()
+	repo := memory.NewAccountRepository()
+	c, err := secure.NewCipher(testKey)
+	require.NoError(t, err)
+	signer, err := secure.NewSigner(testKey)
+	require.NoError(t, err)
+	g := guard.NewGuard(memory.NewLoginAttemptRepository(), zap.NewNop(), guard.DefaultAccountPolicy, guard.DefaultIPPolicy)
+	members := newMembers(t)
+	s := NewHandler(repo, members, newTx(repo, members), c, signer, "famili-api", g).(*handler)
+
+	account := newAccount(t, c, true)
+	account.ID = 0
+	require.NoError(t, repo.Create(&account))
+	mfaToken, _ := signer.Sign(claims(account, secure.PurposeMFA), time.Minute)
+
+	login := func(code string) int {
+		body, _ := json.Marshal(totpRequest{MFAToken: mfaToken, Code: code})
+		r := httptest.NewRequest(http.MethodPost, "/v1/login/totp", strings.NewReader(string(body)))
+		w := httptest.NewRecorder()
+		s.LoginTOTP(w, r)
+		return w.Result().StatusCode
+	}
+
+	code, err := totp.GenerateCode(totpSecret, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, login(code))
+	assert.Equal(t, http.StatusUnauthorized, login(code), "a code must not be accepted twice")
+
+	// 前のstepのcodeも、使ったstepより前なので通らない
+	previous, err := totp.GenerateCode(totpSecret, time.Now().Add(-totpPeriod*time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, login(previous))
+
+	next, err := totp.GenerateCode(totpSecret, time.Now().Add(totpPeriod*time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, login(next))
+}
+
+func TestAccountEnrollAndVerifyTOTP(t *testing.T) {
+	t.Parallel()
+	m := new(MockAccountService)
+	s, c, _ := newTestHandler(t, m)
+	account := newAccount(t, c, false)
+
+	// enroll
+	m.On("GetById", domain.Id("1")).Return(account, nil).Once()
+	m.On("Update", mock.Anything).Run(func(args mock.Arguments) {
+		account = *args.Get(0).(*model.Account)
+	}).Return(nil)
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/accounts/me/totp", nil)
+	w := httptest.NewRecorder()
+	s.EnrollTOTP(w, r.WithContext(domain.NewCallerContext(r.Context(), caller)))
+	require.Equal(t, http.StatusOK, w.Result().StatusCode)
+
+	var enrolled struct {
+		TOTP enrollResponse `json:"totp"`
+	}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&enrolled))
+	assert.True(t, strings.HasPrefix(enrolled.TOTP.ProvisioningURI, "otpauth://totp/famili-api:"))
+	assert.NotContains(t, account.TOTPSecret, enrolled.TOTP.Secret, "secret must be encrypted at rest")
+	assert.False(t, account.TOTPEnabled, "totp must not be enabled before verify")
+
+	// verify
+	m.On("GetById", domain.Id("1")).Return(account, nil).Once()
+	m.On("ReplaceRecoveryCodes", mock.Anything, mock.MatchedBy(func(hashes []string) bool {
+		return len(hashes) == recoveryCodeCount
+	})).Return(nil)
+	m.On("UseTOTPStep", mock.Anything, mock.Anything).Return(true, nil)
+
+	code, err := totp.GenerateCode(enrolled.TOTP.Secret, time.Now())
+	require.NoError(t, err)
+	r = httptest.NewRequest(http.MethodPost, "/v1/accounts/me/totp/verify", strings.NewReader(`{"code":"`+code+`"}`))
+	w = httptest.NewRecorder()
+	s.VerifyTOTP(w, r.WithContext(domain.NewCallerContext(r.Context(), caller)))
+	require.Equal(t, http.StatusOK, w.Result().StatusCode)
+
+	var verified struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&verified))
+	assert.Len(t, verified.RecoveryCodes, recoveryCodeCount)
+	assert.True(t, account.TOTPEnabled)
+}
+
+// TestAccountTOTPLockout...verify, disableのcodeもloginと同じく総当たりできない
+func TestAccountTOTPLockout(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		name        string
+		totpEnabled bool
+		call        func(Handler, http.ResponseWriter, *http.Request)
+	}{
+		{"verify", false, Handler.VerifyTOTP},
+		{"disable", true, Handler.DisableTOTP},
+	}
+	for _, v := range cases {
+		v := v
+		t.Run(v.name, func(tt *testing.T) {
+			tt.Parallel()
+			m := new(MockAccountService)
+			s, c, _ := newTestHandler(tt, m)
+			account := newAccount(tt, c, true)
+			account.TOTPEnabled = v.totpEnabled
+			m.On("GetById", domain.Id("1")).Return(account, nil)
+			m.On("UseTOTPStep", mock.Anything, mock.Anything).Return(true, nil)
+			m.On("ReplaceRecoveryCodes", mock.Anything, mock.Anything).Return(nil)
+			m.On("Update", mock.Anything).Return(nil)
+
+			do := func(code string) *httptest.ResponseRecorder {
+				r := httptest.NewRequest(http.MethodPost, "/v1/accounts/me/totp", strings.NewReader(`{"code":"`+code+`"}`))
+				w := httptest.NewRecorder()
+				v.call(s, w, r.WithContext(domain.NewCallerContext(r.Context(), caller)))
+				return w
+			}
+
+			for i := 0; i <= guard.DefaultAccountPolicy.FreeAttempts; i++ {
+				require.Equal(tt, http.StatusUnauthorized, do("wrong").Result().StatusCode, "failure %d", i+1)
+			}
+
+			// 正しいcodeでもbackoff中は試せない
+			code, err := totp.GenerateCode(totpSecret, time.Now())
+			require.NoError(tt, err)
+			w := do(code)
+			require.Equal(tt, http.StatusTooManyRequests, w.Result().StatusCode)
+			assert.Contains(tt, w.Body.String(), ErrorMessageTooManyAttempts)
+		})
+	}
+}
+
+func TestAccountMeRequiresLogin(t *testing.T) {
+	t.Parallel()
+	s, _, _ := newTestHandler(t, new(MockAccountService))
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/accounts/me", nil)
+	w := httptest.NewRecorder()
+	s.Me(w, r.WithContext(domain.NewCallerContext(r.Context(), domain.Caller{MemberId: "1"})))
+
+	assert.Equal(t, http.StatusUnauthorized, w.Result().StatusCode)
+}
@@ -0,0 +1,17 @@
+package v1accounts
+
+import (
+	"net/http"
+)
+
+// Handler...interfaceを使うことでDIPを解決する。mockも作成できるようになる
+type Handler interface {
+	Create(w http.ResponseWriter, r *http.Request)
+	Bootstrap(w http.ResponseWriter, r *http.Request)
+	Me(w http.ResponseWriter, r *http.Request)
+	Login(w http.ResponseWriter, r *http.Request)
+	LoginTOTP(w http.ResponseWriter, r *http.Request)
+	EnrollTOTP(w http.ResponseWriter, r *http.Request)
+	VerifyTOTP(w http.ResponseWriter, r *http.Request)
+	DisableTOTP(w http.ResponseWriter, r *http.Request)
+}
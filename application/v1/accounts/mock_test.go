@@ -0,0 +1,47 @@
+package v1accounts
+
+import (
+	"github.com/stretchr/testify/mock"
+
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/domain/model"
+)
+
+type MockAccountService struct {
+	mock.Mock
+}
+
+func (m *MockAccountService) GetById(id domain.Id) (model.Account, error) {
+	r := m.Called(id)
+	return r.Get(0).(model.Account), r.Error(1)
+}
+
+func (m *MockAccountService) GetByEmail(email string) (model.Account, error) {
+	r := m.Called(email)
+	return r.Get(0).(model.Account), r.Error(1)
+}
+
+func (m *MockAccountService) Create(account *model.Account) error {
+	r := m.Called(account)
+	return r.Error(0)
+}
+
+func (m *MockAccountService) Update(account *model.Account) error {
+	r := m.Called(account)
+	return r.Error(0)
+}
+
+func (m *MockAccountService) ReplaceRecoveryCodes(account *model.Account, hashes []string) error {
+	r := m.Called(account, hashes)
+	return r.Error(0)
+}
+
+func (m *MockAccountService) UseRecoveryCode(account *model.Account, hash string) (bool, error) {
+	r := m.Called(account, hash)
+	return r.Bool(0), r.Error(1)
+}
+
+func (m *MockAccountService) UseTOTPStep(account *model.Account, step int64) (bool, error) {
+	r := m.Called(account, step)
+	return r.Bool(0), r.Error(1)
+}
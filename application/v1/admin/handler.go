@@ -0,0 +1,80 @@
+package v1admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/sioncojp/famili-api/application/guard"
+	"github.com/sioncojp/famili-api/domain/repository"
+	httpresponse "github.com/sioncojp/famili-api/utils/http_response"
+)
+
+const (
+	ErrorMessageInvalidProvided = "invalid_unlock_provided"
+	ErrorMessageMissingArgument = "missing_argument"
+)
+
+// handler...
+type handler struct {
+	guard *guard.Guard
+	// cache...[cache] driverがnoneならnil
+	cache repository.CacheStatsReporter
+	// pools...[datastore] driverがmemoryならnil
+	pools repository.PoolStatsReporter
+}
+
+// cacheResponse...GET /v1/admin/cache のレスポンス
+type cacheResponse struct {
+	Enabled bool `json:"enabled"`
+	repository.CacheStats
+}
+
+// unlockRequest...POST /v1/admin/unlock のbody. どちらか片方だけでもよい
+type unlockRequest struct {
+	Email string `json:"email"`
+	IP    string `json:"ip"`
+}
+
+// NewHandler create a instance of this handler
+func NewHandler(g *guard.Guard, cache repository.CacheStatsReporter, pools repository.PoolStatsReporter) Handler {
+	return &handler{g, cache, pools}
+}
+
+// Unlock...loginのlockを解除してhttpを返す
+func (s *handler) Unlock(w http.ResponseWriter, r *http.Request) {
+	req := &unlockRequest{}
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || (req.Email == "" && req.IP == "") {
+		httpresponse.Error(w, r, http.StatusBadRequest, ErrorMessageMissingArgument, "")
+		return
+	}
+
+	if err := s.guard.Unlock(strings.ToLower(req.Email), req.IP); err != nil {
+		httpresponse.Error(w, r, http.StatusServiceUnavailable, ErrorMessageInvalidProvided, "")
+		return
+	}
+
+	httpresponse.OK(w, r, http.StatusOK, "", nil)
+}
+
+// Cache...todoのcacheのhit/miss回数を返す
+func (s *handler) Cache(w http.ResponseWriter, r *http.Request) {
+	out := cacheResponse{}
+	if s.cache != nil {
+		out.Enabled = true
+		out.CacheStats = s.cache.CacheStats()
+	}
+
+	httpresponse.OK(w, r, http.StatusOK, "cache", out)
+}
+
+// DB...DBのコネクションpoolの状態を返す
+func (s *handler) DB(w http.ResponseWriter, r *http.Request) {
+	out := []repository.PoolStats{}
+	if s.pools != nil {
+		out = s.pools.PoolStats()
+	}
+
+	httpresponse.OK(w, r, http.StatusOK, "pools", out)
+}
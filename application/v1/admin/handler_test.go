@@ -0,0 +1,125 @@
+package v1admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/sioncojp/famili-api/application/guard"
+	"github.com/sioncojp/famili-api/domain/model"
+	"github.com/sioncojp/famili-api/domain/repository"
+	"github.com/sioncojp/famili-api/infrastructure/memory"
+)
+
+type TestCase struct {
+	name           string
+	parameter      string
+	httpStatusCode int
+}
+
+// newLockedGuard...papa@example.comと192.0.2.1がlockされたguard
+func newLockedGuard(t *testing.T) *guard.Guard {
+	store := memory.NewLoginAttemptRepository()
+	until := time.Now().Add(guard.DefaultAccountPolicy.LockoutDuration)
+	for _, key := range []string{guard.AccountKey("papa@example.com"), guard.IPKey("192.0.2.1")} {
+		require.NoError(t, store.Save(&model.LoginAttempt{Key: key, Failures: guard.DefaultAccountPolicy.LockoutThreshold, LastFailedAt: time.Now(), LockedUntil: until}))
+	}
+	return guard.NewGuard(store, zap.NewNop(), guard.DefaultAccountPolicy, guard.DefaultIPPolicy)
+}
+
+func TestAdminUnlock(t *testing.T) {
+	t.Parallel()
+	cases := []TestCase{
+		{"email", `{"email":"Papa@example.com"}`, http.StatusOK},
+		{"ip", `{"ip":"192.0.2.1"}`, http.StatusOK},
+		{"empty", `{}`, http.StatusBadRequest},
+		{"invalid json", `{`, http.StatusBadRequest},
+	}
+
+	for _, v := range cases {
+		v := v
+		t.Run(v.name, func(tt *testing.T) {
+			tt.Parallel()
+			g := newLockedGuard(tt)
+
+			r := httptest.NewRequest(http.MethodPost, "/v1/admin/unlock", strings.NewReader(v.parameter))
+			w := httptest.NewRecorder()
+			NewHandler(g, nil, nil).Unlock(w, r)
+			assert.Equal(tt, v.httpStatusCode, w.Result().StatusCode)
+		})
+	}
+
+	g := newLockedGuard(t)
+	r := httptest.NewRequest(http.MethodPost, "/v1/admin/unlock", strings.NewReader(`{"email":"papa@example.com"}`))
+	NewHandler(g, nil, nil).Unlock(httptest.NewRecorder(), r)
+	_, err := g.Check("papa@example.com", "198.51.100.1")
+	assert.NoError(t, err, "account should be unlocked")
+}
+
+// stubCacheStats...固定のhit/missを返す
+type stubCacheStats repository.CacheStats
+
+func (s stubCacheStats) CacheStats() repository.CacheStats { return repository.CacheStats(s) }
+
+func TestAdminCache(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		name  string
+		cache repository.CacheStatsReporter
+		want  string
+	}{
+		{"disabled", nil, `{"ok":true,"cache":{"enabled":false,"hits":0,"misses":0}}`},
+		{"enabled", stubCacheStats{Hits: 3, Misses: 1}, `{"ok":true,"cache":{"enabled":true,"hits":3,"misses":1}}`},
+	}
+
+	for _, v := range cases {
+		v := v
+		t.Run(v.name, func(tt *testing.T) {
+			tt.Parallel()
+			g := guard.NewGuard(memory.NewLoginAttemptRepository(), zap.NewNop(), guard.DefaultAccountPolicy, guard.DefaultIPPolicy)
+			r := httptest.NewRequest(http.MethodGet, "/v1/admin/cache", nil)
+			w := httptest.NewRecorder()
+			NewHandler(g, v.cache, nil).Cache(w, r)
+			assert.Equal(tt, http.StatusOK, w.Result().StatusCode)
+			assert.JSONEq(tt, v.want, w.Body.String())
+		})
+	}
+}
+
+// stubPoolStats...固定のpoolの状態を返す
+type stubPoolStats []repository.PoolStats
+
+func (s stubPoolStats) PoolStats() []repository.PoolStats { return s }
+
+func TestAdminDB(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		name  string
+		pools repository.PoolStatsReporter
+		want  string
+	}{
+		{"memory", nil, `{"ok":true,"pools":[]}`},
+		{"mysql", stubPoolStats{{Name: "primary", Healthy: true, MaxOpenConnections: 25, OpenConnections: 2, InUse: 1, Idle: 1}}, `{"ok":true,"pools":[{
+			"name":"primary","healthy":true,"max_open_connections":25,"open_connections":2,"in_use":1,"idle":1,
+			"wait_count":0,"wait_duration_millis":0,"max_idle_closed":0,"max_lifetime_closed":0}]}`},
+	}
+
+	for _, v := range cases {
+		v := v
+		t.Run(v.name, func(tt *testing.T) {
+			tt.Parallel()
+			g := guard.NewGuard(memory.NewLoginAttemptRepository(), zap.NewNop(), guard.DefaultAccountPolicy, guard.DefaultIPPolicy)
+			r := httptest.NewRequest(http.MethodGet, "/v1/admin/db", nil)
+			w := httptest.NewRecorder()
+			NewHandler(g, nil, v.pools).DB(w, r)
+			assert.Equal(tt, http.StatusOK, w.Result().StatusCode)
+			assert.JSONEq(tt, v.want, w.Body.String())
+		})
+	}
+}
@@ -0,0 +1,12 @@
+package v1admin
+
+import (
+	"net/http"
+)
+
+// Handler...interfaceを使うことでDIPを解決する。mockも作成できるようになる
+type Handler interface {
+	Unlock(w http.ResponseWriter, r *http.Request)
+	Cache(w http.ResponseWriter, r *http.Request)
+	DB(w http.ResponseWriter, r *http.Request)
+}
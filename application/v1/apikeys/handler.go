@@ -0,0 +1,139 @@
+package v1apikeys
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/domain/model"
+	"github.com/sioncojp/famili-api/domain/repository"
+	"github.com/sioncojp/famili-api/utils"
+	httpresponse "github.com/sioncojp/famili-api/utils/http_response"
+)
+
+const (
+	ErrorMessageNotFound        = "api_key_not_found"
+	ErrorMessageInvalidProvided = "invalid_api_key_provided"
+	ErrorMessageMissingArgument = "missing_argument"
+	ErrorMessageUnidentified    = "caller_not_identified"
+	ErrorMessageUnauthenticated = "login_required"
+	ErrorValidation             = "missing_validation"
+
+	// secretBytes...keyのsecret部分の長さ
+	secretBytes = 32
+)
+
+var cv = &domain.CustomValidator{}
+
+// handler...
+type handler struct {
+	repo repository.APIKeyRepository
+}
+
+// NewHandler create a instance of this handler
+func NewHandler(repo repository.APIKeyRepository) Handler {
+	return &handler{repo}
+}
+
+// List...callerのAPI keyを取得してhttpを返す. hashや平文は返さない
+func (s *handler) List(w http.ResponseWriter, r *http.Request) {
+	caller := domain.CallerFromContext(r.Context())
+	if caller.MemberId == "" {
+		httpresponse.Error(w, r, http.StatusUnauthorized, ErrorMessageUnidentified, "")
+		return
+	}
+
+	out, err := s.repo.List(caller.MemberId)
+	if err != nil {
+		httpresponse.Error(w, r, http.StatusNotFound, ErrorMessageInvalidProvided, "")
+		return
+	}
+
+	httpresponse.OK(w, r, http.StatusOK, "api_keys", out)
+}
+
+// Create...API keyを発行してhttpを返す. 平文のkeyはこのレスポンスでしか返さない
+// keyは長く使えるcredentialなので、login sessionで認証したcallerにしか発行しない
+func (s *handler) Create(w http.ResponseWriter, r *http.Request) {
+	caller := domain.CallerFromContext(r.Context())
+	if caller.AccountId == "" || caller.MemberId == "" {
+		httpresponse.Error(w, r, http.StatusUnauthorized, ErrorMessageUnauthenticated, "")
+		return
+	}
+
+	result := &model.APIKey{}
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&result); err != nil {
+		httpresponse.Error(w, r, http.StatusBadRequest, ErrorMessageMissingArgument, "")
+		return
+	}
+	if err := cv.Validate(result); err != nil {
+		httpresponse.Validation(w, r, ErrorValidation, err)
+		return
+	}
+
+	key, err := generateKey()
+	if err != nil {
+		httpresponse.Error(w, r, http.StatusInternalServerError, ErrorMessageInvalidProvided, "")
+		return
+	}
+	prefix, _ := model.ParseAPIKeyPrefix(key)
+
+	result.Prefix = prefix
+	result.Hash = model.HashAPIKey(key)
+	result.MemberId = caller.MemberId
+	result.FamilyId = caller.FamilyId
+	result.LastUsedAt = nil
+	result.RevokedAt = nil
+
+	if err := s.repo.Create(result); err != nil {
+		httpresponse.Error(w, r, http.StatusNotFound, ErrorMessageInvalidProvided, "")
+		return
+	}
+
+	result.Key = key
+	httpresponse.OK(w, r, http.StatusCreated, "api_key", result)
+}
+
+// Revoke...API keyを失効させてhttpを返す
+func (s *handler) Revoke(w http.ResponseWriter, r *http.Request) {
+	caller := domain.CallerFromContext(r.Context())
+	if caller.MemberId == "" {
+		httpresponse.Error(w, r, http.StatusUnauthorized, ErrorMessageUnidentified, "")
+		return
+	}
+
+	key, err := s.repo.GetById(domain.Id(chi.URLParam(r, "id")))
+	// 他のメンバーのkeyは存在自体を隠す
+	if err != nil || key.MemberId != caller.MemberId {
+		httpresponse.Error(w, r, http.StatusNotFound, ErrorMessageNotFound, "")
+		return
+	}
+
+	if !key.Revoked() {
+		now := time.Now()
+		key.RevokedAt = &now
+		if err := s.repo.Update(&key); err != nil {
+			httpresponse.Error(w, r, http.StatusNotFound, ErrorMessageInvalidProvided, "")
+			return
+		}
+	}
+
+	httpresponse.OK(w, r, http.StatusOK, "", nil)
+}
+
+// generateKey...fam_<prefix>_<secret> の形式でkeyを生成する
+func generateKey() (string, error) {
+	prefix, err := utils.MakeSecureToken(model.APIKeyPrefixLength)
+	if err != nil {
+		return "", err
+	}
+	secret, err := utils.MakeSecureToken(secretBytes)
+	if err != nil {
+		return "", err
+	}
+	return model.APIKeyPrefix + prefix[:model.APIKeyPrefixLength] + "_" + secret, nil
+}
@@ -0,0 +1,177 @@
+package v1apikeys
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/domain/model"
+)
+
+type TestCase struct {
+	name           string
+	parameter      string
+	httpStatusCode int
+}
+
+var (
+	url    = "/v1/api-keys"
+	caller = domain.Caller{MemberId: "1", FamilyId: "f1"}
+	// session...login sessionで認証したcaller. keyの発行にはAccountIdが要る
+	session = domain.Caller{MemberId: "1", FamilyId: "f1", AccountId: "1"}
+)
+
+func TestAPIKeyList(t *testing.T) {
+	t.Parallel()
+	m := new(MockAPIKeyService)
+	m.On("List", caller.MemberId).Return([]model.APIKey{{Name: "raspberry pi", Hash: "secret"}}, nil)
+	s := NewHandler(m)
+
+	r := httptest.NewRequest(http.MethodGet, url, nil)
+	w := httptest.NewRecorder()
+	s.List(w, r.WithContext(domain.NewCallerContext(r.Context(), caller)))
+
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	assert.NotContains(t, w.Body.String(), "secret", "hash must not be returned")
+}
+
+func TestAPIKeyCreate(t *testing.T) {
+	t.Parallel()
+	cases := []TestCase{
+		{
+			"ok",
+			`{"name":"raspberry pi","scopes":["todos:read","todos:write"]}`,
+			http.StatusCreated,
+		},
+		{
+			"no scopes",
+			`{"name":"raspberry pi","scopes":[]}`,
+			http.StatusBadRequest,
+		},
+		{
+			"unknown scope",
+			`{"name":"raspberry pi","scopes":["admin"]}`,
+			http.StatusBadRequest,
+		},
+		{
+			"name below min size",
+			`{"name":"","scopes":["todos:read"]}`,
+			http.StatusBadRequest,
+		},
+	}
+
+	m := new(MockAPIKeyService)
+	m.On("Create", mock.Anything).Return(nil)
+	s := NewHandler(m)
+
+	for _, v := range cases {
+		v := v
+		t.Run(
+			v.name,
+			func(tt *testing.T) {
+				tt.Parallel()
+				r := httptest.NewRequest(http.MethodPost, url, strings.NewReader(v.parameter))
+				w := httptest.NewRecorder()
+				s.Create(w, r.WithContext(domain.NewCallerContext(r.Context(), session)))
+
+				assert.Equal(tt, v.httpStatusCode, w.Result().StatusCode)
+			},
+		)
+	}
+}
+
+func TestAPIKeyCreateRequiresSession(t *testing.T) {
+	t.Parallel()
+	m := new(MockAPIKeyService)
+	s := NewHandler(m)
+
+	for _, c := range []domain.Caller{{}, caller} {
+		r := httptest.NewRequest(http.MethodPost, url, strings.NewReader(`{"name":"ha","scopes":["todos:read"]}`))
+		w := httptest.NewRecorder()
+		s.Create(w, r.WithContext(domain.NewCallerContext(r.Context(), c)))
+		assert.Equal(t, http.StatusUnauthorized, w.Result().StatusCode)
+		assert.Contains(t, w.Body.String(), ErrorMessageUnauthenticated)
+	}
+	m.AssertNotCalled(t, "Create", mock.Anything)
+}
+
+func TestAPIKeyCreateReturnsKeyOnce(t *testing.T) {
+	t.Parallel()
+	var created *model.APIKey
+	m := new(MockAPIKeyService)
+	m.On("Create", mock.Anything).Run(func(args mock.Arguments) {
+		created = args.Get(0).(*model.APIKey)
+	}).Return(nil)
+	s := NewHandler(m)
+
+	r := httptest.NewRequest(http.MethodPost, url, strings.NewReader(`{"name":"ha","scopes":["todos:read"]}`))
+	w := httptest.NewRecorder()
+	s.Create(w, r.WithContext(domain.NewCallerContext(r.Context(), session)))
+	require.Equal(t, http.StatusCreated, w.Result().StatusCode)
+
+	var body struct {
+		APIKey model.APIKey `json:"api_key"`
+	}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&body))
+
+	prefix, ok := model.ParseAPIKeyPrefix(body.APIKey.Key)
+	require.True(t, ok, "unexpected key format: %s", body.APIKey.Key)
+	assert.Equal(t, created.Prefix, prefix)
+	assert.True(t, created.Matches(body.APIKey.Key))
+	assert.Equal(t, caller.MemberId, created.MemberId)
+}
+
+func TestAPIKeyRevoke(t *testing.T) {
+	t.Parallel()
+	cases := []TestCase{
+		{
+			"ok",
+			"1",
+			http.StatusOK,
+		},
+		{
+			"other member key",
+			"2",
+			http.StatusNotFound,
+		},
+		{
+			"not found",
+			"3",
+			http.StatusNotFound,
+		},
+	}
+
+	m := new(MockAPIKeyService)
+	m.On("GetById", domain.Id("1")).Return(model.APIKey{MemberId: caller.MemberId}, nil)
+	m.On("GetById", domain.Id("2")).Return(model.APIKey{MemberId: "2"}, nil)
+	m.On("GetById", domain.Id("3")).Return(model.APIKey{}, errors.New("record not found"))
+	m.On("Update", mock.MatchedBy(func(key *model.APIKey) bool { return key.Revoked() })).Return(nil)
+	s := NewHandler(m)
+
+	r := chi.NewRouter()
+	r.Delete(url+"/{id}", s.Revoke)
+
+	for _, v := range cases {
+		v := v
+		t.Run(
+			v.name,
+			func(tt *testing.T) {
+				tt.Parallel()
+				req := httptest.NewRequest(http.MethodDelete, url+"/"+v.parameter, nil)
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, req.WithContext(domain.NewCallerContext(req.Context(), caller)))
+
+				assert.Equal(tt, v.httpStatusCode, w.Result().StatusCode)
+			},
+		)
+	}
+}
@@ -0,0 +1,12 @@
+package v1apikeys
+
+import (
+	"net/http"
+)
+
+// Handler...interfaceを使うことでDIPを解決する。mockも作成できるようになる
+type Handler interface {
+	List(w http.ResponseWriter, r *http.Request)
+	Create(w http.ResponseWriter, r *http.Request)
+	Revoke(w http.ResponseWriter, r *http.Request)
+}
@@ -0,0 +1,42 @@
+package v1apikeys
+
+import (
+	"github.com/stretchr/testify/mock"
+
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/domain/model"
+)
+
+type MockAPIKeyService struct {
+	mock.Mock
+}
+
+func (m *MockAPIKeyService) GetById(id domain.Id) (model.APIKey, error) {
+	r := m.Called(id)
+	return r.Get(0).(model.APIKey), r.Error(1)
+}
+
+func (m *MockAPIKeyService) GetByPrefix(prefix string) (model.APIKey, error) {
+	r := m.Called(prefix)
+	return r.Get(0).(model.APIKey), r.Error(1)
+}
+
+func (m *MockAPIKeyService) List(memberId domain.Id) ([]model.APIKey, error) {
+	r := m.Called(memberId)
+	return r.Get(0).([]model.APIKey), r.Error(1)
+}
+
+func (m *MockAPIKeyService) Create(key *model.APIKey) error {
+	r := m.Called(key)
+	return r.Error(0)
+}
+
+func (m *MockAPIKeyService) Update(key *model.APIKey) error {
+	r := m.Called(key)
+	return r.Error(0)
+}
+
+func (m *MockAPIKeyService) TouchLastUsed(key *model.APIKey) error {
+	r := m.Called(key)
+	return r.Error(0)
+}
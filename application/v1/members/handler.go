@@ -0,0 +1,66 @@
+package v1members
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/domain/model"
+	"github.com/sioncojp/famili-api/domain/repository"
+	httpresponse "github.com/sioncojp/famili-api/utils/http_response"
+)
+
+const (
+	ErrorMessageInvalidProvided = "invalid_member_provided"
+	ErrorMessageMissingArgument = "missing_argument"
+	ErrorValidation             = "missing_validation"
+)
+
+var cv = &domain.CustomValidator{}
+
+// messages...repositoryのerrorを返すときのerror message. それ以外のstatusはhttpresponseのdefaultを使う
+var messages = httpresponse.Messages{
+	http.StatusBadRequest: ErrorValidation,
+}
+
+// handler...
+type handler struct {
+	repo repository.MemberRepository
+}
+
+// NewHandler create a instance of this handler
+func NewHandler(repo repository.MemberRepository) Handler {
+	return &handler{repo}
+}
+
+// List...callerのfamilyのメンバーを取得してhttpを返す
+func (s *handler) List(w http.ResponseWriter, r *http.Request) {
+	out, err := s.repo.List(r.Context(), domain.CallerFromContext(r.Context()).FamilyId)
+	if err != nil {
+		httpresponse.FromError(w, r, err, messages)
+		return
+	}
+
+	httpresponse.OK(w, r, http.StatusOK, "members", out)
+}
+
+// Create...callerのfamilyにメンバーを作成してhttpを返す
+func (s *handler) Create(w http.ResponseWriter, r *http.Request) {
+	result := &model.Member{}
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&result); err != nil {
+		httpresponse.Error(w, r, http.StatusBadRequest, ErrorMessageMissingArgument, "")
+		return
+	}
+	if err := cv.Validate(result); err != nil {
+		httpresponse.FromError(w, r, err, messages)
+		return
+	}
+	result.FamilyId = domain.CallerFromContext(r.Context()).FamilyId
+
+	if err := s.repo.Create(r.Context(), result); err != nil {
+		httpresponse.FromError(w, r, err, messages)
+		return
+	}
+	httpresponse.OK(w, r, http.StatusCreated, "member", result)
+}
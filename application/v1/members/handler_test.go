@@ -0,0 +1,90 @@
+package v1members
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/domain/model"
+	"github.com/sioncojp/famili-api/utils"
+)
+
+type TestCase struct {
+	name           string
+	parameter      string
+	httpStatusCode int
+}
+
+var (
+	url    = "/v1/members"
+	caller = domain.Caller{MemberId: "1", FamilyId: "f1"}
+)
+
+func TestMemberList(t *testing.T) {
+	t.Parallel()
+	data := []model.Member{
+		{Name: "papa", FamilyId: caller.FamilyId},
+		{Name: "mama", FamilyId: caller.FamilyId},
+	}
+
+	m := new(MockMemberService)
+	m.On("List", mock.Anything, caller.FamilyId).Return(data, nil)
+	s := NewHandler(m)
+
+	r := httptest.NewRequest(http.MethodGet, url, nil)
+	w := httptest.NewRecorder()
+	s.List(w, r.WithContext(domain.NewCallerContext(r.Context(), caller)))
+
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+}
+
+func TestMemberCreate(t *testing.T) {
+	t.Parallel()
+	cases := []TestCase{
+		{
+			"ok",
+			`{"name":"papa"}`,
+			http.StatusCreated,
+		},
+		{
+			"name above max size",
+			fmt.Sprintf(`{"name":"%s"}`, utils.MakeRandomString(51)),
+			http.StatusBadRequest,
+		},
+		{
+			"name below min size",
+			`{"name":""}`,
+			http.StatusBadRequest,
+		},
+	}
+
+	data := &model.Member{
+		Name:     "papa",
+		FamilyId: caller.FamilyId,
+	}
+
+	m := new(MockMemberService)
+	m.On("Create", mock.Anything, data).Return(nil).Once()
+	s := NewHandler(m)
+
+	for _, v := range cases {
+		v := v
+		t.Run(
+			v.name,
+			func(tt *testing.T) {
+				json := strings.NewReader(v.parameter)
+				r := httptest.NewRequest(http.MethodPost, url, json)
+				w := httptest.NewRecorder()
+				s.Create(w, r.WithContext(domain.NewCallerContext(r.Context(), caller)))
+
+				assert.Equal(tt, v.httpStatusCode, w.Result().StatusCode)
+			},
+		)
+	}
+}
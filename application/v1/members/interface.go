@@ -0,0 +1,11 @@
+package v1members
+
+import (
+	"net/http"
+)
+
+// Handler...interfaceを使うことでDIPを解決する。mockも作成できるようになる
+type Handler interface {
+	List(w http.ResponseWriter, r *http.Request)
+	Create(w http.ResponseWriter, r *http.Request)
+}
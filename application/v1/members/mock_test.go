@@ -0,0 +1,29 @@
+package v1members
+
+import (
+	"context"
+
+	"github.com/stretchr/testify/mock"
+
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/domain/model"
+)
+
+type MockMemberService struct {
+	mock.Mock
+}
+
+func (m *MockMemberService) List(ctx context.Context, familyId domain.Id) ([]model.Member, error) {
+	r := m.Called(ctx, familyId)
+	return r.Get(0).([]model.Member), r.Error(1)
+}
+
+func (m *MockMemberService) ListByIds(ctx context.Context, ids []uint) ([]model.Member, error) {
+	r := m.Called(ctx, ids)
+	return r.Get(0).([]model.Member), r.Error(1)
+}
+
+func (m *MockMemberService) Create(ctx context.Context, member *model.Member) error {
+	r := m.Called(ctx, member)
+	return r.Error(0)
+}
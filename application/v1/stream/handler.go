@@ -0,0 +1,130 @@
+package v1stream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/infrastructure/stream"
+	httpresponse "github.com/sioncojp/famili-api/utils/http_response"
+)
+
+const (
+	ErrorMessageUnidentified = "caller_not_identified"
+	ErrorMessageUnsupported  = "streaming_unsupported"
+
+	// eventReset...Last-Event-IDの続きを返せないときに送る. clientはGET /v1/todosで読み直す
+	eventReset = "reset"
+
+	// retryMillis...切れたときにEventSourceが再接続するまでの時間
+	retryMillis = 3000
+)
+
+// connContextKey...ConnContextで覚えたnet.Connのkey
+type connContextKey struct{}
+
+// ConnContext...http.ServerのConnContextに渡す. streamの間だけWriteTimeoutを延ばすためにnet.Connを覚える
+func ConnContext(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connContextKey{}, c)
+}
+
+// handler...
+type handler struct {
+	broker *stream.Broker
+	// heartbeat...この間隔でcommentを送り、proxyやload balancerに切られないようにする
+	heartbeat time.Duration
+	// writeTimeout...1回の書き込みの上限. 受け取らないclientのstreamはこれで閉じる
+	writeTimeout time.Duration
+}
+
+// NewHandler create a instance of this handler
+func NewHandler(broker *stream.Broker, heartbeat, writeTimeout time.Duration) Handler {
+	return &handler{broker, heartbeat, writeTimeout}
+}
+
+// Todos...callerが見れるtodoの変更をSSEで送り続ける
+// Last-Event-IDがあれば続きから送り直し、続きがなければresetを送る
+func (s *handler) Todos(w http.ResponseWriter, r *http.Request) {
+	caller := domain.CallerFromContext(r.Context())
+	if caller.MemberId == "" && caller.FamilyId == "" {
+		httpresponse.Error(w, r, http.StatusUnauthorized, ErrorMessageUnidentified, "")
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		httpresponse.Error(w, r, http.StatusInternalServerError, ErrorMessageUnsupported, "")
+		return
+	}
+
+	sub, replay, ok := s.broker.Subscribe(r.Header.Get("Last-Event-ID"))
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// nginxがbufferingして届かなくなるのを防ぐ
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	conn, _ := r.Context().Value(connContextKey{}).(net.Conn)
+	write := func(format string, args ...interface{}) bool {
+		// serverのWriteTimeoutの代わりに、書き込むたびに期限を延ばす
+		if conn != nil {
+			conn.SetWriteDeadline(time.Now().Add(s.writeTimeout))
+		}
+		if _, err := fmt.Fprintf(w, format, args...); err != nil {
+			return false
+		}
+		flusher.Flush()
+		return true
+	}
+	send := func(msg stream.Message) bool {
+		if !msg.Event.Todo.VisibleTo(caller) {
+			return true
+		}
+		data, err := json.Marshal(msg.Event)
+		if err != nil {
+			return false
+		}
+		return write("id: %s\nevent: %s\ndata: %s\n\n", msg.ID, msg.Event.Type, data)
+	}
+
+	if !write("retry: %d\n\n", retryMillis) {
+		return
+	}
+	if !ok && !write("event: %s\ndata: {}\n\n", eventReset) {
+		return
+	}
+	for _, v := range replay {
+		if !send(v) {
+			return
+		}
+	}
+
+	ticker := time.NewTicker(s.heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case msg, ok := <-sub.C:
+			// 受け取りが遅れたか、shutdownで閉じた. clientはLast-Event-IDで再接続する
+			if !ok || !send(msg) {
+				return
+			}
+		case <-ticker.C:
+			if !write(": heartbeat\n\n") {
+				return
+			}
+		}
+	}
+}
+
+// Shutdown...開いている全てのstreamを閉じる
+func (s *handler) Shutdown() {
+	s.broker.Close()
+}
@@ -0,0 +1,212 @@
+package v1stream
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/domain/model"
+	"github.com/sioncojp/famili-api/infrastructure/stream"
+)
+
+var (
+	ctx    = context.Background()
+	url    = "/v1/todos/stream"
+	caller = domain.Caller{MemberId: "1", FamilyId: "f1"}
+)
+
+// sseEvent...SSEの1つのevent. commentはheartbeat
+type sseEvent struct {
+	id      string
+	event   string
+	data    string
+	comment string
+	retry   string
+}
+
+// newServer...WriteTimeoutを短くしたserverでstreamを開く
+func newServer(t *testing.T, s Handler, c domain.Caller) *httptest.Server {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Todos(w, r.WithContext(domain.NewCallerContext(r.Context(), c)))
+	}))
+	server.Config.WriteTimeout = 200 * time.Millisecond
+	server.Config.ConnContext = ConnContext
+	server.Start()
+	t.Cleanup(server.Close)
+	return server
+}
+
+// open...streamを開き、読んだeventをchannelで返す. streamが閉じたらchannelも閉じる
+func open(t *testing.T, server *httptest.Server, lastEventId string) (*http.Response, <-chan sseEvent) {
+	req, err := http.NewRequest(http.MethodGet, server.URL+url, nil)
+	require.NoError(t, err)
+	if lastEventId != "" {
+		req.Header.Set("Last-Event-ID", lastEventId)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+
+	ch := make(chan sseEvent, 100)
+	go func() {
+		defer close(ch)
+		scanner := bufio.NewScanner(resp.Body)
+		var e sseEvent
+		for scanner.Scan() {
+			line := scanner.Text()
+			if line == "" {
+				ch <- e
+				e = sseEvent{}
+				continue
+			}
+			field, value, _ := strings.Cut(line, ":")
+			value = strings.TrimPrefix(value, " ")
+			switch field {
+			case "":
+				e.comment = value
+			case "id":
+				e.id = value
+			case "event":
+				e.event = value
+			case "data":
+				e.data = value
+			case "retry":
+				e.retry = value
+			}
+		}
+	}()
+	return resp, ch
+}
+
+// next...heartbeat以外の次のeventを待つ
+func next(t *testing.T, ch <-chan sseEvent) sseEvent {
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case e, ok := <-ch:
+			require.True(t, ok, "stream closed")
+			if e.comment == "" {
+				return e
+			}
+		case <-timeout:
+			require.FailNow(t, "timeout")
+		}
+	}
+}
+
+func todoEvent(id uint, t model.EventType, todo model.Todo) model.Event {
+	todo.ID = id
+	return model.Event{ID: id, Type: t, TodoId: id, FamilyId: todo.FamilyId, Todo: todo}
+}
+
+func TestStreamVisibility(t *testing.T) {
+	t.Parallel()
+	broker := stream.NewBroker(100, 10)
+	s := NewHandler(broker, 50*time.Millisecond, time.Second)
+	resp, ch := open(t, newServer(t, s, caller), "")
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "3000", next(t, ch).retry)
+
+	// 他のメンバーのprivateなtodoと、他のfamilyのtodoは送らない
+	events := []model.Event{
+		todoEvent(1, model.EventTodoCreated, model.Todo{FamilyId: "f1", CreatedBy: "2", Visibility: model.VisibilityPrivate}),
+		todoEvent(2, model.EventTodoCreated, model.Todo{FamilyId: "f2", CreatedBy: "3", Visibility: model.VisibilityFamily}),
+		todoEvent(3, model.EventTodoCompleted, model.Todo{FamilyId: "f1", CreatedBy: "2", Visibility: model.VisibilityFamily}),
+		todoEvent(4, model.EventTodoDeleted, model.Todo{FamilyId: "f1", CreatedBy: "1", Visibility: model.VisibilityPrivate}),
+	}
+	for _, v := range events {
+		require.NoError(t, broker.Send(ctx, v))
+	}
+
+	e := next(t, ch)
+	assert.Equal(t, "todo.completed", e.event)
+	assert.Contains(t, e.data, `"todo_id":3`)
+	e = next(t, ch)
+	assert.Equal(t, "todo.deleted", e.event)
+	assert.Contains(t, e.data, `"todo_id":4`)
+}
+
+func TestStreamOutlivesWriteTimeout(t *testing.T) {
+	t.Parallel()
+	broker := stream.NewBroker(100, 10)
+	s := NewHandler(broker, 50*time.Millisecond, time.Second)
+	_, ch := open(t, newServer(t, s, caller), "")
+	next(t, ch)
+
+	// serverのWriteTimeoutを過ぎてもheartbeatを送りながら開いたまま
+	time.Sleep(500 * time.Millisecond)
+	heartbeats := 0
+	for len(ch) > 0 {
+		if v := <-ch; v.comment == "heartbeat" {
+			heartbeats++
+		}
+	}
+	assert.Greater(t, heartbeats, 0)
+
+	require.NoError(t, broker.Send(ctx, todoEvent(1, model.EventTodoUpdated, model.Todo{FamilyId: "f1", Visibility: model.VisibilityFamily})))
+	assert.Equal(t, "todo.updated", next(t, ch).event)
+}
+
+func TestStreamResume(t *testing.T) {
+	t.Parallel()
+	broker := stream.NewBroker(2, 10)
+	s := NewHandler(broker, time.Second, time.Second)
+	server := newServer(t, s, caller)
+	family := model.Todo{FamilyId: "f1", Visibility: model.VisibilityFamily}
+
+	resp, ch := open(t, server, "")
+	next(t, ch)
+	require.NoError(t, broker.Send(ctx, todoEvent(1, model.EventTodoCreated, family)))
+	first := next(t, ch)
+	resp.Body.Close()
+
+	// 切れている間のeventをLast-Event-IDの続きから受け取る
+	require.NoError(t, broker.Send(ctx, todoEvent(2, model.EventTodoUpdated, family)))
+	require.NoError(t, broker.Send(ctx, todoEvent(3, model.EventTodoCompleted, family)))
+	_, ch = open(t, server, first.id)
+	next(t, ch)
+	assert.Equal(t, "todo.updated", next(t, ch).event)
+	assert.Equal(t, "todo.completed", next(t, ch).event)
+
+	// 続きがbufferから消えていたらresetを送り、そこから新しいeventを送る
+	require.NoError(t, broker.Send(ctx, todoEvent(4, model.EventTodoDeleted, family)))
+	_, ch = open(t, server, first.id)
+	next(t, ch)
+	assert.Equal(t, "reset", next(t, ch).event)
+	require.NoError(t, broker.Send(ctx, todoEvent(5, model.EventTodoCreated, family)))
+	assert.Equal(t, "todo.created", next(t, ch).event)
+}
+
+func TestStreamShutdown(t *testing.T) {
+	t.Parallel()
+	broker := stream.NewBroker(100, 10)
+	s := NewHandler(broker, time.Second, time.Second)
+	_, ch := open(t, newServer(t, s, caller), "")
+	next(t, ch)
+
+	// shutdownしたらstreamを閉じる
+	s.Shutdown()
+	select {
+	case _, ok := <-ch:
+		assert.False(t, ok)
+	case <-time.After(2 * time.Second):
+		t.Fatal("stream was not closed")
+	}
+}
+
+func TestStreamUnidentified(t *testing.T) {
+	t.Parallel()
+	s := NewHandler(stream.NewBroker(100, 10), time.Second, time.Second)
+	r := httptest.NewRequest(http.MethodGet, url, nil)
+	w := httptest.NewRecorder()
+	s.Todos(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Result().StatusCode)
+}
@@ -0,0 +1,12 @@
+package v1stream
+
+import (
+	"net/http"
+)
+
+// Handler...interfaceを使うことでDIPを解決する。mockも作成できるようになる
+type Handler interface {
+	Todos(w http.ResponseWriter, r *http.Request)
+	// Shutdown...開いている全てのstreamを閉じる. http.ServerのRegisterOnShutdownに渡す
+	Shutdown()
+}
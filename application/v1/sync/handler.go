@@ -0,0 +1,447 @@
+package v1sync
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pkg/errors"
+
+	"github.com/sioncojp/famili-api/application/todoservice"
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/domain/model"
+	"github.com/sioncojp/famili-api/domain/repository"
+	httpresponse "github.com/sioncojp/famili-api/utils/http_response"
+	"github.com/sioncojp/famili-api/utils/i18n"
+)
+
+const (
+	ErrorMessageUnidentified    = "caller_not_identified"
+	ErrorMessageNotFound        = "todo_not_found"
+	ErrorMessageMissingArgument = "missing_argument"
+	ErrorValidation             = "missing_validation"
+	ErrorMessageInvalidToken    = "invalid_sync_token"
+
+	// OpCreate, OpUpdate, OpDelete...POST /v1/syncで送れる変更
+	OpCreate = "create"
+	OpUpdate = "update"
+	OpDelete = "delete"
+
+	// defaultLimit, maxLimit...1回のresponseで返す変更の数
+	defaultLimit = 100
+	maxLimit     = 500
+	// maxMutations...1回のPOSTで送れる変更の数
+	maxMutations = 100
+	// maxClockSkew...client_timeがserverの時刻よりこれ以上先なら時計がずれているので断る
+	maxClockSkew = 5 * time.Minute
+)
+
+// messages...repositoryのerrorを返すときのerror message. RESTのtodoと揃える
+var messages = httpresponse.Messages{
+	http.StatusNotFound:   ErrorMessageNotFound,
+	http.StatusBadRequest: ErrorValidation,
+}
+
+// handler...
+type handler struct {
+	repo    repository.TodoRepository
+	changes repository.TodoChangeRepository
+	tx      repository.TxManager
+	now     func() time.Time
+}
+
+// change...responseのchangesの1件. deletedならtodoは無く、clientは手元のtodoを消す
+type change struct {
+	TodoId  uint        `json:"todo_id"`
+	Deleted bool        `json:"deleted"`
+	Todo    *model.Todo `json:"todo,omitempty"`
+}
+
+// syncResponse...GET, POST /v1/syncのresponse. 次は返したtokenをsinceに渡す
+type syncResponse struct {
+	Token   string           `json:"token"`
+	HasMore bool             `json:"has_more"`
+	Changes []change         `json:"changes"`
+	Results []mutationResult `json:"results,omitempty"`
+}
+
+// mutation...POST /v1/syncで送る変更の1件. todo fieldsは省略したら今の値を引き継ぐ
+type mutation struct {
+	// ClientId...clientが振る変更のID. 同じIDを送り直しても1回しか反映しない
+	ClientId string `json:"client_id"`
+	Op       string `json:"op"`
+	TodoId   uint   `json:"todo_id"`
+	// TodoClientId...まだIDを知らないtodoを、createしたときのclient_idで指定する
+	TodoClientId string `json:"todo_client_id"`
+	// ClientTime...clientで変更した時刻. update, deleteはserverの最後の書き込みより後でなければconflictになる
+	ClientTime  time.Time         `json:"client_time"`
+	Title       *string           `json:"title"`
+	Description *string           `json:"description"`
+	Completed   *bool             `json:"completed"`
+	Position    *int              `json:"position"`
+	Visibility  *model.Visibility `json:"visibility"`
+}
+
+// pushRequest...POST /v1/syncのbody. sinceより後の変更をresponseで返す
+type pushRequest struct {
+	Since     string     `json:"since"`
+	Mutations []mutation `json:"mutations"`
+}
+
+// mutationResult...変更1件の結果. conflictならtodoかdeletedがserverの今の値
+type mutationResult struct {
+	ClientId string           `json:"client_id"`
+	Status   model.SyncStatus `json:"status"`
+	TodoId   uint             `json:"todo_id,omitempty"`
+	Todo     *model.Todo      `json:"todo,omitempty"`
+	Deleted  bool             `json:"deleted,omitempty"`
+	Error    string           `json:"error,omitempty"`
+	Warn     string           `json:"warn,omitempty"`
+}
+
+// NewHandler create a instance of this handler
+// todoの変更はRESTと同じtodoserviceのWriterで、client_idの記録と同じtransactionに書き込む
+func NewHandler(repo repository.TodoRepository, changes repository.TodoChangeRepository, tx repository.TxManager) Handler {
+	return &handler{repo: repo, changes: changes, tx: tx, now: time.Now}
+}
+
+// Changes...sinceより後の変更を返す. sinceが無ければcallerが見れる全てのtodoを返す
+func (s *handler) Changes(w http.ResponseWriter, r *http.Request) {
+	caller := domain.CallerFromContext(r.Context())
+	if caller.MemberId == "" {
+		httpresponse.Error(w, r, http.StatusUnauthorized, ErrorMessageUnidentified, "")
+		return
+	}
+
+	limit := defaultLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxLimit {
+			httpresponse.FromError(w, r, domain.NewValidationError(validation.Errors{
+				"limit": i18n.NewError(i18n.Between).SetParams(map[string]interface{}{"min": 1, "max": maxLimit}),
+			}), messages)
+			return
+		}
+		limit = n
+	}
+
+	out, err := s.since(r.Context(), caller, r.URL.Query().Get("since"), limit)
+	if errors.Is(err, model.ErrInvalidSyncToken) {
+		httpresponse.Error(w, r, http.StatusBadRequest, ErrorMessageInvalidToken, "")
+		return
+	}
+	if err != nil {
+		httpresponse.FromError(w, r, err, messages)
+		return
+	}
+
+	httpresponse.OK(w, r, http.StatusOK, "sync", out)
+}
+
+// Push...clientの変更を1件ずつ反映し、結果とsinceより後の変更を返す
+// 途中でDBのerrorになったら、それまでの変更は反映したまま返す. 同じclient_idで送り直せば残りだけ反映される
+func (s *handler) Push(w http.ResponseWriter, r *http.Request) {
+	caller := domain.CallerFromContext(r.Context())
+	if caller.MemberId == "" {
+		httpresponse.Error(w, r, http.StatusUnauthorized, ErrorMessageUnidentified, "")
+		return
+	}
+
+	body := &pushRequest{}
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		httpresponse.Error(w, r, http.StatusBadRequest, ErrorMessageMissingArgument, "")
+		return
+	}
+	if body.Since != "" {
+		if _, err := model.ParseSyncToken(body.Since); err != nil {
+			httpresponse.Error(w, r, http.StatusBadRequest, ErrorMessageInvalidToken, "")
+			return
+		}
+	}
+	if len(body.Mutations) > maxMutations {
+		httpresponse.FromError(w, r, domain.NewValidationError(validation.Errors{
+			"mutations": i18n.NewError(i18n.ItemsTooMany).SetParams(map[string]interface{}{"max": maxMutations}),
+		}), messages)
+		return
+	}
+
+	results := make([]mutationResult, 0, len(body.Mutations))
+	for _, v := range body.Mutations {
+		result, err := s.apply(r.Context(), caller, v)
+		if err != nil {
+			httpresponse.FromError(w, r, err, messages)
+			return
+		}
+		results = append(results, result)
+	}
+
+	out, err := s.since(r.Context(), caller, body.Since, maxLimit)
+	if err != nil {
+		httpresponse.FromError(w, r, err, messages)
+		return
+	}
+	out.Results = results
+
+	httpresponse.OK(w, r, http.StatusOK, "sync", out)
+}
+
+// since...tokenより後の変更をlimit件返す. 見れなくなったtodoは削除と同じtombstoneにする
+func (s *handler) since(ctx context.Context, caller domain.Caller, token string, limit int) (syncResponse, error) {
+	if token == "" {
+		return s.snapshot(ctx, caller)
+	}
+	seq, err := model.ParseSyncToken(token)
+	if err != nil {
+		return syncResponse{}, err
+	}
+
+	// 1件多く取って、続きがあるかを確かめる
+	found, err := s.changes.Since(ctx, caller, seq, limit+1)
+	if err != nil {
+		return syncResponse{}, err
+	}
+	out := syncResponse{Changes: make([]change, 0, len(found))}
+	if len(found) > limit {
+		found = found[:limit]
+		out.HasMore = true
+	}
+	for _, v := range found {
+		if v.Deleted || !v.Todo.VisibleTo(caller) {
+			out.Changes = append(out.Changes, change{TodoId: v.TodoId, Deleted: true})
+			continue
+		}
+		todo := v.Todo
+		out.Changes = append(out.Changes, change{TodoId: v.TodoId, Todo: &todo})
+	}
+	if len(found) > 0 {
+		seq = found[len(found)-1].Seq
+	}
+	out.Token = model.NewSyncToken(seq)
+	return out, nil
+}
+
+// snapshot...初回の同期. 先にseqを取るので、一覧を取る間の変更は次の同期でもう一度返る
+func (s *handler) snapshot(ctx context.Context, caller domain.Caller) (syncResponse, error) {
+	seq, err := s.changes.Latest(ctx)
+	if err != nil {
+		return syncResponse{}, err
+	}
+	todos, err := s.repo.List(ctx, caller)
+	if err != nil {
+		return syncResponse{}, err
+	}
+
+	out := syncResponse{Token: model.NewSyncToken(seq), Changes: make([]change, 0, len(todos))}
+	for i := range todos {
+		out.Changes = append(out.Changes, change{TodoId: todos[i].ID, Todo: &todos[i]})
+	}
+	return out, nil
+}
+
+// apply...変更1件を1つのtransactionで反映し、結果を記録する. 返すerrorはDBなどのerrorだけ
+func (s *handler) apply(ctx context.Context, caller domain.Caller, m mutation) (mutationResult, error) {
+	result := mutationResult{ClientId: m.ClientId}
+	if m.ClientId == "" {
+		result.reject(ctx, domain.NewValidationError(validation.Errors{"client_id": validation.ErrRequired}))
+		return result, nil
+	}
+
+	err := s.tx.Do(ctx, func(ctx context.Context, repos repository.Repositories) error {
+		// 同じclient_idは反映せずに前の結果を返す
+		prev, err := repos.SyncMutations.Get(ctx, caller.MemberId, m.ClientId)
+		if err == nil {
+			result = replay(ctx, repos, caller, prev)
+			return nil
+		}
+		if !errors.Is(err, domain.ErrNotFound) {
+			return err
+		}
+
+		switch m.Op {
+		case OpCreate:
+			result, err = s.create(ctx, repos, caller, m)
+		case OpUpdate:
+			result, err = s.update(ctx, repos, caller, m)
+		case OpDelete:
+			result, err = s.delete(ctx, repos, caller, m)
+		default:
+			err = result.reject(ctx, domain.NewValidationError(validation.Errors{"op": i18n.NewError(i18n.EnumInvalid).SetParams(map[string]interface{}{
+				"values": strings.Join([]string{OpCreate, OpUpdate, OpDelete}, ", "),
+			})}))
+		}
+		if err != nil {
+			return err
+		}
+		return repos.SyncMutations.Save(ctx, &model.SyncMutation{
+			MemberId: caller.MemberId,
+			ClientId: m.ClientId,
+			TodoId:   result.TodoId,
+			Status:   result.Status,
+		})
+	})
+	return result, err
+}
+
+// create...todoを作る. RESTのPOST /v1/todosと同じく未完了で作り、作成者とfamilyはcallerにする
+func (s *handler) create(ctx context.Context, repos repository.Repositories, caller domain.Caller, m mutation) (mutationResult, error) {
+	result := mutationResult{ClientId: m.ClientId}
+	todo := &model.Todo{Visibility: model.VisibilityFamily}
+	m.applyTo(todo)
+	if err := todoservice.NewWriter(repos).Create(ctx, caller, todo); err != nil {
+		err = result.reject(ctx, err)
+		return result, err
+	}
+	result.applied(*todo)
+	return result, nil
+}
+
+// update...client_timeがserverの最後の書き込みより後ならtodoを変える. 消えていればconflictでdeletedを返す
+func (s *handler) update(ctx context.Context, repos repository.Repositories, caller domain.Caller, m mutation) (mutationResult, error) {
+	result := mutationResult{ClientId: m.ClientId}
+	todo, err := s.target(ctx, repos, caller, m)
+	if errors.Is(err, domain.ErrNotFound) && m.TodoClientId == "" {
+		result.Status = model.SyncConflict
+		result.TodoId = m.TodoId
+		result.Deleted = true
+		return result, nil
+	}
+	if err != nil {
+		err = result.reject(ctx, err)
+		return result, err
+	}
+	if !todo.AcceptsChangeAt(m.ClientTime) {
+		result.conflict(todo)
+		return result, nil
+	}
+
+	next := todo
+	m.applyTo(&next)
+	if err := todoservice.NewWriter(repos).Update(ctx, &todo, next); err != nil {
+		err = result.reject(ctx, err)
+		return result, err
+	}
+	result.applied(todo)
+	return result, nil
+}
+
+// delete...client_timeがserverの最後の書き込みより後ならtodoを消す. 既に消えていればそのままappliedにする
+func (s *handler) delete(ctx context.Context, repos repository.Repositories, caller domain.Caller, m mutation) (mutationResult, error) {
+	result := mutationResult{ClientId: m.ClientId}
+	todo, err := s.target(ctx, repos, caller, m)
+	if errors.Is(err, domain.ErrNotFound) && m.TodoClientId == "" {
+		result.Status = model.SyncApplied
+		result.TodoId = m.TodoId
+		result.Deleted = true
+		return result, nil
+	}
+	if err != nil {
+		err = result.reject(ctx, err)
+		return result, err
+	}
+	if !todo.AcceptsChangeAt(m.ClientTime) {
+		result.conflict(todo)
+		return result, nil
+	}
+
+	if err := todoservice.NewWriter(repos).Delete(ctx, &todo); err != nil {
+		return result, err
+	}
+	result.Status = model.SyncApplied
+	result.TodoId = todo.ID
+	result.Deleted = true
+	return result, nil
+}
+
+// target...update, deleteするtodoを取得する. 見れないtodoは存在自体を隠すためnot foundにする
+func (s *handler) target(ctx context.Context, repos repository.Repositories, caller domain.Caller, m mutation) (model.Todo, error) {
+	if err := m.validateTime(s.now()); err != nil {
+		return model.Todo{}, err
+	}
+
+	id := m.TodoId
+	if id == 0 && m.TodoClientId != "" {
+		created, err := repos.SyncMutations.Get(ctx, caller.MemberId, m.TodoClientId)
+		if err != nil {
+			return model.Todo{}, err
+		}
+		if created.Status != model.SyncApplied || created.TodoId == 0 {
+			return model.Todo{}, errors.Wrapf(domain.ErrNotFound, "todo_client_id %s", m.TodoClientId)
+		}
+		id = created.TodoId
+	}
+	return todoservice.Visible(ctx, repos.Todos, caller, id)
+}
+
+// replay...前に反映した変更の結果を、todoの今の値で返す
+func replay(ctx context.Context, repos repository.Repositories, caller domain.Caller, prev model.SyncMutation) mutationResult {
+	result := mutationResult{ClientId: prev.ClientId, Status: prev.Status, TodoId: prev.TodoId}
+	if prev.TodoId == 0 {
+		return result
+	}
+	todo, err := repos.Todos.GetById(ctx, domain.Id(strconv.FormatUint(uint64(prev.TodoId), 10)))
+	if err != nil || !todo.VisibleTo(caller) {
+		result.Deleted = true
+		return result
+	}
+	result.Todo = &todo
+	return result
+}
+
+// applyTo...送られたfieldだけtodoに反映する
+func (m mutation) applyTo(todo *model.Todo) {
+	if m.Title != nil {
+		todo.Title = *m.Title
+	}
+	if m.Description != nil {
+		todo.Description = *m.Description
+	}
+	if m.Completed != nil {
+		todo.Completed = *m.Completed
+	}
+	if m.Position != nil {
+		todo.Position = *m.Position
+	}
+	if m.Visibility != nil {
+		todo.Visibility = *m.Visibility
+	}
+}
+
+// validateTime...update, deleteにはclient_timeが必要で、serverの時刻からmaxClockSkew以上先であってはいけない
+func (m mutation) validateTime(now time.Time) error {
+	if m.ClientTime.IsZero() {
+		return domain.NewValidationError(validation.Errors{"client_time": validation.ErrRequired})
+	}
+	if m.ClientTime.After(now.Add(maxClockSkew)) {
+		return domain.NewValidationError(validation.Errors{"client_time": i18n.NewError(i18n.NotFuture)})
+	}
+	return nil
+}
+
+// reject...errをrejectedにする. validation, not found以外のerrorはそのまま返してtransactionを戻す
+func (r *mutationResult) reject(ctx context.Context, err error) error {
+	if !domain.IsValidation(err) && !errors.Is(err, domain.ErrNotFound) {
+		return err
+	}
+	_, r.Error, r.Warn = httpresponse.Describe(ctx, err, messages)
+	r.Status = model.SyncRejected
+	return nil
+}
+
+// applied...反映したtodoを結果に入れる
+func (r *mutationResult) applied(todo model.Todo) {
+	r.Status = model.SyncApplied
+	r.TodoId = todo.ID
+	r.Todo = &todo
+}
+
+// conflict...serverの方が新しいので、serverの今の値を結果に入れる
+func (r *mutationResult) conflict(todo model.Todo) {
+	r.Status = model.SyncConflict
+	r.TodoId = todo.ID
+	r.Todo = &todo
+}
@@ -0,0 +1,289 @@
+package v1sync
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sioncojp/famili-api/application/todoservice/todotest"
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/domain/model"
+)
+
+var (
+	ctx             = context.Background()
+	caller, sibling = todotest.Caller, todotest.Sibling
+)
+
+// response...GET, POST /v1/syncのresponse
+type response struct {
+	Ok    bool         `json:"ok"`
+	Error string       `json:"error"`
+	Warn  string       `json:"warn"`
+	Sync  syncResponse `json:"sync"`
+}
+
+// fixture...todotestのrepositoryを使うhandler
+type fixture struct {
+	*todotest.Fixture
+	handler Handler
+}
+
+func newFixture() *fixture {
+	f := &fixture{Fixture: todotest.NewFixture()}
+	f.handler = NewHandler(f.Todos, f.Changes, f.Tx)
+	return f
+}
+
+// get...callerとしてGET /v1/syncする
+func (f *fixture) get(t *testing.T, c domain.Caller, query string) (int, response) {
+	r := httptest.NewRequest(http.MethodGet, "/v1/sync?"+query, nil)
+	w := httptest.NewRecorder()
+	f.handler.Changes(w, r.WithContext(domain.NewCallerContext(r.Context(), c)))
+	return decode(t, w)
+}
+
+// push...callerとしてPOST /v1/syncする
+func (f *fixture) push(t *testing.T, c domain.Caller, since string, mutations ...map[string]interface{}) (int, response) {
+	b, err := json.Marshal(map[string]interface{}{"since": since, "mutations": mutations})
+	require.NoError(t, err)
+	r := httptest.NewRequest(http.MethodPost, "/v1/sync", strings.NewReader(string(b)))
+	w := httptest.NewRecorder()
+	f.handler.Push(w, r.WithContext(domain.NewCallerContext(r.Context(), c)))
+	return decode(t, w)
+}
+
+func decode(t *testing.T, w *httptest.ResponseRecorder) (int, response) {
+	var out response
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&out))
+	return w.Code, out
+}
+
+// clientTime...serverの最後の書き込みより後の時刻
+func clientTime(d time.Duration) string {
+	return time.Now().Add(d).Format(time.RFC3339Nano)
+}
+
+func TestSyncUnidentified(t *testing.T) {
+	t.Parallel()
+	f := newFixture()
+	status, out := f.get(t, domain.Caller{}, "")
+	assert.Equal(t, http.StatusUnauthorized, status)
+	assert.Equal(t, ErrorMessageUnidentified, out.Error)
+	status, out = f.push(t, domain.Caller{}, "")
+	assert.Equal(t, http.StatusUnauthorized, status)
+	assert.Equal(t, ErrorMessageUnidentified, out.Error)
+}
+
+func TestSyncInvalidRequest(t *testing.T) {
+	t.Parallel()
+	f := newFixture()
+	cases := []struct {
+		name  string
+		query string
+		error string
+	}{
+		{"token", "since=abc", ErrorMessageInvalidToken},
+		{"limit zero", "limit=0", ErrorValidation},
+		{"limit too large", "limit=501", ErrorValidation},
+		{"limit not number", "limit=a", ErrorValidation},
+	}
+	for _, v := range cases {
+		v := v
+		t.Run(v.name, func(tt *testing.T) {
+			tt.Parallel()
+			status, out := f.get(tt, caller, v.query)
+			assert.Equal(tt, http.StatusBadRequest, status)
+			assert.Equal(tt, v.error, out.Error)
+		})
+	}
+
+	status, out := f.push(t, caller, "abc")
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, ErrorMessageInvalidToken, out.Error)
+
+	mutations := make([]map[string]interface{}, maxMutations+1)
+	status, out = f.push(t, caller, "", mutations...)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, ErrorValidation, out.Error)
+	assert.Contains(t, out.Warn, "mutations")
+}
+
+func TestSyncChanges(t *testing.T) {
+	t.Parallel()
+	f := newFixture()
+	a := f.Create(t, caller, "a", model.VisibilityFamily)
+	f.Create(t, sibling, "private", model.VisibilityPrivate)
+
+	// sinceが無ければ見れるtodoを全て返す
+	status, out := f.get(t, caller, "")
+	require.Equal(t, http.StatusOK, status)
+	require.Len(t, out.Sync.Changes, 1)
+	assert.Equal(t, a.ID, out.Sync.Changes[0].TodoId)
+	assert.False(t, out.Sync.HasMore)
+	token := out.Sync.Token
+
+	// 変更が無ければ同じtokenを返す
+	status, out = f.get(t, caller, "since="+token)
+	require.Equal(t, http.StatusOK, status)
+	assert.Empty(t, out.Sync.Changes)
+	assert.Equal(t, token, out.Sync.Token)
+
+	// 別の端末での変更がsinceより後の変更として返る
+	status, out = f.push(t, sibling, "",
+		map[string]interface{}{"client_id": "s1", "op": OpCreate, "title": "b", "description": "b"},
+		map[string]interface{}{"client_id": "s2", "op": OpUpdate, "todo_id": a.ID, "client_time": clientTime(time.Minute), "completed": true},
+		map[string]interface{}{"client_id": "s3", "op": OpCreate, "title": "c", "description": "c"},
+		map[string]interface{}{"client_id": "s4", "op": OpDelete, "todo_client_id": "s3", "client_time": clientTime(time.Minute)},
+	)
+	require.Equal(t, http.StatusOK, status)
+	for _, v := range out.Sync.Results {
+		assert.Equal(t, model.SyncApplied, v.Status, v.ClientId)
+	}
+
+	status, out = f.get(t, caller, "since="+token+"&limit=2")
+	require.Equal(t, http.StatusOK, status)
+	require.Len(t, out.Sync.Changes, 2)
+	assert.True(t, out.Sync.HasMore)
+	assert.Equal(t, "b", out.Sync.Changes[0].Todo.Title)
+	assert.Equal(t, a.ID, out.Sync.Changes[1].TodoId)
+	assert.True(t, out.Sync.Changes[1].Todo.Completed)
+
+	// 削除はtombstoneで返る
+	status, out = f.get(t, caller, "since="+out.Sync.Token)
+	require.Equal(t, http.StatusOK, status)
+	require.Len(t, out.Sync.Changes, 1)
+	assert.True(t, out.Sync.Changes[0].Deleted)
+	assert.Nil(t, out.Sync.Changes[0].Todo)
+	assert.False(t, out.Sync.HasMore)
+
+	// privateにされて見れなくなったtodoもtombstoneになる
+	token = out.Sync.Token
+	status, _ = f.push(t, caller, "",
+		map[string]interface{}{"client_id": "c1", "op": OpUpdate, "todo_id": a.ID, "client_time": clientTime(2 * time.Minute), "visibility": model.VisibilityPrivate},
+	)
+	require.Equal(t, http.StatusOK, status)
+	status, out = f.get(t, sibling, "since="+token)
+	require.Equal(t, http.StatusOK, status)
+	require.Len(t, out.Sync.Changes, 1)
+	assert.Equal(t, a.ID, out.Sync.Changes[0].TodoId)
+	assert.True(t, out.Sync.Changes[0].Deleted)
+}
+
+func TestSyncPush(t *testing.T) {
+	t.Parallel()
+	f := newFixture()
+	a := f.Create(t, caller, "a", model.VisibilityFamily)
+	private := f.Create(t, sibling, "private", model.VisibilityPrivate)
+	id := strconv.FormatUint(uint64(a.ID), 10)
+
+	status, out := f.push(t, caller, "",
+		// 作成はcallerのtodoとして未完了で作る
+		map[string]interface{}{"client_id": "m1", "op": OpCreate, "title": "b", "description": "b", "completed": true, "visibility": model.VisibilityPublic},
+		// serverの最後の書き込みより前の変更はconflictになり、serverの値を返す
+		map[string]interface{}{"client_id": "m2", "op": OpUpdate, "todo_id": a.ID, "client_time": clientTime(-time.Hour), "title": "old"},
+		map[string]interface{}{"client_id": "m3", "op": OpUpdate, "todo_id": a.ID, "client_time": clientTime(time.Minute), "title": "new", "position": 2},
+		map[string]interface{}{"client_id": "m4", "op": OpUpdate, "todo_id": a.ID, "client_time": clientTime(time.Hour), "title": "future"},
+		map[string]interface{}{"client_id": "m5", "op": OpUpdate, "todo_id": 999, "client_time": clientTime(time.Minute), "title": "gone"},
+		map[string]interface{}{"client_id": "m6", "op": OpDelete, "todo_id": 999, "client_time": clientTime(time.Minute)},
+		map[string]interface{}{"client_id": "m7", "op": OpUpdate, "todo_id": private.ID, "client_time": clientTime(time.Minute), "title": "x"},
+		map[string]interface{}{"client_id": "m8", "op": OpCreate, "title": "", "description": "c"},
+		map[string]interface{}{"client_id": "m9", "op": "move"},
+		map[string]interface{}{"client_id": "m10", "op": OpUpdate, "todo_client_id": "unknown", "client_time": clientTime(time.Minute)},
+		map[string]interface{}{"op": OpCreate, "title": "c", "description": "c"},
+	)
+	require.Equal(t, http.StatusOK, status)
+	require.Len(t, out.Sync.Results, 11)
+	results := out.Sync.Results
+
+	assert.Equal(t, model.SyncApplied, results[0].Status)
+	require.NotNil(t, results[0].Todo)
+	assert.False(t, results[0].Todo.Completed)
+	assert.Equal(t, caller.MemberId, results[0].Todo.CreatedBy)
+	assert.NotEmpty(t, results[0].Todo.ShareToken)
+
+	assert.Equal(t, model.SyncConflict, results[1].Status)
+	assert.Equal(t, "a", results[1].Todo.Title)
+
+	assert.Equal(t, model.SyncApplied, results[2].Status)
+	assert.Equal(t, "new", results[2].Todo.Title)
+	assert.Equal(t, 2, results[2].Todo.Position)
+	assert.Equal(t, "a", results[2].Todo.Description)
+
+	assert.Equal(t, model.SyncRejected, results[3].Status)
+	assert.Equal(t, ErrorValidation, results[3].Error)
+	assert.Contains(t, results[3].Warn, "client_time")
+
+	assert.Equal(t, model.SyncConflict, results[4].Status)
+	assert.True(t, results[4].Deleted)
+	assert.Equal(t, model.SyncApplied, results[5].Status)
+	assert.True(t, results[5].Deleted)
+	// 見れないtodoは存在しないものとして扱う
+	assert.Equal(t, model.SyncConflict, results[6].Status)
+	assert.True(t, results[6].Deleted)
+	assert.Nil(t, results[6].Todo)
+
+	assert.Equal(t, model.SyncRejected, results[7].Status)
+	assert.Contains(t, results[7].Warn, "title")
+	assert.Equal(t, model.SyncRejected, results[8].Status)
+	assert.Contains(t, results[8].Warn, "op")
+	assert.Equal(t, model.SyncRejected, results[9].Status)
+	assert.Equal(t, ErrorMessageNotFound, results[9].Error)
+	assert.Equal(t, model.SyncRejected, results[10].Status)
+	assert.Contains(t, results[10].Warn, "client_id")
+
+	todo, err := f.Todos.GetById(ctx, domain.Id(id))
+	require.NoError(t, err)
+	assert.Equal(t, "new", todo.Title)
+
+	// sinceが無ければresponseのchangesは全てのtodo
+	assert.Len(t, out.Sync.Changes, 2)
+
+	// 反映したものだけeventを書き込む
+	assert.Equal(t, []model.EventType{model.EventTodoCreated, model.EventTodoUpdated}, f.EventTypes(t))
+}
+
+func TestSyncPushReplay(t *testing.T) {
+	t.Parallel()
+	f := newFixture()
+	create := map[string]interface{}{"client_id": "m1", "op": OpCreate, "title": "a", "description": "a"}
+	status, out := f.push(t, caller, "", create)
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, model.SyncApplied, out.Sync.Results[0].Status)
+	id := out.Sync.Results[0].TodoId
+
+	// 作成したtodoをclient_idで指定して変更する
+	status, out = f.push(t, caller, out.Sync.Token,
+		create,
+		map[string]interface{}{"client_id": "m2", "op": OpUpdate, "todo_client_id": "m1", "client_time": clientTime(time.Minute), "title": "b"},
+	)
+	require.Equal(t, http.StatusOK, status)
+	require.Len(t, out.Sync.Results, 2)
+
+	// 同じclient_idは反映せず、前の結果を今のtodoで返す
+	assert.Equal(t, model.SyncApplied, out.Sync.Results[0].Status)
+	assert.Equal(t, id, out.Sync.Results[0].TodoId)
+	assert.Equal(t, model.SyncApplied, out.Sync.Results[1].Status)
+	assert.Equal(t, id, out.Sync.Results[1].TodoId)
+	todos, err := f.Todos.List(ctx, caller)
+	require.NoError(t, err)
+	require.Len(t, todos, 1)
+	assert.Equal(t, "b", todos[0].Title)
+
+	// sinceより後の変更には自分の変更も含まれる
+	require.Len(t, out.Sync.Changes, 1)
+	assert.Equal(t, "b", out.Sync.Changes[0].Todo.Title)
+
+	// 別のmemberのclient_idとは区別する
+	status, out = f.push(t, sibling, "", create)
+	require.Equal(t, http.StatusOK, status)
+	assert.NotEqual(t, id, out.Sync.Results[0].TodoId)
+}
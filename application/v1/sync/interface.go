@@ -0,0 +1,11 @@
+package v1sync
+
+import (
+	"net/http"
+)
+
+// Handler...interfaceを使うことでDIPを解決する。mockも作成できるようになる
+type Handler interface {
+	Changes(w http.ResponseWriter, r *http.Request)
+	Push(w http.ResponseWriter, r *http.Request)
+}
@@ -3,11 +3,13 @@ package v1todos
 import (
 	"context"
 	"encoding/json"
-	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/pkg/errors"
 
+	"github.com/sioncojp/famili-api/application/todoservice"
 	"github.com/sioncojp/famili-api/domain"
 	"github.com/sioncojp/famili-api/domain/model"
 	"github.com/sioncojp/famili-api/domain/repository"
@@ -19,18 +21,51 @@ const (
 	ErrorMessageInvalidProvided = "invalid_todo_provided"
 	ErrorMessageMissingArgument = "missing_argument"
 	ErrorValidation             = "missing_validation"
+	ErrorMessageUnidentified    = "caller_not_identified"
+	ErrorMessageAssigneeInvalid = "assignee_not_found"
 )
 
-var cv = &domain.CustomValidator{}
+// messages...repositoryのerrorを返すときのerror message. それ以外のstatusはhttpresponseのdefaultを使う
+var messages = httpresponse.Messages{
+	http.StatusNotFound:   ErrorMessageNotFound,
+	http.StatusBadRequest: ErrorValidation,
+}
 
 // Service...
 type handler struct {
-	repo repository.TodoRepository
+	repo  repository.TodoRepository
+	todos todoservice.Service
+}
+
+// assigneesRequest...PUT /v1/todos/{id}/assignees のbody
+type assigneesRequest struct {
+	AssigneeIds []uint `json:"assignee_ids"`
+}
+
+// SharedTodo...GET /v1/shared/{token} で返すtodo. 認証しなくても見れるので、メンバーやfamily, share tokenは含めない
+type SharedTodo struct {
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Completed   bool      `json:"completed"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// NewSharedTodo...公開してよいfieldだけを取り出す
+func NewSharedTodo(t model.Todo) SharedTodo {
+	return SharedTodo{
+		Title:       t.Title,
+		Description: t.Description,
+		Completed:   t.Completed,
+		CreatedAt:   t.CreatedAt,
+		UpdatedAt:   t.UpdatedAt,
+	}
 }
 
 // NewService create a instance of this service
-func NewHandler(repo repository.TodoRepository) Handler {
-	return &handler{repo}
+// todoの書き込みと一覧は/v2と同じtodoserviceを使い、repoは{id}とshare tokenのtodoを読むのに使う
+func NewHandler(repo repository.TodoRepository, todos todoservice.Service) Handler {
+	return &handler{repo, todos}
 }
 
 // Ctx...アクセスした際に、既存の情報を保管する
@@ -41,8 +76,19 @@ func (s *handler) Ctx(next http.Handler) http.Handler {
 
 		// IDが空じゃないならidをベースにクエリを叩く
 		if todoId := chi.URLParam(r, "id"); todoId != "" {
-			todo, err = s.repo.GetById(domain.Id(todoId))
+			// 書き込むrouteでは、replicaやcacheの古いtodoを元に書き込まないようにprimaryから読む
+			ctx := r.Context()
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				ctx = domain.NewPrimaryContext(ctx)
+			}
+			todo, err = s.repo.GetById(ctx, domain.Id(todoId))
 			if err != nil {
+				httpresponse.FromError(w, r, err, messages)
+				return
+			}
+
+			// 見れないtodoは存在自体を隠すためnot foundにする
+			if !todo.VisibleTo(domain.CallerFromContext(r.Context())) {
 				httpresponse.Error(w, r, http.StatusNotFound, ErrorMessageNotFound, "")
 				return
 			}
@@ -56,11 +102,15 @@ func (s *handler) Ctx(next http.Handler) http.Handler {
 	})
 }
 
-// List...todoを取得してhttpを返す
+// List...todoを取得してhttpを返す. ?assignee=me で自分がassigneeのtodoに絞り込める
 func (s *handler) List(w http.ResponseWriter, r *http.Request) {
-	out, err := s.repo.List()
+	out, err := s.todos.List(r.Context(), domain.CallerFromContext(r.Context()), r.URL.Query().Get("assignee"))
+	if errors.Is(err, todoservice.ErrUnidentified) {
+		httpresponse.Error(w, r, http.StatusUnauthorized, ErrorMessageUnidentified, "")
+		return
+	}
 	if err != nil {
-		httpresponse.Error(w, r, http.StatusNotFound, ErrorMessageInvalidProvided, "")
+		httpresponse.FromError(w, r, err, messages)
 		return
 	}
 
@@ -74,20 +124,15 @@ func (s *handler) Create(w http.ResponseWriter, r *http.Request) {
 		httpresponse.Error(w, r, http.StatusBadRequest, ErrorMessageMissingArgument, "")
 		return
 	}
-	if err := cv.Validate(result); err != nil {
-		httpresponse.Error(w, r, http.StatusBadRequest, ErrorValidation, fmt.Sprintf("%s", err))
-		return
-	}
-	result.Completed = false
 
-	if err := s.repo.Create(result); err != nil {
-		httpresponse.Error(w, r, http.StatusNotFound, ErrorMessageInvalidProvided, "")
+	if err := s.todos.Create(r.Context(), domain.CallerFromContext(r.Context()), result); err != nil {
+		httpresponse.FromError(w, r, err, messages)
 		return
 	}
 	httpresponse.OK(w, r, http.StatusCreated, "", nil)
 }
 
-// Update...todoを更新してhttpを返す
+// Update...todoを更新してhttpを返す. /v1では並び順は変えない
 func (s *handler) Update(w http.ResponseWriter, r *http.Request) {
 	result := &model.Todo{}
 	todo := r.Context().Value("todo").(*model.Todo)
@@ -97,17 +142,14 @@ func (s *handler) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := cv.Validate(result); err != nil {
-		httpresponse.Error(w, r, http.StatusBadRequest, ErrorValidation, fmt.Sprintf("%s", err))
-		return
+	// visibilityが省略された場合は今の公開範囲を引き継ぐ
+	if result.Visibility == "" {
+		result.Visibility = todo.Visibility
 	}
+	result.Position = todo.Position
 
-	todo.Title = result.Title
-	todo.Description = result.Description
-	todo.Completed = result.Completed
-
-	if err := s.repo.Update(todo); err != nil {
-		httpresponse.Error(w, r, http.StatusNotFound, ErrorMessageInvalidProvided, "")
+	if err := s.todos.Update(r.Context(), todo, *result); err != nil {
+		httpresponse.FromError(w, r, err, messages)
 		return
 	}
 
@@ -119,10 +161,50 @@ func (s *handler) Delete(w http.ResponseWriter, r *http.Request) {
 	todo := r.Context().Value("todo").(*model.Todo)
 	defer r.Body.Close()
 
-	if err := s.repo.Delete(todo); err != nil {
-		httpresponse.Error(w, r, http.StatusNotFound, ErrorMessageInvalidProvided, "")
+	if err := s.todos.Delete(r.Context(), todo); err != nil {
+		httpresponse.FromError(w, r, err, messages)
 		return
 	}
 
 	httpresponse.OK(w, r, http.StatusOK, "", nil)
 }
+
+// Assign...todoのassigneeを置き換えてhttpを返す
+func (s *handler) Assign(w http.ResponseWriter, r *http.Request) {
+	result := &assigneesRequest{}
+	todo := r.Context().Value("todo").(*model.Todo)
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&result); err != nil {
+		httpresponse.Error(w, r, http.StatusBadRequest, ErrorMessageMissingArgument, "")
+		return
+	}
+
+	err := s.todos.Assign(r.Context(), todo, result.AssigneeIds)
+	if errors.Is(err, model.ErrAssigneeNotFound) {
+		httpresponse.Error(w, r, http.StatusBadRequest, ErrorMessageAssigneeInvalid, err.Error())
+		return
+	}
+	if err != nil {
+		httpresponse.FromError(w, r, err, messages)
+		return
+	}
+
+	httpresponse.OK(w, r, http.StatusOK, "todo", todo)
+}
+
+// Shared...share tokenから公開されているtodoを取得してhttpを返す
+func (s *handler) Shared(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
+	if token == "" {
+		httpresponse.Error(w, r, http.StatusNotFound, ErrorMessageNotFound, "")
+		return
+	}
+
+	todo, err := s.repo.GetByShareToken(r.Context(), token)
+	if err != nil {
+		httpresponse.FromError(w, r, err, messages)
+		return
+	}
+
+	httpresponse.OK(w, r, http.StatusOK, "todo", NewSharedTodo(todo))
+}
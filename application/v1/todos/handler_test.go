@@ -2,16 +2,26 @@ package v1todos
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 
+	"github.com/sioncojp/famili-api/application/todoservice"
+	"github.com/sioncojp/famili-api/domain"
 	"github.com/sioncojp/famili-api/domain/model"
+	"github.com/sioncojp/famili-api/domain/repository"
+	"github.com/sioncojp/famili-api/infrastructure/memory"
 	"github.com/sioncojp/famili-api/utils"
+	httpresponse "github.com/sioncojp/famili-api/utils/http_response"
 )
 
 type TestCase struct {
@@ -26,6 +36,21 @@ var (
 	urlId      = "/v1/todos/1"
 )
 
+// newTestHandler...mockはsnapshotを取れないので、TxManagerはmockをそのまま渡すだけになる
+func newTestHandler(m *MockTodoService, mm *MockMemberService) Handler {
+	return newTestHandlerWithOutbox(m, mm, memory.NewOutboxRepository(), memory.NewTodoChangeRepository())
+}
+
+// newTestHandlerWithOutbox...eventと/v1/syncの変更を確かめるためにoutboxとchangesを渡す
+func newTestHandlerWithOutbox(m *MockTodoService, mm *MockMemberService, outbox repository.OutboxRepository, changes repository.TodoChangeRepository) Handler {
+	return NewHandler(m, todoservice.NewService(m, memory.NewTxManager(repository.Repositories{
+		Todos:   m,
+		Members: mm,
+		Outbox:  outbox,
+		Changes: changes,
+	})))
+}
+
 func TestTodoList(t *testing.T) {
 	t.Parallel()
 	cases := []TestCase{
@@ -50,10 +75,11 @@ func TestTodoList(t *testing.T) {
 	}
 
 	m := new(MockTodoService)
-	m.On("List").Return(data, nil)
-	s := NewHandler(m)
+	m.On("List", mock.Anything, domain.Caller{}).Return(data, nil)
+	s := newTestHandler(m, new(MockMemberService))
 
 	for _, v := range cases {
+		v := v
 		t.Run(
 			v.name,
 			func(tt *testing.T) {
@@ -69,6 +95,67 @@ func TestTodoList(t *testing.T) {
 	}
 }
 
+func TestTodoListPropagatesContext(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	r := httptest.NewRequest(http.MethodGet, url, nil).WithContext(ctx)
+
+	// requestのcontextがそのままrepositoryに渡り、clientの切断でcancelされる
+	m := new(MockTodoService)
+	m.On("List", mock.MatchedBy(func(got context.Context) bool {
+		cancel()
+		return got.Err() == context.Canceled
+	}), domain.Caller{}).Return([]model.Todo{}, nil)
+
+	w := httptest.NewRecorder()
+	newTestHandler(m, new(MockMemberService)).List(w, r)
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	m.AssertExpectations(t)
+}
+
+func TestTodoListByAssignee(t *testing.T) {
+	t.Parallel()
+	caller := domain.Caller{MemberId: "1", FamilyId: "f1"}
+	cases := []struct {
+		name           string
+		parameter      string
+		caller         domain.Caller
+		httpStatusCode int
+	}{
+		{"me", "?assignee=me", caller, http.StatusOK},
+		{"member id", "?assignee=2", caller, http.StatusOK},
+		{"me without identity", "?assignee=me", domain.Caller{}, http.StatusUnauthorized},
+	}
+
+	data := []model.Todo{
+		{
+			Title:       "1",
+			Description: "hoge",
+			AssigneeIds: []uint{1},
+		},
+	}
+
+	m := new(MockTodoService)
+	m.On("ListByAssignee", mock.Anything, caller, domain.Id("1")).Return(data, nil)
+	m.On("ListByAssignee", mock.Anything, caller, domain.Id("2")).Return([]model.Todo{}, nil)
+	s := newTestHandler(m, new(MockMemberService))
+
+	for _, v := range cases {
+		v := v
+		t.Run(
+			v.name,
+			func(tt *testing.T) {
+				tt.Parallel()
+				r := httptest.NewRequest(http.MethodGet, url+v.parameter, nil)
+				w := httptest.NewRecorder()
+				s.List(w, r.WithContext(domain.NewCallerContext(r.Context(), v.caller)))
+
+				assert.Equal(tt, v.httpStatusCode, w.Result().StatusCode)
+			},
+		)
+	}
+}
+
 func TestTodoCreate(t *testing.T) {
 	t.Parallel()
 	cases := []TestCase{
@@ -103,13 +190,15 @@ func TestTodoCreate(t *testing.T) {
 		Title:       "1",
 		Description: "hoge",
 		Completed:   false,
+		Visibility:  model.VisibilityFamily,
 	}
 
 	m := new(MockTodoService)
-	m.On("Create", data).Return(nil).Once()
-	s := NewHandler(m)
+	m.On("Create", mock.Anything, data).Return(nil).Once()
+	s := newTestHandler(m, new(MockMemberService))
 
 	for _, v := range cases {
+		v := v
 		t.Run(
 			v.name,
 			func(tt *testing.T) {
@@ -159,19 +248,22 @@ func TestTodoUpdate(t *testing.T) {
 		Title:       "1",
 		Description: "hoge",
 		Completed:   false,
+		Visibility:  model.VisibilityFamily,
 	}
 
 	dataUpdate := &model.Todo{
 		Title:       "2",
 		Description: "fuga",
 		Completed:   true,
+		Visibility:  model.VisibilityFamily,
 	}
 
 	m := new(MockTodoService)
-	m.On("Update", dataUpdate).Return(nil).Once()
-	s := NewHandler(m)
+	m.On("Update", mock.Anything, dataUpdate).Return(nil).Once()
+	s := newTestHandler(m, new(MockMemberService))
 
 	for _, v := range cases {
+		v := v
 		t.Run(
 			v.name,
 			func(tt *testing.T) {
@@ -205,10 +297,11 @@ func TestTodoDelete(t *testing.T) {
 	}
 
 	m := new(MockTodoService)
-	m.On("Delete", data).Return(nil).Once()
-	s := NewHandler(m)
+	m.On("Delete", mock.Anything, data).Return(nil).Once()
+	s := newTestHandler(m, new(MockMemberService))
 
 	for _, v := range cases {
+		v := v
 		t.Run(
 			v.name,
 			func(tt *testing.T) {
@@ -223,3 +316,288 @@ func TestTodoDelete(t *testing.T) {
 		)
 	}
 }
+
+func TestTodoEvents(t *testing.T) {
+	t.Parallel()
+	m := new(MockTodoService)
+	m.On("Create", mock.Anything, mock.Anything).Return(nil).Once()
+	m.On("Update", mock.Anything, mock.Anything).Return(nil).Once()
+	m.On("Delete", mock.Anything, mock.Anything).Return(nil).Once()
+	m.On("Update", mock.Anything, mock.Anything).Return(errors.New("db error")).Once()
+	outbox := memory.NewOutboxRepository()
+	changes := memory.NewTodoChangeRepository()
+	s := newTestHandlerWithOutbox(m, new(MockMemberService), outbox, changes)
+	todo := &model.Todo{Model: model.Model{ID: 1}, Title: "1", Description: "hoge", FamilyId: "f1", Visibility: model.VisibilityFamily}
+	withTodo := func(r *http.Request) *http.Request {
+		return r.WithContext(context.WithValue(r.Context(), contextKey, todo))
+	}
+
+	w := httptest.NewRecorder()
+	s.Create(w, httptest.NewRequest(http.MethodPost, url, strings.NewReader(`{"title":"1","description":"hoge"}`)))
+	assert.Equal(t, http.StatusCreated, w.Result().StatusCode)
+
+	// 未完了から完了にするとupdatedとcompletedが出る
+	w = httptest.NewRecorder()
+	s.Update(w, withTodo(httptest.NewRequest(http.MethodPut, urlId, strings.NewReader(`{"title":"2","description":"fuga","completed":true}`))))
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+
+	w = httptest.NewRecorder()
+	s.Delete(w, withTodo(httptest.NewRequest(http.MethodDelete, urlId, nil)))
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+
+	// 保存に失敗したらeventも書き込まない
+	w = httptest.NewRecorder()
+	s.Update(w, withTodo(httptest.NewRequest(http.MethodPut, urlId, strings.NewReader(`{"title":"3","description":"fuga"}`))))
+	assert.Equal(t, http.StatusInternalServerError, w.Result().StatusCode)
+
+	events, err := outbox.Pending(context.Background(), time.Now(), 10)
+	assert.NoError(t, err)
+	var types []model.EventType
+	for _, v := range events {
+		types = append(types, v.Type)
+	}
+	assert.Equal(t, []model.EventType{
+		model.EventTodoCreated, model.EventTodoUpdated, model.EventTodoCompleted, model.EventTodoDeleted,
+	}, types)
+	assert.Equal(t, "2", events[2].Todo.Title)
+
+	// todoごとに最後の変更だけが残るので、deleteのtombstoneになる
+	caller := domain.Caller{MemberId: "1", FamilyId: "f1"}
+	result, err := changes.Since(context.Background(), caller, 0, 10)
+	assert.NoError(t, err)
+	if assert.Len(t, result, 1) {
+		assert.True(t, result[0].Deleted)
+		assert.Equal(t, uint(1), result[0].TodoId)
+		assert.Equal(t, "2", result[0].Todo.Title)
+	}
+	m.AssertExpectations(t)
+}
+
+func TestTodoCtxVisibility(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		name           string
+		visibility     model.Visibility
+		caller         domain.Caller
+		httpStatusCode int
+	}{
+		{"private owner", model.VisibilityPrivate, domain.Caller{MemberId: "1", FamilyId: "f1"}, http.StatusOK},
+		{"private family member", model.VisibilityPrivate, domain.Caller{MemberId: "2", FamilyId: "f1"}, http.StatusNotFound},
+		{"family member", model.VisibilityFamily, domain.Caller{MemberId: "2", FamilyId: "f1"}, http.StatusOK},
+		{"family other family", model.VisibilityFamily, domain.Caller{MemberId: "3", FamilyId: "f2"}, http.StatusNotFound},
+		{"public other family", model.VisibilityPublic, domain.Caller{MemberId: "3", FamilyId: "f2"}, http.StatusNotFound},
+	}
+
+	for _, v := range cases {
+		v := v
+		t.Run(
+			v.name,
+			func(tt *testing.T) {
+				tt.Parallel()
+				data := model.Todo{
+					Title:       "1",
+					Description: "hoge",
+					CreatedBy:   "1",
+					FamilyId:    "f1",
+					Visibility:  v.visibility,
+				}
+				m := new(MockTodoService)
+				m.On("GetById", mock.Anything, domain.Id("1")).Return(data, nil)
+				s := newTestHandler(m, new(MockMemberService))
+
+				r := chi.NewRouter()
+				r.Route("/v1/todos/{id}", func(r chi.Router) {
+					r.Use(s.Ctx)
+					r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+						w.WriteHeader(http.StatusOK)
+					})
+				})
+
+				req := httptest.NewRequest(http.MethodGet, urlId, nil)
+				req = req.WithContext(domain.NewCallerContext(req.Context(), v.caller))
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, req)
+
+				assert.Equal(tt, v.httpStatusCode, w.Result().StatusCode)
+			},
+		)
+	}
+}
+
+func TestTodoRepositoryErrors(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		name           string
+		err            error
+		httpStatusCode int
+		want           string
+	}{
+		{"not found", domain.ErrNotFound, http.StatusNotFound, ErrorMessageNotFound},
+		{"conflict", domain.ErrConflict, http.StatusConflict, httpresponse.ErrorMessageConflict},
+		{"mysql is down", domain.ErrUnavailable, http.StatusServiceUnavailable, httpresponse.ErrorMessageUnavailable},
+		{"unknown", errors.New("boom"), http.StatusInternalServerError, httpresponse.ErrorMessageInternal},
+	}
+
+	for _, v := range cases {
+		v := v
+		t.Run(
+			v.name,
+			func(tt *testing.T) {
+				tt.Parallel()
+				m := new(MockTodoService)
+				m.On("GetById", mock.Anything, domain.Id("1")).Return(model.Todo{}, v.err)
+				m.On("List", mock.Anything, domain.Caller{}).Return([]model.Todo(nil), v.err)
+				m.On("Create", mock.Anything, mock.Anything).Return(v.err)
+				s := newTestHandler(m, new(MockMemberService))
+
+				r := chi.NewRouter()
+				r.Get("/v1/todos", s.List)
+				r.Post("/v1/todos", s.Create)
+				r.Route("/v1/todos/{id}", func(r chi.Router) {
+					r.Use(s.Ctx)
+					r.Get("/", func(w http.ResponseWriter, r *http.Request) {})
+				})
+
+				for _, req := range []*http.Request{
+					httptest.NewRequest(http.MethodGet, urlId, nil),
+					httptest.NewRequest(http.MethodGet, url, nil),
+					httptest.NewRequest(http.MethodPost, url, strings.NewReader(`{"title":"1","description":"hoge"}`)),
+				} {
+					w := httptest.NewRecorder()
+					r.ServeHTTP(w, req)
+					assert.Equal(tt, v.httpStatusCode, w.Result().StatusCode, req.Method+" "+req.URL.Path)
+					assert.Contains(tt, w.Body.String(), `"error":"`+v.want+`"`, req.Method+" "+req.URL.Path)
+				}
+			},
+		)
+	}
+}
+
+func TestTodoShared(t *testing.T) {
+	t.Parallel()
+	cases := []TestCase{
+		{
+			"ok",
+			"valid-token",
+			http.StatusOK,
+		},
+		{
+			"unknown token",
+			"unknown-token",
+			http.StatusNotFound,
+		},
+	}
+
+	data := model.Todo{
+		Title:       "1",
+		Description: "hoge",
+		Visibility:  model.VisibilityPublic,
+		ShareToken:  "valid-token",
+		CreatedBy:   "1",
+		FamilyId:    "f1",
+		AssigneeIds: []uint{2},
+	}
+
+	m := new(MockTodoService)
+	m.On("GetByShareToken", mock.Anything, "valid-token").Return(data, nil)
+	m.On("GetByShareToken", mock.Anything, "unknown-token").Return(model.Todo{}, domain.ErrNotFound)
+	s := newTestHandler(m, new(MockMemberService))
+
+	r := chi.NewRouter()
+	r.Get("/v1/shared/{token}", s.Shared)
+
+	for _, v := range cases {
+		v := v
+		t.Run(
+			v.name,
+			func(tt *testing.T) {
+				tt.Parallel()
+				req := httptest.NewRequest(http.MethodGet, "/v1/shared/"+v.parameter, nil)
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, req)
+
+				assert.Equal(tt, v.httpStatusCode, w.Result().StatusCode)
+				if v.httpStatusCode != http.StatusOK {
+					return
+				}
+				// 公開linkからメンバーやfamilyが分からないようにする
+				var body struct {
+					Todo map[string]interface{} `json:"todo"`
+				}
+				assert.NoError(tt, json.Unmarshal(w.Body.Bytes(), &body))
+				assert.Equal(tt, "1", body.Todo["title"])
+				for _, k := range []string{"id", "created_by", "family_id", "share_token", "assignee_ids", "visibility"} {
+					assert.NotContains(tt, body.Todo, k)
+				}
+			},
+		)
+	}
+}
+
+func TestTodoAssign(t *testing.T) {
+	t.Parallel()
+	cases := []TestCase{
+		{
+			"ok",
+			`{"assignee_ids":[1,2]}`,
+			http.StatusOK,
+		},
+		{
+			"unassign all",
+			`{"assignee_ids":[]}`,
+			http.StatusOK,
+		},
+		{
+			"member does not exist",
+			`{"assignee_ids":[1,3]}`,
+			http.StatusBadRequest,
+		},
+		{
+			"member of other family",
+			`{"assignee_ids":[4]}`,
+			http.StatusBadRequest,
+		},
+		{
+			"invalid json",
+			`{"assignee_ids":"1"}`,
+			http.StatusBadRequest,
+		},
+	}
+
+	members := []model.Member{
+		{Model: model.Model{ID: 1}, Name: "papa", FamilyId: "f1"},
+		{Model: model.Model{ID: 2}, Name: "mama", FamilyId: "f1"},
+		{Model: model.Model{ID: 4}, Name: "other", FamilyId: "f2"},
+	}
+
+	m := new(MockTodoService)
+	m.On("SetAssignees", mock.Anything, mock.Anything).Return(nil)
+	mm := new(MockMemberService)
+	mm.On("ListByIds", mock.Anything, []uint{1, 2}).Return(members[:2], nil)
+	mm.On("ListByIds", mock.Anything, []uint{}).Return([]model.Member{}, nil)
+	mm.On("ListByIds", mock.Anything, []uint{1, 3}).Return(members[:1], nil)
+	mm.On("ListByIds", mock.Anything, []uint{4}).Return(members[2:], nil)
+	s := newTestHandler(m, mm)
+
+	for _, v := range cases {
+		v := v
+		t.Run(
+			v.name,
+			func(tt *testing.T) {
+				tt.Parallel()
+				data := &model.Todo{
+					Title:       "1",
+					Description: "hoge",
+					FamilyId:    "f1",
+				}
+				json := strings.NewReader(v.parameter)
+				r := httptest.NewRequest(http.MethodPut, urlId+"/assignees", json)
+				ctx := context.WithValue(r.Context(), contextKey, data)
+				w := httptest.NewRecorder()
+				s.Assign(w, r.WithContext(ctx))
+
+				assert.Equal(tt, v.httpStatusCode, w.Result().StatusCode)
+			},
+		)
+	}
+}
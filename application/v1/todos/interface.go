@@ -11,4 +11,6 @@ type Handler interface {
 	Create(w http.ResponseWriter, r *http.Request)
 	Update(w http.ResponseWriter, r *http.Request)
 	Delete(w http.ResponseWriter, r *http.Request)
+	Assign(w http.ResponseWriter, r *http.Request)
+	Shared(w http.ResponseWriter, r *http.Request)
 }
@@ -1,6 +1,8 @@
 package v1todos
 
 import (
+	"context"
+
 	"github.com/stretchr/testify/mock"
 
 	"github.com/sioncojp/famili-api/domain"
@@ -11,22 +13,36 @@ type MockTodoService struct {
 	mock.Mock
 }
 
+type MockMemberService struct {
+	mock.Mock
+}
+
 type DomainMock struct {
 	mock.Mock
 }
 
-func (m *MockTodoService) GetById(id domain.Id) (model.Todo, error) {
-	r := m.Called(id)
+func (m *MockTodoService) GetById(ctx context.Context, id domain.Id) (model.Todo, error) {
+	r := m.Called(ctx, id)
 	return r.Get(0).(model.Todo), r.Error(1)
 }
 
-func (m *MockTodoService) List() ([]model.Todo, error) {
-	r := m.Called()
+func (m *MockTodoService) GetByShareToken(ctx context.Context, token string) (model.Todo, error) {
+	r := m.Called(ctx, token)
+	return r.Get(0).(model.Todo), r.Error(1)
+}
+
+func (m *MockTodoService) List(ctx context.Context, caller domain.Caller) ([]model.Todo, error) {
+	r := m.Called(ctx, caller)
+	return r.Get(0).([]model.Todo), r.Error(1)
+}
+
+func (m *MockTodoService) ListByAssignee(ctx context.Context, caller domain.Caller, memberId domain.Id) ([]model.Todo, error) {
+	r := m.Called(ctx, caller, memberId)
 	return r.Get(0).([]model.Todo), r.Error(1)
 }
 
-func (m *MockTodoService) Create(todo *model.Todo) error {
-	r := m.Called(todo)
+func (m *MockTodoService) Create(ctx context.Context, todo *model.Todo) error {
+	r := m.Called(ctx, todo)
 	var r0 error
 	if rf, ok := r.Get(0).(func(*model.Todo) error); ok {
 		r0 = rf(todo)
@@ -36,8 +52,8 @@ func (m *MockTodoService) Create(todo *model.Todo) error {
 	return r0
 }
 
-func (m *MockTodoService) Update(todo *model.Todo) error {
-	r := m.Called(todo)
+func (m *MockTodoService) Update(ctx context.Context, todo *model.Todo) error {
+	r := m.Called(ctx, todo)
 	var r0 error
 	if rf, ok := r.Get(0).(func(*model.Todo) error); ok {
 		r0 = rf(todo)
@@ -47,8 +63,8 @@ func (m *MockTodoService) Update(todo *model.Todo) error {
 	return r0
 }
 
-func (m *MockTodoService) Delete(todo *model.Todo) error {
-	r := m.Called(todo)
+func (m *MockTodoService) Delete(ctx context.Context, todo *model.Todo) error {
+	r := m.Called(ctx, todo)
 	var r0 error
 	if rf, ok := r.Get(0).(func(*model.Todo) error); ok {
 		r0 = rf(todo)
@@ -57,3 +73,23 @@ func (m *MockTodoService) Delete(todo *model.Todo) error {
 	}
 	return r0
 }
+
+func (m *MockTodoService) SetAssignees(ctx context.Context, todo *model.Todo) error {
+	r := m.Called(ctx, todo)
+	return r.Error(0)
+}
+
+func (m *MockMemberService) List(ctx context.Context, familyId domain.Id) ([]model.Member, error) {
+	r := m.Called(ctx, familyId)
+	return r.Get(0).([]model.Member), r.Error(1)
+}
+
+func (m *MockMemberService) ListByIds(ctx context.Context, ids []uint) ([]model.Member, error) {
+	r := m.Called(ctx, ids)
+	return r.Get(0).([]model.Member), r.Error(1)
+}
+
+func (m *MockMemberService) Create(ctx context.Context, member *model.Member) error {
+	r := m.Called(ctx, member)
+	return r.Error(0)
+}
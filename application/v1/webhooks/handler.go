@@ -0,0 +1,282 @@
+package v1webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/domain/model"
+	"github.com/sioncojp/famili-api/domain/repository"
+	"github.com/sioncojp/famili-api/utils"
+	httpresponse "github.com/sioncojp/famili-api/utils/http_response"
+	"github.com/sioncojp/famili-api/utils/i18n"
+	"github.com/sioncojp/famili-api/utils/secure"
+)
+
+const (
+	ErrorMessageNotFound        = "webhook_not_found"
+	ErrorMessageInvalidProvided = "invalid_webhook_provided"
+	ErrorMessageMissingArgument = "missing_argument"
+	ErrorMessageUnidentified    = "caller_not_identified"
+	ErrorValidation             = "missing_validation"
+
+	// secretBytes...signing secretの長さ
+	secretBytes = 32
+
+	// deliveriesLimit, deliveriesMaxLimit...GET /v1/webhooks/{id}/deliveries で返す件数
+	deliveriesLimit    = 50
+	deliveriesMaxLimit = 100
+)
+
+var cv = &domain.CustomValidator{}
+
+// messages...repositoryのerrorを返すときのerror message. それ以外のstatusはhttpresponseのdefaultを使う
+var messages = httpresponse.Messages{
+	http.StatusNotFound:   ErrorMessageNotFound,
+	http.StatusBadRequest: ErrorValidation,
+}
+
+// handler...
+type handler struct {
+	repo   repository.WebhookRepository
+	cipher *secure.Cipher
+	tester Tester
+	now    func() time.Time
+}
+
+// webhookRequest...POST /v1/webhooks, PUT /v1/webhooks/{id} のbody
+type webhookRequest struct {
+	URL        string           `json:"url"`
+	EventTypes model.EventTypes `json:"event_types"`
+	// Enabled...trueで無効になったwebhookを戻し、falseで止める. 省略したら変えない
+	Enabled *bool `json:"enabled"`
+}
+
+// NewHandler create a instance of this handler
+func NewHandler(repo repository.WebhookRepository, cipher *secure.Cipher, tester Tester) Handler {
+	return &handler{repo, cipher, tester, time.Now}
+}
+
+// Ctx...アクセスした際に、既存の情報を保管する
+// privateなtodoのeventも届くので、webhookは登録したメンバーだけが見て変えられる
+func (s *handler) Ctx(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		caller := domain.CallerFromContext(r.Context())
+		if caller.MemberId == "" || caller.FamilyId == "" {
+			httpresponse.Error(w, r, http.StatusUnauthorized, ErrorMessageUnidentified, "")
+			return
+		}
+
+		webhookId := chi.URLParam(r, "id")
+		if webhookId == "" {
+			httpresponse.Error(w, r, http.StatusNotFound, ErrorMessageInvalidProvided, "")
+			return
+		}
+		webhook, err := s.repo.GetById(r.Context(), domain.Id(webhookId))
+		if err != nil {
+			httpresponse.FromError(w, r, err, messages)
+			return
+		}
+		// 他のメンバーのwebhookは存在自体を隠す
+		if webhook.FamilyId != caller.FamilyId || webhook.CreatedBy != caller.MemberId {
+			httpresponse.Error(w, r, http.StatusNotFound, ErrorMessageNotFound, "")
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), "webhook", &webhook)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// List...callerが登録したwebhookを取得してhttpを返す. secretは返さない
+func (s *handler) List(w http.ResponseWriter, r *http.Request) {
+	caller := domain.CallerFromContext(r.Context())
+	if caller.MemberId == "" || caller.FamilyId == "" {
+		httpresponse.Error(w, r, http.StatusUnauthorized, ErrorMessageUnidentified, "")
+		return
+	}
+
+	webhooks, err := s.repo.List(r.Context(), caller.FamilyId)
+	if err != nil {
+		httpresponse.FromError(w, r, err, messages)
+		return
+	}
+	out := []model.Webhook{}
+	for _, v := range webhooks {
+		if v.CreatedBy == caller.MemberId {
+			out = append(out, v)
+		}
+	}
+
+	httpresponse.OK(w, r, http.StatusOK, "webhooks", out)
+}
+
+// Create...webhookを登録してhttpを返す. 平文のsecretはこのレスポンスとRotateでしか返さない
+func (s *handler) Create(w http.ResponseWriter, r *http.Request) {
+	caller := domain.CallerFromContext(r.Context())
+	if caller.MemberId == "" || caller.FamilyId == "" {
+		httpresponse.Error(w, r, http.StatusUnauthorized, ErrorMessageUnidentified, "")
+		return
+	}
+
+	req := &webhookRequest{}
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpresponse.Error(w, r, http.StatusBadRequest, ErrorMessageMissingArgument, "")
+		return
+	}
+	result := &model.Webhook{
+		FamilyId:   caller.FamilyId,
+		CreatedBy:  caller.MemberId,
+		URL:        req.URL,
+		EventTypes: req.EventTypes,
+	}
+	if err := cv.Validate(result); err != nil {
+		httpresponse.FromError(w, r, err, messages)
+		return
+	}
+
+	secret, encrypted, err := s.generateSecret()
+	if err != nil {
+		httpresponse.Error(w, r, http.StatusInternalServerError, ErrorMessageInvalidProvided, "")
+		return
+	}
+	result.Secret = encrypted
+
+	if err := s.repo.Create(r.Context(), result); err != nil {
+		httpresponse.FromError(w, r, err, messages)
+		return
+	}
+
+	result.PlainSecret = secret
+	httpresponse.OK(w, r, http.StatusCreated, "webhook", result)
+}
+
+// Get...webhookを取得してhttpを返す
+func (s *handler) Get(w http.ResponseWriter, r *http.Request) {
+	webhook := r.Context().Value("webhook").(*model.Webhook)
+	httpresponse.OK(w, r, http.StatusOK, "webhook", webhook)
+}
+
+// Update...webhookのurl, event_typesを変えてhttpを返す
+// enabledをtrueにすると、失敗し続けて無効になったwebhookを連続失敗回数0から戻す
+func (s *handler) Update(w http.ResponseWriter, r *http.Request) {
+	webhook := r.Context().Value("webhook").(*model.Webhook)
+	req := &webhookRequest{}
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpresponse.Error(w, r, http.StatusBadRequest, ErrorMessageMissingArgument, "")
+		return
+	}
+
+	webhook.URL = req.URL
+	webhook.EventTypes = req.EventTypes
+	if err := cv.Validate(webhook); err != nil {
+		httpresponse.FromError(w, r, err, messages)
+		return
+	}
+	if req.Enabled != nil {
+		switch {
+		case *req.Enabled:
+			webhook.DisabledAt = nil
+			webhook.Failures = 0
+		case !webhook.Disabled():
+			now := s.now()
+			webhook.DisabledAt = &now
+		}
+	}
+
+	if err := s.repo.Update(r.Context(), webhook); err != nil {
+		httpresponse.FromError(w, r, err, messages)
+		return
+	}
+
+	httpresponse.OK(w, r, http.StatusOK, "webhook", webhook)
+}
+
+// Delete...webhookと配信の記録を削除してhttpを返す
+func (s *handler) Delete(w http.ResponseWriter, r *http.Request) {
+	webhook := r.Context().Value("webhook").(*model.Webhook)
+	if err := s.repo.Delete(r.Context(), webhook); err != nil {
+		httpresponse.FromError(w, r, err, messages)
+		return
+	}
+
+	httpresponse.OK(w, r, http.StatusOK, "", nil)
+}
+
+// Rotate...signing secretを作り直してhttpを返す
+// 古いsecretでもWebhookSecretGraceの間は署名を続けるので、受け取る側は止めずに切り替えられる
+func (s *handler) Rotate(w http.ResponseWriter, r *http.Request) {
+	webhook := r.Context().Value("webhook").(*model.Webhook)
+	secret, encrypted, err := s.generateSecret()
+	if err != nil {
+		httpresponse.Error(w, r, http.StatusInternalServerError, ErrorMessageInvalidProvided, "")
+		return
+	}
+	webhook.Rotate(encrypted, s.now())
+
+	if err := s.repo.Update(r.Context(), webhook); err != nil {
+		httpresponse.FromError(w, r, err, messages)
+		return
+	}
+
+	webhook.PlainSecret = secret
+	httpresponse.OK(w, r, http.StatusOK, "webhook", webhook)
+}
+
+// Test...webhook.testのeventを送り、配信の記録をhttpで返す. 受け取る側が失敗しても200で記録を返す
+func (s *handler) Test(w http.ResponseWriter, r *http.Request) {
+	webhook := r.Context().Value("webhook").(*model.Webhook)
+	delivery, err := s.tester.Test(r.Context(), *webhook)
+	if err != nil {
+		httpresponse.FromError(w, r, err, messages)
+		return
+	}
+
+	httpresponse.OK(w, r, http.StatusOK, "delivery", delivery)
+}
+
+// Deliveries...配信の記録を新しい順に取得してhttpを返す. ?limit= で件数を変えられる
+func (s *handler) Deliveries(w http.ResponseWriter, r *http.Request) {
+	webhook := r.Context().Value("webhook").(*model.Webhook)
+	limit := deliveriesLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > deliveriesMaxLimit {
+			httpresponse.Validation(w, r, ErrorValidation, validation.Errors{
+				"limit": i18n.NewError(i18n.Between).SetParams(map[string]interface{}{"min": 1, "max": deliveriesMaxLimit}),
+			})
+			return
+		}
+		limit = n
+	}
+
+	out, err := s.repo.ListDeliveries(r.Context(), webhook.ID, limit)
+	if err != nil {
+		httpresponse.FromError(w, r, err, messages)
+		return
+	}
+
+	httpresponse.OK(w, r, http.StatusOK, "deliveries", out)
+}
+
+// generateSecret...whsec_<secret> の形式でsecretを生成し、平文と暗号化したものを返す
+func (s *handler) generateSecret() (string, string, error) {
+	token, err := utils.MakeSecureToken(secretBytes)
+	if err != nil {
+		return "", "", err
+	}
+	secret := model.WebhookSecretPrefix + token
+	encrypted, err := s.cipher.Encrypt(secret)
+	if err != nil {
+		return "", "", err
+	}
+	return secret, encrypted, nil
+}
@@ -0,0 +1,393 @@
+package v1webhooks
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/domain/model"
+	"github.com/sioncojp/famili-api/infrastructure/memory"
+	"github.com/sioncojp/famili-api/infrastructure/webhook"
+	"github.com/sioncojp/famili-api/utils/secure"
+)
+
+type TestCase struct {
+	name           string
+	parameter      string
+	httpStatusCode int
+}
+
+var (
+	url     = "/v1/webhooks"
+	caller  = domain.Caller{MemberId: "1", FamilyId: "f1"}
+	testKey = base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+)
+
+// newRouter...router.goと同じroutingでhandlerを組み立て、callerを入れて叩く
+func newRouter(s Handler, c domain.Caller) http.Handler {
+	r := chi.NewRouter()
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(domain.NewCallerContext(r.Context(), c)))
+		})
+	})
+	r.Route(url, func(r chi.Router) {
+		r.Get("/", s.List)
+		r.Post("/", s.Create)
+		r.Route("/{id}", func(r chi.Router) {
+			r.Use(s.Ctx)
+			r.Get("/", s.Get)
+			r.Put("/", s.Update)
+			r.Delete("/", s.Delete)
+			r.Post("/rotate", s.Rotate)
+			r.Post("/test", s.Test)
+			r.Get("/deliveries", s.Deliveries)
+		})
+	})
+	return r
+}
+
+func newCipher(t *testing.T) *secure.Cipher {
+	c, err := secure.NewCipher(testKey)
+	require.NoError(t, err)
+	return c
+}
+
+func TestWebhookList(t *testing.T) {
+	t.Parallel()
+	m := new(MockWebhookService)
+	m.On("List", caller.FamilyId).Return([]model.Webhook{
+		{Model: model.Model{ID: 1}, CreatedBy: caller.MemberId, URL: "https://a.example.com", Secret: "encrypted"},
+		{Model: model.Model{ID: 2}, CreatedBy: "2", URL: "https://b.example.com"},
+	}, nil)
+	s := NewHandler(m, newCipher(t), nil)
+
+	w := httptest.NewRecorder()
+	newRouter(s, caller).ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+	require.Equal(t, http.StatusOK, w.Result().StatusCode)
+	assert.NotContains(t, w.Body.String(), "encrypted", "secret must not be returned")
+	// 他のメンバーが登録したwebhookは返さない
+	assert.NotContains(t, w.Body.String(), "b.example.com")
+
+	w = httptest.NewRecorder()
+	newRouter(s, domain.Caller{}).ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Result().StatusCode)
+}
+
+func TestWebhookCreate(t *testing.T) {
+	t.Parallel()
+	cases := []TestCase{
+		{
+			"ok",
+			`{"url":"https://example.com/hook","event_types":["todo.created","todo.completed"]}`,
+			http.StatusCreated,
+		},
+		{
+			"no event types",
+			`{"url":"https://example.com/hook","event_types":[]}`,
+			http.StatusBadRequest,
+		},
+		{
+			"unknown event type",
+			`{"url":"https://example.com/hook","event_types":["todo.archived"]}`,
+			http.StatusBadRequest,
+		},
+		{
+			"not http url",
+			`{"url":"ftp://example.com/hook","event_types":["todo.created"]}`,
+			http.StatusBadRequest,
+		},
+		{
+			"invalid json",
+			`{"url":`,
+			http.StatusBadRequest,
+		},
+	}
+
+	m := new(MockWebhookService)
+	m.On("Create", mock.Anything).Return(nil)
+	s := NewHandler(m, newCipher(t), nil)
+
+	for _, v := range cases {
+		v := v
+		t.Run(
+			v.name,
+			func(tt *testing.T) {
+				tt.Parallel()
+				w := httptest.NewRecorder()
+				newRouter(s, caller).ServeHTTP(w, httptest.NewRequest(http.MethodPost, url, strings.NewReader(v.parameter)))
+				assert.Equal(tt, v.httpStatusCode, w.Result().StatusCode)
+			},
+		)
+	}
+}
+
+func TestWebhookCreateReturnsSecretOnce(t *testing.T) {
+	t.Parallel()
+	var created *model.Webhook
+	m := new(MockWebhookService)
+	m.On("Create", mock.Anything).Run(func(args mock.Arguments) {
+		created = args.Get(0).(*model.Webhook)
+	}).Return(nil)
+	cipher := newCipher(t)
+	s := NewHandler(m, cipher, nil)
+
+	w := httptest.NewRecorder()
+	newRouter(s, caller).ServeHTTP(w, httptest.NewRequest(http.MethodPost, url, strings.NewReader(`{"url":"https://example.com/hook","event_types":["todo.created"]}`)))
+	require.Equal(t, http.StatusCreated, w.Result().StatusCode)
+
+	var body struct {
+		Webhook model.Webhook `json:"webhook"`
+	}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&body))
+	assert.True(t, strings.HasPrefix(body.Webhook.PlainSecret, model.WebhookSecretPrefix))
+
+	// 保存するのは暗号化したsecretだけ
+	assert.NotEqual(t, body.Webhook.PlainSecret, created.Secret)
+	decrypted, err := cipher.Decrypt(created.Secret)
+	require.NoError(t, err)
+	assert.Equal(t, body.Webhook.PlainSecret, decrypted)
+	assert.Equal(t, caller.FamilyId, created.FamilyId)
+	assert.Equal(t, caller.MemberId, created.CreatedBy)
+}
+
+func TestWebhookCtx(t *testing.T) {
+	t.Parallel()
+	cases := []TestCase{
+		{"ok", "1", http.StatusOK},
+		{"other member", "2", http.StatusNotFound},
+		{"other family", "3", http.StatusNotFound},
+		{"not found", "4", http.StatusNotFound},
+	}
+
+	m := new(MockWebhookService)
+	m.On("GetById", domain.Id("1")).Return(model.Webhook{FamilyId: "f1", CreatedBy: "1"}, nil)
+	m.On("GetById", domain.Id("2")).Return(model.Webhook{FamilyId: "f1", CreatedBy: "2"}, nil)
+	m.On("GetById", domain.Id("3")).Return(model.Webhook{FamilyId: "f2", CreatedBy: "1"}, nil)
+	m.On("GetById", domain.Id("4")).Return(model.Webhook{}, domain.ErrNotFound)
+	s := NewHandler(m, newCipher(t), nil)
+
+	for _, v := range cases {
+		v := v
+		t.Run(
+			v.name,
+			func(tt *testing.T) {
+				tt.Parallel()
+				w := httptest.NewRecorder()
+				newRouter(s, caller).ServeHTTP(w, httptest.NewRequest(http.MethodGet, url+"/"+v.parameter, nil))
+				assert.Equal(tt, v.httpStatusCode, w.Result().StatusCode)
+			},
+		)
+	}
+}
+
+func TestWebhookUpdate(t *testing.T) {
+	t.Parallel()
+	disabledAt := time.Now()
+	cases := []struct {
+		name           string
+		parameter      string
+		httpStatusCode int
+		wantDisabled   bool
+	}{
+		{"keep disabled", `{"url":"https://example.com/new","event_types":["todo.deleted"]}`, http.StatusOK, true},
+		{"enable", `{"url":"https://example.com/new","event_types":["todo.deleted"],"enabled":true}`, http.StatusOK, false},
+		{"invalid url", `{"url":"example.com","event_types":["todo.deleted"],"enabled":true}`, http.StatusBadRequest, true},
+	}
+
+	for _, v := range cases {
+		v := v
+		t.Run(
+			v.name,
+			func(tt *testing.T) {
+				tt.Parallel()
+				var updated *model.Webhook
+				m := new(MockWebhookService)
+				m.On("GetById", domain.Id("1")).Return(model.Webhook{FamilyId: "f1", CreatedBy: "1", Failures: 15, DisabledAt: &disabledAt}, nil)
+				m.On("Update", mock.Anything).Run(func(args mock.Arguments) {
+					updated = args.Get(0).(*model.Webhook)
+				}).Return(nil)
+				s := NewHandler(m, newCipher(t), nil)
+
+				w := httptest.NewRecorder()
+				newRouter(s, caller).ServeHTTP(w, httptest.NewRequest(http.MethodPut, url+"/1", strings.NewReader(v.parameter)))
+				require.Equal(tt, v.httpStatusCode, w.Result().StatusCode)
+				if v.httpStatusCode != http.StatusOK {
+					m.AssertNotCalled(tt, "Update", mock.Anything)
+					return
+				}
+				assert.Equal(tt, "https://example.com/new", updated.URL)
+				assert.Equal(tt, v.wantDisabled, updated.Disabled())
+				if !v.wantDisabled {
+					assert.Equal(tt, 0, updated.Failures)
+				}
+			},
+		)
+	}
+}
+
+func TestWebhookRotate(t *testing.T) {
+	t.Parallel()
+	cipher := newCipher(t)
+	old, err := cipher.Encrypt("whsec_old")
+	require.NoError(t, err)
+	var updated *model.Webhook
+	m := new(MockWebhookService)
+	m.On("GetById", domain.Id("1")).Return(model.Webhook{FamilyId: "f1", CreatedBy: "1", Secret: old}, nil)
+	m.On("Update", mock.Anything).Run(func(args mock.Arguments) {
+		updated = args.Get(0).(*model.Webhook)
+	}).Return(nil)
+	s := NewHandler(m, cipher, nil)
+
+	w := httptest.NewRecorder()
+	newRouter(s, caller).ServeHTTP(w, httptest.NewRequest(http.MethodPost, url+"/1/rotate", nil))
+	require.Equal(t, http.StatusOK, w.Result().StatusCode)
+
+	var body struct {
+		Webhook model.Webhook `json:"webhook"`
+	}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&body))
+	decrypted, err := cipher.Decrypt(updated.Secret)
+	require.NoError(t, err)
+	assert.Equal(t, body.Webhook.PlainSecret, decrypted)
+	// 古いsecretは猶予の間だけ残る
+	assert.Equal(t, old, updated.PreviousSecret)
+	assert.Len(t, updated.Secrets(time.Now()), 2)
+	assert.Len(t, updated.Secrets(time.Now().Add(model.WebhookSecretGrace+time.Minute)), 1)
+}
+
+func TestWebhookDeliveries(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		name           string
+		query          string
+		httpStatusCode int
+		wantLimit      int
+	}{
+		{"default", "", http.StatusOK, deliveriesLimit},
+		{"limit", "?limit=10", http.StatusOK, 10},
+		{"over max", "?limit=1000", http.StatusBadRequest, 0},
+		{"not number", "?limit=x", http.StatusBadRequest, 0},
+	}
+
+	m := new(MockWebhookService)
+	m.On("GetById", domain.Id("1")).Return(model.Webhook{Model: model.Model{ID: 1}, FamilyId: "f1", CreatedBy: "1"}, nil)
+	m.On("ListDeliveries", uint(1), mock.Anything).Return([]model.WebhookDelivery{{WebhookId: 1, Payload: "secret payload"}}, nil)
+	s := NewHandler(m, newCipher(t), nil)
+
+	for _, v := range cases {
+		w := httptest.NewRecorder()
+		newRouter(s, caller).ServeHTTP(w, httptest.NewRequest(http.MethodGet, url+"/1/deliveries"+v.query, nil))
+		require.Equal(t, v.httpStatusCode, w.Result().StatusCode, v.name)
+		if v.httpStatusCode == http.StatusOK {
+			m.AssertCalled(t, "ListDeliveries", uint(1), v.wantLimit)
+			assert.NotContains(t, w.Body.String(), "secret payload", v.name)
+		}
+	}
+}
+
+func TestWebhookLifecycle(t *testing.T) {
+	t.Parallel()
+	// 受け取る側. 署名を確かめて記録する
+	var mu sync.Mutex
+	var secret string
+	var received []string
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		body, _ := io.ReadAll(r.Body)
+		if err := webhook.Verify(secret, r.Header.Get(webhook.HeaderSignature), r.Header.Get(webhook.HeaderTimestamp), body, time.Now(), 5*time.Minute); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		received = append(received, r.Header.Get(webhook.HeaderEventType))
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(receiver.Close)
+
+	cipher := newCipher(t)
+	repo := memory.NewWebhookRepository()
+	deliverer := webhook.NewDeliverer(repo, cipher, webhook.NewClient(time.Second, true), webhook.Options{MaxAttempts: 3, DisableAfterFailures: 5, BatchSize: 10}, zap.NewNop())
+	router := newRouter(NewHandler(repo, cipher, deliverer), caller)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+
+	// 登録して返ってきたsecretで受け取る側が検証できる
+	w := do(http.MethodPost, url, `{"url":"`+receiver.URL+`","event_types":["todo.created"]}`)
+	require.Equal(t, http.StatusCreated, w.Result().StatusCode)
+	var created struct {
+		Webhook model.Webhook `json:"webhook"`
+	}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&created))
+	mu.Lock()
+	secret = created.Webhook.PlainSecret
+	mu.Unlock()
+
+	w = do(http.MethodPost, url+"/1/test", "")
+	require.Equal(t, http.StatusOK, w.Result().StatusCode)
+	var tested struct {
+		Delivery model.WebhookDelivery `json:"delivery"`
+	}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&tested))
+	assert.Equal(t, model.DeliveryDelivered, tested.Delivery.Status)
+	assert.Equal(t, http.StatusOK, tested.Delivery.StatusCode)
+
+	// rotateした後は新しいsecretだけを知っている受け取る側でも検証できる
+	w = do(http.MethodPost, url+"/1/rotate", "")
+	require.Equal(t, http.StatusOK, w.Result().StatusCode)
+	var rotated struct {
+		Webhook model.Webhook `json:"webhook"`
+	}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&rotated))
+	assert.NotEqual(t, secret, rotated.Webhook.PlainSecret)
+	mu.Lock()
+	secret = rotated.Webhook.PlainSecret
+	mu.Unlock()
+
+	w = do(http.MethodPost, url+"/1/test", "")
+	require.Equal(t, http.StatusOK, w.Result().StatusCode)
+
+	// 知らないsecretになると受け取る側が拒否し、失敗として記録される
+	mu.Lock()
+	secret = "whsec_unknown"
+	mu.Unlock()
+	w = do(http.MethodPost, url+"/1/test", "")
+	require.Equal(t, http.StatusOK, w.Result().StatusCode)
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&tested))
+	assert.Equal(t, model.DeliveryFailed, tested.Delivery.Status)
+	assert.Equal(t, http.StatusUnauthorized, tested.Delivery.StatusCode)
+
+	w = do(http.MethodGet, url+"/1/deliveries", "")
+	require.Equal(t, http.StatusOK, w.Result().StatusCode)
+	var deliveries struct {
+		Deliveries []model.WebhookDelivery `json:"deliveries"`
+	}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&deliveries))
+	require.Len(t, deliveries.Deliveries, 3)
+	assert.Equal(t, model.DeliveryFailed, deliveries.Deliveries[0].Status)
+	mu.Lock()
+	assert.Equal(t, []string{"webhook.test", "webhook.test"}, received)
+	mu.Unlock()
+
+	// 削除したら配信の記録も見えなくなる
+	w = do(http.MethodDelete, url+"/1", "")
+	require.Equal(t, http.StatusOK, w.Result().StatusCode)
+	w = do(http.MethodGet, url+"/1/deliveries", "")
+	assert.Equal(t, http.StatusNotFound, w.Result().StatusCode)
+}
@@ -0,0 +1,26 @@
+package v1webhooks
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/sioncojp/famili-api/domain/model"
+)
+
+// Handler...interfaceを使うことでDIPを解決する。mockも作成できるようになる
+type Handler interface {
+	Ctx(next http.Handler) http.Handler
+	List(w http.ResponseWriter, r *http.Request)
+	Create(w http.ResponseWriter, r *http.Request)
+	Get(w http.ResponseWriter, r *http.Request)
+	Update(w http.ResponseWriter, r *http.Request)
+	Delete(w http.ResponseWriter, r *http.Request)
+	Rotate(w http.ResponseWriter, r *http.Request)
+	Test(w http.ResponseWriter, r *http.Request)
+	Deliveries(w http.ResponseWriter, r *http.Request)
+}
+
+// Tester...webhook.testのeventを1回だけ送る. infrastructure/webhookのDelivererが実装する
+type Tester interface {
+	Test(ctx context.Context, webhook model.Webhook) (model.WebhookDelivery, error)
+}
@@ -0,0 +1,70 @@
+package v1webhooks
+
+import (
+	"context"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/domain/model"
+)
+
+type MockWebhookService struct {
+	mock.Mock
+}
+
+func (m *MockWebhookService) GetById(ctx context.Context, id domain.Id) (model.Webhook, error) {
+	r := m.Called(id)
+	return r.Get(0).(model.Webhook), r.Error(1)
+}
+
+func (m *MockWebhookService) List(ctx context.Context, familyId domain.Id) ([]model.Webhook, error) {
+	r := m.Called(familyId)
+	return r.Get(0).([]model.Webhook), r.Error(1)
+}
+
+func (m *MockWebhookService) Create(ctx context.Context, webhook *model.Webhook) error {
+	r := m.Called(webhook)
+	return r.Error(0)
+}
+
+func (m *MockWebhookService) Update(ctx context.Context, webhook *model.Webhook) error {
+	r := m.Called(webhook)
+	return r.Error(0)
+}
+
+func (m *MockWebhookService) Delete(ctx context.Context, webhook *model.Webhook) error {
+	r := m.Called(webhook)
+	return r.Error(0)
+}
+
+func (m *MockWebhookService) RecordSuccess(ctx context.Context, id uint) error {
+	r := m.Called(id)
+	return r.Error(0)
+}
+
+func (m *MockWebhookService) RecordFailure(ctx context.Context, id uint, disableAfter int, now time.Time) (bool, error) {
+	r := m.Called(id, disableAfter)
+	return r.Bool(0), r.Error(1)
+}
+
+func (m *MockWebhookService) Enqueue(ctx context.Context, deliveries ...model.WebhookDelivery) error {
+	r := m.Called(deliveries)
+	return r.Error(0)
+}
+
+func (m *MockWebhookService) PendingDeliveries(ctx context.Context, now time.Time, limit int) ([]model.WebhookDelivery, error) {
+	r := m.Called(limit)
+	return r.Get(0).([]model.WebhookDelivery), r.Error(1)
+}
+
+func (m *MockWebhookService) SaveDelivery(ctx context.Context, delivery *model.WebhookDelivery) error {
+	r := m.Called(delivery)
+	return r.Error(0)
+}
+
+func (m *MockWebhookService) ListDeliveries(ctx context.Context, webhookId uint, limit int) ([]model.WebhookDelivery, error) {
+	r := m.Called(webhookId, limit)
+	return r.Get(0).([]model.WebhookDelivery), r.Error(1)
+}
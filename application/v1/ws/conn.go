@@ -0,0 +1,196 @@
+package v1ws
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/domain/model"
+	"github.com/sioncojp/famili-api/infrastructure/stream"
+)
+
+const (
+	// closeSlowConsumer...送信を待つmessageがqueueSizeを超えた. clientはlast_event_idで再接続する
+	closeSlowConsumer = "slow consumer"
+	// closeShutdown...serverのshutdown
+	closeShutdown = "server shutdown"
+)
+
+// limiter...接続ごとのtoken bucket. 読み込みのgoroutineからしか使わないのでlockしない
+type limiter struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newLimiter(rate float64, burst int, now time.Time) *limiter {
+	return &limiter{rate: rate, burst: float64(burst), tokens: float64(burst), last: now}
+}
+
+// allow...tokenが残っていれば1つ使ってtrueを返す. 1秒にrate個, 最大burst個まで貯まる
+func (l *limiter) allow(now time.Time) bool {
+	l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+// presence...入力中の状態. 切断したときに他のメンバーへidleを送るために覚える
+type presence struct {
+	todoId uint
+	// todo...todoIdのtodo. 見れるメンバーにだけ送るために使う. list全体ならnil
+	todo *model.Todo
+}
+
+// conn...1つのWebSocket接続. 書き込みはwriteLoopだけが行い、他のgoroutineはenqueueでqueueに積む
+type conn struct {
+	ws      *websocket.Conn
+	caller  domain.Caller
+	limiter *limiter
+	send    chan serverMessage
+	done    chan struct{}
+	once    sync.Once
+	// closeCode, closeText...doneを閉じたときにclientへ送るclose frame
+	closeCode int
+	closeText string
+
+	mu  sync.Mutex
+	sub *stream.Subscription
+
+	// typing...読み込みのgoroutineからしか使わない
+	typing *presence
+}
+
+func newConn(ws *websocket.Conn, caller domain.Caller, limiter *limiter, queueSize int) *conn {
+	return &conn{
+		ws:      ws,
+		caller:  caller,
+		limiter: limiter,
+		send:    make(chan serverMessage, queueSize),
+		done:    make(chan struct{}),
+	}
+}
+
+// enqueue...送信を待つqueueに積む. queueがあふれたら受け取りが遅いclientとして閉じる
+func (c *conn) enqueue(msg serverMessage) {
+	select {
+	case <-c.done:
+		return
+	default:
+	}
+	select {
+	case c.send <- msg:
+	default:
+		c.close(websocket.CloseTryAgainLater, closeSlowConsumer)
+	}
+}
+
+// close...doneを一度だけ閉じる. writeLoopがclose frameを送って接続を切る
+func (c *conn) close(code int, text string) {
+	c.once.Do(func() {
+		c.closeCode = code
+		c.closeText = text
+		close(c.done)
+	})
+}
+
+// unsubscribe...購読していればやめる
+func (c *conn) unsubscribe() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.sub != nil {
+		c.sub.Close()
+	}
+}
+
+// writeLoop...queueのmessageを順に書き込み、ping間隔でpingを送る. doneが閉じたらclose frameを送って切る
+func (c *conn) writeLoop(ping, writeTimeout time.Duration) {
+	ticker := time.NewTicker(ping)
+	defer func() {
+		ticker.Stop()
+		c.ws.Close()
+	}()
+
+	for {
+		select {
+		case <-c.done:
+			message := websocket.FormatCloseMessage(c.closeCode, c.closeText)
+			c.ws.WriteControl(websocket.CloseMessage, message, time.Now().Add(writeTimeout))
+			return
+		case msg := <-c.send:
+			c.ws.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := c.ws.WriteJSON(msg); err != nil {
+				c.close(websocket.CloseAbnormalClosure, "")
+				return
+			}
+		case <-ticker.C:
+			if err := c.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeTimeout)); err != nil {
+				c.close(websocket.CloseAbnormalClosure, "")
+				return
+			}
+		}
+	}
+}
+
+// hub...プロセス内のWebSocket接続. presenceを同じfamilyに配り、shutdownで全て閉じる
+type hub struct {
+	mu     sync.Mutex
+	conns  map[*conn]struct{}
+	closed bool
+}
+
+func newHub() *hub {
+	return &hub{conns: map[*conn]struct{}{}}
+}
+
+// add...接続を覚える. shutdown後ならfalseを返す
+func (h *hub) add(c *conn) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return false
+	}
+	h.conns[c] = struct{}{}
+	return true
+}
+
+func (h *hub) remove(c *conn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.conns, c)
+}
+
+// broadcast...fromと同じfamilyの他の接続に送る. todoがあれば、そのtodoを見れる接続にだけ送る
+func (h *hub) broadcast(from *conn, msg serverMessage, todo *model.Todo) {
+	if from.caller.FamilyId == "" {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for c := range h.conns {
+		if c == from || c.caller.FamilyId != from.caller.FamilyId {
+			continue
+		}
+		if todo != nil && !todo.VisibleTo(c.caller) {
+			continue
+		}
+		c.enqueue(msg)
+	}
+}
+
+// close...以降の接続を断り、開いている接続を全て閉じる
+func (h *hub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for c := range h.conns {
+		c.close(websocket.CloseGoingAway, closeShutdown)
+	}
+}
@@ -0,0 +1,350 @@
+package v1ws
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/gorilla/websocket"
+
+	"github.com/sioncojp/famili-api/application/todoservice"
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/domain/model"
+	"github.com/sioncojp/famili-api/domain/repository"
+	"github.com/sioncojp/famili-api/infrastructure/stream"
+	httpresponse "github.com/sioncojp/famili-api/utils/http_response"
+	"github.com/sioncojp/famili-api/utils/i18n"
+)
+
+const (
+	ErrorMessageUnidentified      = "caller_not_identified"
+	ErrorMessageNotFound          = "todo_not_found"
+	ErrorValidation               = "missing_validation"
+	ErrorMessageInvalidMessage    = "invalid_message"
+	ErrorMessageRateLimited       = "rate_limited"
+	ErrorMessageInsufficientScope = "insufficient_scope"
+	ErrorMessageAlreadySubscribed = "already_subscribed"
+
+	// maxReorder...1回のreorderで並べられるtodoの数
+	maxReorder = 500
+)
+
+// messages...repositoryのerrorを返すときのerror message. RESTのtodoと揃える
+var messages = httpresponse.Messages{
+	http.StatusNotFound:   ErrorMessageNotFound,
+	http.StatusBadRequest: ErrorValidation,
+}
+
+// Options...接続ごとの制限
+type Options struct {
+	// MessagesPerSecond, Burst...1つの接続から受け付けるmessageの数. 超えたmessageはrate_limitedで断る
+	MessagesPerSecond float64
+	Burst             int
+	// QueueSize...1つの接続で送るのを待てるmessage数. 超えたら受け取りが遅いclientとして閉じる
+	QueueSize int
+	// MaxMessageBytes...clientから届く1つのmessageの上限. 超えたら閉じる
+	MaxMessageBytes int64
+	// PingInterval...pingを送る間隔. pongがPingInterval+WriteTimeoutの間届かなければ閉じる
+	PingInterval time.Duration
+	// WriteTimeout...1回の書き込みの上限
+	WriteTimeout time.Duration
+}
+
+// handler...
+type handler struct {
+	repo     repository.TodoRepository
+	todos    todoservice.Service
+	broker   *stream.Broker
+	options  Options
+	upgrader websocket.Upgrader
+	hub      *hub
+	now      func() time.Time
+}
+
+// NewHandler create a instance of this handler
+// todoの変更はRESTと同じtodoserviceで書き込み、relayがbrokerに流したeventを購読している接続に送る
+func NewHandler(repo repository.TodoRepository, todos todoservice.Service, broker *stream.Broker, options Options) Handler {
+	return &handler{
+		repo:    repo,
+		todos:   todos,
+		broker:  broker,
+		options: options,
+		hub:     newHub(),
+		now:     time.Now,
+	}
+}
+
+// Serve...WebSocketにupgradeし、閉じるまでclientのmessageを処理する
+func (s *handler) Serve(w http.ResponseWriter, r *http.Request) {
+	caller := domain.CallerFromContext(r.Context())
+	if caller.MemberId == "" && caller.FamilyId == "" {
+		httpresponse.Error(w, r, http.StatusUnauthorized, ErrorMessageUnidentified, "")
+		return
+	}
+
+	ws, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// upgraderが400などを返している
+		return
+	}
+	c := newConn(ws, caller, newLimiter(s.options.MessagesPerSecond, s.options.Burst, s.now()), s.options.QueueSize)
+	if !s.hub.add(c) {
+		c.close(websocket.CloseGoingAway, closeShutdown)
+	}
+	defer s.hub.remove(c)
+
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		c.writeLoop(s.options.PingInterval, s.options.WriteTimeout)
+	}()
+
+	s.readLoop(r.Context(), c)
+	c.close(websocket.CloseNormalClosure, "")
+	<-finished
+	c.unsubscribe()
+
+	// 入力中のまま切れたら、他のメンバーの表示が残らないようにidleを送る
+	if c.typing != nil {
+		s.hub.broadcast(c, presenceMessage(c, c.typing.todoId, PresenceIdle), c.typing.todo)
+	}
+}
+
+// Shutdown...開いている全ての接続を閉じる
+func (s *handler) Shutdown() {
+	s.hub.close()
+}
+
+// readLoop...clientのmessageを1つずつ処理する. 処理が終わるまで次を読まないので、送りすぎたclientはTCPで待たされる
+func (s *handler) readLoop(ctx context.Context, c *conn) {
+	pongWait := s.options.PingInterval + s.options.WriteTimeout
+	c.ws.SetReadLimit(s.options.MaxMessageBytes)
+	c.ws.SetReadDeadline(s.now().Add(pongWait))
+	c.ws.SetPongHandler(func(string) error {
+		return c.ws.SetReadDeadline(s.now().Add(pongWait))
+	})
+
+	for {
+		_, data, err := c.ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		c.ws.SetReadDeadline(s.now().Add(pongWait))
+
+		// 壊れたmessageも数えるので先にlimiterを通す. idが読めればerrorに入れる
+		var msg clientMessage
+		err = json.Unmarshal(data, &msg)
+		if !c.limiter.allow(s.now()) {
+			c.enqueue(serverMessage{Type: TypeError, Id: msg.Id, Error: ErrorMessageRateLimited})
+			continue
+		}
+		if err != nil {
+			c.enqueue(serverMessage{Type: TypeError, Error: ErrorMessageInvalidMessage, Warn: err.Error()})
+			continue
+		}
+		s.handle(ctx, c, msg)
+	}
+}
+
+// handle...typeごとに処理し、ackかerrorを返す
+func (s *handler) handle(ctx context.Context, c *conn, msg clientMessage) {
+	switch msg.Type {
+	case TypeSubscribe:
+		s.subscribe(c, msg)
+	case TypeMutate:
+		if scopes, ok := domain.ScopesFromContext(ctx); ok && !model.Scopes(scopes).Has(model.ScopeTodosWrite) {
+			c.enqueue(serverMessage{Type: TypeError, Id: msg.Id, Error: ErrorMessageInsufficientScope, Warn: model.ScopeTodosWrite})
+			return
+		}
+		ack, err := s.mutate(ctx, c.caller, msg)
+		if err != nil {
+			c.enqueue(errorMessage(ctx, msg.Id, err))
+			return
+		}
+		c.enqueue(ack)
+	case TypePresence:
+		if err := s.presence(ctx, c, msg); err != nil {
+			c.enqueue(errorMessage(ctx, msg.Id, err))
+			return
+		}
+		c.enqueue(serverMessage{Type: TypeAck, Id: msg.Id})
+	default:
+		c.enqueue(serverMessage{Type: TypeError, Id: msg.Id, Error: ErrorMessageInvalidMessage, Warn: "unknown type " + strconv.Quote(msg.Type)})
+	}
+}
+
+// subscribe...brokerの購読を始め、last_event_idの続きと以降のeventを送る. 購読は1つの接続に1つまで
+func (s *handler) subscribe(c *conn, msg clientMessage) {
+	c.mu.Lock()
+	if c.sub != nil {
+		c.mu.Unlock()
+		c.enqueue(serverMessage{Type: TypeError, Id: msg.Id, Error: ErrorMessageAlreadySubscribed})
+		return
+	}
+	sub, replay, ok := s.broker.Subscribe(msg.LastEventId)
+	c.sub = sub
+	c.mu.Unlock()
+
+	c.enqueue(serverMessage{Type: TypeAck, Id: msg.Id})
+	go s.forward(c, sub, replay, ok)
+}
+
+// forward...callerが見れるeventを送る. 購読が閉じたら接続も閉じ、clientにlast_event_idで再接続させる
+func (s *handler) forward(c *conn, sub *stream.Subscription, replay []stream.Message, ok bool) {
+	send := func(msg stream.Message) {
+		if msg.Event.Todo.VisibleTo(c.caller) {
+			event := msg.Event
+			c.enqueue(serverMessage{Type: TypeEvent, EventId: msg.ID, Event: &event})
+		}
+	}
+
+	if !ok {
+		c.enqueue(serverMessage{Type: TypeReset})
+	}
+	for _, v := range replay {
+		send(v)
+	}
+	for {
+		select {
+		case <-c.done:
+			return
+		case msg, ok := <-sub.C:
+			if ok {
+				send(msg)
+				continue
+			}
+			if s.broker.Closed() {
+				c.close(websocket.CloseGoingAway, closeShutdown)
+			} else {
+				c.close(websocket.CloseTryAgainLater, closeSlowConsumer)
+			}
+			return
+		}
+	}
+}
+
+// mutate...opごとにtodoを変更する. RESTと同じくmodelのValidateを通し、todoとeventを同じtransactionで書き込む
+func (s *handler) mutate(ctx context.Context, caller domain.Caller, msg clientMessage) (serverMessage, error) {
+	switch msg.Op {
+	case OpComplete, OpUpdate:
+		todo, err := s.change(ctx, caller, msg)
+		if err != nil {
+			return serverMessage{}, err
+		}
+		return serverMessage{Type: TypeAck, Id: msg.Id, Todo: &todo}, nil
+	case OpReorder:
+		todos, err := s.reorder(ctx, caller, msg.Order)
+		if err != nil {
+			return serverMessage{}, err
+		}
+		return serverMessage{Type: TypeAck, Id: msg.Id, Todos: todos}, nil
+	default:
+		return serverMessage{}, domain.NewValidationError(validation.Errors{
+			"op": i18n.NewError(i18n.EnumInvalid).SetParams(map[string]interface{}{
+				"values": strings.Join([]string{OpComplete, OpUpdate, OpReorder}, ", "),
+			}),
+		})
+	}
+}
+
+// change...complete, updateでtodoの値を変える
+func (s *handler) change(ctx context.Context, caller domain.Caller, msg clientMessage) (model.Todo, error) {
+	if msg.Op == OpComplete && msg.Completed == nil {
+		return model.Todo{}, domain.NewValidationError(validation.Errors{"completed": validation.ErrRequired})
+	}
+
+	// replicaやcacheの古いtodoを元に書き込まないようにprimaryから読む
+	todo, err := todoservice.Visible(domain.NewPrimaryContext(ctx), s.repo, caller, msg.TodoId)
+	if err != nil {
+		return model.Todo{}, err
+	}
+
+	next := todo
+	switch msg.Op {
+	case OpComplete:
+		next.Completed = *msg.Completed
+	case OpUpdate:
+		if msg.Title != nil {
+			next.Title = *msg.Title
+		}
+		if msg.Description != nil {
+			next.Description = *msg.Description
+		}
+	}
+	if err := s.todos.Update(ctx, &todo, next); err != nil {
+		return model.Todo{}, err
+	}
+	return todo, nil
+}
+
+// reorder...orderのtodoのpositionを先頭から1, 2, ...にする. 変わったtodoだけ書き込む
+func (s *handler) reorder(ctx context.Context, caller domain.Caller, order []uint) ([]model.Todo, error) {
+	if err := validateOrder(order); err != nil {
+		return nil, err
+	}
+	return s.todos.Reorder(ctx, caller, order)
+}
+
+// presence...入力中の状態を同じfamilyのメンバーに送る. todo_idがあれば、そのtodoを見れるメンバーにだけ送る
+func (s *handler) presence(ctx context.Context, c *conn, msg clientMessage) error {
+	if err := validation.Validate(msg.State,
+		validation.Required,
+		validation.In(PresenceTyping, PresenceIdle).ErrorObject(i18n.NewError(i18n.EnumInvalid).SetParams(map[string]interface{}{
+			"values": strings.Join([]string{PresenceTyping, PresenceIdle}, ", "),
+		})),
+	); err != nil {
+		return domain.NewValidationError(validation.Errors{"state": err})
+	}
+
+	var todo *model.Todo
+	if msg.TodoId != 0 {
+		v, err := todoservice.Visible(ctx, s.repo, c.caller, msg.TodoId)
+		if err != nil {
+			return err
+		}
+		todo = &v
+	}
+
+	if msg.State == PresenceTyping {
+		c.typing = &presence{todoId: msg.TodoId, todo: todo}
+	} else {
+		c.typing = nil
+	}
+	s.hub.broadcast(c, presenceMessage(c, msg.TodoId, msg.State), todo)
+	return nil
+}
+
+// validateOrder...reorderのorderは1件以上maxReorder件以下で、同じIDを含まない
+func validateOrder(order []uint) error {
+	if err := validation.Validate(order,
+		validation.Required,
+		validation.Length(1, maxReorder).ErrorObject(i18n.NewError(i18n.ItemsOutOfRange).SetParams(map[string]interface{}{
+			"min": 1, "max": maxReorder,
+		})),
+	); err != nil {
+		return domain.NewValidationError(validation.Errors{"order": err})
+	}
+	seen := make(map[uint]bool, len(order))
+	for _, id := range order {
+		if seen[id] {
+			return domain.NewValidationError(validation.Errors{"order": i18n.NewError(i18n.Duplicate).SetParams(map[string]interface{}{"value": id})})
+		}
+		seen[id] = true
+	}
+	return nil
+}
+
+// presenceMessage...cのメンバーの状態
+func presenceMessage(c *conn, todoId uint, state string) serverMessage {
+	return serverMessage{Type: TypePresence, MemberId: c.caller.MemberId, TodoId: todoId, State: state}
+}
+
+// errorMessage...RESTと同じerror, warnを返す. warnは接続したときのrequestの言語
+func errorMessage(ctx context.Context, id string, err error) serverMessage {
+	_, message, warn := httpresponse.Describe(ctx, err, messages)
+	return serverMessage{Type: TypeError, Id: id, Error: message, Warn: warn}
+}
@@ -0,0 +1,314 @@
+package v1ws
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sioncojp/famili-api/application/todoservice/todotest"
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/domain/model"
+	"github.com/sioncojp/famili-api/infrastructure/stream"
+)
+
+var (
+	ctx             = context.Background()
+	caller, sibling = todotest.Caller, todotest.Sibling
+	options         = Options{
+		MessagesPerSecond: 100,
+		Burst:             100,
+		QueueSize:         16,
+		MaxMessageBytes:   4096,
+		PingInterval:      time.Second,
+		WriteTimeout:      time.Second,
+	}
+)
+
+// fixture...todotestのrepositoryとserviceに、brokerとWebSocketのserverを足す
+type fixture struct {
+	*todotest.Fixture
+	handler Handler
+	broker  *stream.Broker
+	server  *httptest.Server
+}
+
+func newFixture(t *testing.T, o Options) *fixture {
+	f := &fixture{Fixture: todotest.NewFixture(), broker: stream.NewBroker(10, 10)}
+	f.handler = NewHandler(f.Todos, f.Service, f.broker, o)
+
+	// X-Test-Member-Idでcallerを切り替え、X-Test-Scopesがあれば API keyのscopeとして扱う
+	f.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := domain.Caller{MemberId: domain.Id(r.Header.Get("X-Test-Member-Id")), FamilyId: domain.Id(r.Header.Get("X-Test-Family-Id"))}
+		ctx := domain.NewCallerContext(r.Context(), c)
+		if scopes := r.Header.Get("X-Test-Scopes"); scopes != "" {
+			ctx = domain.NewScopesContext(ctx, strings.Split(scopes, ","))
+		}
+		f.handler.Serve(w, r.WithContext(ctx))
+	}))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+// dial...callerとして接続する
+func (f *fixture) dial(t *testing.T, c domain.Caller, scopes ...string) *websocket.Conn {
+	header := http.Header{}
+	header.Set("X-Test-Member-Id", string(c.MemberId))
+	header.Set("X-Test-Family-Id", string(c.FamilyId))
+	if len(scopes) > 0 {
+		header.Set("X-Test-Scopes", strings.Join(scopes, ","))
+	}
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(f.server.URL, "http"), header)
+	require.NoError(t, err)
+	t.Cleanup(func() { ws.Close() })
+	return ws
+}
+
+// send...messageを送り、次に届いたmessageを返す
+func send(t *testing.T, ws *websocket.Conn, msg map[string]interface{}) serverMessage {
+	require.NoError(t, ws.WriteJSON(msg))
+	return read(t, ws)
+}
+
+// read...次に届いたmessageを返す
+func read(t *testing.T, ws *websocket.Conn) serverMessage {
+	var msg serverMessage
+	ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	require.NoError(t, ws.ReadJSON(&msg))
+	return msg
+}
+
+func TestServeUnidentified(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t, options)
+	_, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(f.server.URL, "http"), nil)
+	assert.Equal(t, websocket.ErrBadHandshake, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestMutateComplete(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t, options)
+	todo := f.Create(t, caller, "buy milk", model.VisibilityFamily)
+	ws := f.dial(t, sibling)
+
+	got := send(t, ws, map[string]interface{}{"type": TypeMutate, "id": "a", "op": OpComplete, "todo_id": todo.ID, "completed": true})
+	assert.Equal(t, TypeAck, got.Type)
+	assert.Equal(t, "a", got.Id)
+	require.NotNil(t, got.Todo)
+	assert.True(t, got.Todo.Completed)
+
+	stored, err := f.Todos.GetById(ctx, "1")
+	require.NoError(t, err)
+	assert.True(t, stored.Completed)
+
+	events := f.Events(t)
+	require.Len(t, events, 2)
+	assert.Equal(t, model.EventTodoUpdated, events[0].Type)
+	assert.Equal(t, model.EventTodoCompleted, events[1].Type)
+}
+
+func TestMutateErrors(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t, options)
+	todo := f.Create(t, caller, "buy milk", model.VisibilityFamily)
+	private := f.Create(t, caller, "diary", model.VisibilityPrivate)
+
+	cases := []struct {
+		name   string
+		scopes []string
+		msg    map[string]interface{}
+		want   string
+		warn   string
+	}{
+		{"validation", nil, map[string]interface{}{"op": OpUpdate, "todo_id": todo.ID, "title": ""}, ErrorValidation, "title: is required."},
+		{"missing completed", nil, map[string]interface{}{"op": OpComplete, "todo_id": todo.ID}, ErrorValidation, "completed: is required."},
+		{"unknown op", nil, map[string]interface{}{"op": "archive"}, ErrorValidation, "op: must be one of complete, update, reorder."},
+		{"private", nil, map[string]interface{}{"op": OpComplete, "todo_id": private.ID, "completed": true}, ErrorMessageNotFound, ""},
+		{"not found", nil, map[string]interface{}{"op": OpComplete, "todo_id": 99, "completed": true}, ErrorMessageNotFound, ""},
+		{"duplicate order", nil, map[string]interface{}{"op": OpReorder, "order": []uint{todo.ID, todo.ID}}, ErrorValidation, "order: contains 1 twice."},
+		{"read only key", []string{model.ScopeTodosRead}, map[string]interface{}{"op": OpComplete, "todo_id": todo.ID, "completed": true}, ErrorMessageInsufficientScope, model.ScopeTodosWrite},
+	}
+	for _, v := range cases {
+		v := v
+		t.Run(v.name, func(tt *testing.T) {
+			ws := f.dial(tt, sibling, v.scopes...)
+			v.msg["type"] = TypeMutate
+			v.msg["id"] = v.name
+			got := send(tt, ws, v.msg)
+			assert.Equal(tt, serverMessage{Type: TypeError, Id: v.name, Error: v.want, Warn: v.warn}, got)
+		})
+	}
+
+	// 失敗したmutateはtodoもeventも書き込まない
+	stored, err := f.Todos.GetById(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, "buy milk", stored.Title)
+	events := f.Events(t)
+	assert.Empty(t, events)
+}
+
+func TestMutateReorder(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t, options)
+	a := f.Create(t, caller, "a", model.VisibilityFamily)
+	b := f.Create(t, caller, "b", model.VisibilityFamily)
+	c := f.Create(t, caller, "c", model.VisibilityFamily)
+	ws := f.dial(t, caller)
+
+	got := send(t, ws, map[string]interface{}{"type": TypeMutate, "id": "r", "op": OpReorder, "order": []uint{c.ID, a.ID, b.ID}})
+	require.Equal(t, TypeAck, got.Type)
+	require.Len(t, got.Todos, 3)
+	assert.Equal(t, []int{1, 2, 3}, []int{got.Todos[0].Position, got.Todos[1].Position, got.Todos[2].Position})
+
+	list, err := f.Todos.List(ctx, caller)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c", "a", "b"}, []string{list[0].Title, list[1].Title, list[2].Title})
+
+	// positionが変わらなければ書き込まない
+	got = send(t, ws, map[string]interface{}{"type": TypeMutate, "id": "r2", "op": OpReorder, "order": []uint{c.ID, b.ID}})
+	require.Equal(t, TypeAck, got.Type)
+	events := f.Events(t)
+	assert.Len(t, events, 4)
+}
+
+func TestSubscribe(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t, options)
+	ws := f.dial(t, sibling)
+
+	got := send(t, ws, map[string]interface{}{"type": TypeSubscribe, "id": "s"})
+	assert.Equal(t, serverMessage{Type: TypeAck, Id: "s"}, got)
+	got = send(t, ws, map[string]interface{}{"type": TypeSubscribe, "id": "s2"})
+	assert.Equal(t, serverMessage{Type: TypeError, Id: "s2", Error: ErrorMessageAlreadySubscribed}, got)
+
+	private := model.Todo{Model: model.Model{ID: 1}, CreatedBy: caller.MemberId, FamilyId: caller.FamilyId, Visibility: model.VisibilityPrivate}
+	family := model.Todo{Model: model.Model{ID: 2}, CreatedBy: caller.MemberId, FamilyId: caller.FamilyId, Visibility: model.VisibilityFamily}
+	require.NoError(t, f.broker.Send(ctx, model.Event{ID: 1, Type: model.EventTodoCreated, TodoId: 1, Todo: private}))
+	require.NoError(t, f.broker.Send(ctx, model.Event{ID: 2, Type: model.EventTodoCreated, TodoId: 2, Todo: family}))
+
+	// 見れないprivateのtodoは届かない
+	got = read(t, ws)
+	assert.Equal(t, TypeEvent, got.Type)
+	require.NotNil(t, got.Event)
+	assert.Equal(t, uint(2), got.Event.TodoId)
+	assert.NotEmpty(t, got.EventId)
+
+	// 別の接続でlast_event_idの続きを受け取れる. 前のプロセスのIDならresetを送る
+	ws = f.dial(t, caller)
+	assert.Equal(t, TypeAck, send(t, ws, map[string]interface{}{"type": TypeSubscribe, "id": "s", "last_event_id": "0-0"}).Type)
+	assert.Equal(t, TypeReset, read(t, ws).Type)
+}
+
+func TestPresence(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t, options)
+	todo := f.Create(t, caller, "buy milk", model.VisibilityFamily)
+	private := f.Create(t, caller, "diary", model.VisibilityPrivate)
+	a := f.dial(t, caller)
+	b := f.dial(t, sibling)
+	other := f.dial(t, domain.Caller{MemberId: "3", FamilyId: "f2"})
+
+	got := send(t, a, map[string]interface{}{"type": TypePresence, "id": "p", "todo_id": todo.ID, "state": PresenceTyping})
+	assert.Equal(t, serverMessage{Type: TypeAck, Id: "p"}, got)
+	assert.Equal(t, serverMessage{Type: TypePresence, MemberId: caller.MemberId, TodoId: todo.ID, State: PresenceTyping}, read(t, b))
+
+	// 見れないtodoのpresenceはbに届かない. 次にbに届くのがp4であることで確かめる
+	got = send(t, a, map[string]interface{}{"type": TypePresence, "id": "p2", "todo_id": private.ID, "state": PresenceTyping})
+	assert.Equal(t, serverMessage{Type: TypeAck, Id: "p2"}, got)
+	got = send(t, a, map[string]interface{}{"type": TypePresence, "id": "p3", "state": "sleeping"})
+	assert.Equal(t, serverMessage{Type: TypeError, Id: "p3", Error: ErrorValidation, Warn: "state: must be one of typing, idle."}, got)
+
+	got = send(t, a, map[string]interface{}{"type": TypePresence, "id": "p4", "state": PresenceTyping})
+	assert.Equal(t, serverMessage{Type: TypeAck, Id: "p4"}, got)
+	assert.Equal(t, serverMessage{Type: TypePresence, MemberId: caller.MemberId, State: PresenceTyping}, read(t, b))
+
+	// 入力中のまま切れたらidleを送る
+	a.Close()
+	assert.Equal(t, serverMessage{Type: TypePresence, MemberId: caller.MemberId, State: PresenceIdle}, read(t, b))
+
+	// 別familyには何も届かない
+	got = send(t, other, map[string]interface{}{"type": TypePresence, "id": "o", "state": PresenceIdle})
+	assert.Equal(t, serverMessage{Type: TypeAck, Id: "o"}, got)
+}
+
+func TestRateLimit(t *testing.T) {
+	t.Parallel()
+	o := options
+	o.MessagesPerSecond = 0.001
+	o.Burst = 2
+	f := newFixture(t, o)
+	ws := f.dial(t, caller)
+
+	for _, id := range []string{"1", "2"} {
+		got := send(t, ws, map[string]interface{}{"type": TypePresence, "id": id, "state": PresenceIdle})
+		assert.Equal(t, TypeAck, got.Type)
+	}
+	got := send(t, ws, map[string]interface{}{"type": TypePresence, "id": "3", "state": PresenceIdle})
+	assert.Equal(t, serverMessage{Type: TypeError, Id: "3", Error: ErrorMessageRateLimited}, got)
+}
+
+func TestMessageTooBig(t *testing.T) {
+	t.Parallel()
+	o := options
+	o.MaxMessageBytes = 64
+	f := newFixture(t, o)
+	ws := f.dial(t, caller)
+
+	require.NoError(t, ws.WriteJSON(map[string]interface{}{"type": TypePresence, "id": strings.Repeat("x", 100)}))
+	ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err := ws.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseMessageTooBig), "got %v", err)
+}
+
+func TestShutdown(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t, options)
+	ws := f.dial(t, caller)
+	assert.Equal(t, TypeAck, send(t, ws, map[string]interface{}{"type": TypeSubscribe, "id": "s"}).Type)
+
+	f.handler.Shutdown()
+	ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err := ws.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway), "got %v", err)
+}
+
+func TestEnqueueSlowConsumer(t *testing.T) {
+	t.Parallel()
+	c := newConn(nil, caller, nil, 1)
+	c.enqueue(serverMessage{Type: TypeAck})
+	c.enqueue(serverMessage{Type: TypeAck})
+
+	select {
+	case <-c.done:
+	default:
+		t.Fatal("conn is not closed")
+	}
+	assert.Equal(t, websocket.CloseTryAgainLater, c.closeCode)
+	assert.Equal(t, closeSlowConsumer, c.closeText)
+}
+
+func TestLimiter(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	l := newLimiter(2, 3, now)
+	for i := 0; i < 3; i++ {
+		assert.True(t, l.allow(now))
+	}
+	assert.False(t, l.allow(now))
+
+	// 0.5秒で1つ戻り、burstより多くは貯まらない
+	assert.True(t, l.allow(now.Add(500*time.Millisecond)))
+	assert.False(t, l.allow(now.Add(500*time.Millisecond)))
+	now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		assert.True(t, l.allow(now))
+	}
+	assert.False(t, l.allow(now))
+}
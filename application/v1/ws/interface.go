@@ -0,0 +1,12 @@
+package v1ws
+
+import (
+	"net/http"
+)
+
+// Handler...interfaceを使うことでDIPを解決する。mockも作成できるようになる
+type Handler interface {
+	Serve(w http.ResponseWriter, r *http.Request)
+	// Shutdown...開いている全ての接続を閉じる. http.ServerのRegisterOnShutdownに渡す
+	Shutdown()
+}
@@ -0,0 +1,84 @@
+package v1ws
+
+import (
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/domain/model"
+)
+
+// clientから届くmessageのtype
+const (
+	// TypeSubscribe...todoの変更を受け取り始める. last_event_idがあれば続きから送り直す
+	TypeSubscribe = "subscribe"
+	// TypeMutate...todoを変更する. opで変更の種類を指定する
+	TypeMutate = "mutate"
+	// TypePresence...入力中などの状態を同じfamilyに知らせる. 保存はしない
+	TypePresence = "presence"
+)
+
+// serverから送るmessageのtype. TypePresenceは他のメンバーの状態として送る
+const (
+	// TypeAck...idのmessageを受け付けた
+	TypeAck = "ack"
+	// TypeError...idのmessageを受け付けなかった. errorとwarnはRESTと同じ
+	TypeError = "error"
+	// TypeEvent...todoの変更. event_idをlast_event_idに使える
+	TypeEvent = "event"
+	// TypeReset...last_event_idの続きを返せない. clientはGET /v1/todosで読み直す
+	TypeReset = "reset"
+)
+
+// TypeMutateのop
+const (
+	// OpComplete...completedを切り替える
+	OpComplete = "complete"
+	// OpUpdate...title, descriptionを変える. 公開範囲はRESTで変える
+	OpUpdate = "update"
+	// OpReorder...orderのtodoを先頭から順に並べる
+	OpReorder = "reorder"
+)
+
+// TypePresenceのstate
+const (
+	PresenceTyping = "typing"
+	PresenceIdle   = "idle"
+)
+
+// clientMessage...clientから届くmessage. typeごとに使うfieldが違う
+type clientMessage struct {
+	Type string `json:"type"`
+	// Id...ack, errorに入れて返す. clientが対応を取るために使う
+	Id string `json:"id"`
+
+	// LastEventId...subscribe. 最後に受け取ったeventのevent_id
+	LastEventId string `json:"last_event_id"`
+
+	// Op...mutate
+	Op string `json:"op"`
+	// TodoId...mutateのcomplete, update, presence. presenceで0ならlist全体
+	TodoId      uint    `json:"todo_id"`
+	Completed   *bool   `json:"completed"`
+	Title       *string `json:"title"`
+	Description *string `json:"description"`
+	// Order...mutateのreorder. 並べたいtodoのID
+	Order []uint `json:"order"`
+
+	// State...presence. typing or idle
+	State string `json:"state"`
+}
+
+// serverMessage...serverから送るmessage
+type serverMessage struct {
+	Type  string       `json:"type"`
+	Id    string       `json:"id,omitempty"`
+	Error string       `json:"error,omitempty"`
+	Warn  string       `json:"warn,omitempty"`
+	Todo  *model.Todo  `json:"todo,omitempty"`
+	Todos []model.Todo `json:"todos,omitempty"`
+
+	EventId string       `json:"event_id,omitempty"`
+	Event   *model.Event `json:"event,omitempty"`
+
+	MemberId domain.Id `json:"member_id,omitempty"`
+	TodoId   uint      `json:"todo_id,omitempty"`
+	State    string    `json:"state,omitempty"`
+}
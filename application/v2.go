@@ -0,0 +1,35 @@
+package application
+
+import (
+	"github.com/go-chi/chi/v5"
+
+	v2todos "github.com/sioncojp/famili-api/application/v2/todos"
+	"github.com/sioncojp/famili-api/domain/model"
+	"github.com/sioncojp/famili-api/utils/config"
+	httpresponse "github.com/sioncojp/famili-api/utils/http_response"
+)
+
+// V2.../v2 で利用するstructを格納. IDはstringで、errorはRFC 7807で返す
+type V2 struct {
+	TodosHandler v2todos.Handler
+}
+
+func (v *V2) Name() string { return config.VersionV2 }
+
+func (v *V2) ErrorFormat() httpresponse.Format { return httpresponse.FormatProblem }
+
+// Route.../v2のroute. scopeはv1の同じrouteに合わせ、どのrouteもbearerで認証したCallerが必要
+func (v *V2) Route(r chi.Router, s *HttpHandler) {
+	r.Use(requireCaller)
+	r.Route("/todos", func(r chi.Router) {
+		r.With(requireScope(model.ScopeTodosRead)).Get("/", v.TodosHandler.List)
+		r.With(requireScope(model.ScopeTodosWrite)).Post("/", v.TodosHandler.Create)
+		r.Route("/{id}", func(r chi.Router) {
+			r.Use(requireScope(model.ScopeTodosRead))
+			r.Use(v.TodosHandler.Ctx)
+			r.Get("/", v.TodosHandler.Get)
+			r.With(requireScope(model.ScopeTodosWrite)).Put("/", v.TodosHandler.Update)
+			r.With(requireScope(model.ScopeTodosWrite)).Delete("/", v.TodosHandler.Delete)
+		})
+	})
+}
@@ -0,0 +1,84 @@
+package v2todos
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/sioncojp/famili-api/domain/model"
+)
+
+// Todo.../v2で返すtodo. IDはJavaScriptの数値の範囲を気にしなくていいようにstringで返す
+type Todo struct {
+	Id          string           `json:"id"`
+	Title       string           `json:"title"`
+	Description string           `json:"description"`
+	Completed   bool             `json:"completed"`
+	Position    int              `json:"position"`
+	Visibility  model.Visibility `json:"visibility"`
+	CreatedBy   string           `json:"created_by"`
+	FamilyId    string           `json:"family_id"`
+	AssigneeIds []string         `json:"assignee_ids"`
+	ShareToken  string           `json:"share_token,omitempty"`
+	CreatedAt   time.Time        `json:"created_at"`
+	UpdatedAt   time.Time        `json:"updated_at"`
+}
+
+// TodoInput...POST, PUT /v2/todos のbody. 省略したpositionは変えず、visibilityは作るときはfamily, 変えるときは今のまま
+type TodoInput struct {
+	Title       string           `json:"title"`
+	Description string           `json:"description"`
+	Completed   bool             `json:"completed,omitempty"`
+	Position    *int             `json:"position,omitempty"`
+	Visibility  model.Visibility `json:"visibility,omitempty"`
+}
+
+// todoList...GET /v2/todos のresponse
+type todoList struct {
+	Todos []Todo `json:"todos"`
+}
+
+// NewTodo...modelのtodoを/v2の形にする
+func NewTodo(t model.Todo) Todo {
+	assignees := make([]string, 0, len(t.AssigneeIds))
+	for _, v := range t.AssigneeIds {
+		assignees = append(assignees, strconv.FormatUint(uint64(v), 10))
+	}
+	return Todo{
+		Id:          strconv.FormatUint(uint64(t.ID), 10),
+		Title:       t.Title,
+		Description: t.Description,
+		Completed:   t.Completed,
+		Position:    t.Position,
+		Visibility:  t.Visibility,
+		CreatedBy:   string(t.CreatedBy),
+		FamilyId:    string(t.FamilyId),
+		AssigneeIds: assignees,
+		ShareToken:  t.ShareToken,
+		CreatedAt:   t.CreatedAt,
+		UpdatedAt:   t.UpdatedAt,
+	}
+}
+
+// newTodoList...nilのsliceでも [] で返す
+func newTodoList(todos []model.Todo) todoList {
+	out := todoList{Todos: make([]Todo, 0, len(todos))}
+	for _, v := range todos {
+		out.Todos = append(out.Todos, NewTodo(v))
+	}
+	return out
+}
+
+// apply...inputをtodoに反映したnextを返す. completed, title, descriptionは置き換える
+func (in TodoInput) apply(todo model.Todo) model.Todo {
+	next := todo
+	next.Title = in.Title
+	next.Description = in.Description
+	next.Completed = in.Completed
+	if in.Position != nil {
+		next.Position = *in.Position
+	}
+	if in.Visibility != "" {
+		next.Visibility = in.Visibility
+	}
+	return next
+}
@@ -0,0 +1,145 @@
+package v2todos
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pkg/errors"
+
+	"github.com/sioncojp/famili-api/application/todoservice"
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/domain/model"
+	"github.com/sioncojp/famili-api/domain/repository"
+	httpresponse "github.com/sioncojp/famili-api/utils/http_response"
+)
+
+const (
+	ErrorMessageNotFound        = "todo_not_found"
+	ErrorMessageInvalidProvided = "invalid_todo_provided"
+	ErrorMessageMissingArgument = "missing_argument"
+	ErrorValidation             = "missing_validation"
+	ErrorMessageUnidentified    = "caller_not_identified"
+)
+
+// messages...repositoryのerrorを返すときのerror message. それ以外のstatusはhttpresponseのdefaultを使う
+var messages = httpresponse.Messages{
+	http.StatusNotFound:   ErrorMessageNotFound,
+	http.StatusBadRequest: ErrorValidation,
+}
+
+type todoKey struct{}
+
+type handler struct {
+	repo  repository.TodoRepository
+	todos todoservice.Service
+}
+
+// NewHandler create a instance of this handler
+// todoの書き込みと一覧はv1と同じtodoserviceを使うので、/v1/syncや/v1/wsにも届く
+func NewHandler(repo repository.TodoRepository, todos todoservice.Service) Handler {
+	return &handler{repo: repo, todos: todos}
+}
+
+// Ctx...{id}のtodoをcontextに格納する. IDは数字の文字列で、数字でなければ存在しないものとしてnot foundにする
+func (s *handler) Ctx(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "id")
+		if n, err := strconv.ParseUint(id, 10, 64); err != nil || n == 0 {
+			httpresponse.Error(w, r, http.StatusNotFound, ErrorMessageNotFound, "")
+			return
+		}
+
+		// 書き込むrouteでは、replicaやcacheの古いtodoを元に書き込まないようにprimaryから読む
+		ctx := r.Context()
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			ctx = domain.NewPrimaryContext(ctx)
+		}
+		todo, err := s.repo.GetById(ctx, domain.Id(id))
+		if err != nil {
+			httpresponse.FromError(w, r, err, messages)
+			return
+		}
+		// 見れないtodoは存在自体を隠すためnot foundにする
+		if !todo.VisibleTo(domain.CallerFromContext(r.Context())) {
+			httpresponse.Error(w, r, http.StatusNotFound, ErrorMessageNotFound, "")
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), todoKey{}, &todo)))
+	})
+}
+
+// List...見れるtodoを返す. ?assignee=me で自分がassigneeのtodoに絞り込める
+func (s *handler) List(w http.ResponseWriter, r *http.Request) {
+	out, err := s.todos.List(r.Context(), domain.CallerFromContext(r.Context()), r.URL.Query().Get("assignee"))
+	if errors.Is(err, todoservice.ErrUnidentified) {
+		httpresponse.Error(w, r, http.StatusUnauthorized, ErrorMessageUnidentified, "")
+		return
+	}
+	if err != nil {
+		httpresponse.FromError(w, r, err, messages)
+		return
+	}
+
+	httpresponse.JSON(w, r, http.StatusOK, newTodoList(out))
+}
+
+// Get...{id}のtodoを返す
+func (s *handler) Get(w http.ResponseWriter, r *http.Request) {
+	todo := r.Context().Value(todoKey{}).(*model.Todo)
+	httpresponse.JSON(w, r, http.StatusOK, NewTodo(*todo))
+}
+
+// Create...todoを作り、作ったtodoを201で返す. v1と同じく未完了で作り、作成者とfamilyはcallerにする
+func (s *handler) Create(w http.ResponseWriter, r *http.Request) {
+	in := TodoInput{}
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		httpresponse.Error(w, r, http.StatusBadRequest, ErrorMessageMissingArgument, "")
+		return
+	}
+
+	result := in.apply(model.Todo{Visibility: model.VisibilityFamily})
+	if err := s.todos.Create(r.Context(), domain.CallerFromContext(r.Context()), &result); err != nil {
+		httpresponse.FromError(w, r, err, messages)
+		return
+	}
+
+	out := NewTodo(result)
+	w.Header().Set("Location", "/v2/todos/"+out.Id)
+	httpresponse.JSON(w, r, http.StatusCreated, out)
+}
+
+// Update...todoを置き換えて、変えたtodoを返す
+func (s *handler) Update(w http.ResponseWriter, r *http.Request) {
+	in := TodoInput{}
+	todo := r.Context().Value(todoKey{}).(*model.Todo)
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		httpresponse.Error(w, r, http.StatusBadRequest, ErrorMessageMissingArgument, "")
+		return
+	}
+
+	if err := s.todos.Update(r.Context(), todo, in.apply(*todo)); err != nil {
+		httpresponse.FromError(w, r, err, messages)
+		return
+	}
+
+	httpresponse.JSON(w, r, http.StatusOK, NewTodo(*todo))
+}
+
+// Delete...todoを削除して204を返す
+func (s *handler) Delete(w http.ResponseWriter, r *http.Request) {
+	todo := r.Context().Value(todoKey{}).(*model.Todo)
+	defer r.Body.Close()
+
+	if err := s.todos.Delete(r.Context(), todo); err != nil {
+		httpresponse.FromError(w, r, err, messages)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
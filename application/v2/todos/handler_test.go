@@ -0,0 +1,178 @@
+package v2todos
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sioncojp/famili-api/application/todoservice/todotest"
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/domain/model"
+	httpresponse "github.com/sioncojp/famili-api/utils/http_response"
+)
+
+// 同じfamilyのcaller, siblingと別familyのother
+var caller, sibling, other = todotest.Caller, todotest.Sibling, todotest.Other
+
+// newRouter.../v2と同じくerrorをproblemで返すrouter
+func newRouter(f *todotest.Fixture) chi.Router {
+	h := NewHandler(f.Todos, f.Service)
+	r := chi.NewRouter()
+	r.Use(httpresponse.WithFormat(httpresponse.FormatProblem))
+	r.Get("/v2/todos", h.List)
+	r.Post("/v2/todos", h.Create)
+	r.Route("/v2/todos/{id}", func(r chi.Router) {
+		r.Use(h.Ctx)
+		r.Get("/", h.Get)
+		r.Put("/", h.Update)
+		r.Delete("/", h.Delete)
+	})
+	return r
+}
+
+func decodeTodo(t *testing.T, w *httptest.ResponseRecorder) Todo {
+	var out Todo
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&out))
+	return out
+}
+
+func decodeProblem(t *testing.T, w *httptest.ResponseRecorder) httpresponse.Problem {
+	assert.Equal(t, httpresponse.ContentTypeProblem, w.Header().Get("Content-Type"))
+	var out httpresponse.Problem
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&out))
+	return out
+}
+
+func TestNewTodo(t *testing.T) {
+	t.Parallel()
+	todo := model.Todo{CreatedBy: "1", FamilyId: "f1", AssigneeIds: []uint{2, 3}}
+	todo.ID = 12
+	out := NewTodo(todo)
+	assert.Equal(t, "12", out.Id)
+	assert.Equal(t, "1", out.CreatedBy)
+	assert.Equal(t, []string{"2", "3"}, out.AssigneeIds)
+
+	// assigneeが居なくても [] で返す
+	todo = model.Todo{}
+	todo.ID = 1
+	b, err := json.Marshal(NewTodo(todo))
+	require.NoError(t, err)
+	assert.Contains(t, string(b), `"assignee_ids":[]`)
+	assert.Contains(t, string(b), `"id":"1"`)
+}
+
+func TestTodoLifecycle(t *testing.T) {
+	t.Parallel()
+	f := todotest.NewFixture()
+	router := newRouter(f)
+
+	w := todotest.Do(router, caller, http.MethodPost, "/v2/todos", `{"title": "牛乳", "description": "2本", "completed": true, "position": 2}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	created := decodeTodo(t, w)
+	assert.Equal(t, "/v2/todos/"+created.Id, w.Header().Get("Location"))
+	assert.Equal(t, "1", created.CreatedBy)
+	assert.Equal(t, "f1", created.FamilyId)
+	assert.Equal(t, model.VisibilityFamily, created.Visibility)
+	assert.Equal(t, 2, created.Position)
+	assert.False(t, created.Completed)
+
+	// 同じfamilyのメンバーにも見え、一覧は {"todos": [...]} で返る
+	w = todotest.Do(router, sibling, http.MethodGet, "/v2/todos", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var list todoList
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&list))
+	if assert.Len(t, list.Todos, 1) {
+		assert.Equal(t, created.Id, list.Todos[0].Id)
+	}
+
+	// positionを省略したら今の値のまま
+	w = todotest.Do(router, caller, http.MethodPut, "/v2/todos/"+created.Id, `{"title": "牛乳", "description": "3本", "completed": true}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	updated := decodeTodo(t, w)
+	assert.Equal(t, "3本", updated.Description)
+	assert.True(t, updated.Completed)
+	assert.Equal(t, 2, updated.Position)
+
+	w = todotest.Do(router, caller, http.MethodGet, "/v2/todos/"+created.Id, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, updated.Description, decodeTodo(t, w).Description)
+
+	w = todotest.Do(router, caller, http.MethodDelete, "/v2/todos/"+created.Id, "")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Empty(t, w.Body.String())
+
+	w = todotest.Do(router, caller, http.MethodGet, "/v2/todos/"+created.Id, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// v1と同じくoutboxとchangesに書き込むので、webhookや/v1/syncにも届く
+	assert.Equal(t, []model.EventType{
+		model.EventTodoCreated, model.EventTodoUpdated, model.EventTodoCompleted, model.EventTodoDeleted,
+	}, f.EventTypes(t))
+	changes, err := f.Changes.Since(context.Background(), caller, 0, 10)
+	require.NoError(t, err)
+	if assert.Len(t, changes, 1) {
+		assert.True(t, changes[0].Deleted)
+	}
+}
+
+func TestTodoNotFound(t *testing.T) {
+	t.Parallel()
+	f := todotest.NewFixture()
+	router := newRouter(f)
+	f.Create(t, caller, "a", model.VisibilityFamily)
+
+	cases := []struct {
+		name   string
+		caller domain.Caller
+		id     string
+	}{
+		{name: "not a number", caller: caller, id: "abc"},
+		{name: "zero", caller: caller, id: "0"},
+		{name: "missing", caller: caller, id: "99"},
+		{name: "other family", caller: other, id: "1"},
+	}
+	for _, v := range cases {
+		v := v
+		t.Run(v.name, func(tt *testing.T) {
+			tt.Parallel()
+			w := todotest.Do(router, v.caller, http.MethodGet, "/v2/todos/"+v.id, "")
+			assert.Equal(tt, http.StatusNotFound, w.Code)
+			assert.Equal(tt, httpresponse.ProblemTypePrefix+ErrorMessageNotFound, decodeProblem(tt, w).Type)
+		})
+	}
+}
+
+func TestTodoInvalid(t *testing.T) {
+	t.Parallel()
+	f := todotest.NewFixture()
+	router := newRouter(f)
+
+	cases := []struct {
+		name   string
+		caller domain.Caller
+		method string
+		path   string
+		body   string
+		status int
+		error  string
+	}{
+		{name: "broken json", caller: caller, method: http.MethodPost, path: "/v2/todos", body: `{`, status: http.StatusBadRequest, error: ErrorMessageMissingArgument},
+		{name: "validation", caller: caller, method: http.MethodPost, path: "/v2/todos", body: `{"title": "", "description": "b"}`, status: http.StatusBadRequest, error: ErrorValidation},
+		{name: "unidentified", caller: domain.Caller{}, method: http.MethodGet, path: "/v2/todos?assignee=me", status: http.StatusUnauthorized, error: ErrorMessageUnidentified},
+	}
+	for _, v := range cases {
+		v := v
+		t.Run(v.name, func(tt *testing.T) {
+			tt.Parallel()
+			w := todotest.Do(router, v.caller, v.method, v.path, v.body)
+			assert.Equal(tt, v.status, w.Code)
+			assert.Equal(tt, httpresponse.ProblemTypePrefix+v.error, decodeProblem(tt, w).Type)
+		})
+	}
+}
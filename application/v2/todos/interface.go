@@ -0,0 +1,15 @@
+package v2todos
+
+import (
+	"net/http"
+)
+
+// Handler.../v2/todos のhandler. todoの書き込みと一覧はv1と同じtodoserviceを使い、requestとresponseの形だけを変える
+type Handler interface {
+	Ctx(next http.Handler) http.Handler
+	List(w http.ResponseWriter, r *http.Request)
+	Get(w http.ResponseWriter, r *http.Request)
+	Create(w http.ResponseWriter, r *http.Request)
+	Update(w http.ResponseWriter, r *http.Request)
+	Delete(w http.ResponseWriter, r *http.Request)
+}
@@ -0,0 +1,52 @@
+package application
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+
+	"github.com/sioncojp/famili-api/openapi"
+	httpresponse "github.com/sioncojp/famili-api/utils/http_response"
+	"github.com/sioncojp/famili-api/utils/i18n"
+)
+
+// maxBodyBytes...validateRequestが読むbodyの上限
+const maxBodyBytes = 1 << 20
+
+// validateRequest...documentのschemaでpath parameter, query, bodyを確かめる. 不正ならhandlerに渡さずに400とfieldごとのerrorを返す
+// documentに無いrouteはそのまま渡し、404, 405はrouterに任せる
+func validateRequest(d *openapi.Document) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			o, params := d.Find(r.Method, r.URL.Path)
+			if o == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			var body []byte
+			if o.RequestBody != nil {
+				b, err := io.ReadAll(io.LimitReader(r.Body, maxBodyBytes+1))
+				r.Body.Close()
+				switch {
+				case err != nil:
+					httpresponse.Invalid(w, r, []httpresponse.FieldError{httpresponse.NewFieldError(openapi.InBody, "", i18n.BodyUnreadable, nil)})
+					return
+				case len(b) > maxBodyBytes:
+					httpresponse.Invalid(w, r, []httpresponse.FieldError{
+						httpresponse.NewFieldError(openapi.InBody, "", i18n.BodyTooLarge, map[string]interface{}{"max": maxBodyBytes}),
+					})
+					return
+				}
+				// handlerがもう1度読めるように戻す
+				body, r.Body = b, io.NopCloser(bytes.NewReader(b))
+			}
+
+			if errs := d.ValidateRequest(o, params, r.URL.Query(), body); len(errs) > 0 {
+				httpresponse.Invalid(w, r, errs)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package application
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/sioncojp/famili-api/utils/config"
+	httpresponse "github.com/sioncojp/famili-api/utils/http_response"
+)
+
+// Version...API version. HttpHandler.Registerで足すと、NewRouterが /{Name} の下に
+// error format, 廃止予定のheader, 認証, documentでのvalidationを付けてからRouteを呼ぶ
+type Version interface {
+	// Name..."v1"のようなpathの先頭. [versions.{Name}]で廃止予定を書ける
+	Name() string
+	// ErrorFormat...errorのresponseの形. Accept: application/problem+json ならどのversionでもproblemになる
+	ErrorFormat() httpresponse.Format
+	// Route...versionのrouteを登録する
+	Route(r chi.Router, s *HttpHandler)
+}
+
+// shutdowner...server.Shutdownの前に閉じるものを持つversion. streamやWebSocketのように終わらないrequestを閉じる
+type shutdowner interface {
+	Shutdown()
+}
+
+// deprecation...versionの廃止予定をheaderで伝える. DeprecationはRFC 9745, SunsetはRFC 8594の形
+// ValidateVersionsConfigで確かめているので、ここでは日時が読めなかったら付けない
+func deprecation(c config.VersionConfig) func(http.Handler) http.Handler {
+	deprecated, sunset, err := c.Dates()
+	return func(next http.Handler) http.Handler {
+		if err != nil || deprecated.IsZero() && sunset.IsZero() {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !deprecated.IsZero() {
+				w.Header().Set("Deprecation", "@"+strconv.FormatInt(deprecated.Unix(), 10))
+			}
+			if !sunset.IsZero() {
+				w.Header().Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
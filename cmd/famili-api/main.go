@@ -12,6 +12,15 @@ import (
 func main() {
 	file := flag.String("c", "", "toml file")
 	flag.Parse()
+
+	// famili-api -c config.toml migrate up|down|status|force
+	if flag.Arg(0) == "migrate" {
+		os.Exit(Migrate(*file, flag.Args()[1:]))
+	}
+	// famili-api openapi > openapi/openapi.json
+	if flag.Arg(0) == "openapi" {
+		os.Exit(OpenAPI())
+	}
 	os.Exit(Run(*file))
 }
 
@@ -29,7 +38,10 @@ func Run(configFilePath string) int {
 		suggar.Errorf("%+v", err)
 		return 1
 	}
-	defer db.Close()
+	// [datastore] driver = "memory" のときはDBに接続しない
+	if db != nil {
+		defer db.Close()
+	}
 	app.RunServer()
 
 	return 0
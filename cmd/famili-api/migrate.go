@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/sioncojp/famili-api/di"
+	"github.com/sioncojp/famili-api/utils/migrate"
+)
+
+const migrateUsage = `usage: famili-api -c config.toml migrate <command>
+
+commands:
+  up             未適用のmigrationを全て適用する
+  down [N]       適用済みのmigrationをN個戻す. default: 1
+  status         DBのversionと未適用のmigrationを表示する
+  force VERSION  migrationを実行せずにversionを書き換えてdirtyを消す. -1なら初期状態
+  claim MEMBER   作成者とfamilyが空のtodoを、メンバーとそのfamilyのものにする
+                 visibilityを追加する前からあるtodoは、これを流すまで誰にも見えない
+`
+
+// Migrate...埋め込んだmigrationを[datastore] driverのDBに適用する
+func Migrate(configFilePath string, args []string) int {
+	logger, _ := zap.NewProduction()
+	defer logger.Sync()
+	suggar := logger.Sugar()
+
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	fs.StringVar(&configFilePath, "c", configFilePath, "toml file")
+	fs.Usage = func() { fmt.Fprint(os.Stderr, migrateUsage) }
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	m, db, err := di.NewMigrator(configFilePath)
+	if err != nil {
+		suggar.Errorf("%+v", err)
+		return 1
+	}
+	defer db.Close()
+
+	if err := runMigrate(context.Background(), m, fs.Args()); err != nil {
+		suggar.Errorf("%+v", err)
+		return 1
+	}
+	return 0
+}
+
+// runMigrate...subcommandを実行する
+func runMigrate(ctx context.Context, m *migrate.Migrator, args []string) error {
+	switch args[0] {
+	case "up":
+		n, err := m.Up(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("applied %d migrations\n", n)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			v, err := strconv.Atoi(args[1])
+			if err != nil || v < 1 {
+				return errors.Errorf("invalid steps %q", args[1])
+			}
+			steps = v
+		}
+		n, err := m.Down(ctx, steps)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("reverted %d migrations\n", n)
+	case "status":
+		status, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("version: %d (dirty: %t)\n", status.Version, status.Dirty)
+		for _, v := range status.Applied {
+			fmt.Printf("  applied  %s\n", v)
+		}
+		for _, v := range status.Pending {
+			fmt.Printf("  pending  %s\n", v)
+		}
+	case "force":
+		if len(args) < 2 {
+			return errors.New("force needs VERSION")
+		}
+		version, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return errors.Errorf("invalid version %q", args[1])
+		}
+		if err := m.Force(ctx, version); err != nil {
+			return err
+		}
+		fmt.Printf("forced version %d\n", version)
+	case "claim":
+		if len(args) < 2 {
+			return errors.New("claim needs MEMBER")
+		}
+		memberId, err := strconv.ParseUint(args[1], 10, 64)
+		if err != nil || memberId == 0 {
+			return errors.Errorf("invalid member %q", args[1])
+		}
+		n, err := m.Claim(ctx, memberId)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("claimed %d todos for member %d\n", n, memberId)
+	default:
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return errors.Errorf("unknown command %q", args[0])
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"os"
+
+	"go.uber.org/zap"
+
+	"github.com/sioncojp/famili-api/openapi"
+)
+
+// OpenAPI...OpenAPIのdocumentをstdoutに書く. configは読まない
+func OpenAPI() int {
+	logger, _ := zap.NewProduction()
+	defer logger.Sync()
+	suggar := logger.Sugar()
+
+	b, err := openapi.New().Marshal()
+	if err != nil {
+		suggar.Errorf("%+v", err)
+		return 1
+	}
+	if _, err := os.Stdout.Write(b); err != nil {
+		suggar.Errorf("%+v", err)
+		return 1
+	}
+	return 0
+}
@@ -1,57 +1,395 @@
 package di
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
 
 	"github.com/sioncojp/famili-api/application"
+	"github.com/sioncojp/famili-api/application/guard"
+	"github.com/sioncojp/famili-api/application/todoservice"
+	v1accounts "github.com/sioncojp/famili-api/application/v1/accounts"
+	v1admin "github.com/sioncojp/famili-api/application/v1/admin"
+	v1apikeys "github.com/sioncojp/famili-api/application/v1/apikeys"
+	v1members "github.com/sioncojp/famili-api/application/v1/members"
+	v1stream "github.com/sioncojp/famili-api/application/v1/stream"
+	v1sync "github.com/sioncojp/famili-api/application/v1/sync"
 	v1todos "github.com/sioncojp/famili-api/application/v1/todos"
+	v1webhooks "github.com/sioncojp/famili-api/application/v1/webhooks"
+	v1ws "github.com/sioncojp/famili-api/application/v1/ws"
+	v2todos "github.com/sioncojp/famili-api/application/v2/todos"
+	"github.com/sioncojp/famili-api/domain/repository"
+	"github.com/sioncojp/famili-api/infrastructure/cache"
 	"github.com/sioncojp/famili-api/infrastructure/database"
+	"github.com/sioncojp/famili-api/infrastructure/memory"
+	"github.com/sioncojp/famili-api/infrastructure/outbox"
+	"github.com/sioncojp/famili-api/infrastructure/stream"
+	"github.com/sioncojp/famili-api/infrastructure/webhook"
 	"github.com/sioncojp/famili-api/utils/config"
 	"github.com/sioncojp/famili-api/utils/log"
+	"github.com/sioncojp/famili-api/utils/migrate"
 	"github.com/sioncojp/famili-api/utils/mysql"
+	"github.com/sioncojp/famili-api/utils/postgres"
+	"github.com/sioncojp/famili-api/utils/redis"
+	"github.com/sioncojp/famili-api/utils/secure"
+	"github.com/sioncojp/famili-api/utils/sqlite"
 )
 
 // NewApplication...Applicationを動かすための依存関係を解決する
 func NewApplication(configPath string) (*application.HttpHandler, *sql.DB, error) {
+	appConfig, err := newConfig(configPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// relayやhealth checkなど裏で動くloop. RunServerのshutdownで止める
+	background := application.NewBackground()
+
+	// repositoryの初期化. memoryならMySQLに接続しない
+	repos, db, err := newRepositories(appConfig, background)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// todoのcache. noneならcacheしない
+	if err := newCache(appConfig, repos); err != nil {
+		return nil, nil, err
+	}
+
+	// TOTP, webhookのsecretの暗号化とsession tokenの署名
+	cipher, err := secure.NewCipher(appConfig.Security.TOTPEncryptionKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	sessionSigner, err := secure.NewSigner(appConfig.Security.SessionSigningKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// outboxのeventを配信するrelayと、webhook, streamへの配信
+	deliverer := newDeliverer(appConfig, repos, cipher)
+	broker := stream.NewBroker(appConfig.Stream.BufferSize, appConfig.Stream.QueueSize)
+	newRelay(appConfig, repos, deliverer, broker, background)
+
+	// service初期化
+	s := &application.HttpHandler{}
+	s.AppConfig = appConfig
+	s.APIKeyRepository = repos.apiKey
+	s.SessionSigner = sessionSigner
+	s.Background = background
+
+	// todoの書き込みと一覧はv1, v2, wsで同じserviceを使う
+	todos := todoservice.NewService(repos.todo, repos.tx)
+
+	v1 := &application.V1{}
+	v1.TodosHandler = v1todos.NewHandler(repos.todo, todos)
+	v1.MembersHandler = v1members.NewHandler(repos.member)
+	v1.APIKeysHandler = v1apikeys.NewHandler(repos.apiKey)
+	loginGuard := guard.NewGuard(repos.loginAttempt, log.ZapLogger, guard.DefaultAccountPolicy, guard.DefaultIPPolicy)
+	v1.AccountsHandler = v1accounts.NewHandler(
+		repos.account, repos.member, repos.tx, cipher, sessionSigner, appConfig.Server.Name, loginGuard,
+	)
+	v1.AdminHandler = v1admin.NewHandler(loginGuard, repos.cacheStats, repos.poolStats)
+	v1.WebhooksHandler = v1webhooks.NewHandler(repos.webhook, cipher, deliverer)
+	v1.StreamHandler = v1stream.NewHandler(
+		broker,
+		time.Duration(appConfig.Stream.HeartbeatSeconds)*time.Second,
+		time.Duration(appConfig.Stream.WriteTimeoutSeconds)*time.Second,
+	)
+	v1.WsHandler = v1ws.NewHandler(repos.todo, todos, broker, v1ws.Options{
+		MessagesPerSecond: appConfig.WebSocket.MessagesPerSecond,
+		Burst:             appConfig.WebSocket.Burst,
+		QueueSize:         appConfig.WebSocket.QueueSize,
+		MaxMessageBytes:   appConfig.WebSocket.MaxMessageBytes,
+		PingInterval:      time.Duration(appConfig.WebSocket.PingSeconds) * time.Second,
+		WriteTimeout:      time.Duration(appConfig.WebSocket.WriteTimeoutSeconds) * time.Second,
+	})
+	v1.SyncHandler = v1sync.NewHandler(repos.todo, repos.change, repos.tx)
+
+	// v2はtodoserviceをv1と共有し、DTOとerrorの形だけを変える
+	v2 := &application.V2{}
+	v2.TodosHandler = v2todos.NewHandler(repos.todo, todos)
+
+	s.Register(v1, v2)
+
+	// Router setting
+	s.NewRouter()
+
+	return s, db, nil
+}
+
+// NewMigrator...famili-api migrate で使う. serverは立ち上げずにprimaryにだけ接続する
+func NewMigrator(configPath string) (*migrate.Migrator, *sql.DB, error) {
+	appConfig, err := newConfig(configPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dataStore, open, err := opener(appConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	if open == nil {
+		return nil, nil, errors.Errorf("driver %q has no migrations", appConfig.DataStore.Driver)
+	}
+	handler, err := open(dataStore)
+	if err != nil {
+		return nil, nil, err
+	}
+	db, err := handler.DB()
+	if err != nil {
+		return nil, nil, err
+	}
+	m, err := migrate.New(db, appConfig.DataStore.Driver, log.ZapLogger)
+	if err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+	return m, db, nil
+}
+
+// newConfig...configを読み込んでvalidateし、loggerを初期化する
+func newConfig(configPath string) (*config.AppConfig, error) {
 	// configの読み込み
 	appConfig, err := config.NewConfig(configPath)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
 	// configの各フィールドのvalidateと初期化
 	if err := appConfig.Validate(
 		config.ValidateServerConfig,
 		config.ValidateServiceConfig,
+		config.ValidateDataStoreConfig,
 		config.ValidateMySQLConfig,
+		config.ValidatePostgresConfig,
+		config.ValidateSQLiteConfig,
+		config.ValidateCacheConfig,
+		config.ValidateOutboxConfig,
+		config.ValidateWebhookConfig,
+		config.ValidateStreamConfig,
+		config.ValidateWebSocketConfig,
 		config.ValidateLogConfig,
+		config.ValidateSecurityConfig,
+		config.ValidateVersionsConfig,
 	); err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
 	// logger初期化
 	if err := log.NewLogger(&appConfig.Log); err != nil {
-		return nil, nil, err
+		return nil, err
+	}
+	return appConfig, nil
+}
+
+// repositories...[datastore] driverで切り替えるrepository
+type repositories struct {
+	todo         repository.TodoRepository
+	member       repository.MemberRepository
+	apiKey       repository.APIKeyRepository
+	account      repository.AccountRepository
+	loginAttempt repository.LoginAttemptRepository
+	outbox       repository.OutboxRepository
+	webhook      repository.WebhookRepository
+	change       repository.TodoChangeRepository
+	syncMutation repository.SyncMutationRepository
+	tx           repository.TxManager
+	// cacheStats...[cache] driverがnoneならnil
+	cacheStats repository.CacheStatsReporter
+	// poolStats...memoryならnil
+	poolStats repository.PoolStatsReporter
+}
+
+// newRepositories...driverに応じてrepositoryを作る. memoryの場合*sql.DBはnilになる
+func newRepositories(appConfig *config.AppConfig, background *application.Background) (*repositories, *sql.DB, error) {
+	if appConfig.DataStore.Driver == config.DriverMemory {
+		repos := &repositories{
+			todo:         memory.NewTodoRepository(),
+			member:       memory.NewMemberRepository(),
+			apiKey:       memory.NewAPIKeyRepository(),
+			account:      memory.NewAccountRepository(),
+			loginAttempt: memory.NewLoginAttemptRepository(),
+			outbox:       memory.NewOutboxRepository(),
+			webhook:      memory.NewWebhookRepository(),
+			change:       memory.NewTodoChangeRepository(),
+			syncMutation: memory.NewSyncMutationRepository(),
+		}
+		repos.tx = memory.NewTxManager(repository.Repositories{
+			Todos:         repos.todo,
+			Members:       repos.member,
+			Outbox:        repos.outbox,
+			Changes:       repos.change,
+			SyncMutations: repos.syncMutation,
+			Accounts:      repos.account,
+		})
+		return repos, nil, nil
 	}
 
-	// MySQLのhandler初期化
-	mysqlHandler, err := mysql.NewMySQLHandler(&appConfig.MySQL)
+	// MySQL, PostgreSQL, SQLiteのhandler初期化. どれもgormなのでrepositoryは同じ実装を使う
+	dataStore, open, err := opener(appConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	handler, err := open(dataStore)
+	if err != nil {
+		return nil, nil, err
+	}
+	db, err := handler.DB()
 	if err != nil {
 		return nil, nil, err
 	}
-	db, err := mysqlHandler.DB()
 
+	// autoMigrateなら、repositoryを使う前に未適用のmigrationを流す
+	if appConfig.DataStore.AutoMigrate {
+		m, err := migrate.New(db, appConfig.DataStore.Driver, log.ZapLogger)
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, err := m.Up(context.Background()); err != nil {
+			return nil, nil, errors.Wrap(err, "auto migrate")
+		}
+	}
+
+	repos := &repositories{
+		todo:         database.NewTodoRepository(handler),
+		member:       database.NewMemberRepository(handler),
+		apiKey:       database.NewAPIKeyRepository(handler),
+		account:      database.NewAccountRepository(handler),
+		loginAttempt: database.NewLoginAttemptRepository(handler),
+		outbox:       database.NewOutboxRepository(handler),
+		webhook:      database.NewWebhookRepository(handler),
+		change:       database.NewTodoChangeRepository(handler),
+		syncMutation: database.NewSyncMutationRepository(handler),
+		tx:           database.NewTxManager(handler),
+	}
+
+	replicas, err := newReplicas(handler, dataStore, open, background)
 	if err != nil {
 		return nil, nil, err
 	}
+	repos.todo = database.NewReplicatedTodoRepository(replicas)
+	repos.tx = database.NewReplicatedTxManager(replicas)
+	repos.poolStats = replicas
+	return repos, db, nil
+}
 
-	// service初期化
-	s := &application.HttpHandler{}
-	s.AppConfig = appConfig
-	s.Router.V1.TodosHandler = v1todos.NewHandler(database.NewTodoRepository(mysqlHandler))
+// opener...driverに応じてhandlerを開く関数とそのconfigを返す
+// SQLiteはDataStoreConfigを使わないのでconfigはnil. memoryはhandlerがないのでどちらもnil
+// 知らないdriverはmysqlとして開かずにerrorにする
+func opener(appConfig *config.AppConfig) (*config.DataStoreConfig, func(*config.DataStoreConfig) (*gorm.DB, error), error) {
+	switch appConfig.DataStore.Driver {
+	case config.DriverMemory:
+		return nil, nil, nil
+	case config.DriverMySQL:
+		return &appConfig.MySQL, mysql.NewMySQLHandler, nil
+	case config.DriverPostgres:
+		return &appConfig.Postgres, postgres.NewPostgresHandler, nil
+	case config.DriverSQLite:
+		return nil, func(*config.DataStoreConfig) (*gorm.DB, error) { return sqlite.NewSQLiteHandler(&appConfig.SQLite) }, nil
+	default:
+		return nil, nil, errors.Errorf("unknown driver %q", appConfig.DataStore.Driver)
+	}
+}
 
-	// Router setting
-	s.NewRouter()
+// newReplicas...replicaを開いて、primaryとreplicaのhealth checkを始める
+// replicaはprimaryのconfigのurl, portだけを差し替えて開く. SQLiteはファイル1つなのでcはnilでprimaryだけになる
+// 繋がらないreplicaがあっても起動は止めず、unhealthyとして始めてhealth checkで戻す
+func newReplicas(primary *gorm.DB, c *config.DataStoreConfig, open func(*config.DataStoreConfig) (*gorm.DB, error), background *application.Background) (*database.Replicas, error) {
+	if c == nil {
+		c = &config.DataStoreConfig{HealthCheckSeconds: config.HealthCheckSeconds}
+	}
+	pools := make([]*database.Pool, 0, len(c.Replicas))
+	for i, v := range c.Replicas {
+		replica := *c
+		replica.Url, replica.Port, replica.Replicas, replica.Lazy = v.Url, v.Port, nil, true
+		handler, err := open(&replica)
+		if err != nil {
+			return nil, errors.Wrapf(err, "open replicas[%d]", i)
+		}
+		pools = append(pools, database.NewPool(fmt.Sprintf("replica%d", i), handler))
+	}
 
-	return s, db, nil
+	replicas := database.NewReplicas(
+		database.NewPool("primary", primary),
+		pools,
+		time.Duration(c.StickySeconds)*time.Second,
+		log.ZapLogger,
+	)
+	replicas.CheckHealth(context.Background())
+	interval := time.Duration(c.HealthCheckSeconds) * time.Second
+	background.Go(func(ctx context.Context) { replicas.RunHealthCheck(ctx, interval) })
+	return replicas, nil
+}
+
+// newCache...[cache] driverに応じてtodoのrepositoryとtransactionをcacheでwrapする
+func newCache(appConfig *config.AppConfig, repos *repositories) error {
+	c := &appConfig.Cache
+	ttl := time.Duration(c.TTLSeconds) * time.Second
+
+	var store cache.Store
+	switch c.Driver {
+	case config.CacheLRU:
+		store = cache.NewLRUStore(c.Size, ttl)
+	case config.CacheRedis:
+		client, err := redis.NewRedisClient(c)
+		if err != nil {
+			return err
+		}
+		store = cache.NewRedisStore(client, c.KeyPrefix, ttl)
+	default:
+		return nil
+	}
+
+	todos := cache.NewTodoRepository(repos.todo, store, log.ZapLogger)
+	repos.todo = todos
+	repos.tx = cache.NewTxManager(repos.tx, todos)
+	repos.cacheStats = todos
+	return nil
+}
+
+// newDeliverer.../v1/webhooks に登録されたURLへ配信するDelivererを作る. 動かすのはnewRelay
+func newDeliverer(appConfig *config.AppConfig, repos *repositories, cipher *secure.Cipher) *webhook.Deliverer {
+	c := &appConfig.Webhook
+	client := webhook.NewClient(time.Duration(c.TimeoutSeconds)*time.Second, c.AllowPrivateNetworks)
+	options := webhook.Options{
+		MaxAttempts:          c.MaxAttempts,
+		DisableAfterFailures: c.DisableAfterFailures,
+		BatchSize:            c.BatchSize,
+	}
+	return webhook.NewDeliverer(repos.webhook, cipher, client, options, log.ZapLogger)
+}
+
+// newRelay...[outbox] sinksにoutboxのeventを配信するrelayを動かす. noneだけなら動かさない
+// webhookがあれば、relayが積んだ配信を送るdelivererも動かす. streamならbrokerがSSEのstreamに配る
+func newRelay(appConfig *config.AppConfig, repos *repositories, deliverer *webhook.Deliverer, broker *stream.Broker, background *application.Background) {
+	c := &appConfig.Outbox
+	sinks := make([]outbox.Sink, 0, len(c.Sinks))
+	for _, v := range c.Sinks {
+		switch v {
+		case config.OutboxSinkLog:
+			sinks = append(sinks, outbox.NewLogSink(log.ZapLogger))
+		case config.OutboxSinkHTTP:
+			client := &http.Client{Timeout: time.Duration(c.HTTPTimeoutSeconds) * time.Second}
+			sinks = append(sinks, outbox.NewHTTPSink(c.HTTPUrl, client))
+		case config.OutboxSinkWebhook:
+			sinks = append(sinks, webhook.NewDispatcher(repos.webhook))
+			interval := time.Duration(appConfig.Webhook.IntervalMillis) * time.Millisecond
+			background.Go(func(ctx context.Context) { deliverer.Run(ctx, interval) })
+		case config.OutboxSinkStream:
+			sinks = append(sinks, broker)
+		}
+	}
+	if len(sinks) == 0 {
+		return
+	}
+
+	relay := outbox.NewRelay(repos.outbox, sinks, c.BatchSize, c.MaxAttempts, log.ZapLogger)
+	interval := time.Duration(c.IntervalMillis) * time.Millisecond
+	background.Go(func(ctx context.Context) { relay.Run(ctx, interval) })
 }
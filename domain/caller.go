@@ -0,0 +1,52 @@
+package domain
+
+import "context"
+
+type callerContextKey struct{}
+
+// Caller...リクエストしてきたメンバーの情報。visibilityの判定に使う
+type Caller struct {
+	MemberId Id
+	FamilyId Id
+	// AccountId...login sessionで認証したときだけ入る
+	AccountId Id
+}
+
+// NewCallerContext...CallerをContextに格納する
+func NewCallerContext(ctx context.Context, c Caller) context.Context {
+	return context.WithValue(ctx, callerContextKey{}, c)
+}
+
+// CallerFromContext...ContextからCallerを取り出す。無ければ匿名のCallerを返す
+func CallerFromContext(ctx context.Context) Caller {
+	if c, ok := ctx.Value(callerContextKey{}).(Caller); ok {
+		return c
+	}
+	return Caller{}
+}
+
+type scopesContextKey struct{}
+
+// NewScopesContext...API keyで認証したときに、keyのscopeをContextに格納する
+func NewScopesContext(ctx context.Context, scopes []string) context.Context {
+	return context.WithValue(ctx, scopesContextKey{}, scopes)
+}
+
+// ScopesFromContext...Contextからscopeを取り出す。API keyで認証していなければokはfalse
+func ScopesFromContext(ctx context.Context) (scopes []string, ok bool) {
+	scopes, ok = ctx.Value(scopesContextKey{}).([]string)
+	return scopes, ok
+}
+
+type primaryContextKey struct{}
+
+// NewPrimaryContext...書き込む前の読み込みなど、replicaやcacheの古い値を使えないときに付ける
+func NewPrimaryContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryContextKey{}, true)
+}
+
+// PrimaryFromContext...NewPrimaryContextを付けていればtrue
+func PrimaryFromContext(ctx context.Context) bool {
+	primary, _ := ctx.Value(primaryContextKey{}).(bool)
+	return primary
+}
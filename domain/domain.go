@@ -9,9 +9,10 @@ type Id string
 
 type CustomValidator struct{}
 
+// Validate...Validateを通らなければValidationErrorを返す
 func (cv *CustomValidator) Validate(i interface{}) error {
 	if c, ok := i.(validation.Validatable); ok {
-		return c.Validate()
+		return NewValidationError(c.Validate())
 	}
 	return nil
 }
@@ -0,0 +1,40 @@
+package domain
+
+import "github.com/pkg/errors"
+
+// repositoryが返すerror. infrastructureの実装はDBのerrorをこれらに変換し、applicationはerrors.Isで見分ける
+var (
+	// ErrNotFound...対象が存在しない
+	ErrNotFound = errors.New("not found")
+	// ErrConflict...UNIQUE制約などで既存のデータとぶつかった
+	ErrConflict = errors.New("conflict")
+	// ErrUnavailable...DBに繋がらないなど、時間を置けば通るかもしれない
+	ErrUnavailable = errors.New("unavailable")
+)
+
+// ValidationError...入力がmodelのValidateを通らなかった
+type ValidationError struct {
+	Err error
+}
+
+// NewValidationError...errがnilならnilを返す
+func NewValidationError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &ValidationError{err}
+}
+
+func (e *ValidationError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// IsValidation...errがValidationErrorかどうか
+func IsValidation(err error) bool {
+	var v *ValidationError
+	return errors.As(err, &v)
+}
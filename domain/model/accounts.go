@@ -0,0 +1,37 @@
+package model
+
+import (
+	"regexp"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/utils/i18n"
+)
+
+var emailRegexp = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+
+// Account...familyのデータを操作できる親のアカウント. TOTPで2段階認証できる
+type Account struct {
+	Model
+	Email        string    `gorm:"email" json:"email"`
+	PasswordHash string    `gorm:"password_hash" json:"-"`
+	MemberId     domain.Id `gorm:"member_id" json:"member_id"`
+	FamilyId     domain.Id `gorm:"family_id" json:"family_id"`
+	// TOTPSecret...暗号化して保存する. 平文はDBに置かない
+	TOTPSecret  string `gorm:"totp_secret" json:"-"`
+	TOTPEnabled bool   `gorm:"totp_enabled" json:"totp_enabled"`
+	// TOTPLastStep...最後に通ったcodeの時間step. 同じcodeを2回使わせない
+	TOTPLastStep int64 `gorm:"totp_last_step" json:"-"`
+}
+
+func (a Account) Validate() error {
+	return validation.ValidateStruct(&a,
+		validation.Field(
+			&a.Email,
+			validation.Required,
+			validation.RuneLength(1, 255),
+			validation.Match(emailRegexp).ErrorObject(i18n.NewError(i18n.EmailInvalid)),
+		),
+	)
+}
@@ -0,0 +1,131 @@
+package model
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql/driver"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/utils/i18n"
+)
+
+const (
+	// APIKeyPrefix...API keyの先頭につける文字列. fam_<prefix>_<secret> の形にする
+	APIKeyPrefix = "fam_"
+	// APIKeyPrefixLength...keyを特定するためのprefixの長さ
+	APIKeyPrefixLength = 8
+
+	ScopeTodosRead    = "todos:read"
+	ScopeTodosWrite   = "todos:write"
+	ScopeMembersRead  = "members:read"
+	ScopeMembersWrite = "members:write"
+)
+
+// Scopes...API keyで許可する操作. DBにはカンマ区切りで保存する
+type Scopes []string
+
+// Value...driver.Valuer
+func (s Scopes) Value() (driver.Value, error) {
+	return strings.Join(s, ","), nil
+}
+
+// Scan...sql.Scanner
+func (s *Scopes) Scan(src interface{}) error {
+	var v string
+	switch t := src.(type) {
+	case string:
+		v = t
+	case []byte:
+		v = string(t)
+	case nil:
+		*s = Scopes{}
+		return nil
+	default:
+		return fmt.Errorf("unsupported scopes type: %T", src)
+	}
+
+	*s = Scopes{}
+	for _, scope := range strings.Split(v, ",") {
+		if scope != "" {
+			*s = append(*s, scope)
+		}
+	}
+	return nil
+}
+
+// Has...scopeを持っているか
+func (s Scopes) Has(scope string) bool {
+	for _, v := range s {
+		if v == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// APIKey...スクリプトやHome Assistantから使うためのkey. 平文は発行時にしか返さずhashだけ保存する
+type APIKey struct {
+	Model
+	Name       string     `gorm:"name" json:"name"`
+	Prefix     string     `gorm:"prefix" json:"prefix"`
+	Hash       string     `gorm:"hash" json:"-"`
+	Scopes     Scopes     `gorm:"scopes" json:"scopes"`
+	MemberId   domain.Id  `gorm:"member_id" json:"member_id"`
+	FamilyId   domain.Id  `gorm:"family_id" json:"family_id"`
+	LastUsedAt *time.Time `gorm:"last_used_at" json:"last_used_at"`
+	RevokedAt  *time.Time `gorm:"revoked_at" json:"revoked_at"`
+
+	// Key...平文のkey. 作成時のレスポンスでのみ返す
+	Key string `gorm:"-" json:"key,omitempty"`
+}
+
+func (a APIKey) Validate() error {
+	return validation.ValidateStruct(&a,
+		validation.Field(
+			&a.Name,
+			validation.Required,
+			validation.RuneLength(1, 50),
+		),
+		validation.Field(
+			&a.Scopes,
+			validation.Required,
+			validation.Each(
+				validation.In(ScopeTodosRead, ScopeTodosWrite, ScopeMembersRead, ScopeMembersWrite).ErrorObject(i18n.NewError(i18n.ScopeUnknown)),
+			),
+		),
+	)
+}
+
+// Revoked...失効済みか
+func (a APIKey) Revoked() bool {
+	return a.RevokedAt != nil
+}
+
+// Matches...平文のkeyが保存されているhashと一致するか
+func (a APIKey) Matches(key string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashAPIKey(key)), []byte(a.Hash)) == 1
+}
+
+// HashAPIKey...keyは十分なエントロピーがあるのでsha256で保存する
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// ParseAPIKeyPrefix...fam_<prefix>_<secret> からprefixを取り出す
+func ParseAPIKeyPrefix(key string) (string, bool) {
+	if !strings.HasPrefix(key, APIKeyPrefix) {
+		return "", false
+	}
+	rest := strings.TrimPrefix(key, APIKeyPrefix)
+	if len(rest) <= APIKeyPrefixLength+1 || rest[APIKeyPrefixLength] != '_' {
+		return "", false
+	}
+	return rest[:APIKeyPrefixLength], true
+}
@@ -0,0 +1,41 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAPIKeyPrefix(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		name   string
+		key    string
+		prefix string
+		ok     bool
+	}{
+		{"ok", "fam_abcd_-12_secret", "abcd_-12", true},
+		{"no fam_", "abcd1234_secret", "", false},
+		{"no secret", "fam_abcd1234_", "", false},
+		{"short prefix", "fam_abc_secret", "", false},
+	}
+
+	for _, v := range cases {
+		prefix, ok := ParseAPIKeyPrefix(v.key)
+		assert.Equal(t, v.ok, ok, v.name)
+		assert.Equal(t, v.prefix, prefix, v.name)
+	}
+}
+
+func TestScopesScan(t *testing.T) {
+	t.Parallel()
+	var s Scopes
+	assert.NoError(t, s.Scan([]byte("todos:read,todos:write")))
+	assert.Equal(t, Scopes{ScopeTodosRead, ScopeTodosWrite}, s)
+	assert.True(t, s.Has(ScopeTodosWrite))
+	assert.False(t, s.Has(ScopeMembersRead))
+
+	v, err := s.Value()
+	assert.NoError(t, err)
+	assert.Equal(t, "todos:read,todos:write", v)
+}
@@ -0,0 +1,70 @@
+package model
+
+import (
+	"time"
+
+	"github.com/sioncojp/famili-api/domain"
+)
+
+// EventType...todoの変更を表すdomain event
+type EventType string
+
+const (
+	EventTodoCreated   EventType = "todo.created"
+	EventTodoUpdated   EventType = "todo.updated"
+	EventTodoCompleted EventType = "todo.completed"
+	EventTodoDeleted   EventType = "todo.deleted"
+)
+
+// Event...outboxに書き込み、relayが配信するdomain event
+// 配信は少なくとも1回なので、受け取る側はIDで重複を除く
+type Event struct {
+	// ID...outboxのID. 書き込むまでは0
+	ID       uint      `json:"id"`
+	Type     EventType `json:"type"`
+	TodoId   uint      `json:"todo_id"`
+	FamilyId domain.Id `json:"family_id"`
+	// Todo...変更後のtodo. deletedなら削除前のtodo
+	Todo       Todo      `json:"todo"`
+	OccurredAt time.Time `json:"occurred_at"`
+
+	// Attempts...配信に失敗した回数. relayのbackoffに使う
+	Attempts int `json:"-"`
+}
+
+// Events...このtodoのeventを作る. Createの後に呼べばTodoIdが入る
+func (a Todo) Events(types ...EventType) []Event {
+	events := make([]Event, 0, len(types))
+	for _, t := range types {
+		events = append(events, Event{
+			Type:     t,
+			TodoId:   a.ID,
+			FamilyId: a.FamilyId,
+			Todo:     a,
+		})
+	}
+	return events
+}
+
+// Change...title, description, completed, visibilityをnextの値に変え、起きたeventを返す
+// 未完了から完了になったときはupdatedに加えてcompletedも返す
+func (a *Todo) Change(next Todo) []EventType {
+	completed := !a.Completed && next.Completed
+
+	a.Title = next.Title
+	a.Description = next.Description
+	a.Completed = next.Completed
+	a.Visibility = next.Visibility
+
+	events := []EventType{EventTodoUpdated}
+	if completed {
+		events = append(events, EventTodoCompleted)
+	}
+	return events
+}
+
+// Move...並び順をpositionに変え、起きたeventを返す
+func (a *Todo) Move(position int) []EventType {
+	a.Position = position
+	return []EventType{EventTodoUpdated}
+}
@@ -0,0 +1,69 @@
+package model
+
+import "time"
+
+// LoginPolicy...失敗回数に応じたbackoffとlockoutの設定
+type LoginPolicy struct {
+	// FreeAttempts...この回数までは待たせない
+	FreeAttempts int
+	// BaseDelay...FreeAttemptsを超えたら BaseDelay * 2^n 待たせる
+	BaseDelay time.Duration
+	// MaxDelay...backoffの上限
+	MaxDelay time.Duration
+	// LockoutThreshold...この回数失敗したらLockoutDurationの間lockする
+	LockoutThreshold int
+	LockoutDuration  time.Duration
+	// ResetAfter...最後の失敗からこの時間が経てば失敗回数を忘れる
+	ResetAfter time.Duration
+}
+
+// LoginAttempt...account, IPごとのlogin失敗の記録
+type LoginAttempt struct {
+	Key          string    `gorm:"column:attempt_key;primary_key" json:"key"`
+	Failures     int       `gorm:"failures" json:"failures"`
+	LastFailedAt time.Time `gorm:"last_failed_at" json:"last_failed_at"`
+	LockedUntil  time.Time `gorm:"locked_until" json:"locked_until"`
+}
+
+// RetryAfter...次に試せるまでの時間. 0なら今すぐ試せる
+func (a LoginAttempt) RetryAfter(now time.Time) time.Duration {
+	if now.Before(a.LockedUntil) {
+		return a.LockedUntil.Sub(now)
+	}
+	return 0
+}
+
+// RecordFailure...失敗を記録してbackoffを計算する. lockoutになったらtrueを返す
+func (a *LoginAttempt) RecordFailure(now time.Time, p LoginPolicy) bool {
+	if !a.LastFailedAt.IsZero() && now.Sub(a.LastFailedAt) > p.ResetAfter {
+		a.Failures = 0
+	}
+	a.Failures++
+	a.LastFailedAt = now
+	a.LockedUntil = now.Add(a.delay(p))
+	return a.Failures >= p.LockoutThreshold
+}
+
+// ReleaseFailure...先に失敗として数えた1回を取り消し、backoffを計算し直す
+func (a *LoginAttempt) ReleaseFailure(p LoginPolicy) {
+	if a.Failures == 0 {
+		return
+	}
+	a.Failures--
+	a.LockedUntil = a.LastFailedAt.Add(a.delay(p))
+}
+
+// delay...失敗回数に応じて待たせる時間
+func (a LoginAttempt) delay(p LoginPolicy) time.Duration {
+	if a.Failures >= p.LockoutThreshold {
+		return p.LockoutDuration
+	}
+	if a.Failures <= p.FreeAttempts {
+		return 0
+	}
+	d := p.BaseDelay << uint(a.Failures-p.FreeAttempts-1)
+	if d > p.MaxDelay || d <= 0 {
+		d = p.MaxDelay
+	}
+	return d
+}
@@ -0,0 +1,24 @@
+package model
+
+import (
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+
+	"github.com/sioncojp/famili-api/domain"
+)
+
+// Member...familyに所属するメンバー。todoのassigneeになる
+type Member struct {
+	Model
+	Name     string    `gorm:"name" json:"name"`
+	FamilyId domain.Id `gorm:"family_id" json:"family_id"`
+}
+
+func (a Member) Validate() error {
+	return validation.ValidateStruct(&a,
+		validation.Field(
+			&a.Name,
+			validation.Required,
+			validation.RuneLength(1, 50),
+		),
+	)
+}
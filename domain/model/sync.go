@@ -0,0 +1,86 @@
+package model
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/sioncojp/famili-api/domain"
+)
+
+// SyncStatus...POST /v1/syncで受け取った1件の変更の結果
+type SyncStatus string
+
+const (
+	// SyncApplied...変更を反映した. 既に消えているtodoのdeleteも含む
+	SyncApplied SyncStatus = "applied"
+	// SyncConflict...serverの方が新しいので反映しなかった. clientはtodoの値で上書きする
+	SyncConflict SyncStatus = "conflict"
+	// SyncRejected...validationなどで反映できなかった. 同じ変更を送り直しても通らない
+	SyncRejected SyncStatus = "rejected"
+)
+
+// syncTokenPrefix...tokenの形式を変えたときに古いtokenを見分ける
+const syncTokenPrefix = "s1."
+
+// ErrInvalidSyncToken...このserverが返したtokenではない
+var ErrInvalidSyncToken = errors.New("invalid sync token")
+
+// TodoChange...todoごとの最後の変更. Seqは変更するたびに振り直すので、Seqより後の変更を取れば差分になる
+type TodoChange struct {
+	Seq       uint
+	TodoId    uint
+	FamilyId  domain.Id
+	CreatedBy domain.Id
+	// Deleted...削除されたtodoのtombstone. Todoは削除前の値
+	Deleted   bool
+	Todo      Todo
+	ChangedAt time.Time
+}
+
+// NewTodoChange...todoの今の値で変更を作る. Seqはrepositoryが振る
+func NewTodoChange(todo Todo, deleted bool) TodoChange {
+	return TodoChange{
+		TodoId:    todo.ID,
+		FamilyId:  todo.FamilyId,
+		CreatedBy: todo.CreatedBy,
+		Deleted:   deleted,
+		Todo:      todo,
+	}
+}
+
+// SyncMutation...POST /v1/syncで反映した変更. 同じclient_idを送り直されたら反映せずに同じ結果を返す
+type SyncMutation struct {
+	ID        uint       `gorm:"primary_key"`
+	MemberId  domain.Id  `gorm:"member_id"`
+	ClientId  string     `gorm:"client_id"`
+	TodoId    uint       `gorm:"todo_id"`
+	Status    SyncStatus `gorm:"status"`
+	CreatedAt time.Time  `gorm:"created_at"`
+}
+
+// NewSyncToken...seqまでの変更を受け取ったことを表すtoken
+func NewSyncToken(seq uint) string {
+	return syncTokenPrefix + strconv.FormatUint(uint64(seq), 36)
+}
+
+// ParseSyncToken...tokenのseqを返す
+func ParseSyncToken(token string) (uint, error) {
+	v := strings.TrimPrefix(token, syncTokenPrefix)
+	if v == token {
+		return 0, ErrInvalidSyncToken
+	}
+	seq, err := strconv.ParseUint(v, 36, 64)
+	if err != nil {
+		return 0, ErrInvalidSyncToken
+	}
+	return uint(seq), nil
+}
+
+// AcceptsChangeAt...clientがatに行った変更でこのtodoを上書きできるか
+// 最後に書いた方を残す. 同じ時刻ならserverを残すので、同じ入力なら必ず同じ結果になる
+func (a Todo) AcceptsChangeAt(at time.Time) bool {
+	return at.After(a.UpdatedAt)
+}
@@ -0,0 +1,34 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncToken(t *testing.T) {
+	t.Parallel()
+	for _, seq := range []uint{0, 1, 35, 36, 123456789} {
+		seq := seq
+		got, err := ParseSyncToken(NewSyncToken(seq))
+		assert.NoError(t, err)
+		assert.Equal(t, seq, got)
+	}
+
+	for _, token := range []string{"", "1", "s1.", "s1.!", "s2.1"} {
+		_, err := ParseSyncToken(token)
+		assert.ErrorIs(t, err, ErrInvalidSyncToken, token)
+	}
+}
+
+func TestTodoAcceptsChangeAt(t *testing.T) {
+	t.Parallel()
+	updatedAt := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	todo := Todo{Model: Model{UpdatedAt: updatedAt}}
+
+	assert.True(t, todo.AcceptsChangeAt(updatedAt.Add(time.Second)))
+	// 同じ時刻ならserverを残す
+	assert.False(t, todo.AcceptsChangeAt(updatedAt))
+	assert.False(t, todo.AcceptsChangeAt(updatedAt.Add(-time.Second)))
+}
@@ -2,26 +2,119 @@ package model
 
 import (
 	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pkg/errors"
+
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/utils"
+	"github.com/sioncojp/famili-api/utils/i18n"
 )
 
+// Visibility...todoの公開範囲
+type Visibility string
+
+const (
+	// VisibilityPrivate...作成者のみ
+	VisibilityPrivate Visibility = "private"
+	// VisibilityFamily...同じfamilyのメンバー
+	VisibilityFamily Visibility = "family"
+	// VisibilityPublic...familyに加えて、share tokenを知っている人
+	VisibilityPublic Visibility = "public"
+)
+
+// shareTokenBytes...share tokenの長さ. 256bitあれば推測できない
+const shareTokenBytes = 32
+
+// ErrAssigneeNotFound...存在しない、または別familyのメンバーをassigneeにしようとした
+var ErrAssigneeNotFound = errors.New("assignee not found")
+
 type Todo struct {
 	Model
 	Title       string `gorm:"title" json:"title"`
 	Description string `gorm:"description" json:"description"`
 	Completed   bool   `gorm:"completed" json:"completed"`
+	// Position...一覧での並び順. 小さい順に並べ、同じならID順
+	Position    int        `gorm:"position" json:"position"`
+	CreatedBy   domain.Id  `gorm:"created_by" json:"created_by"`
+	FamilyId    domain.Id  `gorm:"family_id" json:"family_id"`
+	Visibility  Visibility `gorm:"visibility" json:"visibility"`
+	ShareToken  string     `gorm:"share_token" json:"share_token,omitempty"`
+	AssigneeIds []uint     `gorm:"-" json:"assignee_ids"`
 }
 
 func (a Todo) Validate() error {
 	return validation.ValidateStruct(&a,
 		validation.Field(
 			&a.Title,
-			validation.Required.Error("is required"),
-			validation.RuneLength(1, 50).Error("size is 1～50"),
+			validation.Required,
+			validation.RuneLength(1, 50),
 		),
 		validation.Field(
 			&a.Description,
-			validation.Required.Error("is required"),
-			validation.RuneLength(1, 100).Error("size is 1～100"),
+			validation.Required,
+			validation.RuneLength(1, 100),
+		),
+		validation.Field(
+			&a.Position,
+			validation.Min(0),
+		),
+		validation.Field(
+			&a.Visibility,
+			validation.In(VisibilityPrivate, VisibilityFamily, VisibilityPublic).ErrorObject(i18n.NewError(i18n.VisibilityInvalid)),
 		),
 	)
 }
+
+// VisibleTo...callerがこのtodoを見れるかどうか
+// 空のIDはmigrationのdefaultと一致してしまうので、匿名のcallerには何も見せない
+func (a Todo) VisibleTo(c domain.Caller) bool {
+	if c.MemberId != "" && a.CreatedBy == c.MemberId {
+		return true
+	}
+	if a.Visibility == VisibilityPrivate || c.FamilyId == "" {
+		return false
+	}
+	return a.FamilyId == c.FamilyId
+}
+
+// Assign...assigneeを設定する。membersには存在するメンバーを渡し、含まれないIDや別familyのメンバーはエラーにする
+func (a *Todo) Assign(ids []uint, members []Member) error {
+	found := make(map[uint]Member, len(members))
+	for _, m := range members {
+		found[m.ID] = m
+	}
+
+	assigneeIds := make([]uint, 0, len(ids))
+	seen := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		m, ok := found[id]
+		if !ok || m.FamilyId != a.FamilyId {
+			return errors.Wrapf(ErrAssigneeNotFound, "id %d", id)
+		}
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		assigneeIds = append(assigneeIds, id)
+	}
+
+	a.AssigneeIds = assigneeIds
+	return nil
+}
+
+// SetShareToken...publicならshare tokenを発行し、それ以外ならtokenを破棄してリンクを無効にする
+func (a *Todo) SetShareToken() error {
+	if a.Visibility != VisibilityPublic {
+		a.ShareToken = ""
+		return nil
+	}
+	if a.ShareToken != "" {
+		return nil
+	}
+
+	token, err := utils.MakeSecureToken(shareTokenBytes)
+	if err != nil {
+		return err
+	}
+	a.ShareToken = token
+	return nil
+}
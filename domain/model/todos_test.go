@@ -0,0 +1,122 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sioncojp/famili-api/domain"
+)
+
+func TestTodoVisibleTo(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		name       string
+		visibility Visibility
+		caller     domain.Caller
+		want       bool
+	}{
+		{"private owner", VisibilityPrivate, domain.Caller{MemberId: "1", FamilyId: "f1"}, true},
+		{"private family member", VisibilityPrivate, domain.Caller{MemberId: "2", FamilyId: "f1"}, false},
+		{"family member", VisibilityFamily, domain.Caller{MemberId: "2", FamilyId: "f1"}, true},
+		{"family other family", VisibilityFamily, domain.Caller{MemberId: "3", FamilyId: "f2"}, false},
+		{"public family member", VisibilityPublic, domain.Caller{MemberId: "2", FamilyId: "f1"}, true},
+		{"public anonymous", VisibilityPublic, domain.Caller{}, false},
+	}
+
+	for _, v := range cases {
+		todo := Todo{CreatedBy: "1", FamilyId: "f1", Visibility: v.visibility}
+		assert.Equal(t, v.want, todo.VisibleTo(v.caller), v.name)
+	}
+
+	// 作成者もfamilyも空のtodoは、匿名のcallerのIDと一致しても見せない
+	for _, v := range []Visibility{VisibilityPrivate, VisibilityFamily, VisibilityPublic} {
+		assert.False(t, Todo{Visibility: v}.VisibleTo(domain.Caller{}), "anonymous "+string(v))
+	}
+}
+
+func TestTodoAssign(t *testing.T) {
+	t.Parallel()
+	members := []Member{
+		{Model: Model{ID: 1}, FamilyId: "f1"},
+		{Model: Model{ID: 2}, FamilyId: "f1"},
+		{Model: Model{ID: 3}, FamilyId: "f2"},
+	}
+
+	cases := []struct {
+		name    string
+		ids     []uint
+		want    []uint
+		wantErr error
+	}{
+		{"ok", []uint{1, 2}, []uint{1, 2}, nil},
+		{"duplicated", []uint{2, 2, 1}, []uint{2, 1}, nil},
+		{"empty", []uint{}, []uint{}, nil},
+		{"not found", []uint{1, 4}, nil, ErrAssigneeNotFound},
+		{"other family", []uint{3}, nil, ErrAssigneeNotFound},
+	}
+
+	for _, v := range cases {
+		todo := Todo{FamilyId: "f1"}
+		err := todo.Assign(v.ids, members)
+		if v.wantErr != nil {
+			assert.True(t, errors.Is(err, v.wantErr), v.name)
+			continue
+		}
+		assert.NoError(t, err, v.name)
+		assert.Equal(t, v.want, todo.AssigneeIds, v.name)
+	}
+}
+
+func TestTodoChange(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		name      string
+		completed bool
+		next      bool
+		want      []EventType
+	}{
+		{"update", false, false, []EventType{EventTodoUpdated}},
+		{"complete", false, true, []EventType{EventTodoUpdated, EventTodoCompleted}},
+		{"already completed", true, true, []EventType{EventTodoUpdated}},
+		{"reopen", true, false, []EventType{EventTodoUpdated}},
+	}
+
+	for _, v := range cases {
+		todo := Todo{Model: Model{ID: 1}, Title: "t", Completed: v.completed, FamilyId: "f1", Visibility: VisibilityFamily}
+		got := todo.Change(Todo{Title: "t2", Description: "d2", Completed: v.next, Visibility: VisibilityPrivate})
+		assert.Equal(t, v.want, got, v.name)
+		assert.Equal(t, "t2", todo.Title, v.name)
+		assert.Equal(t, v.next, todo.Completed, v.name)
+		assert.Equal(t, VisibilityPrivate, todo.Visibility, v.name)
+	}
+}
+
+func TestTodoEvents(t *testing.T) {
+	t.Parallel()
+	todo := Todo{Model: Model{ID: 1}, Title: "t", FamilyId: "f1"}
+	events := todo.Events(EventTodoUpdated, EventTodoCompleted)
+	assert.Len(t, events, 2)
+	assert.Equal(t, EventTodoCompleted, events[1].Type)
+	assert.Equal(t, uint(1), events[1].TodoId)
+	assert.Equal(t, domain.Id("f1"), events[1].FamilyId)
+	assert.Equal(t, "t", events[1].Todo.Title)
+}
+
+func TestSetShareToken(t *testing.T) {
+	t.Parallel()
+	todo := &Todo{Visibility: VisibilityPublic}
+	assert.NoError(t, todo.SetShareToken())
+	assert.NotEmpty(t, todo.ShareToken)
+
+	// publicのままなら同じリンクを使い続ける
+	token := todo.ShareToken
+	assert.NoError(t, todo.SetShareToken())
+	assert.Equal(t, token, todo.ShareToken)
+
+	// publicでなくなったらリンクを無効にする
+	todo.Visibility = VisibilityFamily
+	assert.NoError(t, todo.SetShareToken())
+	assert.Empty(t, todo.ShareToken)
+}
@@ -0,0 +1,175 @@
+package model
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/utils/i18n"
+)
+
+const (
+	// WebhookSecretPrefix...signing secretの先頭につける文字列
+	WebhookSecretPrefix = "whsec_"
+
+	// WebhookSecretGrace...rotateした後も古いsecretで署名し続ける時間. 受け取る側の切り替えを待つ
+	WebhookSecretGrace = 24 * time.Hour
+
+	// EventWebhookTest...POST /v1/webhooks/{id}/test で送るevent
+	EventWebhookTest EventType = "webhook.test"
+)
+
+// DeliveryStatus...webhookの配信状況
+type DeliveryStatus string
+
+const (
+	// DeliveryPending...未配信. next_attempt_atを過ぎたら送る
+	DeliveryPending DeliveryStatus = "pending"
+	// DeliveryDelivered...2xxが返った
+	DeliveryDelivered DeliveryStatus = "delivered"
+	// DeliveryFailed...最大回数まで失敗したか、webhookが無効になった
+	DeliveryFailed DeliveryStatus = "failed"
+)
+
+// EventTypes...webhookが受け取るevent. DBにはカンマ区切りで保存する
+type EventTypes []EventType
+
+// Value...driver.Valuer
+func (s EventTypes) Value() (driver.Value, error) {
+	v := make([]string, 0, len(s))
+	for _, t := range s {
+		v = append(v, string(t))
+	}
+	return strings.Join(v, ","), nil
+}
+
+// Scan...sql.Scanner
+func (s *EventTypes) Scan(src interface{}) error {
+	var v string
+	switch t := src.(type) {
+	case string:
+		v = t
+	case []byte:
+		v = string(t)
+	case nil:
+		*s = EventTypes{}
+		return nil
+	default:
+		return fmt.Errorf("unsupported event types type: %T", src)
+	}
+
+	*s = EventTypes{}
+	for _, t := range strings.Split(v, ",") {
+		if t != "" {
+			*s = append(*s, EventType(t))
+		}
+	}
+	return nil
+}
+
+// Has...eventを受け取るか
+func (s EventTypes) Has(t EventType) bool {
+	for _, v := range s {
+		if v == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Webhook...todoが変わったときにeventをPOSTする先. family単位で登録する
+type Webhook struct {
+	Model
+	FamilyId   domain.Id  `gorm:"family_id" json:"family_id"`
+	CreatedBy  domain.Id  `gorm:"created_by" json:"created_by"`
+	URL        string     `gorm:"url" json:"url"`
+	EventTypes EventTypes `gorm:"event_types" json:"event_types"`
+	// Secret, PreviousSecret...暗号化して保存する. PreviousSecretはrotateしてからWebhookSecretGraceの間だけ使う
+	Secret                  string     `gorm:"secret" json:"-"`
+	PreviousSecret          string     `gorm:"previous_secret" json:"-"`
+	PreviousSecretExpiresAt *time.Time `gorm:"previous_secret_expires_at" json:"previous_secret_expires_at"`
+	// Failures...連続で配信に失敗した回数. 成功したら0に戻す
+	Failures   int        `gorm:"failures" json:"failures"`
+	DisabledAt *time.Time `gorm:"disabled_at" json:"disabled_at"`
+
+	// PlainSecret...平文のsecret. 作成時とrotate時のレスポンスでのみ返す
+	PlainSecret string `gorm:"-" json:"secret,omitempty"`
+}
+
+func (a Webhook) Validate() error {
+	return validation.ValidateStruct(&a,
+		validation.Field(
+			&a.URL,
+			validation.Required,
+			validation.RuneLength(1, 255),
+			validation.By(validateWebhookURL),
+		),
+		validation.Field(
+			&a.EventTypes,
+			validation.Required,
+			validation.Each(
+				validation.In(EventTodoCreated, EventTodoUpdated, EventTodoCompleted, EventTodoDeleted).ErrorObject(i18n.NewError(i18n.EventTypeUnknown)),
+			),
+		),
+	)
+}
+
+// validateWebhookURL...httpかhttpsの絶対URLだけを許可する
+func validateWebhookURL(value interface{}) error {
+	u, err := url.Parse(value.(string))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return i18n.NewError(i18n.URLInvalid)
+	}
+	return nil
+}
+
+// Disabled...配信に失敗し続けて無効になっているか
+func (a Webhook) Disabled() bool {
+	return a.DisabledAt != nil
+}
+
+// Accepts...eventをこのwebhookに送るか. privateなtodoのeventは作成者が登録したwebhookにだけ送る
+func (a Webhook) Accepts(event Event) bool {
+	if a.Disabled() || a.FamilyId != event.FamilyId || !a.EventTypes.Has(event.Type) {
+		return false
+	}
+	return event.Todo.Visibility != VisibilityPrivate || event.Todo.CreatedBy == a.CreatedBy
+}
+
+// Rotate...secretを入れ替える. 古いsecretはnowからWebhookSecretGraceの間だけ残す
+func (a *Webhook) Rotate(secret string, now time.Time) {
+	expiresAt := now.Add(WebhookSecretGrace)
+	a.PreviousSecret = a.Secret
+	a.PreviousSecretExpiresAt = &expiresAt
+	a.Secret = secret
+}
+
+// Secrets...nowの時点で署名に使う暗号化されたsecret. 新しいものが先
+func (a Webhook) Secrets(now time.Time) []string {
+	secrets := []string{a.Secret}
+	if a.PreviousSecret != "" && a.PreviousSecretExpiresAt != nil && now.Before(*a.PreviousSecretExpiresAt) {
+		secrets = append(secrets, a.PreviousSecret)
+	}
+	return secrets
+}
+
+// WebhookDelivery...webhookへの配信. 配信の記録としても返す
+type WebhookDelivery struct {
+	Model
+	WebhookId uint `gorm:"webhook_id" json:"webhook_id"`
+	// EventId...outboxのeventのID. testのときはnil
+	EventId       *uint          `gorm:"event_id" json:"event_id"`
+	EventType     EventType      `gorm:"event_type" json:"event_type"`
+	Payload       string         `gorm:"payload" json:"-"`
+	Status        DeliveryStatus `gorm:"status" json:"status"`
+	Attempts      int            `gorm:"attempts" json:"attempts"`
+	StatusCode    int            `gorm:"status_code" json:"status_code"`
+	LastError     string         `gorm:"last_error" json:"last_error"`
+	NextAttemptAt time.Time      `gorm:"next_attempt_at" json:"next_attempt_at"`
+	DeliveredAt   *time.Time     `gorm:"delivered_at" json:"delivered_at"`
+}
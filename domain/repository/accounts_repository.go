@@ -0,0 +1,20 @@
+package repository
+
+import (
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/domain/model"
+)
+
+// interfaceを使うことでDIPを解決する。mockも作成できるようになる
+type AccountRepository interface {
+	GetById(domain.Id) (model.Account, error)
+	GetByEmail(string) (model.Account, error)
+	Create(*model.Account) error
+	Update(*model.Account) error
+	// ReplaceRecoveryCodes...recovery codeのhashを全て置き換える. hashesが空なら全て削除する
+	ReplaceRecoveryCodes(account *model.Account, hashes []string) error
+	// UseRecoveryCode...未使用のrecovery codeを使用済みにする. 使えなければfalseを返す
+	UseRecoveryCode(account *model.Account, hash string) (bool, error)
+	// UseTOTPStep...TOTPのcodeの時間stepを使用済みにする. 使ったstep以前ならfalseを返す
+	UseTOTPStep(account *model.Account, step int64) (bool, error)
+}
@@ -0,0 +1,16 @@
+package repository
+
+import (
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/domain/model"
+)
+
+// interfaceを使うことでDIPを解決する。mockも作成できるようになる
+type APIKeyRepository interface {
+	GetById(domain.Id) (model.APIKey, error)
+	GetByPrefix(string) (model.APIKey, error)
+	List(memberId domain.Id) ([]model.APIKey, error)
+	Create(*model.APIKey) error
+	Update(*model.APIKey) error
+	TouchLastUsed(*model.APIKey) error
+}
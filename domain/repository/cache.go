@@ -0,0 +1,12 @@
+package repository
+
+// CacheStats...cacheのhit/miss回数
+type CacheStats struct {
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+}
+
+// CacheStatsReporter...cacheのhit/miss回数を返す. 管理用endpointで使う
+type CacheStatsReporter interface {
+	CacheStats() CacheStats
+}
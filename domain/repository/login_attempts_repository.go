@@ -0,0 +1,13 @@
+package repository
+
+import (
+	"github.com/sioncojp/famili-api/domain/model"
+)
+
+// interfaceを使うことでDIPを解決する。MySQLとメモリの実装を差し替えられる
+type LoginAttemptRepository interface {
+	// Get...記録が無ければKeyだけ入ったLoginAttemptを返す
+	Get(key string) (model.LoginAttempt, error)
+	Save(*model.LoginAttempt) error
+	Delete(key string) error
+}
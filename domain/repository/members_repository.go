@@ -0,0 +1,15 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/domain/model"
+)
+
+// interfaceを使うことでDIPを解決する。mockも作成できるようになる
+type MemberRepository interface {
+	List(ctx context.Context, familyId domain.Id) ([]model.Member, error)
+	ListByIds(ctx context.Context, ids []uint) ([]model.Member, error)
+	Create(ctx context.Context, member *model.Member) error
+}
@@ -0,0 +1,26 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/sioncojp/famili-api/domain/model"
+)
+
+// OutboxRepository...todoの変更と同じtransactionでeventを書き込み、relayが後から配信する
+// 書き込みと配信を分けることで、保存に成功したのにeventだけ消えることを防ぐ
+type OutboxRepository interface {
+	// Add...eventを書き込む. TxManagerのRepositories.Outboxを使えば変更と一緒にcommit/rollbackされる
+	Add(ctx context.Context, events ...model.Event) error
+	// Pending...未配信でnextAttemptAtを過ぎたeventを古い順にlimit件取得する. 取り出さないので、配信にはClaimを使う
+	Pending(ctx context.Context, now time.Time, limit int) ([]model.Event, error)
+	// Claim...Pendingと同じeventを取り出し、nextAttemptAtをnow+leaseに延ばす
+	// 複数台のrelayが同じeventを取り出さないように、他が取り出し中の行は飛ばす. lease内に配信済みにしなければまた取り出される
+	Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]model.Event, error)
+	// MarkDelivered...配信済みにする
+	MarkDelivered(ctx context.Context, id uint) error
+	// MarkFailed...失敗回数を増やし、retryAtまで配信しない
+	MarkFailed(ctx context.Context, id uint, retryAt time.Time, reason string) error
+	// MarkDead...失敗回数を増やし、もう配信しない. 行はfailedで残すので、last_errorを見て調べられる
+	MarkDead(ctx context.Context, id uint, reason string) error
+}
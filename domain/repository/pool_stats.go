@@ -0,0 +1,20 @@
+package repository
+
+// PoolStats...DBのコネクションpoolの状態. database/sqlのDBStatsに、health checkの結果を足したもの
+type PoolStats struct {
+	Name               string `json:"name"`
+	Healthy            bool   `json:"healthy"`
+	MaxOpenConnections int    `json:"max_open_connections"`
+	OpenConnections    int    `json:"open_connections"`
+	InUse              int    `json:"in_use"`
+	Idle               int    `json:"idle"`
+	WaitCount          int64  `json:"wait_count"`
+	WaitDurationMillis int64  `json:"wait_duration_millis"`
+	MaxIdleClosed      int64  `json:"max_idle_closed"`
+	MaxLifetimeClosed  int64  `json:"max_lifetime_closed"`
+}
+
+// PoolStatsReporter...primary, replicaの順にpoolの状態を返す. 管理用endpointで使う
+type PoolStatsReporter interface {
+	PoolStats() []PoolStats
+}
@@ -0,0 +1,27 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/domain/model"
+)
+
+// TodoChangeRepository...todoごとに最後の変更だけを残す. GET /v1/syncはtokenのseqより後の変更を返す
+// todoを書き込むときは、TxManagerのRepositories.Changesで同じtransactionに記録する
+type TodoChangeRepository interface {
+	// Record...変更を記録し、SeqとChangedAtを埋める. 同じtodoの前の変更は消える
+	Record(ctx context.Context, change *model.TodoChange) error
+	// Since...callerのfamilyか、callerが作ったtodoの変更のうち、seqより後のものを古い順にlimit件取得する
+	Since(ctx context.Context, caller domain.Caller, seq uint, limit int) ([]model.TodoChange, error)
+	// Latest...最後に振ったseq. 変更が無ければ0
+	Latest(ctx context.Context) (uint, error)
+}
+
+// SyncMutationRepository...POST /v1/syncで反映した変更をclient_idで覚える
+type SyncMutationRepository interface {
+	// Get...memberが送ったclient_idの変更を取得する. 無ければErrNotFound
+	Get(ctx context.Context, memberId domain.Id, clientId string) (model.SyncMutation, error)
+	// Save...変更を記録する. 同じmemberとclient_idならErrConflict
+	Save(ctx context.Context, mutation *model.SyncMutation) error
+}
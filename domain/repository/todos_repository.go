@@ -1,15 +1,21 @@
 package repository
 
 import (
+	"context"
+
 	"github.com/sioncojp/famili-api/domain"
 	"github.com/sioncojp/famili-api/domain/model"
 )
 
 // interfaceを使うことでDIPを解決する。mockも作成できるようになる
+// ctxはrequestのcontextを渡す. clientの切断やtimeoutでqueryを止められる
 type TodoRepository interface {
-	GetById(domain.Id) (model.Todo, error)
-	List() ([]model.Todo, error)
-	Create(*model.Todo) error
-	Update(*model.Todo) error
-	Delete(*model.Todo) error
+	GetById(context.Context, domain.Id) (model.Todo, error)
+	GetByShareToken(context.Context, string) (model.Todo, error)
+	List(context.Context, domain.Caller) ([]model.Todo, error)
+	ListByAssignee(ctx context.Context, caller domain.Caller, memberId domain.Id) ([]model.Todo, error)
+	Create(context.Context, *model.Todo) error
+	Update(context.Context, *model.Todo) error
+	Delete(context.Context, *model.Todo) error
+	SetAssignees(context.Context, *model.Todo) error
 }
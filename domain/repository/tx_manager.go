@@ -0,0 +1,25 @@
+package repository
+
+import (
+	"context"
+)
+
+// Repositories...TxManagerのcallbackに渡す. 全てのrepositoryが同じtransactionに紐づいている
+type Repositories struct {
+	Todos         TodoRepository
+	Members       MemberRepository
+	Outbox        OutboxRepository
+	Changes       TodoChangeRepository
+	SyncMutations SyncMutationRepository
+	Accounts      AccountRepository
+}
+
+// TxFunc...transactionの中で実行する処理. ctxは入れ子のDoにそのまま渡す
+type TxFunc func(ctx context.Context, repos Repositories) error
+
+// TxManager...複数のtableを触る処理を1つのtransactionにまとめる. gormとメモリの実装がある
+type TxManager interface {
+	// Do...fnをtransactionの中で実行する. fnがerrorを返すかpanicしたらrollbackする
+	// fnに渡されたctxでDoを呼ぶとsavepointになり、内側のrollbackは外側に影響しない
+	Do(ctx context.Context, fn TxFunc) error
+}
@@ -0,0 +1,32 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/domain/model"
+)
+
+// WebhookRepository...webhookの登録と配信の記録
+type WebhookRepository interface {
+	GetById(ctx context.Context, id domain.Id) (model.Webhook, error)
+	// List...familyのwebhookを全て取得する. 無効になったものも含む
+	List(ctx context.Context, familyId domain.Id) ([]model.Webhook, error)
+	Create(ctx context.Context, webhook *model.Webhook) error
+	Update(ctx context.Context, webhook *model.Webhook) error
+	Delete(ctx context.Context, webhook *model.Webhook) error
+	// RecordSuccess...連続失敗回数を0に戻す
+	RecordSuccess(ctx context.Context, id uint) error
+	// RecordFailure...連続失敗回数を増やし、disableAfter回以上ならnowで無効にする. 無効にしたらtrueを返す
+	RecordFailure(ctx context.Context, id uint, disableAfter int, now time.Time) (bool, error)
+
+	// Enqueue...配信を追加する. 同じwebhookとeventの配信が既にあれば何もしない
+	Enqueue(ctx context.Context, deliveries ...model.WebhookDelivery) error
+	// PendingDeliveries...pendingでnextAttemptAtを過ぎた配信を古い順にlimit件取得する
+	PendingDeliveries(ctx context.Context, now time.Time, limit int) ([]model.WebhookDelivery, error)
+	// SaveDelivery...配信の結果を保存する. IDが0なら追加する
+	SaveDelivery(ctx context.Context, delivery *model.WebhookDelivery) error
+	// ListDeliveries...webhookの配信を新しい順にlimit件取得する
+	ListDeliveries(ctx context.Context, webhookId uint, limit int) ([]model.WebhookDelivery, error)
+}
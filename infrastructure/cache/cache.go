@@ -0,0 +1,14 @@
+package cache
+
+import (
+	"context"
+)
+
+// Store...cacheの保存先. lruとredisで同じinterfaceにしてdecoratorから切り替える
+// 有効期限はStoreを作るときに決める
+type Store interface {
+	// Get...keyが無い、または期限切れならfalseを返す
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte) error
+	Delete(ctx context.Context, keys ...string) error
+}
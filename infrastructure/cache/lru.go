@@ -0,0 +1,104 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// lruStore...プロセス内に持つLRU. sizeを超えたら最後に使われてから一番古いものを捨てる
+type lruStore struct {
+	mu    sync.Mutex
+	size  int
+	ttl   time.Duration
+	ll    *list.List
+	items map[string]*list.Element
+	now   func() time.Time
+}
+
+// lruEntry...listの要素
+type lruEntry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+}
+
+// NewLRUStore...size件までプロセス内に持つ. ttlが0なら期限切れにしない
+func NewLRUStore(size int, ttl time.Duration) Store {
+	return &lruStore{
+		size:  size,
+		ttl:   ttl,
+		ll:    list.New(),
+		items: map[string]*list.Element{},
+		now:   time.Now,
+	}
+}
+
+// Get...keyの値を取得して、一番新しく使われたものにする
+func (s *lruStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.items[key]
+	if !ok {
+		return nil, false, nil
+	}
+	entry := e.Value.(*lruEntry)
+	if !entry.expiresAt.IsZero() && !s.now().Before(entry.expiresAt) {
+		s.remove(e)
+		return nil, false, nil
+	}
+	s.ll.MoveToFront(e)
+	return entry.value, true, nil
+}
+
+// Set...keyに値を入れる. sizeを超えたら古いものを捨てる
+func (s *lruStore) Set(ctx context.Context, key string, value []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var expiresAt time.Time
+	if s.ttl > 0 {
+		expiresAt = s.now().Add(s.ttl)
+	}
+
+	if e, ok := s.items[key]; ok {
+		entry := e.Value.(*lruEntry)
+		entry.value = value
+		entry.expiresAt = expiresAt
+		s.ll.MoveToFront(e)
+		return nil
+	}
+
+	s.items[key] = s.ll.PushFront(&lruEntry{key: key, value: value, expiresAt: expiresAt})
+	for s.ll.Len() > s.size {
+		s.remove(s.ll.Back())
+	}
+	return nil
+}
+
+// Delete...keyを消す. 無いkeyは無視する
+func (s *lruStore) Delete(ctx context.Context, keys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range keys {
+		if e, ok := s.items[key]; ok {
+			s.remove(e)
+		}
+	}
+	return nil
+}
+
+// remove...lockを取った状態で呼ぶ
+func (s *lruStore) remove(e *list.Element) {
+	s.ll.Remove(e)
+	delete(s.items, e.Value.(*lruEntry).key)
+}
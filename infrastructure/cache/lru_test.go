@@ -0,0 +1,60 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var ctx = context.Background()
+
+func TestLRUStoreEvict(t *testing.T) {
+	t.Parallel()
+	s := NewLRUStore(2, 0)
+
+	require.NoError(t, s.Set(ctx, "a", []byte("1")))
+	require.NoError(t, s.Set(ctx, "b", []byte("2")))
+	// aを使ったので、次に捨てられるのはb
+	_, ok, _ := s.Get(ctx, "a")
+	require.True(t, ok)
+	require.NoError(t, s.Set(ctx, "c", []byte("3")))
+
+	cases := []struct {
+		key  string
+		want bool
+	}{
+		{"a", true},
+		{"b", false},
+		{"c", true},
+	}
+	for _, v := range cases {
+		_, ok, err := s.Get(ctx, v.key)
+		require.NoError(t, err)
+		assert.Equal(t, v.want, ok, v.key)
+	}
+
+	require.NoError(t, s.Delete(ctx, "a", "unknown"))
+	_, ok, _ = s.Get(ctx, "a")
+	assert.False(t, ok)
+}
+
+func TestLRUStoreTTL(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2022, 8, 1, 0, 0, 0, 0, time.UTC)
+	s := NewLRUStore(10, time.Minute).(*lruStore)
+	s.now = func() time.Time { return now }
+
+	require.NoError(t, s.Set(ctx, "a", []byte("1")))
+	now = now.Add(59 * time.Second)
+	v, ok, _ := s.Get(ctx, "a")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("1"), v)
+
+	now = now.Add(time.Second)
+	_, ok, _ = s.Get(ctx, "a")
+	assert.False(t, ok, "should be expired")
+	assert.Zero(t, s.ll.Len())
+}
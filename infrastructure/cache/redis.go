@@ -0,0 +1,47 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+)
+
+// redisStore...複数台で同じcacheを共有するときに使う
+type redisStore struct {
+	client *redis.Client
+	prefix string
+	ttl    time.Duration
+}
+
+// NewRedisStore...keyにprefixを付けてredisに持つ. ttlが0なら期限切れにしない
+func NewRedisStore(client *redis.Client, prefix string, ttl time.Duration) Store {
+	return &redisStore{client, prefix, ttl}
+}
+
+// Get...keyの値を取得する
+func (s *redisStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	v, err := s.client.Get(ctx, s.prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return v, true, nil
+}
+
+// Set...keyに値を入れる
+func (s *redisStore) Set(ctx context.Context, key string, value []byte) error {
+	return s.client.Set(ctx, s.prefix+key, value, s.ttl).Err()
+}
+
+// Delete...keyを消す. 無いkeyは無視する
+func (s *redisStore) Delete(ctx context.Context, keys ...string) error {
+	prefixed := make([]string, 0, len(keys))
+	for _, key := range keys {
+		prefixed = append(prefixed, s.prefix+key)
+	}
+	return s.client.Del(ctx, prefixed...).Err()
+}
@@ -0,0 +1,44 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newRedisStore...miniredisをプロセス内で立ち上げてstoreを作る
+func newRedisStore(t *testing.T, ttl time.Duration) (Store, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewRedisStore(client, "famili-api:", ttl), mr
+}
+
+func TestRedisStore(t *testing.T) {
+	t.Parallel()
+	s, mr := newRedisStore(t, time.Minute)
+
+	_, ok, err := s.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, s.Set(ctx, "a", []byte("1")))
+	assert.True(t, mr.Exists("famili-api:a"), "key should be prefixed")
+	v, ok, err := s.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []byte("1"), v)
+
+	mr.FastForward(time.Minute)
+	_, ok, err = s.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.False(t, ok, "should be expired")
+
+	require.NoError(t, s.Set(ctx, "b", []byte("2")))
+	require.NoError(t, s.Delete(ctx, "b", "unknown"))
+	assert.False(t, mr.Exists("famili-api:b"))
+}
@@ -0,0 +1,206 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/domain/model"
+	"github.com/sioncojp/famili-api/domain/repository"
+	"github.com/sioncojp/famili-api/utils"
+)
+
+const (
+	// generationKey...list系のkeyに含める世代. 書き込みがあったら消して、全てのlistを一度に無効にする
+	generationKey = "todos:generation"
+
+	// generationBytes...世代はrandomにして、消えた世代が再利用されないようにする
+	generationBytes = 8
+)
+
+// TodoRepository...TodoRepositoryをwrapしてGetById, List, ListByAssigneeの結果をcacheする
+// Create, Update, Delete, SetAssigneesをしたらそのtodoと全てのlistを無効にする
+// storeが使えないときはcacheせずにwrapしたrepositoryをそのまま使う
+// cacheに入れる値はdomain.NewPrimaryContextでprimaryから読む. replicaの遅れた行を入れると、
+// 書き込んだcallerがstickyの間もcacheから古い値を読んでしまう
+type TodoRepository struct {
+	repo   repository.TodoRepository
+	store  Store
+	logger *zap.Logger
+
+	hits   uint64
+	misses uint64
+}
+
+// NewTodoRepository...repoの前にstoreのcacheを挟む
+func NewTodoRepository(repo repository.TodoRepository, store Store, logger *zap.Logger) *TodoRepository {
+	return &TodoRepository{repo: repo, store: store, logger: logger}
+}
+
+// CacheStats...これまでのhit/miss回数
+func (r *TodoRepository) CacheStats() repository.CacheStats {
+	return repository.CacheStats{
+		Hits:   atomic.LoadUint64(&r.hits),
+		Misses: atomic.LoadUint64(&r.misses),
+	}
+}
+
+// GetById...IDからtodoを取得する. domain.NewPrimaryContextを付けたctxならcacheを使わない
+func (r *TodoRepository) GetById(ctx context.Context, id domain.Id) (model.Todo, error) {
+	if domain.PrimaryFromContext(ctx) {
+		return r.repo.GetById(ctx, id)
+	}
+	var todo model.Todo
+	err := r.cached(ctx, idKey(string(id)), &todo, func(ctx context.Context) (interface{}, error) {
+		return r.repo.GetById(ctx, id)
+	})
+	return todo, err
+}
+
+// GetByShareToken...share tokenはUpdateで変わるのでcacheしない
+func (r *TodoRepository) GetByShareToken(ctx context.Context, token string) (model.Todo, error) {
+	return r.repo.GetByShareToken(ctx, token)
+}
+
+// List...callerが見れるtodoを全て取得する
+func (r *TodoRepository) List(ctx context.Context, caller domain.Caller) ([]model.Todo, error) {
+	var todos []model.Todo
+	key := "list:" + callerKey(caller)
+	err := r.cachedList(ctx, key, &todos, func(ctx context.Context) (interface{}, error) {
+		return r.repo.List(ctx, caller)
+	})
+	return todos, err
+}
+
+// ListByAssignee...memberIdがassigneeのtodoのうち、callerが見れるものを取得する
+func (r *TodoRepository) ListByAssignee(ctx context.Context, caller domain.Caller, memberId domain.Id) ([]model.Todo, error) {
+	var todos []model.Todo
+	key := "assignee:" + callerKey(caller) + ":" + url.QueryEscape(string(memberId))
+	err := r.cachedList(ctx, key, &todos, func(ctx context.Context) (interface{}, error) {
+		return r.repo.ListByAssignee(ctx, caller, memberId)
+	})
+	return todos, err
+}
+
+// Create...todoを作成する. 新しいtodoが入るのでlistを無効にする
+func (r *TodoRepository) Create(ctx context.Context, todo *model.Todo) error {
+	defer r.invalidate()
+	return r.repo.Create(ctx, todo)
+}
+
+// Update...todoを更新する
+func (r *TodoRepository) Update(ctx context.Context, todo *model.Todo) error {
+	defer r.invalidate(todo.ID)
+	return r.repo.Update(ctx, todo)
+}
+
+// Delete...todoを削除する
+func (r *TodoRepository) Delete(ctx context.Context, todo *model.Todo) error {
+	defer r.invalidate(todo.ID)
+	return r.repo.Delete(ctx, todo)
+}
+
+// SetAssignees...todoのassigneeを置き換える
+func (r *TodoRepository) SetAssignees(ctx context.Context, todo *model.Todo) error {
+	defer r.invalidate(todo.ID)
+	return r.repo.SetAssignees(ctx, todo)
+}
+
+// cachedList...世代を付けたkeyでcachedを呼ぶ
+func (r *TodoRepository) cachedList(ctx context.Context, key string, out interface{}, load func(context.Context) (interface{}, error)) error {
+	generation, err := r.generation(ctx)
+	if err != nil {
+		r.logger.Warn("cache generation", zap.Error(err))
+		return r.load(ctx, out, load)
+	}
+	return r.cached(ctx, "todos:"+generation+":"+key, out, load)
+}
+
+// cached...keyがあればそれをoutに入れる. 無ければprimaryからloadしてstoreに入れる
+// loadがerrorのとき(not foundを含む)はcacheしない
+func (r *TodoRepository) cached(ctx context.Context, key string, out interface{}, load func(context.Context) (interface{}, error)) error {
+	b, ok, err := r.store.Get(ctx, key)
+	if err != nil {
+		r.logger.Warn("cache get", zap.String("key", key), zap.Error(err))
+	}
+	if ok && json.Unmarshal(b, out) == nil {
+		atomic.AddUint64(&r.hits, 1)
+		return nil
+	}
+	atomic.AddUint64(&r.misses, 1)
+
+	v, err := load(domain.NewPrimaryContext(ctx))
+	if err != nil {
+		return err
+	}
+	b, err = json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := r.store.Set(ctx, key, b); err != nil {
+		r.logger.Warn("cache set", zap.String("key", key), zap.Error(err))
+	}
+	return json.Unmarshal(b, out)
+}
+
+// load...cacheを使わずにloadしてoutに入れる. cacheに入れないのでreplicaから読んでよい
+func (r *TodoRepository) load(ctx context.Context, out interface{}, load func(context.Context) (interface{}, error)) error {
+	v, err := load(ctx)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, out)
+}
+
+// generation...今のlistの世代. 無ければ新しく作る
+func (r *TodoRepository) generation(ctx context.Context) (string, error) {
+	b, ok, err := r.store.Get(ctx, generationKey)
+	if err != nil {
+		return "", err
+	}
+	if ok {
+		return string(b), nil
+	}
+
+	generation, err := utils.MakeSecureToken(generationBytes)
+	if err != nil {
+		return "", err
+	}
+	if err := r.store.Set(ctx, generationKey, []byte(generation)); err != nil {
+		return "", err
+	}
+	return generation, nil
+}
+
+// invalidate...todoと全てのlistを無効にする
+// 書き込みはもう終わっているので、requestがcancelされていても消せるようにctxは引き継がない
+func (r *TodoRepository) invalidate(ids ...uint) {
+	keys := []string{generationKey}
+	for _, id := range ids {
+		if id != 0 {
+			keys = append(keys, idKey(strconv.FormatUint(uint64(id), 10)))
+		}
+	}
+	if err := r.store.Delete(context.Background(), keys...); err != nil {
+		r.logger.Warn("cache invalidate", zap.Strings("keys", keys), zap.Error(err))
+	}
+}
+
+// idKey...GetByIdのkey
+func idKey(id string) string {
+	return "todos:id:" + url.QueryEscape(id)
+}
+
+// callerKey...見れるtodoはMemberIdとFamilyIdで決まる
+func callerKey(c domain.Caller) string {
+	return url.QueryEscape(string(c.MemberId)) + ":" + url.QueryEscape(string(c.FamilyId))
+}
@@ -0,0 +1,180 @@
+package cache
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/domain/model"
+	"github.com/sioncojp/famili-api/domain/repository"
+	"github.com/sioncojp/famili-api/infrastructure/memory"
+)
+
+var papa = domain.Caller{MemberId: "1", FamilyId: "f1"}
+
+// countingRepository...wrapしたrepositoryまで読みに行った回数を数える
+type countingRepository struct {
+	repository.TodoRepository
+	reads int64
+}
+
+func (r *countingRepository) GetById(ctx context.Context, id domain.Id) (model.Todo, error) {
+	atomic.AddInt64(&r.reads, 1)
+	return r.TodoRepository.GetById(ctx, id)
+}
+
+func (r *countingRepository) List(ctx context.Context, caller domain.Caller) ([]model.Todo, error) {
+	atomic.AddInt64(&r.reads, 1)
+	return r.TodoRepository.List(ctx, caller)
+}
+
+func (r *countingRepository) ListByAssignee(ctx context.Context, caller domain.Caller, memberId domain.Id) ([]model.Todo, error) {
+	atomic.AddInt64(&r.reads, 1)
+	return r.TodoRepository.ListByAssignee(ctx, caller, memberId)
+}
+
+func newTodo(title string) *model.Todo {
+	return &model.Todo{Title: title, Description: "d", CreatedBy: papa.MemberId, FamilyId: papa.FamilyId, Visibility: model.VisibilityFamily}
+}
+
+// stores...lruとredisで同じテストを流す
+func stores(t *testing.T) map[string]Store {
+	redisStore, _ := newRedisStore(t, time.Minute)
+	return map[string]Store{
+		"lru":   NewLRUStore(100, time.Minute),
+		"redis": redisStore,
+	}
+}
+
+func TestTodoRepositoryGetById(t *testing.T) {
+	t.Parallel()
+	for name, store := range stores(t) {
+		inner := &countingRepository{TodoRepository: memory.NewTodoRepository()}
+		r := NewTodoRepository(inner, store, zap.NewNop())
+		todo := newTodo("a")
+		require.NoError(t, r.Create(ctx, todo))
+
+		for i := 0; i < 3; i++ {
+			got, err := r.GetById(ctx, "1")
+			require.NoError(t, err, name)
+			assert.Equal(t, "a", got.Title, name)
+		}
+		assert.EqualValues(t, 1, inner.reads, name)
+		assert.Equal(t, repository.CacheStats{Hits: 2, Misses: 1}, r.CacheStats(), name)
+
+		// Updateしたら次のGetByIdは読みに行く
+		todo.Title = "b"
+		require.NoError(t, r.Update(ctx, todo))
+		got, err := r.GetById(ctx, "1")
+		require.NoError(t, err, name)
+		assert.Equal(t, "b", got.Title, name)
+		assert.EqualValues(t, 2, inner.reads, name)
+
+		// primaryから読むcontextならcacheを使わない
+		got, err = r.GetById(domain.NewPrimaryContext(ctx), "1")
+		require.NoError(t, err, name)
+		assert.Equal(t, "b", got.Title, name)
+		assert.EqualValues(t, 3, inner.reads, name)
+
+		// not foundはcacheしない
+		require.NoError(t, r.Delete(ctx, todo))
+		for i := 0; i < 2; i++ {
+			_, err = r.GetById(ctx, "1")
+			assert.ErrorIs(t, err, memory.ErrNotFound, name)
+		}
+		assert.EqualValues(t, 5, inner.reads, name)
+	}
+}
+
+func TestTodoRepositoryList(t *testing.T) {
+	t.Parallel()
+	for name, store := range stores(t) {
+		inner := &countingRepository{TodoRepository: memory.NewTodoRepository()}
+		r := NewTodoRepository(inner, store, zap.NewNop())
+		require.NoError(t, r.Create(ctx, newTodo("a")))
+
+		for i := 0; i < 2; i++ {
+			todos, err := r.List(ctx, papa)
+			require.NoError(t, err, name)
+			assert.Len(t, todos, 1, name)
+		}
+		assert.EqualValues(t, 1, inner.reads, name)
+
+		// callerが違えば別のkey
+		todos, err := r.List(ctx, domain.Caller{MemberId: "2", FamilyId: "f2"})
+		require.NoError(t, err, name)
+		assert.Empty(t, todos, name)
+		assert.EqualValues(t, 2, inner.reads, name)
+
+		// Createしたら全てのlistが無効になる
+		todo := newTodo("b")
+		require.NoError(t, r.Create(ctx, todo))
+		todos, err = r.List(ctx, papa)
+		require.NoError(t, err, name)
+		assert.Len(t, todos, 2, name)
+		assert.EqualValues(t, 3, inner.reads, name)
+
+		// SetAssigneesしたらassigneeのlistも無効になる
+		todos, err = r.ListByAssignee(ctx, papa, "1")
+		require.NoError(t, err, name)
+		assert.Empty(t, todos, name)
+		todo.AssigneeIds = []uint{1}
+		require.NoError(t, r.SetAssignees(ctx, todo))
+		todos, err = r.ListByAssignee(ctx, papa, "1")
+		require.NoError(t, err, name)
+		assert.Len(t, todos, 1, name)
+		assert.EqualValues(t, 5, inner.reads, name)
+	}
+}
+
+func TestTodoRepositoryStoreUnavailable(t *testing.T) {
+	t.Parallel()
+	store, mr := newRedisStore(t, time.Minute)
+	r := NewTodoRepository(memory.NewTodoRepository(), store, zap.NewNop())
+	require.NoError(t, r.Create(ctx, newTodo("a")))
+
+	// redisが落ちていてもwrapしたrepositoryから読める
+	mr.Close()
+	got, err := r.GetById(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, "a", got.Title)
+	todos, err := r.List(ctx, papa)
+	require.NoError(t, err)
+	assert.Len(t, todos, 1)
+}
+
+func TestTxManagerInvalidateAfterCommit(t *testing.T) {
+	t.Parallel()
+	inner := &countingRepository{TodoRepository: memory.NewTodoRepository()}
+	r := NewTodoRepository(inner, NewLRUStore(100, time.Minute), zap.NewNop())
+	tx := NewTxManager(memory.NewTxManager(repository.Repositories{Todos: inner, Members: memory.NewMemberRepository()}), r)
+	todo := newTodo("a")
+	require.NoError(t, r.Create(ctx, todo))
+	_, err := r.GetById(ctx, "1")
+	require.NoError(t, err)
+
+	err = tx.Do(ctx, func(ctx context.Context, repos repository.Repositories) error {
+		// 入れ子のDoで書き込んでも、無効にするのは外側が終わってから
+		return tx.Do(ctx, func(ctx context.Context, repos repository.Repositories) error {
+			todo.AssigneeIds = []uint{1}
+			if err := repos.Todos.SetAssignees(ctx, todo); err != nil {
+				return err
+			}
+			_, err := r.GetById(ctx, "1")
+			return err
+		})
+	})
+	require.NoError(t, err)
+	reads := inner.reads
+
+	got, err := r.GetById(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, []uint{1}, got.AssigneeIds)
+	assert.Equal(t, reads+1, inner.reads, "should be invalidated after commit")
+}
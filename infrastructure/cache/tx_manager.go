@@ -0,0 +1,90 @@
+package cache
+
+import (
+	"context"
+	"sync"
+
+	"github.com/sioncojp/famili-api/domain/model"
+	"github.com/sioncojp/famili-api/domain/repository"
+)
+
+// touchedKey...外側のDoが書き込んだtodoを集めるためのcontextのkey
+type touchedKey struct{}
+
+// touched...transaction中に書き込んだtodoのID
+type touched struct {
+	mu  sync.Mutex
+	ids []uint
+}
+
+func (t *touched) add(id uint) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.ids = append(t.ids, id)
+}
+
+// txManager...transaction中の書き込みはcommitが終わってから無効にする
+// commit前に消すと、その間に読んだ古い値がcacheに入ってしまうため
+type txManager struct {
+	tx    repository.TxManager
+	todos *TodoRepository
+}
+
+// NewTxManager...txのtransaction中はcacheを使わず、終わったら書き込んだtodoを無効にする
+func NewTxManager(tx repository.TxManager, todos *TodoRepository) repository.TxManager {
+	return &txManager{tx, todos}
+}
+
+// Do...fnのTodosはtransactionのrepositoryをそのまま読み、書き込んだIDだけ覚えておく
+func (m *txManager) Do(ctx context.Context, fn repository.TxFunc) error {
+	// 入れ子なら外側のDoが終わってからまとめて無効にする
+	if t, ok := ctx.Value(touchedKey{}).(*touched); ok {
+		return m.tx.Do(ctx, func(ctx context.Context, repos repository.Repositories) error {
+			repos.Todos = &txTodoRepository{repos.Todos, t}
+			return fn(ctx, repos)
+		})
+	}
+
+	t := &touched{}
+	defer func() {
+		if len(t.ids) > 0 {
+			m.todos.invalidate(t.ids...)
+		}
+	}()
+
+	ctx = context.WithValue(ctx, touchedKey{}, t)
+	return m.tx.Do(ctx, func(ctx context.Context, repos repository.Repositories) error {
+		repos.Todos = &txTodoRepository{repos.Todos, t}
+		return fn(ctx, repos)
+	})
+}
+
+// txTodoRepository...transaction中のTodoRepository. 読み込みはそのまま、書き込みはIDを覚える
+type txTodoRepository struct {
+	repository.TodoRepository
+	touched *touched
+}
+
+// Create...todoを作成する
+func (r *txTodoRepository) Create(ctx context.Context, todo *model.Todo) error {
+	defer func() { r.touched.add(todo.ID) }()
+	return r.TodoRepository.Create(ctx, todo)
+}
+
+// Update...todoを更新する
+func (r *txTodoRepository) Update(ctx context.Context, todo *model.Todo) error {
+	r.touched.add(todo.ID)
+	return r.TodoRepository.Update(ctx, todo)
+}
+
+// Delete...todoを削除する
+func (r *txTodoRepository) Delete(ctx context.Context, todo *model.Todo) error {
+	r.touched.add(todo.ID)
+	return r.TodoRepository.Delete(ctx, todo)
+}
+
+// SetAssignees...todoのassigneeを置き換える
+func (r *txTodoRepository) SetAssignees(ctx context.Context, todo *model.Todo) error {
+	r.touched.add(todo.ID)
+	return r.TodoRepository.SetAssignees(ctx, todo)
+}
@@ -0,0 +1,110 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/domain/model"
+	"github.com/sioncojp/famili-api/domain/repository"
+)
+
+// accountRepository...
+type accountRepository struct {
+	db *gorm.DB
+}
+
+// accountRecoveryCode...TOTPを失くしたときのrecovery code. hashだけ保存する
+type accountRecoveryCode struct {
+	model.Model
+	AccountId uint
+	Hash      string
+	UsedAt    *time.Time
+}
+
+func (accountRecoveryCode) TableName() string {
+	return "account_recovery_codes"
+}
+
+// NewAccountRepository...Repository interfaceを返すことでserviceとメソッドを揃える
+func NewAccountRepository(db *gorm.DB) repository.AccountRepository {
+	return &accountRepository{db}
+}
+
+// GetById...IDからaccountを取得するためのDB操作
+func (r *accountRepository) GetById(id domain.Id) (model.Account, error) {
+	var result model.Account
+	v, ok := parseId(id)
+	if !ok {
+		return result, errInvalidId
+	}
+	if err := r.db.Where("id = ?", v).First(&result).Error; err != nil {
+		return result, translate(err)
+	}
+	return result, nil
+}
+
+// GetByEmail...emailからaccountを取得するためのDB操作
+func (r *accountRepository) GetByEmail(email string) (model.Account, error) {
+	var result model.Account
+	if err := r.db.Where("email = ?", email).First(&result).Error; err != nil {
+		return result, translate(err)
+	}
+	return result, nil
+}
+
+// Create...account作成するためのDB操作
+func (r *accountRepository) Create(account *model.Account) error {
+	return translate(r.db.Create(&account).Error)
+}
+
+// Update...account更新するためのDB操作
+func (r *accountRepository) Update(account *model.Account) error {
+	return translate(r.db.Save(&account).Error)
+}
+
+// ReplaceRecoveryCodes...recovery codeを置き換えるためのDB操作
+func (r *accountRepository) ReplaceRecoveryCodes(account *model.Account, hashes []string) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("account_id = ?", account.ID).Delete(&accountRecoveryCode{}).Error; err != nil {
+			return err
+		}
+		if len(hashes) == 0 {
+			return nil
+		}
+
+		rows := make([]accountRecoveryCode, 0, len(hashes))
+		for _, v := range hashes {
+			rows = append(rows, accountRecoveryCode{AccountId: account.ID, Hash: v})
+		}
+		return tx.Create(&rows).Error
+	})
+	return translate(err)
+}
+
+// UseRecoveryCode...recovery codeを使用済みにするためのDB操作. 1回のUPDATEで判定するので同時に使われても1回しか通らない
+func (r *accountRepository) UseRecoveryCode(account *model.Account, hash string) (bool, error) {
+	result := r.db.Model(&accountRecoveryCode{}).
+		Where("account_id = ? AND hash = ? AND used_at IS NULL", account.ID, hash).
+		UpdateColumn("used_at", time.Now())
+	if result.Error != nil {
+		return false, translate(result.Error)
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// UseTOTPStep...TOTPの時間stepを使用済みにするためのDB操作. 1回のUPDATEで判定するので同じcodeを同時に使われても1回しか通らない
+func (r *accountRepository) UseTOTPStep(account *model.Account, step int64) (bool, error) {
+	result := r.db.Model(&model.Account{}).
+		Where("id = ? AND totp_last_step < ?", account.ID, step).
+		UpdateColumn("totp_last_step", step)
+	if result.Error != nil {
+		return false, translate(result.Error)
+	}
+	if result.RowsAffected != 1 {
+		return false, nil
+	}
+	account.TOTPLastStep = step
+	return true, nil
+}
@@ -0,0 +1,135 @@
+package database
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+
+	"github.com/sioncojp/famili-api/domain/model"
+)
+
+// テストスイートの構造体
+type AccountRepositoryTestSuite struct {
+	suite.Suite
+	mock              sqlmock.Sqlmock
+	accountRepository accountRepository
+	dummy             *model.Account
+}
+
+// テストのセットアップ
+func (s *AccountRepositoryTestSuite) SetupTest() {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		panic(err)
+	}
+
+	accountRepository := accountRepository{}
+	accountRepository.db, _ = gorm.Open(
+		mysql.Dialector{Config: &mysql.Config{DriverName: "mysql", Conn: db, SkipInitializeWithVersion: true}},
+		&gorm.Config{},
+	)
+	s.mock = mock
+	s.accountRepository = accountRepository
+	s.dummy = &model.Account{Model: model.Model{ID: 1}, Email: "papa@example.com"}
+}
+
+// テスト終了時の処理（データベース接続のクローズ）
+func (s *AccountRepositoryTestSuite) TearDownTest() {
+	db, _ := s.accountRepository.db.DB()
+	db.Close()
+}
+
+// テストスイートの実行
+func TestAccountRepositoryTestSuite(t *testing.T) {
+	suite.Run(t, new(AccountRepositoryTestSuite))
+}
+
+func (s *AccountRepositoryTestSuite) TestAccountGetByEmail() {
+	s.Run("GetByEmail", func() {
+		rows := sqlmock.NewRows([]string{"id", "email", "totp_secret", "totp_enabled"}).
+			AddRow(s.dummy.ID, s.dummy.Email, "encrypted", true)
+		s.mock.ExpectQuery(regexp.QuoteMeta(
+			"SELECT * FROM `accounts` WHERE email = ? ORDER BY `accounts`.`id` LIMIT 1")).
+			WithArgs(s.dummy.Email).
+			WillReturnRows(rows)
+
+		data, err := s.accountRepository.GetByEmail(s.dummy.Email)
+		require.NoError(s.T(), err)
+		assert.Equal(s.T(), "encrypted", data.TOTPSecret, "unexpected totp secret")
+		assert.True(s.T(), data.TOTPEnabled, "unexpected totp enabled")
+	})
+}
+
+func (s *AccountRepositoryTestSuite) TestAccountReplaceRecoveryCodes() {
+	s.Run("ReplaceRecoveryCodes", func() {
+		s.mock.ExpectBegin()
+		s.mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `account_recovery_codes` WHERE account_id = ?")).
+			WithArgs(s.dummy.ID).
+			WillReturnResult(sqlmock.NewResult(0, 10))
+		s.mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `account_recovery_codes`")).
+			WithArgs(anyTime, anyTime, s.dummy.ID, "hash1", nil, anyTime, anyTime, s.dummy.ID, "hash2", nil).
+			WillReturnResult(sqlmock.NewResult(1, 2))
+		s.mock.ExpectCommit()
+
+		err := s.accountRepository.ReplaceRecoveryCodes(s.dummy, []string{"hash1", "hash2"})
+		require.NoError(s.T(), err)
+	})
+}
+
+func (s *AccountRepositoryTestSuite) TestAccountUseRecoveryCode() {
+	cases := []struct {
+		name         string
+		rowsAffected int64
+		want         bool
+	}{
+		{"unused", 1, true},
+		{"used", 0, false},
+	}
+
+	for _, v := range cases {
+		s.Run(v.name, func() {
+			s.mock.ExpectBegin()
+			s.mock.ExpectExec(regexp.QuoteMeta(
+				"UPDATE `account_recovery_codes` SET `used_at`=? WHERE account_id = ? AND hash = ? AND used_at IS NULL")).
+				WithArgs(anyTime, s.dummy.ID, "hash").
+				WillReturnResult(sqlmock.NewResult(0, v.rowsAffected))
+			s.mock.ExpectCommit()
+
+			ok, err := s.accountRepository.UseRecoveryCode(s.dummy, "hash")
+			require.NoError(s.T(), err)
+			assert.Equal(s.T(), v.want, ok)
+		})
+	}
+}
+
+func (s *AccountRepositoryTestSuite) TestAccountUseTOTPStep() {
+	cases := []struct {
+		name         string
+		rowsAffected int64
+		want         bool
+	}{
+		{"new step", 1, true},
+		{"used step", 0, false},
+	}
+
+	for _, v := range cases {
+		s.Run(v.name, func() {
+			s.mock.ExpectBegin()
+			s.mock.ExpectExec(regexp.QuoteMeta(
+				"UPDATE `accounts` SET `totp_last_step`=? WHERE id = ? AND totp_last_step < ?")).
+				WithArgs(int64(100), s.dummy.ID, int64(100)).
+				WillReturnResult(sqlmock.NewResult(0, v.rowsAffected))
+			s.mock.ExpectCommit()
+
+			ok, err := s.accountRepository.UseTOTPStep(s.dummy, 100)
+			require.NoError(s.T(), err)
+			assert.Equal(s.T(), v.want, ok)
+		})
+	}
+}
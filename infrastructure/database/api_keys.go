@@ -0,0 +1,65 @@
+package database
+
+import (
+	"gorm.io/gorm"
+
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/domain/model"
+	"github.com/sioncojp/famili-api/domain/repository"
+)
+
+// apiKeyRepository...
+type apiKeyRepository struct {
+	db *gorm.DB
+}
+
+// NewAPIKeyRepository...Repository interfaceを返すことでserviceとメソッドを揃える
+func NewAPIKeyRepository(db *gorm.DB) repository.APIKeyRepository {
+	return &apiKeyRepository{db}
+}
+
+// GetById...IDからAPI keyを取得するためのDB操作
+func (r *apiKeyRepository) GetById(id domain.Id) (model.APIKey, error) {
+	var result model.APIKey
+	v, ok := parseId(id)
+	if !ok {
+		return result, errInvalidId
+	}
+	if err := r.db.Where("id = ?", v).First(&result).Error; err != nil {
+		return result, translate(err)
+	}
+	return result, nil
+}
+
+// GetByPrefix...prefixからAPI keyを取得するためのDB操作
+func (r *apiKeyRepository) GetByPrefix(prefix string) (model.APIKey, error) {
+	var result model.APIKey
+	if err := r.db.Where("prefix = ?", prefix).First(&result).Error; err != nil {
+		return result, translate(err)
+	}
+	return result, nil
+}
+
+// List...メンバーのAPI keyを全て取得するためのDB操作
+func (r *apiKeyRepository) List(memberId domain.Id) ([]model.APIKey, error) {
+	var result []model.APIKey
+	if err := r.db.Where("member_id = ?", memberId).Find(&result).Error; err != nil {
+		return result, translate(err)
+	}
+	return result, nil
+}
+
+// Create...API key作成するためのDB操作
+func (r *apiKeyRepository) Create(key *model.APIKey) error {
+	return translate(r.db.Create(&key).Error)
+}
+
+// Update...API key更新するためのDB操作
+func (r *apiKeyRepository) Update(key *model.APIKey) error {
+	return translate(r.db.Save(&key).Error)
+}
+
+// TouchLastUsed...last_used_atだけを更新するためのDB操作. updated_atは変えない
+func (r *apiKeyRepository) TouchLastUsed(key *model.APIKey) error {
+	return translate(r.db.Model(&model.APIKey{}).Where("id = ?", key.ID).UpdateColumn("last_used_at", key.LastUsedAt).Error)
+}
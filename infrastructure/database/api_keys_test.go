@@ -0,0 +1,107 @@
+package database
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/bxcodec/faker/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+
+	"github.com/sioncojp/famili-api/domain/model"
+)
+
+// テストスイートの構造体
+type APIKeyRepositoryTestSuite struct {
+	suite.Suite
+	mock             sqlmock.Sqlmock
+	apiKeyRepository apiKeyRepository
+}
+
+// テストのセットアップ
+func (s *APIKeyRepositoryTestSuite) SetupTest() {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		panic(err)
+	}
+
+	apiKeyRepository := apiKeyRepository{}
+	apiKeyRepository.db, _ = gorm.Open(
+		mysql.Dialector{Config: &mysql.Config{DriverName: "mysql", Conn: db, SkipInitializeWithVersion: true}},
+		&gorm.Config{},
+	)
+	s.mock = mock
+	s.apiKeyRepository = apiKeyRepository
+}
+
+// テスト終了時の処理（データベース接続のクローズ）
+func (s *APIKeyRepositoryTestSuite) TearDownTest() {
+	db, _ := s.apiKeyRepository.db.DB()
+	db.Close()
+}
+
+// テストスイートの実行
+func TestAPIKeyRepositoryTestSuite(t *testing.T) {
+	suite.Run(t, new(APIKeyRepositoryTestSuite))
+}
+
+func (s *APIKeyRepositoryTestSuite) TestAPIKeyGetByPrefix() {
+	s.Run("GetByPrefix", func() {
+		prefix := "abcdefgh"
+		rows := sqlmock.NewRows([]string{"id", "name", "prefix", "hash", "scopes", "member_id"}).
+			AddRow(1, faker.Word(), prefix, "hash", "todos:read,todos:write", "1")
+		s.mock.ExpectQuery(regexp.QuoteMeta(
+			"SELECT * FROM `api_keys` WHERE prefix = ? ORDER BY `api_keys`.`id` LIMIT 1")).
+			WithArgs(prefix).
+			WillReturnRows(rows)
+
+		data, err := s.apiKeyRepository.GetByPrefix(prefix)
+		require.NoError(s.T(), err)
+		assert.Equal(s.T(), prefix, data.Prefix, "unexpected prefix")
+		assert.Equal(s.T(), model.Scopes{model.ScopeTodosRead, model.ScopeTodosWrite}, data.Scopes, "unexpected scopes")
+	})
+}
+
+func (s *APIKeyRepositoryTestSuite) TestAPIKeyCreate() {
+	s.Run("Create", func() {
+		data := &model.APIKey{
+			Name:     faker.Word(),
+			Prefix:   "abcdefgh",
+			Hash:     "hash",
+			Scopes:   model.Scopes{model.ScopeTodosRead},
+			MemberId: "1",
+			FamilyId: "1",
+		}
+
+		s.mock.ExpectBegin()
+		s.mock.ExpectExec("INSERT").
+			WithArgs(anyTime, anyTime, data.Name, data.Prefix, data.Hash, "todos:read", data.MemberId, data.FamilyId, nil, nil).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		s.mock.ExpectCommit()
+
+		err := s.apiKeyRepository.Create(data)
+		require.NoError(s.T(), err)
+		assert.Equal(s.T(), uint(1), data.ID, "unexpected ID")
+	})
+}
+
+func (s *APIKeyRepositoryTestSuite) TestAPIKeyTouchLastUsed() {
+	s.Run("TouchLastUsed", func() {
+		now := time.Now()
+		data := &model.APIKey{Model: model.Model{ID: 1}, LastUsedAt: &now}
+
+		s.mock.ExpectBegin()
+		s.mock.ExpectExec(regexp.QuoteMeta("UPDATE `api_keys` SET `last_used_at`=? WHERE id = ?")).
+			WithArgs(anyTime, data.ID).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		s.mock.ExpectCommit()
+
+		err := s.apiKeyRepository.TouchLastUsed(data)
+		require.NoError(s.T(), err)
+	})
+}
@@ -0,0 +1,81 @@
+package database
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/glebarez/sqlite"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+const (
+	dialectMySQL    = "mysql"
+	dialectPostgres = "postgres"
+	dialectSQLite   = "sqlite"
+
+	// sqliteVersion...RETURNINGが使えるversion. utils/sqliteで使うドライバと揃える
+	sqliteVersion = "3.39.2"
+)
+
+// openDialect...sqlmockのコネクションをdialectのgormで開く
+func openDialect(dialect string, db *sql.DB, mock sqlmock.Sqlmock) *gorm.DB {
+	var dialector gorm.Dialector
+	switch dialect {
+	case dialectSQLite:
+		mock.ExpectQuery("select sqlite_version()").
+			WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(sqliteVersion))
+		dialector = &sqlite.Dialector{Conn: db}
+	case dialectPostgres:
+		dialector = postgres.New(postgres.Config{Conn: db})
+	default:
+		dialector = mysql.Dialector{Config: &mysql.Config{DriverName: "mysql", Conn: db, SkipInitializeWithVersion: true}}
+	}
+
+	g, err := gorm.Open(dialector, &gorm.Config{})
+	if err != nil {
+		panic(err)
+	}
+	return g
+}
+
+// dialectSQL...MySQLで書いたSQLをdialectに合わせる. PostgreSQLは"で囲み、placeholderは$1, $2...になる
+func dialectSQL(dialect, query string) string {
+	if dialect != dialectPostgres {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, c := range query {
+		switch c {
+		case '`':
+			b.WriteRune('"')
+		case '?':
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+		default:
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// expectInsert...auto incrementのIDを返すINSERT. SQLiteとPostgreSQLはRETURNINGでIDを受け取る
+func expectInsert(dialect string, mock sqlmock.Sqlmock, id uint, args ...driver.Value) {
+	switch dialect {
+	case dialectSQLite, dialectPostgres:
+		mock.ExpectQuery(regexp.QuoteMeta(dialectSQL(dialect, "RETURNING `id`"))).
+			WithArgs(args...).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(id))
+		return
+	}
+	mock.ExpectExec("INSERT").
+		WithArgs(args...).
+		WillReturnResult(sqlmock.NewResult(int64(id), 1))
+}
@@ -0,0 +1,113 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"net"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+
+	"github.com/sioncojp/famili-api/domain"
+)
+
+// mysqlErrDuplicateEntry...UNIQUE INDEXに違反した
+const mysqlErrDuplicateEntry = 1062
+
+// sqliteの拡張error code. https://www.sqlite.org/rescode.html
+const (
+	sqliteBusy                 = 5
+	sqliteLocked               = 6
+	sqliteConstraintPrimaryKey = 1555
+	sqliteConstraintUnique     = 2067
+)
+
+// errInvalidId...数字でないIDはDBに問い合わせずにnot foundにする
+var errInvalidId = translate(gorm.ErrRecordNotFound)
+
+// domainError...domainのerrorとして見分けられるようにしたDBのerror
+// errors.Isでdomainのerrorに、errors.Is/Asで元のgorm, driverのerrorにもなる
+type domainError struct {
+	kind error
+	err  error
+}
+
+func (e *domainError) Error() string {
+	return e.err.Error()
+}
+
+func (e *domainError) Unwrap() error {
+	return e.err
+}
+
+func (e *domainError) Is(target error) bool {
+	return target == e.kind
+}
+
+// translate...gorm, driverのerrorをdomain.ErrNotFound, ErrConflict, ErrUnavailableに変換する
+// どれにも当てはまらなければそのまま返す
+func translate(err error) error {
+	if err == nil || errors.Is(err, domain.ErrNotFound) || errors.Is(err, domain.ErrConflict) || errors.Is(err, domain.ErrUnavailable) {
+		return err
+	}
+
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return &domainError{domain.ErrNotFound, err}
+	case isDuplicate(err):
+		return &domainError{domain.ErrConflict, err}
+	case isUnavailable(err):
+		return &domainError{domain.ErrUnavailable, err}
+	}
+	return err
+}
+
+// isDuplicate...UNIQUE制約の違反. MySQL, PostgreSQL, SQLiteのerrorを見る
+func isDuplicate(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == mysqlErrDuplicateEntry
+	}
+
+	// pgconn.PgError. 23505はunique_violation
+	var pgErr interface{ SQLState() string }
+	if errors.As(err, &pgErr) {
+		return pgErr.SQLState() == "23505"
+	}
+
+	var sqliteErr interface{ Code() int }
+	if errors.As(err, &sqliteErr) {
+		code := sqliteErr.Code()
+		return code == sqliteConstraintUnique || code == sqliteConstraintPrimaryKey
+	}
+	return false
+}
+
+// isUnavailable...DBに繋がらない、またはretryしても通らなかったtransientなerror
+func isUnavailable(err error) bool {
+	if IsTransient(err) || errors.Is(err, sql.ErrConnDone) || errors.Is(err, driver.ErrBadConn) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	// 08はconnection exception, 57P0xはserverの停止, 40001, 40P01はserializationの失敗とdeadlock
+	var pgErr interface{ SQLState() string }
+	if errors.As(err, &pgErr) {
+		state := pgErr.SQLState()
+		return strings.HasPrefix(state, "08") || strings.HasPrefix(state, "57P0") || state == "40001" || state == "40P01"
+	}
+
+	var sqliteErr interface{ Code() int }
+	if errors.As(err, &sqliteErr) {
+		code := sqliteErr.Code() & 0xff
+		return code == sqliteBusy || code == sqliteLocked
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"net"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+
+	"github.com/sioncojp/famili-api/domain"
+)
+
+// pgError...pgconn.PgErrorと同じくSQLStateを返す
+type pgError string
+
+func (e pgError) Error() string    { return string(e) }
+func (e pgError) SQLState() string { return string(e) }
+
+// sqliteError...glebarez/go-sqliteのErrorと同じくCodeを返す
+type sqliteError int
+
+func (e sqliteError) Error() string { return "sqlite error" }
+func (e sqliteError) Code() int     { return int(e) }
+
+func TestTranslate(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"not found", gorm.ErrRecordNotFound, domain.ErrNotFound},
+		{"mysql duplicate", &mysql.MySQLError{Number: mysqlErrDuplicateEntry}, domain.ErrConflict},
+		{"postgres unique violation", pgError("23505"), domain.ErrConflict},
+		{"sqlite unique", sqliteError(sqliteConstraintUnique), domain.ErrConflict},
+		{"mysql deadlock", errDeadlock, domain.ErrUnavailable},
+		{"bad conn", driver.ErrBadConn, domain.ErrUnavailable},
+		{"connection refused", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, domain.ErrUnavailable},
+		{"deadline", context.DeadlineExceeded, domain.ErrUnavailable},
+		{"postgres connection failure", pgError("08006"), domain.ErrUnavailable},
+		{"sqlite busy", sqliteError(sqliteBusy), domain.ErrUnavailable},
+	}
+
+	for _, v := range cases {
+		err := translate(v.err)
+		assert.ErrorIs(t, err, v.want, v.name)
+		// 元のerrorも辿れる
+		assert.ErrorIs(t, err, v.err, v.name)
+		assert.Equal(t, v.err.Error(), err.Error(), v.name)
+	}
+
+	assert.Nil(t, translate(nil))
+	unknown := &mysql.MySQLError{Number: 1146}
+	assert.Same(t, unknown, translate(unknown))
+	translated := translate(gorm.ErrRecordNotFound)
+	assert.Same(t, translated, translate(translated), "should not wrap twice")
+}
@@ -0,0 +1,16 @@
+package database
+
+import (
+	"strconv"
+
+	"github.com/sioncojp/famili-api/domain"
+)
+
+// parseId...idカラムはBIGINTなので数値に変換する. MySQLは文字列を暗黙に変換するが、PostgreSQLはエラーになる
+func parseId(id domain.Id) (uint, bool) {
+	v, err := strconv.ParseUint(string(id), 10, 0)
+	if err != nil {
+		return 0, false
+	}
+	return uint(v), true
+}
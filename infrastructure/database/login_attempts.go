@@ -0,0 +1,40 @@
+package database
+
+import (
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/sioncojp/famili-api/domain/model"
+	"github.com/sioncojp/famili-api/domain/repository"
+)
+
+// loginAttemptRepository...
+type loginAttemptRepository struct {
+	db *gorm.DB
+}
+
+// NewLoginAttemptRepository...Repository interfaceを返すことでserviceとメソッドを揃える
+func NewLoginAttemptRepository(db *gorm.DB) repository.LoginAttemptRepository {
+	return &loginAttemptRepository{db}
+}
+
+// Get...keyから失敗の記録を取得するためのDB操作
+func (r *loginAttemptRepository) Get(key string) (model.LoginAttempt, error) {
+	result := model.LoginAttempt{}
+	err := r.db.Where("attempt_key = ?", key).First(&result).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return model.LoginAttempt{Key: key}, nil
+	}
+	return result, translate(err)
+}
+
+// Save...失敗の記録をupsertするためのDB操作
+func (r *loginAttemptRepository) Save(attempt *model.LoginAttempt) error {
+	return translate(r.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(attempt).Error)
+}
+
+// Delete...失敗の記録を削除するためのDB操作
+func (r *loginAttemptRepository) Delete(key string) error {
+	return translate(r.db.Where("attempt_key = ?", key).Delete(&model.LoginAttempt{}).Error)
+}
@@ -0,0 +1,93 @@
+package database
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+
+	"github.com/sioncojp/famili-api/domain/model"
+)
+
+// テストスイートの構造体
+type LoginAttemptRepositoryTestSuite struct {
+	suite.Suite
+	mock                   sqlmock.Sqlmock
+	loginAttemptRepository loginAttemptRepository
+}
+
+// テストのセットアップ
+func (s *LoginAttemptRepositoryTestSuite) SetupTest() {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		panic(err)
+	}
+
+	loginAttemptRepository := loginAttemptRepository{}
+	loginAttemptRepository.db, _ = gorm.Open(
+		mysql.Dialector{Config: &mysql.Config{DriverName: "mysql", Conn: db, SkipInitializeWithVersion: true}},
+		&gorm.Config{},
+	)
+	s.mock = mock
+	s.loginAttemptRepository = loginAttemptRepository
+}
+
+// テスト終了時の処理（データベース接続のクローズ）
+func (s *LoginAttemptRepositoryTestSuite) TearDownTest() {
+	db, _ := s.loginAttemptRepository.db.DB()
+	db.Close()
+}
+
+// テストスイートの実行
+func TestLoginAttemptRepositoryTestSuite(t *testing.T) {
+	suite.Run(t, new(LoginAttemptRepositoryTestSuite))
+}
+
+func (s *LoginAttemptRepositoryTestSuite) TestLoginAttemptGet() {
+	s.Run("Get not found", func() {
+		s.mock.ExpectQuery(regexp.QuoteMeta(
+			"SELECT * FROM `login_attempts` WHERE attempt_key = ? ORDER BY `login_attempts`.`attempt_key` LIMIT 1")).
+			WithArgs("account:papa@example.com").
+			WillReturnRows(sqlmock.NewRows([]string{"attempt_key", "failures"}))
+
+		data, err := s.loginAttemptRepository.Get("account:papa@example.com")
+		require.NoError(s.T(), err)
+		assert.Equal(s.T(), "account:papa@example.com", data.Key, "unexpected key")
+		assert.Equal(s.T(), 0, data.Failures, "unexpected failures")
+	})
+}
+
+func (s *LoginAttemptRepositoryTestSuite) TestLoginAttemptSave() {
+	s.Run("Save", func() {
+		now := time.Now()
+		data := &model.LoginAttempt{Key: "ip:192.0.2.1", Failures: 3, LastFailedAt: now, LockedUntil: now}
+
+		s.mock.ExpectBegin()
+		s.mock.ExpectExec(regexp.QuoteMeta("ON DUPLICATE KEY UPDATE")).
+			WithArgs(data.Failures, anyTime, anyTime, data.Key).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		s.mock.ExpectCommit()
+
+		err := s.loginAttemptRepository.Save(data)
+		require.NoError(s.T(), err)
+	})
+}
+
+func (s *LoginAttemptRepositoryTestSuite) TestLoginAttemptDelete() {
+	s.Run("Delete", func() {
+		s.mock.ExpectBegin()
+		s.mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `login_attempts` WHERE attempt_key = ?")).
+			WithArgs("ip:192.0.2.1").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		s.mock.ExpectCommit()
+
+		err := s.loginAttemptRepository.Delete("ip:192.0.2.1")
+		require.NoError(s.T(), err)
+	})
+}
@@ -0,0 +1,47 @@
+package database
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/domain/model"
+	"github.com/sioncojp/famili-api/domain/repository"
+)
+
+// memberRepository...
+type memberRepository struct {
+	db *gorm.DB
+}
+
+// NewMemberRepository...Repository interfaceを返すことでserviceとメソッドを揃える
+func NewMemberRepository(db *gorm.DB) repository.MemberRepository {
+	return &memberRepository{db}
+}
+
+// List...familyのメンバーを全て取得するためのDB操作
+func (r *memberRepository) List(ctx context.Context, familyId domain.Id) ([]model.Member, error) {
+	var result []model.Member
+	if err := r.db.WithContext(ctx).Where("family_id = ?", familyId).Find(&result).Error; err != nil {
+		return result, translate(err)
+	}
+	return result, nil
+}
+
+// ListByIds...IDからメンバーを取得するためのDB操作。存在しないIDは結果に含まれない
+func (r *memberRepository) ListByIds(ctx context.Context, ids []uint) ([]model.Member, error) {
+	var result []model.Member
+	if len(ids) == 0 {
+		return result, nil
+	}
+	if err := r.db.WithContext(ctx).Where("id IN ?", ids).Find(&result).Error; err != nil {
+		return result, translate(err)
+	}
+	return result, nil
+}
+
+// Create...メンバー作成するためのDB操作
+func (r *memberRepository) Create(ctx context.Context, member *model.Member) error {
+	return translate(r.db.WithContext(ctx).Create(&member).Error)
+}
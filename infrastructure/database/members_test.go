@@ -0,0 +1,107 @@
+package database
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/bxcodec/faker/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/domain/model"
+)
+
+// テストスイートの構造体
+type MemberRepositoryTestSuite struct {
+	suite.Suite
+	mock             sqlmock.Sqlmock
+	memberRepository memberRepository
+}
+
+// テストのセットアップ
+func (s *MemberRepositoryTestSuite) SetupTest() {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		panic(err)
+	}
+
+	memberRepository := memberRepository{}
+	memberRepository.db, _ = gorm.Open(
+		mysql.Dialector{Config: &mysql.Config{DriverName: "mysql", Conn: db, SkipInitializeWithVersion: true}},
+		&gorm.Config{},
+	)
+	s.mock = mock
+	s.memberRepository = memberRepository
+}
+
+// テスト終了時の処理（データベース接続のクローズ）
+func (s *MemberRepositoryTestSuite) TearDownTest() {
+	db, _ := s.memberRepository.db.DB()
+	db.Close()
+}
+
+// テストスイートの実行
+func TestMemberRepositoryTestSuite(t *testing.T) {
+	suite.Run(t, new(MemberRepositoryTestSuite))
+}
+
+func (s *MemberRepositoryTestSuite) TestMemberList() {
+	s.Run("List", func() {
+		familyId := domain.Id(faker.Word())
+		rows := sqlmock.NewRows([]string{"id", "name", "family_id"}).
+			AddRow(1, faker.Word(), familyId).
+			AddRow(2, faker.Word(), familyId)
+		s.mock.ExpectQuery(regexp.QuoteMeta(
+			"SELECT * FROM `members` WHERE family_id = ?")).
+			WithArgs(familyId).
+			WillReturnRows(rows)
+
+		data, err := s.memberRepository.List(context.Background(), familyId)
+		require.NoError(s.T(), err)
+		assert.Len(s.T(), data, 2)
+	})
+}
+
+func (s *MemberRepositoryTestSuite) TestMemberListByIds() {
+	s.Run("ListByIds", func() {
+		rows := sqlmock.NewRows([]string{"id", "name", "family_id"}).
+			AddRow(1, faker.Word(), "1")
+		s.mock.ExpectQuery(regexp.QuoteMeta(
+			"SELECT * FROM `members` WHERE id IN (?,?)")).
+			WithArgs(1, 2).
+			WillReturnRows(rows)
+
+		data, err := s.memberRepository.ListByIds(context.Background(), []uint{1, 2})
+		require.NoError(s.T(), err)
+		require.Len(s.T(), data, 1)
+		assert.Equal(s.T(), uint(1), data[0].ID, "unexpected id")
+	})
+
+	s.Run("ListByIds empty", func() {
+		data, err := s.memberRepository.ListByIds(context.Background(), []uint{})
+		require.NoError(s.T(), err)
+		assert.Empty(s.T(), data)
+	})
+}
+
+func (s *MemberRepositoryTestSuite) TestMemberCreate() {
+	s.Run("Create", func() {
+		data := &model.Member{Name: faker.Word(), FamilyId: "1"}
+
+		s.mock.ExpectBegin()
+		s.mock.ExpectExec("INSERT").
+			WithArgs(anyTime, anyTime, data.Name, data.FamilyId).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		s.mock.ExpectCommit()
+
+		err := s.memberRepository.Create(context.Background(), data)
+		require.NoError(s.T(), err)
+		assert.Equal(s.T(), uint(1), data.ID, "unexpected ID")
+	})
+}
@@ -0,0 +1,167 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/domain/model"
+	"github.com/sioncojp/famili-api/domain/repository"
+)
+
+// lastErrorLength...outbox.last_errorのvarcharの長さ
+const lastErrorLength = 255
+
+// outbox.statusの値. 配信済みの行は消すので、pendingかfailedしかない
+const (
+	outboxPending = "pending"
+	outboxFailed  = "failed"
+)
+
+// outboxRow...outboxテーブルの1行. payloadは変更後のtodoのJSON
+type outboxRow struct {
+	ID            uint
+	EventType     string
+	TodoId        uint
+	FamilyId      string
+	Payload       string
+	Status        string
+	Attempts      int
+	LastError     string
+	NextAttemptAt time.Time
+	CreatedAt     time.Time
+}
+
+func (outboxRow) TableName() string {
+	return "outbox"
+}
+
+// outboxRepository...
+type outboxRepository struct {
+	db *gorm.DB
+}
+
+// NewOutboxRepository...Repository interfaceを返すことでserviceとメソッドを揃える
+// TxManagerのRepositories.Outboxはtransactionのdbで作られるので、todoの変更と一緒にcommitされる
+func NewOutboxRepository(db *gorm.DB) repository.OutboxRepository {
+	return &outboxRepository{db}
+}
+
+// Add...eventを書き込むためのDB操作
+func (r *outboxRepository) Add(ctx context.Context, events ...model.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	rows := make([]outboxRow, 0, len(events))
+	for _, v := range events {
+		payload, err := json.Marshal(v.Todo)
+		if err != nil {
+			return err
+		}
+		occurredAt := v.OccurredAt
+		if occurredAt.IsZero() {
+			occurredAt = now
+		}
+		rows = append(rows, outboxRow{
+			EventType:     string(v.Type),
+			TodoId:        v.TodoId,
+			FamilyId:      string(v.FamilyId),
+			Payload:       string(payload),
+			Status:        outboxPending,
+			NextAttemptAt: occurredAt,
+			CreatedAt:     occurredAt,
+		})
+	}
+	return translate(r.db.WithContext(ctx).Create(&rows).Error)
+}
+
+// Pending...未配信でnext_attempt_atを過ぎたeventを古い順にlimit件取得するためのDB操作
+func (r *outboxRepository) Pending(ctx context.Context, now time.Time, limit int) ([]model.Event, error) {
+	var rows []outboxRow
+	if err := pending(r.db.WithContext(ctx), now, limit).Find(&rows).Error; err != nil {
+		return nil, translate(err)
+	}
+	return toEvents(rows)
+}
+
+// Claim...pendingの行をFOR UPDATE SKIP LOCKEDで取り、next_attempt_atをleaseの後にするためのDB操作
+// SQLiteは行をlockできないが、書き込みは1つずつなので同じ行を2回取り出さない
+func (r *outboxRepository) Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]model.Event, error) {
+	var rows []outboxRow
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := pending(tx, now, limit).Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).Find(&rows).Error
+		if err != nil || len(rows) == 0 {
+			return err
+		}
+		ids := make([]uint, 0, len(rows))
+		for _, v := range rows {
+			ids = append(ids, v.ID)
+		}
+		return tx.Model(&outboxRow{}).Where("id IN ?", ids).Update("next_attempt_at", now.Add(lease)).Error
+	})
+	if err != nil {
+		return nil, translate(err)
+	}
+	return toEvents(rows)
+}
+
+// pending...pendingでnext_attempt_atを過ぎた行を古い順にlimit件
+func pending(db *gorm.DB, now time.Time, limit int) *gorm.DB {
+	return db.Where("status = ? AND next_attempt_at <= ?", outboxPending, now).Order("id").Limit(limit)
+}
+
+// toEvents...payloadのtodoを戻してeventにする
+func toEvents(rows []outboxRow) ([]model.Event, error) {
+	result := make([]model.Event, 0, len(rows))
+	for _, v := range rows {
+		var todo model.Todo
+		if err := json.Unmarshal([]byte(v.Payload), &todo); err != nil {
+			return nil, err
+		}
+		result = append(result, model.Event{
+			ID:         v.ID,
+			Type:       model.EventType(v.EventType),
+			TodoId:     v.TodoId,
+			FamilyId:   domain.Id(v.FamilyId),
+			Todo:       todo,
+			OccurredAt: v.CreatedAt,
+			Attempts:   v.Attempts,
+		})
+	}
+	return result, nil
+}
+
+// MarkDelivered...配信済みのeventを削除するためのDB操作
+func (r *outboxRepository) MarkDelivered(ctx context.Context, id uint) error {
+	return translate(r.db.WithContext(ctx).Delete(&outboxRow{}, id).Error)
+}
+
+// MarkFailed...失敗回数を増やしてnext_attempt_atを延ばすためのDB操作
+func (r *outboxRepository) MarkFailed(ctx context.Context, id uint, retryAt time.Time, reason string) error {
+	if len(reason) > lastErrorLength {
+		reason = reason[:lastErrorLength]
+	}
+	return translate(r.db.WithContext(ctx).Model(&outboxRow{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"attempts":        gorm.Expr("attempts + 1"),
+		"next_attempt_at": retryAt,
+		"last_error":      reason,
+	}).Error)
+}
+
+// MarkDead...失敗回数を増やしてfailedにするためのDB操作
+func (r *outboxRepository) MarkDead(ctx context.Context, id uint, reason string) error {
+	if len(reason) > lastErrorLength {
+		reason = reason[:lastErrorLength]
+	}
+	return translate(r.db.WithContext(ctx).Model(&outboxRow{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"attempts":   gorm.Expr("attempts + 1"),
+		"status":     outboxFailed,
+		"last_error": reason,
+	}).Error)
+}
@@ -0,0 +1,195 @@
+package database
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/domain/repository"
+)
+
+// healthCheckTimeout...1つのpoolのpingを待つ時間
+const healthCheckTimeout = 2 * time.Second
+
+// Pool...primaryかreplicaのコネクション
+type Pool struct {
+	Name string
+	DB   *gorm.DB
+	// healthy...health checkで落ちていたら0. 起動直後は使えるものとして扱う
+	healthy int32
+}
+
+// NewPool...nameはlogとhealthの表示に使う
+func NewPool(name string, db *gorm.DB) *Pool {
+	return &Pool{Name: name, DB: db, healthy: 1}
+}
+
+// Healthy...最後のhealth checkが通ったかどうか
+func (p *Pool) Healthy() bool {
+	return atomic.LoadInt32(&p.healthy) == 1
+}
+
+// setHealthy...状態が変わったらtrueを返す
+func (p *Pool) setHealthy(healthy bool) bool {
+	var v int32
+	if healthy {
+		v = 1
+	}
+	return atomic.SwapInt32(&p.healthy, v) != v
+}
+
+// Replicas...読み込みをreplicaに振り分ける
+// 書き込んだcallerはstickyの間primaryから読むので、replicaの遅延で自分の書き込みが見えないことはない
+// stickyはプロセス内で持つので、複数台で動かすときはload balancerでcallerを同じ台に寄せる
+type Replicas struct {
+	primary  *Pool
+	replicas []*Pool
+	next     uint32
+	sticky   time.Duration
+	logger   *zap.Logger
+
+	mu     sync.Mutex
+	writes map[string]time.Time
+	now    func() time.Time
+}
+
+// NewReplicas...replicasが空ならprimaryだけ使う
+func NewReplicas(primary *Pool, replicas []*Pool, sticky time.Duration, logger *zap.Logger) *Replicas {
+	return &Replicas{
+		primary:  primary,
+		replicas: replicas,
+		sticky:   sticky,
+		logger:   logger,
+		writes:   map[string]time.Time{},
+		now:      time.Now,
+	}
+}
+
+// Pools...primary, replicaの順に全てのpoolを返す
+func (r *Replicas) Pools() []*Pool {
+	return append([]*Pool{r.primary}, r.replicas...)
+}
+
+// reader...callerの読み込みに使うpool
+// stickyならprimary. それ以外は生きているreplicaを順番に使い、全て落ちていればprimaryを使う
+func (r *Replicas) reader(caller domain.Caller) *Pool {
+	if len(r.replicas) == 0 || r.isSticky(caller) {
+		return r.primary
+	}
+
+	n := atomic.AddUint32(&r.next, 1)
+	for i := range r.replicas {
+		p := r.replicas[(int(n)+i)%len(r.replicas)]
+		if p.Healthy() {
+			return p
+		}
+	}
+	return r.primary
+}
+
+// wrote...callerが書き込んだことを記録する
+func (r *Replicas) wrote(caller domain.Caller) {
+	if len(r.replicas) == 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	r.writes[stickyKey(caller)] = now.Add(r.sticky)
+
+	// 期限切れを掃除して、callerが増え続けてもmapが大きくならないようにする
+	for k, v := range r.writes {
+		if !now.Before(v) {
+			delete(r.writes, k)
+		}
+	}
+}
+
+// isSticky...callerが最近書き込んでいればtrue
+func (r *Replicas) isSticky(caller domain.Caller) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	until, ok := r.writes[stickyKey(caller)]
+	return ok && r.now().Before(until)
+}
+
+// markUnhealthy...queryが失敗したreplicaを次のhealth checkまで使わないようにする
+func (r *Replicas) markUnhealthy(p *Pool, err error) {
+	if p != r.primary && p.setHealthy(false) {
+		r.logger.Warn("replica is unhealthy", zap.String("pool", p.Name), zap.Error(err))
+	}
+}
+
+// CheckHealth...全てのpoolにpingして状態を更新する
+func (r *Replicas) CheckHealth(ctx context.Context) {
+	for _, p := range r.Pools() {
+		err := ping(ctx, p.DB)
+		if !p.setHealthy(err == nil) {
+			continue
+		}
+		if err != nil {
+			r.logger.Warn("pool is unhealthy", zap.String("pool", p.Name), zap.Error(err))
+		} else {
+			r.logger.Info("pool is healthy", zap.String("pool", p.Name))
+		}
+	}
+}
+
+// RunHealthCheck...ctxがcancelされるまでintervalごとにCheckHealthする
+func (r *Replicas) RunHealthCheck(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.CheckHealth(ctx)
+		}
+	}
+}
+
+// PoolStats...primary, replicaの順にpoolの状態を返す
+func (r *Replicas) PoolStats() []repository.PoolStats {
+	pools := r.Pools()
+	result := make([]repository.PoolStats, 0, len(pools))
+	for _, p := range pools {
+		v := repository.PoolStats{Name: p.Name, Healthy: p.Healthy()}
+		if sqlDB, err := p.DB.DB(); err == nil {
+			stats := sqlDB.Stats()
+			v.MaxOpenConnections = stats.MaxOpenConnections
+			v.OpenConnections = stats.OpenConnections
+			v.InUse = stats.InUse
+			v.Idle = stats.Idle
+			v.WaitCount = stats.WaitCount
+			v.WaitDurationMillis = stats.WaitDuration.Milliseconds()
+			v.MaxIdleClosed = stats.MaxIdleClosed
+			v.MaxLifetimeClosed = stats.MaxLifetimeClosed
+		}
+		result = append(result, v)
+	}
+	return result
+}
+
+// ping...1つのpoolにpingする
+func ping(ctx context.Context, db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+	return sqlDB.PingContext(ctx)
+}
+
+// stickyKey...見れるtodoと同じくMemberIdとFamilyIdでcallerを区別する
+func stickyKey(c domain.Caller) string {
+	return string(c.MemberId) + "\x00" + string(c.FamilyId)
+}
@@ -0,0 +1,225 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/domain/model"
+	"github.com/sioncojp/famili-api/domain/repository"
+	"github.com/sioncojp/famili-api/infrastructure/cache"
+)
+
+var (
+	replicaPapa = domain.Caller{MemberId: "1", FamilyId: "f1"}
+	replicaMama = domain.Caller{MemberId: "2", FamilyId: "f1"}
+	errReplica  = errors.New("connection refused")
+)
+
+// newPoolMock...pingも確認できるsqlmockでpoolを作る
+func newPoolMock(t *testing.T, name string) (*Pool, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	// gorm.Openで1度pingする
+	mock.ExpectPing()
+	return NewPool(name, openDialect(dialectMySQL, db, mock)), mock
+}
+
+// newReplicasMock...primaryとreplica1つ. nowを進めてstickyを切らせる
+func newReplicasMock(t *testing.T) (*Replicas, sqlmock.Sqlmock, sqlmock.Sqlmock, *time.Time) {
+	primary, primaryMock := newPoolMock(t, "primary")
+	replica, replicaMock := newPoolMock(t, "replica0")
+	r := NewReplicas(primary, []*Pool{replica}, 5*time.Second, zap.NewNop())
+	now := time.Date(2022, 8, 1, 0, 0, 0, 0, time.UTC)
+	r.now = func() time.Time { return now }
+	return r, primaryMock, replicaMock, &now
+}
+
+func expectList(mock sqlmock.Sqlmock, caller domain.Caller) {
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `todos` WHERE created_by = ? OR (family_id = ? AND visibility <> ?)")).
+		WithArgs(caller.MemberId, caller.FamilyId, model.VisibilityPrivate).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+}
+
+func expectDelete(mock sqlmock.Sqlmock) {
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+}
+
+func TestReplicasStickyAfterWrite(t *testing.T) {
+	t.Parallel()
+	replicas, primaryMock, replicaMock, now := newReplicasMock(t)
+	r := NewReplicatedTodoRepository(replicas)
+
+	expectList(replicaMock, replicaPapa)
+	_, err := r.List(context.Background(), replicaPapa)
+	require.NoError(t, err)
+
+	// 書き込んだcallerはstickyの間primaryから読む. 他のcallerはreplicaのまま
+	expectDelete(primaryMock)
+	expectList(primaryMock, replicaPapa)
+	expectList(replicaMock, replicaMama)
+	ctx := domain.NewCallerContext(context.Background(), replicaPapa)
+	require.NoError(t, r.Delete(ctx, &model.Todo{Model: model.Model{ID: 1}}))
+	_, err = r.List(ctx, replicaPapa)
+	require.NoError(t, err)
+	_, err = r.List(context.Background(), replicaMama)
+	require.NoError(t, err)
+
+	*now = now.Add(5 * time.Second)
+	expectList(replicaMock, replicaPapa)
+	_, err = r.List(ctx, replicaPapa)
+	require.NoError(t, err)
+
+	assert.NoError(t, primaryMock.ExpectationsWereMet())
+	assert.NoError(t, replicaMock.ExpectationsWereMet())
+}
+
+func TestReplicasFallbackToPrimary(t *testing.T) {
+	t.Parallel()
+	replicas, primaryMock, replicaMock, _ := newReplicasMock(t)
+	r := NewReplicatedTodoRepository(replicas)
+	ctx := domain.NewCallerContext(context.Background(), replicaPapa)
+
+	// not foundはreplicaの遅延かもしれないのでprimaryで確かめる. replicaは生きている扱いのまま
+	replicaMock.ExpectQuery("SELECT").WillReturnError(gorm.ErrRecordNotFound)
+	primaryMock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"id", "title"}).AddRow(1, "t"))
+	primaryMock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"todo_id", "member_id"}))
+	todo, err := r.GetById(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, "t", todo.Title)
+	assert.True(t, replicas.replicas[0].Healthy())
+
+	// それ以外のerrorならreplicaを外し、次からはprimaryだけを使う
+	replicaMock.ExpectQuery("SELECT").WillReturnError(errReplica)
+	expectList(primaryMock, replicaPapa)
+	expectList(primaryMock, replicaPapa)
+	for i := 0; i < 2; i++ {
+		_, err = r.List(ctx, replicaPapa)
+		require.NoError(t, err)
+	}
+	assert.False(t, replicas.replicas[0].Healthy())
+
+	assert.NoError(t, primaryMock.ExpectationsWereMet())
+	assert.NoError(t, replicaMock.ExpectationsWereMet())
+}
+
+func TestReplicasPrimaryContext(t *testing.T) {
+	t.Parallel()
+	replicas, primaryMock, replicaMock, _ := newReplicasMock(t)
+	r := NewReplicatedTodoRepository(replicas)
+
+	// 書き込む前の読み込みはreplicaが遅れていても古い行を使わないようにprimaryから読む
+	primaryMock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"id", "title"}).AddRow(1, "t"))
+	primaryMock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"todo_id", "member_id"}))
+	ctx := domain.NewPrimaryContext(domain.NewCallerContext(context.Background(), replicaPapa))
+	todo, err := r.GetById(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, "t", todo.Title)
+
+	assert.NoError(t, primaryMock.ExpectationsWereMet())
+	assert.NoError(t, replicaMock.ExpectationsWereMet())
+}
+
+// TestReplicasWithCache...cacheはprimaryから読んだ値だけを入れるので、
+// replicaが遅れていても書き込んだcallerがstickyの間にcacheから古い値を読むことはない
+func TestReplicasWithCache(t *testing.T) {
+	t.Parallel()
+	replicas, primaryMock, replicaMock, _ := newReplicasMock(t)
+	r := cache.NewTodoRepository(NewReplicatedTodoRepository(replicas), cache.NewLRUStore(10, time.Minute), zap.NewNop())
+	papa := domain.NewCallerContext(context.Background(), replicaPapa)
+	mama := domain.NewCallerContext(context.Background(), replicaMama)
+
+	// papaが書き込んでcacheを無効にした直後に、mamaのmissがcacheを埋める. replicaはまだ"old"を返す
+	primaryMock.ExpectBegin()
+	primaryMock.ExpectExec("UPDATE").WillReturnResult(sqlmock.NewResult(0, 1))
+	primaryMock.ExpectCommit()
+	require.NoError(t, r.Update(papa, &model.Todo{Model: model.Model{ID: 1}, Title: "new"}))
+
+	primaryMock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"id", "title"}).AddRow(1, "new"))
+	primaryMock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"todo_id", "member_id"}))
+	todo, err := r.GetById(mama, "1")
+	require.NoError(t, err)
+	assert.Equal(t, "new", todo.Title)
+	// replicaにqueryしていればsqlmockがerrorを返し、落ちている扱いになっている
+	assert.True(t, replicas.replicas[0].Healthy(), "the cache must be filled from the primary")
+
+	// papaはcacheから書き込んだ値を読む
+	todo, err = r.GetById(papa, "1")
+	require.NoError(t, err)
+	assert.Equal(t, "new", todo.Title)
+
+	assert.NoError(t, primaryMock.ExpectationsWereMet())
+	assert.NoError(t, replicaMock.ExpectationsWereMet())
+}
+
+func TestReplicasCheckHealth(t *testing.T) {
+	t.Parallel()
+	replicas, primaryMock, replicaMock, _ := newReplicasMock(t)
+
+	primaryMock.ExpectPing()
+	replicaMock.ExpectPing().WillReturnError(errReplica)
+	replicas.CheckHealth(context.Background())
+	assert.True(t, replicas.primary.Healthy())
+	assert.False(t, replicas.replicas[0].Healthy())
+	assert.Equal(t, replicas.primary, replicas.reader(replicaPapa), "should fall back to primary")
+
+	primaryMock.ExpectPing()
+	replicaMock.ExpectPing()
+	replicas.CheckHealth(context.Background())
+	assert.True(t, replicas.replicas[0].Healthy())
+	assert.Equal(t, replicas.replicas[0], replicas.reader(replicaPapa))
+
+	assert.NoError(t, primaryMock.ExpectationsWereMet())
+	assert.NoError(t, replicaMock.ExpectationsWereMet())
+}
+
+func TestReplicatedTxManagerSticky(t *testing.T) {
+	t.Parallel()
+	replicas, primaryMock, replicaMock, _ := newReplicasMock(t)
+	tx := NewReplicatedTxManager(replicas)
+	ctx := domain.NewCallerContext(context.Background(), replicaPapa)
+
+	primaryMock.ExpectBegin()
+	primaryMock.ExpectRollback()
+	err := tx.Do(ctx, func(ctx context.Context, repos repository.Repositories) error { return errRollback })
+	assert.ErrorIs(t, err, errRollback)
+	assert.Equal(t, replicas.replicas[0], replicas.reader(replicaPapa), "rollback should not be sticky")
+
+	primaryMock.ExpectBegin()
+	primaryMock.ExpectCommit()
+	require.NoError(t, tx.Do(ctx, func(ctx context.Context, repos repository.Repositories) error { return nil }))
+	assert.Equal(t, replicas.primary, replicas.reader(replicaPapa), "commit should be sticky")
+
+	assert.NoError(t, primaryMock.ExpectationsWereMet())
+	assert.NoError(t, replicaMock.ExpectationsWereMet())
+}
+
+func TestReplicasPoolStats(t *testing.T) {
+	t.Parallel()
+	replicas, _, _, _ := newReplicasMock(t)
+	sqlDB, err := replicas.primary.DB.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(25)
+	replicas.replicas[0].setHealthy(false)
+
+	stats := replicas.PoolStats()
+	require.Len(t, stats, 2)
+	assert.Equal(t, "primary", stats[0].Name)
+	assert.True(t, stats[0].Healthy)
+	assert.Equal(t, 25, stats[0].MaxOpenConnections)
+	assert.Equal(t, "replica0", stats[1].Name)
+	assert.False(t, stats[1].Healthy)
+}
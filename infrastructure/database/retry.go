@@ -0,0 +1,66 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
+)
+
+const (
+	// retryAttempts...transientなerrorのときに試す回数. 最初の1回を含む
+	retryAttempts = 3
+
+	// retryBaseDelay...retryの前に待つ時間. 倍々で増やす
+	retryBaseDelay = 50 * time.Millisecond
+)
+
+// MySQLのerror番号. https://dev.mysql.com/doc/mysql-errors/8.0/en/server-error-reference.html
+const (
+	mysqlErrLockWaitTimeout = 1205
+	mysqlErrDeadlock        = 1213
+	mysqlErrServerGone      = 2006
+	mysqlErrLostConnection  = 2013
+)
+
+// IsTransient...やり直せば通るかもしれないerrorならtrue. deadlock, lock wait timeout, 接続切れ
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		switch mysqlErr.Number {
+		case mysqlErrLockWaitTimeout, mysqlErrDeadlock, mysqlErrServerGone, mysqlErrLostConnection:
+			return true
+		}
+		return false
+	}
+
+	// 接続が切れたときはdriverがErrBadConnかErrInvalidConnを返す
+	return errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn)
+}
+
+// retry...fnがtransientなerrorを返したらbackoffしてやり直す
+// 何度実行しても結果が変わらないcallだけに使う. transactionの中ではtransaction全体がrollbackされているので使わない
+func retry(ctx context.Context, fn func() error) error {
+	delay := retryBaseDelay
+	for i := 1; ; i++ {
+		err := fn()
+		if i >= retryAttempts || !IsTransient(err) {
+			return err
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		delay *= 2
+	}
+}
@@ -0,0 +1,103 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	pkgerrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/sioncojp/famili-api/domain/model"
+)
+
+var errDeadlock = &mysql.MySQLError{Number: mysqlErrDeadlock, Message: "Deadlock found when trying to get lock"}
+
+func TestIsTransient(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"deadlock", errDeadlock, true},
+		{"lock wait timeout", &mysql.MySQLError{Number: mysqlErrLockWaitTimeout}, true},
+		{"wrapped", pkgerrors.Wrap(errDeadlock, "delete todo"), true},
+		{"bad conn", driver.ErrBadConn, true},
+		{"invalid conn", mysql.ErrInvalidConn, true},
+		{"duplicate entry", &mysql.MySQLError{Number: 1062}, false},
+		{"not found", gorm.ErrRecordNotFound, false},
+	}
+
+	for _, v := range cases {
+		assert.Equal(t, v.want, IsTransient(v.err), v.name)
+	}
+}
+
+func TestRetryCanceled(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	calls := 0
+	err := retry(ctx, func() error {
+		calls++
+		return errDeadlock
+	})
+	assert.ErrorIs(t, err, errDeadlock)
+	assert.Equal(t, 1, calls, "should not retry after ctx is canceled")
+}
+
+// newRetryRepository...replicaなしのNewReplicatedTodoRepository
+func newRetryRepository(t *testing.T) (*todoRepository, sqlmock.Sqlmock) {
+	primary, mock := newPoolMock(t, "primary")
+	r := NewReplicatedTodoRepository(NewReplicas(primary, nil, time.Second, zap.NewNop()))
+	return r.(*todoRepository), mock
+}
+
+func TestTodoRepositoryRetry(t *testing.T) {
+	t.Parallel()
+	r, mock := newRetryRepository(t)
+	todo := &model.Todo{Model: model.Model{ID: 1}}
+
+	// deadlockならtransactionごとやり直す
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE").WillReturnError(errDeadlock)
+	mock.ExpectRollback()
+	expectDelete(mock)
+	require.NoError(t, r.Delete(context.Background(), todo))
+
+	// retryAttempts回失敗したら諦める
+	for i := 0; i < retryAttempts; i++ {
+		mock.ExpectQuery("SELECT").WillReturnError(mysql.ErrInvalidConn)
+	}
+	_, err := r.List(context.Background(), replicaPapa)
+	assert.ErrorIs(t, err, mysql.ErrInvalidConn)
+
+	// Createは2重に作ってしまうのでやり直さない
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT").WillReturnError(errDeadlock)
+	mock.ExpectRollback()
+	assert.ErrorIs(t, r.Create(context.Background(), &model.Todo{}), errDeadlock)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTodoRepositoryNoRetryInTransaction(t *testing.T) {
+	t.Parallel()
+	primary, mock := newPoolMock(t, "primary")
+	r := NewTodoRepository(primary.DB)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE").WillReturnError(errDeadlock)
+	mock.ExpectRollback()
+	assert.ErrorIs(t, r.Delete(context.Background(), &model.Todo{Model: model.Model{ID: 1}}), errDeadlock)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
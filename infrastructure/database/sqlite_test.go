@@ -0,0 +1,402 @@
+package database
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/domain/model"
+	"github.com/sioncojp/famili-api/domain/repository"
+	"github.com/sioncojp/famili-api/utils/config"
+	"github.com/sioncojp/famili-api/utils/log"
+	"github.com/sioncojp/famili-api/utils/sqlite"
+)
+
+var initLogOnce sync.Once
+
+// applyMigrations...migrations/sqlite/ のファイルを順番に実行する
+func applyMigrations(t *testing.T, db *gorm.DB, direction string) {
+	files, err := filepath.Glob(filepath.Join("..", "..", "migrations", "sqlite", "*."+direction+".sqlite"))
+	require.NoError(t, err)
+	require.NotEmpty(t, files)
+
+	sort.Strings(files)
+	if direction == "down" {
+		sort.Sort(sort.Reverse(sort.StringSlice(files)))
+	}
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		require.NoError(t, err)
+		require.NoError(t, db.Exec(string(b)).Error, f)
+	}
+}
+
+// newSQLite...一時ディレクトリにSQLiteのDBを作ってmigrationを流す
+func newSQLite(t *testing.T) *gorm.DB {
+	initLogOnce.Do(func() {
+		log.Log = zap.NewNop().Sugar()
+	})
+
+	db, err := sqlite.NewSQLiteHandler(&config.SQLiteConfig{Path: filepath.Join(t.TempDir(), "famili-api.db")})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		sqlDB, _ := db.DB()
+		sqlDB.Close()
+	})
+
+	applyMigrations(t, db, "up")
+	return db
+}
+
+func TestSQLiteTodoRepository(t *testing.T) {
+	t.Parallel()
+	db := newSQLite(t)
+	ctx := context.Background()
+	members := NewMemberRepository(db)
+	todos := NewTodoRepository(db)
+
+	papa := &model.Member{Name: "papa", FamilyId: "f1"}
+	mama := &model.Member{Name: "mama", FamilyId: "f1"}
+	require.NoError(t, members.Create(ctx, papa))
+	require.NoError(t, members.Create(ctx, mama))
+	caller := domain.Caller{MemberId: "1", FamilyId: "f1"}
+
+	private := &model.Todo{Title: "private", Description: "d", CreatedBy: "2", FamilyId: "f1", Visibility: model.VisibilityPrivate}
+	public := &model.Todo{Title: "public", Description: "d", CreatedBy: "1", FamilyId: "f1", Visibility: model.VisibilityPublic, ShareToken: "token"}
+	require.NoError(t, todos.Create(ctx, private))
+	require.NoError(t, todos.Create(ctx, public))
+	assert.Equal(t, uint(1), private.ID, "unexpected ID")
+	assert.Equal(t, uint(2), public.ID, "unexpected ID")
+
+	public.AssigneeIds = []uint{papa.ID, mama.ID}
+	require.NoError(t, todos.SetAssignees(ctx, public))
+
+	data, err := todos.List(ctx, caller)
+	require.NoError(t, err)
+	require.Len(t, data, 1, "private todo of another member should be hidden")
+	assert.Equal(t, []uint{papa.ID, mama.ID}, data[0].AssigneeIds)
+	assert.WithinDuration(t, time.Now(), data[0].CreatedAt, time.Minute)
+
+	data, err = todos.ListByAssignee(ctx, caller, "2")
+	require.NoError(t, err)
+	require.Len(t, data, 1)
+
+	// created_by, family_idがmigrationのdefaultのままのtodoも、匿名のcallerには見せない
+	orphan := &model.Todo{Title: "orphan", Description: "d", Visibility: model.VisibilityPrivate}
+	require.NoError(t, todos.Create(ctx, orphan))
+	data, err = todos.List(ctx, domain.Caller{})
+	require.NoError(t, err)
+	assert.Empty(t, data)
+	require.NoError(t, todos.Delete(ctx, orphan))
+
+	shared, err := todos.GetByShareToken(ctx, "token")
+	require.NoError(t, err)
+	assert.Equal(t, public.ID, shared.ID)
+
+	public.Title = "updated"
+	require.NoError(t, todos.Update(ctx, public))
+	got, err := todos.GetById(ctx, "2")
+	require.NoError(t, err)
+	assert.Equal(t, "updated", got.Title)
+
+	// 一覧はposition, ID順
+	family := &model.Todo{Title: "family", Description: "d", CreatedBy: "1", FamilyId: "f1", Visibility: model.VisibilityFamily}
+	require.NoError(t, todos.Create(ctx, family))
+	public.Position = 1
+	require.NoError(t, todos.Update(ctx, public))
+	data, err = todos.List(ctx, caller)
+	require.NoError(t, err)
+	require.Len(t, data, 2)
+	assert.Equal(t, []string{"family", "updated"}, []string{data[0].Title, data[1].Title})
+
+	// foreign_keysが有効なのでtodo_assigneesもON DELETE CASCADEで消える
+	require.NoError(t, todos.Delete(ctx, public))
+	_, err = todos.GetById(ctx, "2")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+	var count int64
+	require.NoError(t, db.Table("todo_assignees").Count(&count).Error)
+	assert.Equal(t, int64(0), count)
+}
+
+func TestSQLiteLoginAttemptAndAccountRepository(t *testing.T) {
+	t.Parallel()
+	db := newSQLite(t)
+
+	attempts := NewLoginAttemptRepository(db)
+	now := time.Now()
+	for i := 1; i <= 2; i++ {
+		require.NoError(t, attempts.Save(&model.LoginAttempt{Key: "ip:192.0.2.1", Failures: i, LastFailedAt: now, LockedUntil: now}))
+	}
+	attempt, err := attempts.Get("ip:192.0.2.1")
+	require.NoError(t, err)
+	assert.Equal(t, 2, attempt.Failures, "Save should upsert")
+
+	accounts := NewAccountRepository(db)
+	account := &model.Account{Email: "papa@example.com", PasswordHash: "hash"}
+	require.NoError(t, accounts.Create(account))
+	assert.ErrorIs(t, accounts.Create(&model.Account{Email: "papa@example.com", PasswordHash: "hash"}), domain.ErrConflict, "email should be unique")
+
+	require.NoError(t, accounts.ReplaceRecoveryCodes(account, []string{"a"}))
+	ok, err := accounts.UseRecoveryCode(account, "a")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = accounts.UseRecoveryCode(account, "a")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	ok, err = accounts.UseTOTPStep(account, 100)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = accounts.UseTOTPStep(account, 100)
+	require.NoError(t, err)
+	assert.False(t, ok, "a step should be used once")
+}
+
+func TestSQLiteTxManager(t *testing.T) {
+	t.Parallel()
+	db := newSQLite(t)
+	ctx := context.Background()
+	tx := NewTxManager(db)
+	newTodo := func() *model.Todo {
+		return &model.Todo{Title: "t", Description: "d", CreatedBy: "1", FamilyId: "f1", Visibility: model.VisibilityFamily}
+	}
+
+	err := tx.Do(ctx, func(ctx context.Context, repos repository.Repositories) error {
+		if err := repos.Todos.Create(ctx, newTodo()); err != nil {
+			return err
+		}
+
+		// savepointまで戻るので2件目だけ消える
+		err := tx.Do(ctx, func(ctx context.Context, repos repository.Repositories) error {
+			if err := repos.Todos.Create(ctx, newTodo()); err != nil {
+				return err
+			}
+			return errRollback
+		})
+		assert.ErrorIs(t, err, errRollback)
+		return nil
+	})
+	require.NoError(t, err)
+
+	err = tx.Do(ctx, func(ctx context.Context, repos repository.Repositories) error {
+		if err := repos.Members.Create(ctx, &model.Member{Name: "papa", FamilyId: "f1"}); err != nil {
+			return err
+		}
+		if err := repos.Todos.Create(ctx, newTodo()); err != nil {
+			return err
+		}
+		return errRollback
+	})
+	assert.ErrorIs(t, err, errRollback)
+
+	todos, err := NewTodoRepository(db).List(ctx, domain.Caller{MemberId: "1", FamilyId: "f1"})
+	require.NoError(t, err)
+	assert.Len(t, todos, 1)
+	members, err := NewMemberRepository(db).List(context.Background(), "f1")
+	require.NoError(t, err)
+	assert.Empty(t, members, "member should be rolled back with the todo")
+}
+
+func TestSQLiteOutbox(t *testing.T) {
+	t.Parallel()
+	db := newSQLite(t)
+	ctx := context.Background()
+	tx := NewTxManager(db)
+	outbox := NewOutboxRepository(db)
+	todo := &model.Todo{Title: "t", Description: "d", CreatedBy: "1", FamilyId: "f1", Visibility: model.VisibilityFamily}
+
+	// todoとeventは一緒にcommit/rollbackされる
+	err := tx.Do(ctx, func(ctx context.Context, repos repository.Repositories) error {
+		if err := repos.Todos.Create(ctx, todo); err != nil {
+			return err
+		}
+		if err := repos.Outbox.Add(ctx, todo.Events(model.EventTodoCreated)...); err != nil {
+			return err
+		}
+		return errRollback
+	})
+	assert.ErrorIs(t, err, errRollback)
+	events, err := outbox.Pending(ctx, time.Now(), 10)
+	require.NoError(t, err)
+	assert.Empty(t, events)
+
+	err = tx.Do(ctx, func(ctx context.Context, repos repository.Repositories) error {
+		if err := repos.Todos.Create(ctx, todo); err != nil {
+			return err
+		}
+		return repos.Outbox.Add(ctx, todo.Events(model.EventTodoCreated)...)
+	})
+	require.NoError(t, err)
+	events, err = outbox.Pending(ctx, time.Now(), 10)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, model.EventTodoCreated, events[0].Type)
+	assert.Equal(t, todo.ID, events[0].TodoId)
+	assert.Equal(t, domain.Id("f1"), events[0].FamilyId)
+	assert.Equal(t, "t", events[0].Todo.Title)
+
+	// 失敗したeventはretryAtまで取れない
+	require.NoError(t, outbox.MarkFailed(ctx, events[0].ID, time.Now().Add(time.Hour), "boom"))
+	pending, err := outbox.Pending(ctx, time.Now(), 10)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+	pending, err = outbox.Pending(ctx, time.Now().Add(2*time.Hour), 10)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, 1, pending[0].Attempts)
+
+	require.NoError(t, outbox.MarkDelivered(ctx, events[0].ID))
+	pending, err = outbox.Pending(ctx, time.Now().Add(2*time.Hour), 10)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+
+	// Claimしたeventはleaseの間、他のrelayに渡さない
+	require.NoError(t, outbox.Add(ctx, todo.Events(model.EventTodoUpdated)...))
+	now := time.Now()
+	claimed, err := outbox.Claim(ctx, now, time.Minute, 10)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	again, err := outbox.Claim(ctx, now, time.Minute, 10)
+	require.NoError(t, err)
+	assert.Empty(t, again)
+	again, err = outbox.Claim(ctx, now.Add(2*time.Minute), time.Minute, 10)
+	require.NoError(t, err)
+	require.Len(t, again, 1)
+
+	// failedにしたeventはもう取り出さない
+	require.NoError(t, outbox.MarkDead(ctx, claimed[0].ID, "boom"))
+	pending, err = outbox.Pending(ctx, now.Add(time.Hour), 10)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+	again, err = outbox.Claim(ctx, now.Add(time.Hour), time.Minute, 10)
+	require.NoError(t, err)
+	assert.Empty(t, again)
+}
+
+func TestSQLiteSync(t *testing.T) {
+	t.Parallel()
+	db := newSQLite(t)
+	ctx := context.Background()
+	changes := NewTodoChangeRepository(db)
+	mutations := NewSyncMutationRepository(db)
+	papa := domain.Caller{MemberId: "1", FamilyId: "f1"}
+
+	latest, err := changes.Latest(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint(0), latest)
+
+	a := model.NewTodoChange(model.Todo{Model: model.Model{ID: 1}, Title: "a", CreatedBy: "1", FamilyId: "f1"}, false)
+	b := model.NewTodoChange(model.Todo{Model: model.Model{ID: 2}, Title: "b", CreatedBy: "3", FamilyId: "f2"}, false)
+	require.NoError(t, changes.Record(ctx, &a))
+	require.NoError(t, changes.Record(ctx, &b))
+	assert.Greater(t, b.Seq, a.Seq)
+
+	// 同じtodoの変更は前の行を消して、新しいseqで書き直す
+	deleted := model.NewTodoChange(model.Todo{Model: model.Model{ID: 1}, Title: "a2", CreatedBy: "1", FamilyId: "f1"}, true)
+	require.NoError(t, changes.Record(ctx, &deleted))
+	assert.Greater(t, deleted.Seq, b.Seq)
+
+	found, err := changes.Since(ctx, papa, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	assert.Equal(t, deleted.Seq, found[0].Seq)
+	assert.True(t, found[0].Deleted)
+	assert.Equal(t, "a2", found[0].Todo.Title)
+	found, err = changes.Since(ctx, papa, deleted.Seq, 10)
+	require.NoError(t, err)
+	assert.Empty(t, found)
+	latest, err = changes.Latest(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, deleted.Seq, latest)
+
+	m := &model.SyncMutation{MemberId: "1", ClientId: "c1", TodoId: 1, Status: model.SyncApplied}
+	require.NoError(t, mutations.Save(ctx, m))
+	got, err := mutations.Get(ctx, "1", "c1")
+	require.NoError(t, err)
+	assert.Equal(t, model.SyncApplied, got.Status)
+	assert.Equal(t, uint(1), got.TodoId)
+	assert.ErrorIs(t, mutations.Save(ctx, &model.SyncMutation{MemberId: "1", ClientId: "c1", Status: model.SyncRejected}), domain.ErrConflict)
+	_, err = mutations.Get(ctx, "2", "c1")
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+}
+
+func TestSQLiteWebhooks(t *testing.T) {
+	t.Parallel()
+	db := newSQLite(t)
+	ctx := context.Background()
+	repo := NewWebhookRepository(db)
+	webhook := &model.Webhook{
+		FamilyId:   "f1",
+		CreatedBy:  "1",
+		URL:        "https://example.com/hook",
+		EventTypes: model.EventTypes{model.EventTodoCreated, model.EventTodoCompleted},
+		Secret:     "encrypted",
+	}
+	require.NoError(t, repo.Create(ctx, webhook))
+
+	got, err := repo.GetById(ctx, domain.Id("1"))
+	require.NoError(t, err)
+	assert.Equal(t, webhook.EventTypes, got.EventTypes)
+	list, err := repo.List(ctx, "f2")
+	require.NoError(t, err)
+	assert.Empty(t, list)
+
+	// 同じeventの配信は1つだけ. testの配信はevent_idがNULLなのでいくつでも入る
+	eventId := uint(10)
+	delivery := model.WebhookDelivery{WebhookId: webhook.ID, EventId: &eventId, EventType: model.EventTodoCreated, Payload: "{}", Status: model.DeliveryPending, NextAttemptAt: time.Now()}
+	test := model.WebhookDelivery{WebhookId: webhook.ID, EventType: model.EventWebhookTest, Payload: "{}", Status: model.DeliveryPending, NextAttemptAt: time.Now()}
+	require.NoError(t, repo.Enqueue(ctx, delivery, test))
+	require.NoError(t, repo.Enqueue(ctx, delivery, test))
+	pending, err := repo.PendingDeliveries(ctx, time.Now().Add(time.Second), 10)
+	require.NoError(t, err)
+	require.Len(t, pending, 3)
+
+	pending[0].Status = model.DeliveryDelivered
+	require.NoError(t, repo.SaveDelivery(ctx, &pending[0]))
+	deliveries, err := repo.ListDeliveries(ctx, webhook.ID, 2)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 2)
+	assert.Equal(t, pending[2].ID, deliveries[0].ID)
+
+	// disableAfter回続けて失敗したら無効になる. 成功すれば数え直す
+	disabled, err := repo.RecordFailure(ctx, webhook.ID, 2, time.Now())
+	require.NoError(t, err)
+	assert.False(t, disabled)
+	require.NoError(t, repo.RecordSuccess(ctx, webhook.ID))
+	for _, want := range []bool{false, true, false} {
+		disabled, err = repo.RecordFailure(ctx, webhook.ID, 2, time.Now())
+		require.NoError(t, err)
+		assert.Equal(t, want, disabled)
+	}
+	got, err = repo.GetById(ctx, domain.Id("1"))
+	require.NoError(t, err)
+	assert.True(t, got.Disabled())
+	assert.Equal(t, 3, got.Failures)
+
+	// 削除すると配信の記録も消える
+	require.NoError(t, repo.Delete(ctx, &got))
+	deliveries, err = repo.ListDeliveries(ctx, webhook.ID, 10)
+	require.NoError(t, err)
+	assert.Empty(t, deliveries)
+}
+
+func TestSQLiteMigrationsDown(t *testing.T) {
+	t.Parallel()
+	db := newSQLite(t)
+	applyMigrations(t, db, "down")
+
+	var tables []string
+	require.NoError(t, db.Raw("SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%'").Scan(&tables).Error)
+	assert.Empty(t, tables)
+}
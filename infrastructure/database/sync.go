@@ -0,0 +1,127 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/domain/model"
+	"github.com/sioncojp/famili-api/domain/repository"
+)
+
+// todoChangeRow...todo_changesテーブルの1行. todoごとに最後の変更だけを持ち、payloadは変更後のtodoのJSON
+type todoChangeRow struct {
+	Seq       uint `gorm:"primaryKey"`
+	TodoId    uint
+	FamilyId  string
+	CreatedBy string
+	Deleted   bool
+	Payload   string
+	ChangedAt time.Time
+}
+
+func (todoChangeRow) TableName() string {
+	return "todo_changes"
+}
+
+// todoChangeRepository...
+type todoChangeRepository struct {
+	db *gorm.DB
+}
+
+// NewTodoChangeRepository...Repository interfaceを返すことでserviceとメソッドを揃える
+// TxManagerのRepositories.Changesはtransactionのdbで作られるので、todoの変更と一緒にcommitされる
+func NewTodoChangeRepository(db *gorm.DB) repository.TodoChangeRepository {
+	return &todoChangeRepository{db}
+}
+
+// Record...todoの前の変更を消してから書き込むためのDB操作. seqはAUTO_INCREMENTで振り直される
+func (r *todoChangeRepository) Record(ctx context.Context, change *model.TodoChange) error {
+	payload, err := json.Marshal(change.Todo)
+	if err != nil {
+		return err
+	}
+	row := todoChangeRow{
+		TodoId:    change.TodoId,
+		FamilyId:  string(change.FamilyId),
+		CreatedBy: string(change.CreatedBy),
+		Deleted:   change.Deleted,
+		Payload:   string(payload),
+		ChangedAt: time.Now(),
+	}
+
+	err = r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("todo_id = ?", change.TodoId).Delete(&todoChangeRow{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&row).Error
+	})
+	if err != nil {
+		return translate(err)
+	}
+	change.Seq = row.Seq
+	change.ChangedAt = row.ChangedAt
+	return nil
+}
+
+// Since...callerのfamilyか、callerが作ったtodoの変更のうち、seqより後のものを古い順にlimit件取得するためのDB操作
+func (r *todoChangeRepository) Since(ctx context.Context, caller domain.Caller, seq uint, limit int) ([]model.TodoChange, error) {
+	var rows []todoChangeRow
+	err := r.db.WithContext(ctx).
+		Where("seq > ?", seq).
+		Where("family_id = ? OR created_by = ?", string(caller.FamilyId), string(caller.MemberId)).
+		Order("seq").Limit(limit).Find(&rows).Error
+	if err != nil {
+		return nil, translate(err)
+	}
+
+	result := make([]model.TodoChange, 0, len(rows))
+	for _, v := range rows {
+		var todo model.Todo
+		if err := json.Unmarshal([]byte(v.Payload), &todo); err != nil {
+			return nil, err
+		}
+		result = append(result, model.TodoChange{
+			Seq:       v.Seq,
+			TodoId:    v.TodoId,
+			FamilyId:  domain.Id(v.FamilyId),
+			CreatedBy: domain.Id(v.CreatedBy),
+			Deleted:   v.Deleted,
+			Todo:      todo,
+			ChangedAt: v.ChangedAt,
+		})
+	}
+	return result, nil
+}
+
+// Latest...最後に振ったseqを取得するためのDB操作. 変更がなければ0
+func (r *todoChangeRepository) Latest(ctx context.Context) (uint, error) {
+	var seq uint
+	err := r.db.WithContext(ctx).Model(&todoChangeRow{}).Select("COALESCE(MAX(seq), 0)").Scan(&seq).Error
+	return seq, translate(err)
+}
+
+// syncMutationRepository...
+type syncMutationRepository struct {
+	db *gorm.DB
+}
+
+// NewSyncMutationRepository...Repository interfaceを返すことでserviceとメソッドを揃える
+func NewSyncMutationRepository(db *gorm.DB) repository.SyncMutationRepository {
+	return &syncMutationRepository{db}
+}
+
+// Get...memberが送ったclient_idの変更を取得するためのDB操作
+func (r *syncMutationRepository) Get(ctx context.Context, memberId domain.Id, clientId string) (model.SyncMutation, error) {
+	var result model.SyncMutation
+	err := r.db.WithContext(ctx).Where("member_id = ? AND client_id = ?", string(memberId), clientId).Take(&result).Error
+	return result, translate(err)
+}
+
+// Save...変更を書き込むためのDB操作. 同じmemberとclient_idはUNIQUE INDEXでErrConflictになる
+func (r *syncMutationRepository) Save(ctx context.Context, mutation *model.SyncMutation) error {
+	return translate(r.db.WithContext(ctx).Create(mutation).Error)
+}
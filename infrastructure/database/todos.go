@@ -1,6 +1,9 @@
 package database
 
 import (
+	"context"
+
+	"github.com/pkg/errors"
 	"gorm.io/gorm"
 
 	"github.com/sioncojp/famili-api/domain"
@@ -11,44 +14,208 @@ import (
 // todoRepository...
 type todoRepository struct {
 	db *gorm.DB
+	// replicas...nilならGetById, Listもdbで実行する
+	replicas *Replicas
+	// retry...transactionの外ならtransientなerrorをretryする
+	retry bool
+}
+
+// todoAssignee...todosとmembersの中間テーブル
+type todoAssignee struct {
+	TodoId   uint
+	MemberId uint
+}
+
+func (todoAssignee) TableName() string {
+	return "todo_assignees"
 }
 
 // NewTodoRepositoryMySQL...Repository interfaceを返すことでserviceとメソッドを揃える
 func NewTodoRepository(db *gorm.DB) repository.TodoRepository {
-	return &todoRepository{db}
+	return &todoRepository{db: db}
+}
+
+// NewReplicatedTodoRepository...GetById, Listをreplicaに振り分ける. 書き込みはprimaryで行う
+// transactionの外で使うので、Create以外はdeadlockや接続切れのときにやり直す
+func NewReplicatedTodoRepository(replicas *Replicas) repository.TodoRepository {
+	return &todoRepository{db: replicas.primary.DB, replicas: replicas, retry: true}
 }
 
 // GetById...IDからtodoを取得するためのDB操作
-func (r *todoRepository) GetById(id domain.Id) (model.Todo, error) {
+func (r *todoRepository) GetById(ctx context.Context, id domain.Id) (model.Todo, error) {
 	var result model.Todo
-	if err := r.db.Where("id = ?", id).First(&result).Error; err != nil {
-		return result, err
+	v, ok := parseId(id)
+	if !ok {
+		return result, errInvalidId
 	}
-	return result, nil
+	err := r.read(ctx, domain.CallerFromContext(ctx), func(db *gorm.DB) error {
+		result = model.Todo{}
+		if err := db.Where("id = ?", v).First(&result).Error; err != nil {
+			return err
+		}
+
+		todos := []model.Todo{result}
+		if err := loadAssignees(db, todos); err != nil {
+			return err
+		}
+		result = todos[0]
+		return nil
+	})
+	return result, translate(err)
 }
 
-// List...todoを全て取得するためのDB操作
-func (r *todoRepository) List() ([]model.Todo, error) {
+// GetByShareToken...share tokenから公開されているtodoを取得するためのDB操作
+func (r *todoRepository) GetByShareToken(ctx context.Context, token string) (model.Todo, error) {
+	var result model.Todo
+	err := r.do(ctx, func() error {
+		return r.db.WithContext(ctx).Where("share_token = ? AND visibility = ?", token, model.VisibilityPublic).First(&result).Error
+	})
+	return result, translate(err)
+}
+
+// List...callerが見れるtodoを全て取得するためのDB操作
+func (r *todoRepository) List(ctx context.Context, caller domain.Caller) ([]model.Todo, error) {
 	var result []model.Todo
+	err := r.read(ctx, caller, func(db *gorm.DB) error {
+		result = nil
+		if err := visibleTo(db, caller).Order("position, id").Find(&result).Error; err != nil {
+			return err
+		}
+		return loadAssignees(db, result)
+	})
+	return result, translate(err)
+}
 
-	if err := r.db.Find(&result).Error; err != nil {
-		return result, err
+// ListByAssignee...callerが見れるtodoのうち、memberIdがassigneeのものを取得するためのDB操作
+func (r *todoRepository) ListByAssignee(ctx context.Context, caller domain.Caller, memberId domain.Id) ([]model.Todo, error) {
+	var result []model.Todo
+	id, ok := parseId(memberId)
+	if !ok {
+		return result, nil
 	}
-
-	return result, nil
+	err := r.do(ctx, func() error {
+		db := r.db.WithContext(ctx)
+		result = nil
+		assigned := db.Model(&todoAssignee{}).Select("todo_id").Where("member_id = ?", id)
+		if err := visibleTo(db, caller).Where("id IN (?)", assigned).Order("position, id").Find(&result).Error; err != nil {
+			return err
+		}
+		return loadAssignees(db, result)
+	})
+	return result, translate(err)
 }
 
 // Create...todo作成するためのDB操作
-func (r *todoRepository) Create(todo *model.Todo) error {
-	return r.db.Create(&todo).Error
+func (r *todoRepository) Create(ctx context.Context, todo *model.Todo) error {
+	return translate(r.wrote(ctx, r.db.WithContext(ctx).Create(&todo).Error))
 }
 
 // Update...todo更新するためのDB操作
-func (r *todoRepository) Update(todo *model.Todo) error {
-	return r.db.Save(&todo).Error
+func (r *todoRepository) Update(ctx context.Context, todo *model.Todo) error {
+	return translate(r.wrote(ctx, r.do(ctx, func() error {
+		return r.db.WithContext(ctx).Save(&todo).Error
+	})))
+}
+
+// Delete...IDからtodo削除するためのDB操作. todo_assigneesはON DELETE CASCADEで消える
+func (r *todoRepository) Delete(ctx context.Context, todo *model.Todo) error {
+	return translate(r.wrote(ctx, r.do(ctx, func() error {
+		return r.db.WithContext(ctx).Delete(&model.Todo{}, todo.ID).Error
+	})))
+}
+
+// SetAssignees...todoのassigneeをAssigneeIdsで置き換えるためのDB操作
+func (r *todoRepository) SetAssignees(ctx context.Context, todo *model.Todo) error {
+	err := r.do(ctx, func() error {
+		return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("todo_id = ?", todo.ID).Delete(&todoAssignee{}).Error; err != nil {
+				return err
+			}
+			if len(todo.AssigneeIds) == 0 {
+				return nil
+			}
+
+			rows := make([]todoAssignee, 0, len(todo.AssigneeIds))
+			for _, id := range todo.AssigneeIds {
+				rows = append(rows, todoAssignee{TodoId: todo.ID, MemberId: id})
+			}
+			return tx.Create(&rows).Error
+		})
+	})
+	return translate(r.wrote(ctx, err))
 }
 
-// Delete...IDからtodo削除するためのDB操作
-func (r *todoRepository) Delete(todo *model.Todo) error {
-	return r.db.Delete(&model.Todo{}, todo.ID).Error
+// read...replicaでfnを実行する. replicaで失敗したらprimaryでやり直す
+// not foundはreplicaの遅延かもしれないのでprimaryで確かめる. それ以外のerrorならreplicaを落ちている扱いにする
+// domain.NewPrimaryContextを付けたctxなら、書き込む前の読み込みなのでreplicaは使わない
+func (r *todoRepository) read(ctx context.Context, caller domain.Caller, fn func(db *gorm.DB) error) error {
+	if r.replicas != nil && !domain.PrimaryFromContext(ctx) {
+		if p := r.replicas.reader(caller); p != r.replicas.primary {
+			err := fn(p.DB.WithContext(ctx))
+			if err == nil || ctx.Err() != nil {
+				return err
+			}
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				r.replicas.markUnhealthy(p, err)
+			}
+		}
+	}
+	return r.do(ctx, func() error { return fn(r.db.WithContext(ctx)) })
+}
+
+// do...transactionの外ならtransientなerrorのときにやり直す
+func (r *todoRepository) do(ctx context.Context, fn func() error) error {
+	if !r.retry {
+		return fn()
+	}
+	return retry(ctx, fn)
+}
+
+// wrote...書き込みに成功したら、callerをしばらくprimaryから読ませる
+func (r *todoRepository) wrote(ctx context.Context, err error) error {
+	if err == nil && r.replicas != nil {
+		r.replicas.wrote(domain.CallerFromContext(ctx))
+	}
+	return err
+}
+
+// visibleTo...callerが見れるtodoに絞り込む. model.Todo.VisibleToと同じく、空のIDでは何にも一致させない
+func visibleTo(db *gorm.DB, caller domain.Caller) *gorm.DB {
+	switch {
+	case caller.MemberId == "" && caller.FamilyId == "":
+		return db.Where("1 = 0")
+	case caller.FamilyId == "":
+		return db.Where("created_by = ?", caller.MemberId)
+	case caller.MemberId == "":
+		return db.Where("family_id = ? AND visibility <> ?", caller.FamilyId, model.VisibilityPrivate)
+	}
+	return db.Where(
+		"created_by = ? OR (family_id = ? AND visibility <> ?)",
+		caller.MemberId, caller.FamilyId, model.VisibilityPrivate,
+	)
+}
+
+// loadAssignees...todosにAssigneeIdsを詰める
+func loadAssignees(db *gorm.DB, todos []model.Todo) error {
+	if len(todos) == 0 {
+		return nil
+	}
+
+	ids := make([]uint, 0, len(todos))
+	index := make(map[uint]int, len(todos))
+	for i, v := range todos {
+		ids = append(ids, v.ID)
+		index[v.ID] = i
+		todos[i].AssigneeIds = []uint{}
+	}
+
+	var rows []todoAssignee
+	if err := db.Where("todo_id IN ?", ids).Find(&rows).Error; err != nil {
+		return err
+	}
+	for _, v := range rows {
+		i := index[v.TodoId]
+		todos[i].AssigneeIds = append(todos[i].AssigneeIds, v.MemberId)
+	}
+	return nil
 }
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"context"
 	"database/sql/driver"
 	"regexp"
 	"strconv"
@@ -12,7 +13,6 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
-	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 
 	"github.com/sioncojp/famili-api/domain"
@@ -20,9 +20,10 @@ import (
 	"github.com/sioncojp/famili-api/utils"
 )
 
-// テストスイートの構造体
+// テストスイートの構造体. dialectごとに同じテストを実行する
 type TodoRepositoryTestSuite struct {
 	suite.Suite
+	dialect        string
 	mock           sqlmock.Sqlmock
 	todoRepository todoRepository
 	dummy          *model.Todo
@@ -39,10 +40,7 @@ func (s *TodoRepositoryTestSuite) SetupTest() {
 	}
 
 	todoRepository := todoRepository{}
-	todoRepository.db, _ = gorm.Open(
-		mysql.Dialector{Config: &mysql.Config{DriverName: "mysql", Conn: db, SkipInitializeWithVersion: true}},
-		&gorm.Config{},
-	)
+	todoRepository.db = openDialect(s.dialect, db, mock)
 	s.mock = mock
 	s.todoRepository = todoRepository
 }
@@ -55,7 +53,22 @@ func (s *TodoRepositoryTestSuite) TearDownTest() {
 
 // テストスイートの実行
 func TestTodoRepositoryTestSuite(t *testing.T) {
-	suite.Run(t, new(TodoRepositoryTestSuite))
+	suite.Run(t, &TodoRepositoryTestSuite{dialect: dialectMySQL})
+}
+
+// テストスイートの実行. SQLite
+func TestTodoRepositoryTestSuiteSQLite(t *testing.T) {
+	suite.Run(t, &TodoRepositoryTestSuite{dialect: dialectSQLite})
+}
+
+// テストスイートの実行. PostgreSQL
+func TestTodoRepositoryTestSuitePostgres(t *testing.T) {
+	suite.Run(t, &TodoRepositoryTestSuite{dialect: dialectPostgres})
+}
+
+// sql...MySQLで書いた期待するSQLをdialectに合わせる
+func (s *TodoRepositoryTestSuite) sql(query string) string {
+	return dialectSQL(s.dialect, query)
 }
 
 // BeforeTest...テストスイート前に実行するメソッド
@@ -65,6 +78,9 @@ func (s *TodoRepositoryTestSuite) BeforeTest(suiteName string, testName string)
 		Title:       faker.Word(),
 		Description: faker.Word(),
 		Completed:   false,
+		CreatedBy:   "1",
+		FamilyId:    "1",
+		Visibility:  model.VisibilityFamily,
 	}
 
 	s.dummys = []model.Todo{
@@ -97,13 +113,18 @@ func (s *TodoRepositoryTestSuite) TestTodoGetById() {
 		rows := s.mock.NewRows([]string{"id", "title", "description", "completed"}).
 			AddRow(s.dummy.ID, s.dummy.Title, s.dummy.Description, s.dummy.Completed)
 
-		s.mock.ExpectQuery(regexp.QuoteMeta(
-			"SELECT * FROM `todos` WHERE id = ? ORDER BY `todos`.`id` LIMIT 1")).
-			WithArgs(strconv.FormatUint(uint64(s.dummy.ID), 10)).
+		s.mock.ExpectQuery(regexp.QuoteMeta(s.sql(
+			"SELECT * FROM `todos` WHERE id = ? ORDER BY `todos`.`id` LIMIT 1"))).
+			WithArgs(s.dummy.ID).
 			WillReturnRows(rows)
+		s.mock.ExpectQuery(regexp.QuoteMeta(s.sql(
+			"SELECT * FROM `todo_assignees` WHERE todo_id IN (?)"))).
+			WithArgs(s.dummy.ID).
+			WillReturnRows(sqlmock.NewRows([]string{"todo_id", "member_id"}).AddRow(s.dummy.ID, 1))
 
-		data, err := s.todoRepository.GetById(domain.Id(strconv.Itoa(int(s.dummy.ID))))
+		data, err := s.todoRepository.GetById(context.Background(), domain.Id(strconv.Itoa(int(s.dummy.ID))))
 		require.NoError(s.T(), err)
+		assert.Equal(s.T(), []uint{1}, data.AssigneeIds, "unexpected assignee ids")
 
 		assert.Equal(s.T(), data.ID, s.dummy.ID, "unexpected id")
 		assert.Equal(s.T(), data.Title, s.dummy.Title, "unexpected title")
@@ -112,17 +133,64 @@ func (s *TodoRepositoryTestSuite) TestTodoGetById() {
 	})
 }
 
+func (s *TodoRepositoryTestSuite) TestTodoGetByIdInvalid() {
+	s.Run("GetById with non numeric id", func() {
+		// PostgreSQLはBIGINTに文字列を渡すとエラーになるので、クエリを投げずにnot foundにする
+		_, err := s.todoRepository.GetById(context.Background(), "abc")
+		assert.ErrorIs(s.T(), err, gorm.ErrRecordNotFound)
+		assert.ErrorIs(s.T(), err, domain.ErrNotFound)
+		assert.NoError(s.T(), s.mock.ExpectationsWereMet())
+	})
+}
+
+func (s *TodoRepositoryTestSuite) TestTodoListCanceled() {
+	s.Run("List with canceled context", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		// cancel済みのcontextではクエリを投げずにエラーになる
+		_, err := s.todoRepository.List(ctx, domain.Caller{MemberId: s.dummy.CreatedBy, FamilyId: s.dummy.FamilyId})
+		assert.ErrorIs(s.T(), err, context.Canceled)
+		assert.NoError(s.T(), s.mock.ExpectationsWereMet())
+	})
+}
+
+func (s *TodoRepositoryTestSuite) TestTodoGetByShareToken() {
+	s.Run("GetByShareToken", func() {
+		token := faker.Word()
+		rows := s.mock.NewRows([]string{"id", "title", "description", "completed", "visibility", "share_token"}).
+			AddRow(s.dummy.ID, s.dummy.Title, s.dummy.Description, s.dummy.Completed, model.VisibilityPublic, token)
+
+		s.mock.ExpectQuery(regexp.QuoteMeta(s.sql(
+			"SELECT * FROM `todos` WHERE share_token = ? AND visibility = ? ORDER BY `todos`.`id` LIMIT 1"))).
+			WithArgs(token, model.VisibilityPublic).
+			WillReturnRows(rows)
+
+		data, err := s.todoRepository.GetByShareToken(context.Background(), token)
+		require.NoError(s.T(), err)
+
+		assert.Equal(s.T(), data.ID, s.dummy.ID, "unexpected id")
+		assert.Equal(s.T(), data.ShareToken, token, "unexpected share token")
+		assert.Equal(s.T(), data.Visibility, model.VisibilityPublic, "unexpected visibility")
+	})
+}
+
 func (s *TodoRepositoryTestSuite) TestTodoList() {
 	s.Run("List", func() {
 		rows := sqlmock.NewRows([]string{"id", "title", "description", "completed"})
 		for _, v := range s.dummys {
 			rows.AddRow(v.ID, v.Title, v.Description, v.Completed)
 		}
-		s.mock.ExpectQuery(regexp.QuoteMeta(
-			"SELECT * FROM `todos`")).
+		s.mock.ExpectQuery(regexp.QuoteMeta(s.sql(
+			"SELECT * FROM `todos` WHERE created_by = ? OR (family_id = ? AND visibility <> ?)"))).
+			WithArgs(s.dummy.CreatedBy, s.dummy.FamilyId, model.VisibilityPrivate).
 			WillReturnRows(rows)
+		s.mock.ExpectQuery(regexp.QuoteMeta(s.sql(
+			"SELECT * FROM `todo_assignees` WHERE todo_id IN (?,?)"))).
+			WithArgs(s.dummys[0].ID, s.dummys[1].ID).
+			WillReturnRows(sqlmock.NewRows([]string{"todo_id", "member_id"}))
 
-		data, err := s.todoRepository.List()
+		data, err := s.todoRepository.List(context.Background(), domain.Caller{MemberId: s.dummy.CreatedBy, FamilyId: s.dummy.FamilyId})
 		require.NoError(s.T(), err)
 
 		num := 0
@@ -136,20 +204,44 @@ func (s *TodoRepositoryTestSuite) TestTodoList() {
 	})
 }
 
+func (s *TodoRepositoryTestSuite) TestTodoListByAssignee() {
+	s.Run("ListByAssignee", func() {
+		rows := sqlmock.NewRows([]string{"id", "title", "description", "completed"}).
+			AddRow(s.dummy.ID, s.dummy.Title, s.dummy.Description, s.dummy.Completed)
+		s.mock.ExpectQuery(regexp.QuoteMeta(s.sql(
+			"SELECT * FROM `todos` WHERE (created_by = ? OR (family_id = ? AND visibility <> ?)) AND id IN (SELECT `todo_id` FROM `todo_assignees` WHERE member_id = ?)"))).
+			WithArgs(s.dummy.CreatedBy, s.dummy.FamilyId, model.VisibilityPrivate, 2).
+			WillReturnRows(rows)
+		s.mock.ExpectQuery(regexp.QuoteMeta(s.sql(
+			"SELECT * FROM `todo_assignees` WHERE todo_id IN (?)"))).
+			WithArgs(s.dummy.ID).
+			WillReturnRows(sqlmock.NewRows([]string{"todo_id", "member_id"}).AddRow(s.dummy.ID, 2))
+
+		data, err := s.todoRepository.ListByAssignee(context.Background(), domain.Caller{MemberId: s.dummy.CreatedBy, FamilyId: s.dummy.FamilyId}, "2")
+		require.NoError(s.T(), err)
+		require.Len(s.T(), data, 1)
+		assert.Equal(s.T(), data[0].ID, s.dummy.ID, "unexpected id")
+		assert.Equal(s.T(), []uint{2}, data[0].AssigneeIds, "unexpected assignee ids")
+	})
+}
+
 func (s *TodoRepositoryTestSuite) TestTodoCreate() {
 	s.Run("Create", func() {
 		s.mock.ExpectBegin()
-		s.mock.ExpectExec("INSERT").
-			WithArgs(anyTime, anyTime, s.dummy.Title, s.dummy.Description, s.dummy.Completed).
-			WillReturnResult(sqlmock.NewResult(int64(s.dummy.ID), 1))
+		expectInsert(s.dialect, s.mock, s.dummy.ID,
+			anyTime, anyTime, s.dummy.Title, s.dummy.Description, s.dummy.Completed, s.dummy.Position,
+			s.dummy.CreatedBy, s.dummy.FamilyId, s.dummy.Visibility, s.dummy.ShareToken)
 		s.mock.ExpectCommit()
 
 		data := &model.Todo{
 			Title:       s.dummy.Title,
 			Description: s.dummy.Description,
 			Completed:   s.dummy.Completed,
+			CreatedBy:   s.dummy.CreatedBy,
+			FamilyId:    s.dummy.FamilyId,
+			Visibility:  s.dummy.Visibility,
 		}
-		err := s.todoRepository.Create(data)
+		err := s.todoRepository.Create(context.Background(), data)
 		require.NoError(s.T(), err)
 		if err == nil {
 			assert.Equal(s.T(), data.ID, s.dummy.ID, "unexpected ID")
@@ -167,15 +259,20 @@ func (s *TodoRepositoryTestSuite) TestTodoUpdate() {
 			Title:       faker.Word(),
 			Description: faker.Sentence(),
 			Completed:   true,
+			Position:    3,
+			CreatedBy:   s.dummy.CreatedBy,
+			FamilyId:    s.dummy.FamilyId,
+			Visibility:  model.VisibilityPrivate,
 		}
 
 		s.mock.ExpectBegin()
 		s.mock.ExpectExec("UPDATE").
-			WithArgs(anyTime, anyTime, data.Title, data.Description, data.Completed, data.ID).
+			WithArgs(anyTime, anyTime, data.Title, data.Description, data.Completed, data.Position,
+				data.CreatedBy, data.FamilyId, data.Visibility, data.ShareToken, data.ID).
 			WillReturnResult(sqlmock.NewResult(int64(s.dummy.ID), 1))
 		s.mock.ExpectCommit()
 
-		err := s.todoRepository.Update(data)
+		err := s.todoRepository.Update(context.Background(), data)
 		require.NoError(s.T(), err)
 		if err == nil {
 			assert.Equal(s.T(), data.ID, s.dummy.ID, "unexpected ID")
@@ -194,7 +291,25 @@ func (s *TodoRepositoryTestSuite) TestTodoDelete() {
 			WillReturnResult(sqlmock.NewResult(1, 1))
 		s.mock.ExpectCommit()
 
-		err := s.todoRepository.Delete(s.dummy)
+		err := s.todoRepository.Delete(context.Background(), s.dummy)
+		require.NoError(s.T(), err)
+	})
+}
+
+func (s *TodoRepositoryTestSuite) TestTodoSetAssignees() {
+	s.Run("SetAssignees", func() {
+		s.dummy.AssigneeIds = []uint{1, 2}
+
+		s.mock.ExpectBegin()
+		s.mock.ExpectExec(regexp.QuoteMeta(s.sql("DELETE FROM `todo_assignees` WHERE todo_id = ?"))).
+			WithArgs(s.dummy.ID).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		s.mock.ExpectExec(regexp.QuoteMeta(s.sql("INSERT INTO `todo_assignees` (`todo_id`,`member_id`) VALUES (?,?),(?,?)"))).
+			WithArgs(s.dummy.ID, 1, s.dummy.ID, 2).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		s.mock.ExpectCommit()
+
+		err := s.todoRepository.SetAssignees(context.Background(), s.dummy)
 		require.NoError(s.T(), err)
 	})
 }
@@ -0,0 +1,55 @@
+package database
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/domain/repository"
+)
+
+// txKey...contextに実行中のtransactionを入れるためのkey
+type txKey struct{}
+
+// txManager...
+type txManager struct {
+	db *gorm.DB
+	// replicas...nilでなければcommitしたcallerをしばらくprimaryから読ませる
+	replicas *Replicas
+}
+
+// NewTxManager...TxManager interfaceを返すことでメモリの実装と差し替えられる
+func NewTxManager(db *gorm.DB) repository.TxManager {
+	return &txManager{db: db}
+}
+
+// NewReplicatedTxManager...primaryでtransactionを実行し、commitしたらreplicasに記録する
+func NewReplicatedTxManager(replicas *Replicas) repository.TxManager {
+	return &txManager{db: replicas.primary.DB, replicas: replicas}
+}
+
+// Do...gormのTransactionで実行する. 既にtransactionの中ならgormがSAVEPOINTを使う
+// panicしたらrollbackしてからpanicをそのまま投げ直す
+func (m *txManager) Do(ctx context.Context, fn repository.TxFunc) error {
+	db := m.db
+	tx, nested := ctx.Value(txKey{}).(*gorm.DB)
+	if nested {
+		db = tx
+	}
+
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(context.WithValue(ctx, txKey{}, tx), repository.Repositories{
+			Todos:         NewTodoRepository(tx),
+			Members:       NewMemberRepository(tx),
+			Outbox:        NewOutboxRepository(tx),
+			Changes:       NewTodoChangeRepository(tx),
+			SyncMutations: NewSyncMutationRepository(tx),
+			Accounts:      NewAccountRepository(tx),
+		})
+	})
+	if err == nil && !nested && m.replicas != nil {
+		m.replicas.wrote(domain.CallerFromContext(ctx))
+	}
+	return translate(err)
+}
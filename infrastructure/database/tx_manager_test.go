@@ -0,0 +1,127 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/sioncojp/famili-api/domain/model"
+	"github.com/sioncojp/famili-api/domain/repository"
+)
+
+var errRollback = errors.New("rollback")
+
+// テストスイートの構造体
+type TxManagerTestSuite struct {
+	suite.Suite
+	mock      sqlmock.Sqlmock
+	txManager txManager
+}
+
+// テストのセットアップ
+func (s *TxManagerTestSuite) SetupTest() {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		panic(err)
+	}
+
+	s.mock = mock
+	s.txManager = txManager{db: openDialect(dialectMySQL, db, mock)}
+}
+
+// テスト終了時の処理（データベース接続のクローズ）
+func (s *TxManagerTestSuite) TearDownTest() {
+	db, _ := s.txManager.db.DB()
+	db.Close()
+}
+
+// テストスイートの実行
+func TestTxManagerTestSuite(t *testing.T) {
+	suite.Run(t, new(TxManagerTestSuite))
+}
+
+func (s *TxManagerTestSuite) expectDeleteTodo(id uint) {
+	s.mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `todos` WHERE `todos`.`id` = ?")).
+		WithArgs(id).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func (s *TxManagerTestSuite) TestTxManagerCommit() {
+	s.Run("Commit", func() {
+		s.mock.ExpectBegin()
+		s.expectDeleteTodo(1)
+		s.mock.ExpectCommit()
+
+		err := s.txManager.Do(context.Background(), func(ctx context.Context, repos repository.Repositories) error {
+			return repos.Todos.Delete(ctx, &model.Todo{Model: model.Model{ID: 1}})
+		})
+		require.NoError(s.T(), err)
+		assert.NoError(s.T(), s.mock.ExpectationsWereMet())
+	})
+}
+
+func (s *TxManagerTestSuite) TestTxManagerRollbackOnError() {
+	s.Run("Rollback on error", func() {
+		s.mock.ExpectBegin()
+		s.expectDeleteTodo(1)
+		s.mock.ExpectRollback()
+
+		err := s.txManager.Do(context.Background(), func(ctx context.Context, repos repository.Repositories) error {
+			if err := repos.Todos.Delete(ctx, &model.Todo{Model: model.Model{ID: 1}}); err != nil {
+				return err
+			}
+			return errRollback
+		})
+		assert.ErrorIs(s.T(), err, errRollback)
+		assert.NoError(s.T(), s.mock.ExpectationsWereMet())
+	})
+}
+
+func (s *TxManagerTestSuite) TestTxManagerRollbackOnPanic() {
+	s.Run("Rollback on panic", func() {
+		s.mock.ExpectBegin()
+		s.mock.ExpectRollback()
+
+		assert.PanicsWithValue(s.T(), "boom", func() {
+			_ = s.txManager.Do(context.Background(), func(ctx context.Context, repos repository.Repositories) error {
+				panic("boom")
+			})
+		})
+		assert.NoError(s.T(), s.mock.ExpectationsWereMet())
+	})
+}
+
+func (s *TxManagerTestSuite) TestTxManagerNestedSavepoint() {
+	s.Run("Nested savepoint", func() {
+		s.mock.ExpectBegin()
+		s.expectDeleteTodo(1)
+		s.mock.ExpectExec("SAVEPOINT sp").WillReturnResult(sqlmock.NewResult(0, 0))
+		s.expectDeleteTodo(2)
+		s.mock.ExpectExec("ROLLBACK TO SAVEPOINT sp").WillReturnResult(sqlmock.NewResult(0, 0))
+		s.mock.ExpectCommit()
+
+		err := s.txManager.Do(context.Background(), func(ctx context.Context, repos repository.Repositories) error {
+			if err := repos.Todos.Delete(ctx, &model.Todo{Model: model.Model{ID: 1}}); err != nil {
+				return err
+			}
+
+			// 内側のerrorはsavepointまで戻すだけで、外側はcommitできる
+			err := s.txManager.Do(ctx, func(ctx context.Context, repos repository.Repositories) error {
+				if err := repos.Todos.Delete(ctx, &model.Todo{Model: model.Model{ID: 2}}); err != nil {
+					return err
+				}
+				return errRollback
+			})
+			assert.ErrorIs(s.T(), err, errRollback)
+			return nil
+		})
+		require.NoError(s.T(), err)
+		assert.NoError(s.T(), s.mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,111 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/domain/model"
+	"github.com/sioncojp/famili-api/domain/repository"
+)
+
+// webhookRepository...
+type webhookRepository struct {
+	db *gorm.DB
+}
+
+// NewWebhookRepository...Repository interfaceを返すことでserviceとメソッドを揃える
+func NewWebhookRepository(db *gorm.DB) repository.WebhookRepository {
+	return &webhookRepository{db}
+}
+
+// GetById...IDからwebhookを取得するためのDB操作
+func (r *webhookRepository) GetById(ctx context.Context, id domain.Id) (model.Webhook, error) {
+	var result model.Webhook
+	v, ok := parseId(id)
+	if !ok {
+		return result, errInvalidId
+	}
+	if err := r.db.WithContext(ctx).Where("id = ?", v).First(&result).Error; err != nil {
+		return result, translate(err)
+	}
+	return result, nil
+}
+
+// List...familyのwebhookを全て取得するためのDB操作
+func (r *webhookRepository) List(ctx context.Context, familyId domain.Id) ([]model.Webhook, error) {
+	var result []model.Webhook
+	if err := r.db.WithContext(ctx).Where("family_id = ?", familyId).Order("id").Find(&result).Error; err != nil {
+		return result, translate(err)
+	}
+	return result, nil
+}
+
+// Create...webhook作成するためのDB操作
+func (r *webhookRepository) Create(ctx context.Context, webhook *model.Webhook) error {
+	return translate(r.db.WithContext(ctx).Create(&webhook).Error)
+}
+
+// Update...webhook更新するためのDB操作
+func (r *webhookRepository) Update(ctx context.Context, webhook *model.Webhook) error {
+	return translate(r.db.WithContext(ctx).Save(&webhook).Error)
+}
+
+// Delete...webhook削除するためのDB操作. webhook_deliveriesはON DELETE CASCADEで消える
+func (r *webhookRepository) Delete(ctx context.Context, webhook *model.Webhook) error {
+	return translate(r.db.WithContext(ctx).Delete(&model.Webhook{}, webhook.ID).Error)
+}
+
+// RecordSuccess...連続失敗回数を0に戻すためのDB操作
+func (r *webhookRepository) RecordSuccess(ctx context.Context, id uint) error {
+	return translate(r.db.WithContext(ctx).Model(&model.Webhook{}).Where("id = ? AND failures <> 0", id).Update("failures", 0).Error)
+}
+
+// RecordFailure...連続失敗回数を増やし、disableAfter回以上なら無効にするためのDB操作
+// 複数の配信が同時に失敗しても数え漏れないように、SQLの中で足す
+func (r *webhookRepository) RecordFailure(ctx context.Context, id uint, disableAfter int, now time.Time) (bool, error) {
+	var disabled bool
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.Webhook{}).Where("id = ?", id).Update("failures", gorm.Expr("failures + 1")).Error; err != nil {
+			return err
+		}
+		result := tx.Model(&model.Webhook{}).
+			Where("id = ? AND failures >= ? AND disabled_at IS NULL", id, disableAfter).
+			Update("disabled_at", now)
+		disabled = result.RowsAffected > 0
+		return result.Error
+	})
+	return disabled, translate(err)
+}
+
+// Enqueue...配信を追加するためのDB操作. (webhook_id, event_id)のUNIQUE INDEXで重複を除く
+func (r *webhookRepository) Enqueue(ctx context.Context, deliveries ...model.WebhookDelivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+	return translate(r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&deliveries).Error)
+}
+
+// PendingDeliveries...pendingでnext_attempt_atを過ぎた配信を取得するためのDB操作
+func (r *webhookRepository) PendingDeliveries(ctx context.Context, now time.Time, limit int) ([]model.WebhookDelivery, error) {
+	var result []model.WebhookDelivery
+	err := r.db.WithContext(ctx).
+		Where("status = ? AND next_attempt_at <= ?", model.DeliveryPending, now).
+		Order("id").Limit(limit).Find(&result).Error
+	return result, translate(err)
+}
+
+// SaveDelivery...配信の結果を保存するためのDB操作
+func (r *webhookRepository) SaveDelivery(ctx context.Context, delivery *model.WebhookDelivery) error {
+	return translate(r.db.WithContext(ctx).Save(&delivery).Error)
+}
+
+// ListDeliveries...webhookの配信を新しい順に取得するためのDB操作
+func (r *webhookRepository) ListDeliveries(ctx context.Context, webhookId uint, limit int) ([]model.WebhookDelivery, error) {
+	var result []model.WebhookDelivery
+	err := r.db.WithContext(ctx).Where("webhook_id = ?", webhookId).Order("id DESC").Limit(limit).Find(&result).Error
+	return result, translate(err)
+}
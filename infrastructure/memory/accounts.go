@@ -0,0 +1,169 @@
+package memory
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/domain/model"
+	"github.com/sioncojp/famili-api/domain/repository"
+)
+
+// recoveryCode...TOTPを失くしたときのrecovery code. hashだけ保存する
+type recoveryCode struct {
+	hash string
+	used bool
+}
+
+// accountRepository...プロセス内でaccountを持つ
+type accountRepository struct {
+	mu            sync.RWMutex
+	seq           sequence
+	accounts      map[uint]model.Account
+	recoveryCodes map[uint][]recoveryCode
+	now           func() time.Time
+}
+
+// NewAccountRepository...Repository interfaceを返すことでserviceとメソッドを揃える
+func NewAccountRepository() repository.AccountRepository {
+	return &accountRepository{
+		accounts:      map[uint]model.Account{},
+		recoveryCodes: map[uint][]recoveryCode{},
+		now:           time.Now,
+	}
+}
+
+// GetById...IDからaccountを取得する
+func (r *accountRepository) GetById(id domain.Id) (model.Account, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	v, ok := parseId(id)
+	if !ok {
+		return model.Account{}, ErrNotFound
+	}
+	account, ok := r.accounts[v]
+	if !ok {
+		return model.Account{}, ErrNotFound
+	}
+	return account, nil
+}
+
+// GetByEmail...emailからaccountを取得する
+func (r *accountRepository) GetByEmail(email string) (model.Account, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, v := range r.accounts {
+		if v.Email == email {
+			return v, nil
+		}
+	}
+	return model.Account{}, ErrNotFound
+}
+
+// Create...accountを作成する. emailはMySQLと同じくuniqueにする
+func (r *accountRepository) Create(account *model.Account) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.accounts[account.ID]; ok && account.ID != 0 {
+		return ErrDuplicateKey
+	}
+	for _, v := range r.accounts {
+		if v.Email == account.Email {
+			return ErrDuplicateKey
+		}
+	}
+	account.ID = r.seq.next(account.ID)
+	touchCreate(&account.Model, r.now())
+	r.accounts[account.ID] = *account
+	return nil
+}
+
+// Update...accountを更新する. gormのSaveと同じく、存在しなければ作成する
+func (r *accountRepository) Update(account *model.Account) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current, ok := r.accounts[account.ID]
+	if !ok || account.ID == 0 {
+		account.ID = r.seq.next(account.ID)
+		touchCreate(&account.Model, r.now())
+	} else {
+		touchUpdate(&account.Model, current.Model, r.now())
+	}
+	r.accounts[account.ID] = *account
+	return nil
+}
+
+// ReplaceRecoveryCodes...recovery codeを置き換える
+func (r *accountRepository) ReplaceRecoveryCodes(account *model.Account, hashes []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(hashes) == 0 {
+		delete(r.recoveryCodes, account.ID)
+		return nil
+	}
+	codes := make([]recoveryCode, 0, len(hashes))
+	for _, v := range hashes {
+		codes = append(codes, recoveryCode{hash: v})
+	}
+	r.recoveryCodes[account.ID] = codes
+	return nil
+}
+
+// UseRecoveryCode...recovery codeを使用済みにする. lockの中で判定するので同時に使われても1回しか通らない
+func (r *accountRepository) UseRecoveryCode(account *model.Account, hash string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	codes := r.recoveryCodes[account.ID]
+	for i, v := range codes {
+		if v.hash == hash && !v.used {
+			codes[i].used = true
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// UseTOTPStep...TOTPの時間stepを使用済みにする. lockの中で判定するので同じcodeを同時に使われても1回しか通らない
+func (r *accountRepository) UseTOTPStep(account *model.Account, step int64) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current, ok := r.accounts[account.ID]
+	if !ok || current.TOTPLastStep >= step {
+		return false, nil
+	}
+	current.TOTPLastStep = step
+	r.accounts[account.ID] = current
+	account.TOTPLastStep = step
+	return true, nil
+}
+
+// snapshot...TxManagerのrollbackのために今の状態をcopyする
+func (r *accountRepository) snapshot() func() {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	seq := r.seq
+	accounts := make(map[uint]model.Account, len(r.accounts))
+	for k, v := range r.accounts {
+		accounts[k] = v
+	}
+	recoveryCodes := make(map[uint][]recoveryCode, len(r.recoveryCodes))
+	for k, v := range r.recoveryCodes {
+		recoveryCodes[k] = append([]recoveryCode(nil), v...)
+	}
+
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.seq = seq
+		r.accounts = accounts
+		r.recoveryCodes = recoveryCodes
+	}
+}
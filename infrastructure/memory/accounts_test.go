@@ -0,0 +1,69 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sioncojp/famili-api/domain/model"
+)
+
+func TestAccountCreateDuplicateEmail(t *testing.T) {
+	t.Parallel()
+	r := NewAccountRepository()
+	require.NoError(t, r.Create(&model.Account{Email: "papa@example.com"}))
+	assert.ErrorIs(t, r.Create(&model.Account{Email: "papa@example.com"}), ErrDuplicateKey)
+
+	got, err := r.GetByEmail("papa@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, uint(1), got.ID)
+
+	_, err = r.GetByEmail("nobody@example.com")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestAccountUseRecoveryCode(t *testing.T) {
+	t.Parallel()
+	r := NewAccountRepository()
+	account := &model.Account{Email: "papa@example.com"}
+	require.NoError(t, r.Create(account))
+	require.NoError(t, r.ReplaceRecoveryCodes(account, []string{"a", "b"}))
+
+	ok, err := r.UseRecoveryCode(account, "a")
+	require.NoError(t, err)
+	assert.True(t, ok, "first use")
+
+	ok, err = r.UseRecoveryCode(account, "a")
+	require.NoError(t, err)
+	assert.False(t, ok, "already used")
+
+	require.NoError(t, r.ReplaceRecoveryCodes(account, nil))
+	ok, err = r.UseRecoveryCode(account, "b")
+	require.NoError(t, err)
+	assert.False(t, ok, "replaced")
+}
+
+func TestAccountUseTOTPStep(t *testing.T) {
+	t.Parallel()
+	r := NewAccountRepository()
+	account := &model.Account{Email: "papa@example.com"}
+	require.NoError(t, r.Create(account))
+
+	ok, err := r.UseTOTPStep(account, 100)
+	require.NoError(t, err)
+	assert.True(t, ok, "first use")
+	assert.Equal(t, int64(100), account.TOTPLastStep)
+
+	ok, err = r.UseTOTPStep(account, 100)
+	require.NoError(t, err)
+	assert.False(t, ok, "already used")
+
+	ok, err = r.UseTOTPStep(account, 99)
+	require.NoError(t, err)
+	assert.False(t, ok, "older step")
+
+	ok, err = r.UseTOTPStep(account, 101)
+	require.NoError(t, err)
+	assert.True(t, ok, "next step")
+}
@@ -0,0 +1,123 @@
+package memory
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/domain/model"
+	"github.com/sioncojp/famili-api/domain/repository"
+)
+
+// apiKeyRepository...プロセス内でAPI keyを持つ
+type apiKeyRepository struct {
+	mu   sync.RWMutex
+	seq  sequence
+	keys map[uint]model.APIKey
+	now  func() time.Time
+}
+
+// NewAPIKeyRepository...Repository interfaceを返すことでserviceとメソッドを揃える
+func NewAPIKeyRepository() repository.APIKeyRepository {
+	return &apiKeyRepository{keys: map[uint]model.APIKey{}, now: time.Now}
+}
+
+// GetById...IDからAPI keyを取得する
+func (r *apiKeyRepository) GetById(id domain.Id) (model.APIKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	v, ok := parseId(id)
+	if !ok {
+		return model.APIKey{}, ErrNotFound
+	}
+	key, ok := r.keys[v]
+	if !ok {
+		return model.APIKey{}, ErrNotFound
+	}
+	return key, nil
+}
+
+// GetByPrefix...prefixからAPI keyを取得する
+func (r *apiKeyRepository) GetByPrefix(prefix string) (model.APIKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, v := range r.keys {
+		if v.Prefix == prefix {
+			return v, nil
+		}
+	}
+	return model.APIKey{}, ErrNotFound
+}
+
+// List...メンバーのAPI keyを全て取得する
+func (r *apiKeyRepository) List(memberId domain.Id) ([]model.APIKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := []model.APIKey{}
+	for _, v := range r.keys {
+		if v.MemberId == memberId {
+			result = append(result, v)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result, nil
+}
+
+// Create...API keyを作成する. prefixはMySQLと同じくuniqueにする
+func (r *apiKeyRepository) Create(key *model.APIKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.keys[key.ID]; ok && key.ID != 0 {
+		return ErrDuplicateKey
+	}
+	for _, v := range r.keys {
+		if v.Prefix == key.Prefix {
+			return ErrDuplicateKey
+		}
+	}
+	key.ID = r.seq.next(key.ID)
+	touchCreate(&key.Model, r.now())
+	r.keys[key.ID] = r.stored(*key)
+	return nil
+}
+
+// Update...API keyを更新する. gormのSaveと同じく、存在しなければ作成する
+func (r *apiKeyRepository) Update(key *model.APIKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current, ok := r.keys[key.ID]
+	if !ok || key.ID == 0 {
+		key.ID = r.seq.next(key.ID)
+		touchCreate(&key.Model, r.now())
+	} else {
+		touchUpdate(&key.Model, current.Model, r.now())
+	}
+	r.keys[key.ID] = r.stored(*key)
+	return nil
+}
+
+// TouchLastUsed...LastUsedAtだけを更新する. UpdatedAtは変えない
+func (r *apiKeyRepository) TouchLastUsed(key *model.APIKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current, ok := r.keys[key.ID]
+	if !ok {
+		return nil
+	}
+	current.LastUsedAt = key.LastUsedAt
+	r.keys[key.ID] = current
+	return nil
+}
+
+// stored...平文のkeyは保存しない
+func (r *apiKeyRepository) stored(key model.APIKey) model.APIKey {
+	key.Key = ""
+	return key
+}
@@ -0,0 +1,45 @@
+package memory
+
+import (
+	"sync"
+
+	"github.com/sioncojp/famili-api/domain/model"
+	"github.com/sioncojp/famili-api/domain/repository"
+)
+
+// loginAttemptRepository...プロセス内で失敗の記録を持つ. 1台構成やテストで使う
+type loginAttemptRepository struct {
+	mu       sync.Mutex
+	attempts map[string]model.LoginAttempt
+}
+
+// NewLoginAttemptRepository...Repository interfaceを返すことでserviceとメソッドを揃える
+func NewLoginAttemptRepository() repository.LoginAttemptRepository {
+	return &loginAttemptRepository{attempts: map[string]model.LoginAttempt{}}
+}
+
+// Get...keyから失敗の記録を取得する
+func (r *loginAttemptRepository) Get(key string) (model.LoginAttempt, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if v, ok := r.attempts[key]; ok {
+		return v, nil
+	}
+	return model.LoginAttempt{Key: key}, nil
+}
+
+// Save...失敗の記録を保存する
+func (r *loginAttemptRepository) Save(attempt *model.LoginAttempt) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.attempts[attempt.Key] = *attempt
+	return nil
+}
+
+// Delete...失敗の記録を削除する
+func (r *loginAttemptRepository) Delete(key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.attempts, key)
+	return nil
+}
@@ -0,0 +1,101 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/domain/model"
+	"github.com/sioncojp/famili-api/domain/repository"
+)
+
+// memberRepository...プロセス内でメンバーを持つ
+type memberRepository struct {
+	mu      sync.RWMutex
+	seq     sequence
+	members map[uint]model.Member
+	now     func() time.Time
+}
+
+// NewMemberRepository...Repository interfaceを返すことでserviceとメソッドを揃える
+func NewMemberRepository() repository.MemberRepository {
+	return &memberRepository{members: map[uint]model.Member{}, now: time.Now}
+}
+
+// List...familyのメンバーを全て取得する
+func (r *memberRepository) List(ctx context.Context, familyId domain.Id) ([]model.Member, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := []model.Member{}
+	for _, v := range r.sorted() {
+		if v.FamilyId == familyId {
+			result = append(result, v)
+		}
+	}
+	return result, nil
+}
+
+// ListByIds...IDからメンバーを取得する。存在しないIDは結果に含まれない
+func (r *memberRepository) ListByIds(ctx context.Context, ids []uint) ([]model.Member, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	wanted := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+
+	result := []model.Member{}
+	for _, v := range r.sorted() {
+		if wanted[v.ID] {
+			result = append(result, v)
+		}
+	}
+	return result, nil
+}
+
+// Create...メンバーを作成する
+func (r *memberRepository) Create(ctx context.Context, member *model.Member) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.members[member.ID]; ok && member.ID != 0 {
+		return ErrDuplicateKey
+	}
+	member.ID = r.seq.next(member.ID)
+	touchCreate(&member.Model, r.now())
+	r.members[member.ID] = *member
+	return nil
+}
+
+// sorted...MySQLと同じくID順で返す
+func (r *memberRepository) sorted() []model.Member {
+	result := make([]model.Member, 0, len(r.members))
+	for _, v := range r.members {
+		result = append(result, v)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
+
+// snapshot...TxManagerのrollbackのために今の状態をcopyする
+func (r *memberRepository) snapshot() func() {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	seq := r.seq
+	members := make(map[uint]model.Member, len(r.members))
+	for k, v := range r.members {
+		members[k] = v
+	}
+
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.seq = seq
+		r.members = members
+	}
+}
@@ -0,0 +1,63 @@
+package memory
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/domain/model"
+)
+
+var (
+	// ErrNotFound...gormの実装と同じく、見つからなければdomain.ErrNotFoundを返す
+	ErrNotFound = domain.ErrNotFound
+
+	// ErrDuplicateKey...MySQLのUNIQUE INDEXに相当する制約に違反した. domain.ErrConflictとして扱う
+	ErrDuplicateKey = errors.Wrap(domain.ErrConflict, "duplicate key")
+)
+
+// parseId...domain.IdをIDに変換する. 数値でなければfalseを返す
+func parseId(id domain.Id) (uint, bool) {
+	v, err := strconv.ParseUint(string(id), 10, 0)
+	if err != nil {
+		return 0, false
+	}
+	return uint(v), true
+}
+
+// sequence...auto incrementのID
+type sequence struct {
+	last uint
+}
+
+// next...IDを採番する. IDが指定されていればそれ以降から採番する
+func (s *sequence) next(id uint) uint {
+	if id == 0 {
+		s.last++
+		return s.last
+	}
+	if id > s.last {
+		s.last = id
+	}
+	return id
+}
+
+// touchCreate...gormと同じく、CreatedAt/UpdatedAtが空なら現在時刻を入れる
+func touchCreate(m *model.Model, now time.Time) {
+	if m.CreatedAt.IsZero() {
+		m.CreatedAt = now
+	}
+	if m.UpdatedAt.IsZero() {
+		m.UpdatedAt = now
+	}
+}
+
+// touchUpdate...gormのSaveと同じく、UpdatedAtを現在時刻にする. CreatedAtが空なら元の値を残す
+func touchUpdate(m *model.Model, current model.Model, now time.Time) {
+	if m.CreatedAt.IsZero() {
+		m.CreatedAt = current.CreatedAt
+	}
+	m.UpdatedAt = now
+}
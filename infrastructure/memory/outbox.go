@@ -0,0 +1,173 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sioncojp/famili-api/domain/model"
+	"github.com/sioncojp/famili-api/domain/repository"
+)
+
+// outboxEvent...配信状態を含めたevent
+type outboxEvent struct {
+	event       model.Event
+	retryAt     time.Time
+	lastFailure string
+	// dead...MarkDeadでもう配信しない
+	dead bool
+}
+
+// outboxRepository...プロセス内でeventを持つ. 再起動すると未配信のeventも消える
+type outboxRepository struct {
+	mu     sync.Mutex
+	seq    sequence
+	events []*outboxEvent
+	now    func() time.Time
+}
+
+// NewOutboxRepository...Repository interfaceを返すことでserviceとメソッドを揃える
+func NewOutboxRepository() repository.OutboxRepository {
+	return &outboxRepository{now: time.Now}
+}
+
+// Add...eventを書き込む. IDとOccurredAtを埋める
+func (r *outboxRepository) Add(ctx context.Context, events ...model.Event) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	for _, v := range events {
+		v.ID = r.seq.next(0)
+		if v.OccurredAt.IsZero() {
+			v.OccurredAt = now
+		}
+		r.events = append(r.events, &outboxEvent{event: v, retryAt: now})
+	}
+	return nil
+}
+
+// Pending...未配信でretryAtを過ぎたeventを古い順にlimit件取得する
+func (r *outboxRepository) Pending(ctx context.Context, now time.Time, limit int) ([]model.Event, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := []model.Event{}
+	for _, v := range r.pending(now, limit) {
+		result = append(result, v.event)
+	}
+	return result, nil
+}
+
+// Claim...Pendingと同じeventを取り出し、leaseの間は取り出さないようにする
+func (r *outboxRepository) Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]model.Event, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := []model.Event{}
+	for _, v := range r.pending(now, limit) {
+		v.retryAt = now.Add(lease)
+		result = append(result, v.event)
+	}
+	return result, nil
+}
+
+// pending...deadでなく、retryAtを過ぎたeventを古い順にlimit件. r.muを取ってから呼ぶ
+func (r *outboxRepository) pending(now time.Time, limit int) []*outboxEvent {
+	var result []*outboxEvent
+	for _, v := range r.events {
+		if len(result) >= limit {
+			break
+		}
+		if v.dead || v.retryAt.After(now) {
+			continue
+		}
+		result = append(result, v)
+	}
+	return result
+}
+
+// MarkDelivered...配信済みにする. 配信済みのeventは持ち続けないので消す
+func (r *outboxRepository) MarkDelivered(ctx context.Context, id uint) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, v := range r.events {
+		if v.event.ID == id {
+			r.events = append(r.events[:i], r.events[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// MarkFailed...失敗回数を増やし、retryAtまで配信しない
+func (r *outboxRepository) MarkFailed(ctx context.Context, id uint, retryAt time.Time, reason string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, v := range r.events {
+		if v.event.ID == id {
+			v.event.Attempts++
+			v.retryAt = retryAt
+			v.lastFailure = reason
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// MarkDead...失敗回数を増やし、もう配信しない
+func (r *outboxRepository) MarkDead(ctx context.Context, id uint, reason string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, v := range r.events {
+		if v.event.ID == id {
+			v.event.Attempts++
+			v.dead = true
+			v.lastFailure = reason
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// snapshot...TxManagerのrollbackのために今のIDを覚える
+// relayはtransactionの外で配信済みにするので、rollbackではtransaction中に追加したeventだけを消す
+func (r *outboxRepository) snapshot() func() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	seq := r.seq
+
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		events := r.events[:0]
+		for _, v := range r.events {
+			if v.event.ID <= seq.last {
+				events = append(events, v)
+			}
+		}
+		r.events = events
+		r.seq = seq
+	}
+}
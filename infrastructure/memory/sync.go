@@ -0,0 +1,163 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/domain/model"
+	"github.com/sioncojp/famili-api/domain/repository"
+)
+
+// todoChangeRepository...プロセス内でtodoごとの最後の変更を持つ
+type todoChangeRepository struct {
+	mu      sync.RWMutex
+	seq     sequence
+	changes map[uint]model.TodoChange
+	now     func() time.Time
+}
+
+// NewTodoChangeRepository...Repository interfaceを返すことでserviceとメソッドを揃える
+func NewTodoChangeRepository() repository.TodoChangeRepository {
+	return &todoChangeRepository{changes: map[uint]model.TodoChange{}, now: time.Now}
+}
+
+// Record...変更を記録する. 同じtodoの前の変更は上書きする
+func (r *todoChangeRepository) Record(ctx context.Context, change *model.TodoChange) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	change.Seq = r.seq.next(0)
+	change.ChangedAt = r.now()
+	change.Todo.AssigneeIds = append([]uint{}, change.Todo.AssigneeIds...)
+	r.changes[change.TodoId] = *change
+	return nil
+}
+
+// Since...callerのfamilyか、callerが作ったtodoの変更のうち、seqより後のものを古い順にlimit件取得する
+func (r *todoChangeRepository) Since(ctx context.Context, caller domain.Caller, seq uint, limit int) ([]model.TodoChange, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := []model.TodoChange{}
+	for _, v := range r.changes {
+		if v.Seq <= seq || (v.FamilyId != caller.FamilyId && v.CreatedBy != caller.MemberId) {
+			continue
+		}
+		v.Todo.AssigneeIds = append([]uint{}, v.Todo.AssigneeIds...)
+		result = append(result, v)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Seq < result[j].Seq })
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
+
+// Latest...最後に振ったseq
+func (r *todoChangeRepository) Latest(ctx context.Context) (uint, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.seq.last, nil
+}
+
+// snapshot...TxManagerのrollbackのために今の状態をcopyする
+func (r *todoChangeRepository) snapshot() func() {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	seq := r.seq
+	changes := make(map[uint]model.TodoChange, len(r.changes))
+	for k, v := range r.changes {
+		changes[k] = v
+	}
+
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.seq = seq
+		r.changes = changes
+	}
+}
+
+// syncMutationKey...memberとclient_idでUNIQUE
+type syncMutationKey struct {
+	memberId domain.Id
+	clientId string
+}
+
+// syncMutationRepository...プロセス内でPOST /v1/syncの変更を持つ
+type syncMutationRepository struct {
+	mu        sync.RWMutex
+	seq       sequence
+	mutations map[syncMutationKey]model.SyncMutation
+	now       func() time.Time
+}
+
+// NewSyncMutationRepository...Repository interfaceを返すことでserviceとメソッドを揃える
+func NewSyncMutationRepository() repository.SyncMutationRepository {
+	return &syncMutationRepository{mutations: map[syncMutationKey]model.SyncMutation{}, now: time.Now}
+}
+
+// Get...memberが送ったclient_idの変更を取得する
+func (r *syncMutationRepository) Get(ctx context.Context, memberId domain.Id, clientId string) (model.SyncMutation, error) {
+	if err := ctx.Err(); err != nil {
+		return model.SyncMutation{}, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	v, ok := r.mutations[syncMutationKey{memberId, clientId}]
+	if !ok {
+		return model.SyncMutation{}, ErrNotFound
+	}
+	return v, nil
+}
+
+// Save...変更を記録する. 同じmemberとclient_idならErrDuplicateKey
+func (r *syncMutationRepository) Save(ctx context.Context, mutation *model.SyncMutation) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := syncMutationKey{mutation.MemberId, mutation.ClientId}
+	if _, ok := r.mutations[key]; ok {
+		return ErrDuplicateKey
+	}
+	mutation.ID = r.seq.next(0)
+	mutation.CreatedAt = r.now()
+	r.mutations[key] = *mutation
+	return nil
+}
+
+// snapshot...TxManagerのrollbackのために今の状態をcopyする
+func (r *syncMutationRepository) snapshot() func() {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	seq := r.seq
+	mutations := make(map[syncMutationKey]model.SyncMutation, len(r.mutations))
+	for k, v := range r.mutations {
+		mutations[k] = v
+	}
+
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.seq = seq
+		r.mutations = mutations
+	}
+}
@@ -0,0 +1,229 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/domain/model"
+	"github.com/sioncojp/famili-api/domain/repository"
+)
+
+// todoRepository...プロセス内でtodoを持つ. ローカル開発やデモで使う
+// gormの実装と同じく、ctxがcancelされていればctx.Err()を返す
+type todoRepository struct {
+	mu        sync.RWMutex
+	seq       sequence
+	todos     map[uint]model.Todo
+	assignees map[uint][]uint
+	now       func() time.Time
+}
+
+// NewTodoRepository...Repository interfaceを返すことでserviceとメソッドを揃える
+func NewTodoRepository() repository.TodoRepository {
+	return &todoRepository{
+		todos:     map[uint]model.Todo{},
+		assignees: map[uint][]uint{},
+		now:       time.Now,
+	}
+}
+
+// GetById...IDからtodoを取得する
+func (r *todoRepository) GetById(ctx context.Context, id domain.Id) (model.Todo, error) {
+	if err := ctx.Err(); err != nil {
+		return model.Todo{}, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	v, ok := parseId(id)
+	if !ok {
+		return model.Todo{}, ErrNotFound
+	}
+	todo, ok := r.todos[v]
+	if !ok {
+		return model.Todo{}, ErrNotFound
+	}
+	return r.withAssignees(todo), nil
+}
+
+// GetByShareToken...share tokenから公開されているtodoを取得する
+func (r *todoRepository) GetByShareToken(ctx context.Context, token string) (model.Todo, error) {
+	if err := ctx.Err(); err != nil {
+		return model.Todo{}, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, v := range r.sorted() {
+		if v.ShareToken == token && v.Visibility == model.VisibilityPublic {
+			return v, nil
+		}
+	}
+	return model.Todo{}, ErrNotFound
+}
+
+// List...callerが見れるtodoを全て取得する
+func (r *todoRepository) List(ctx context.Context, caller domain.Caller) ([]model.Todo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := []model.Todo{}
+	for _, v := range r.sorted() {
+		if v.VisibleTo(caller) {
+			result = append(result, r.withAssignees(v))
+		}
+	}
+	return result, nil
+}
+
+// ListByAssignee...callerが見れるtodoのうち、memberIdがassigneeのものを取得する
+func (r *todoRepository) ListByAssignee(ctx context.Context, caller domain.Caller, memberId domain.Id) ([]model.Todo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := []model.Todo{}
+	id, ok := parseId(memberId)
+	if !ok {
+		return result, nil
+	}
+	for _, v := range r.sorted() {
+		if !v.VisibleTo(caller) {
+			continue
+		}
+		for _, assignee := range r.assignees[v.ID] {
+			if assignee == id {
+				result = append(result, r.withAssignees(v))
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+// Create...todoを作成する. IDとCreatedAt/UpdatedAtはtodoにも反映する
+func (r *todoRepository) Create(ctx context.Context, todo *model.Todo) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.todos[todo.ID]; ok && todo.ID != 0 {
+		return ErrDuplicateKey
+	}
+	todo.ID = r.seq.next(todo.ID)
+	touchCreate(&todo.Model, r.now())
+	r.todos[todo.ID] = r.stored(*todo)
+	return nil
+}
+
+// Update...todoを更新する. gormのSaveと同じく、存在しなければ作成する
+func (r *todoRepository) Update(ctx context.Context, todo *model.Todo) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current, ok := r.todos[todo.ID]
+	if !ok || todo.ID == 0 {
+		todo.ID = r.seq.next(todo.ID)
+		touchCreate(&todo.Model, r.now())
+	} else {
+		touchUpdate(&todo.Model, current.Model, r.now())
+	}
+	r.todos[todo.ID] = r.stored(*todo)
+	return nil
+}
+
+// Delete...todoを削除する. MySQLのON DELETE CASCADEと同じくassigneeも消す
+func (r *todoRepository) Delete(ctx context.Context, todo *model.Todo) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.todos, todo.ID)
+	delete(r.assignees, todo.ID)
+	return nil
+}
+
+// SetAssignees...todoのassigneeをAssigneeIdsで置き換える
+func (r *todoRepository) SetAssignees(ctx context.Context, todo *model.Todo) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.todos[todo.ID]; !ok {
+		return ErrNotFound
+	}
+	if len(todo.AssigneeIds) == 0 {
+		delete(r.assignees, todo.ID)
+		return nil
+	}
+	r.assignees[todo.ID] = append([]uint{}, todo.AssigneeIds...)
+	return nil
+}
+
+// stored...assigneeは別に持つので外して保存する
+func (r *todoRepository) stored(todo model.Todo) model.Todo {
+	todo.AssigneeIds = nil
+	return todo
+}
+
+// withAssignees...todoにAssigneeIdsを詰める. 呼び出し側で書き換えられても良いようにcopyする
+func (r *todoRepository) withAssignees(todo model.Todo) model.Todo {
+	todo.AssigneeIds = append([]uint{}, r.assignees[todo.ID]...)
+	return todo
+}
+
+// sorted...MySQLと同じくposition, ID順で返す
+func (r *todoRepository) sorted() []model.Todo {
+	result := make([]model.Todo, 0, len(r.todos))
+	for _, v := range r.todos {
+		result = append(result, v)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Position != result[j].Position {
+			return result[i].Position < result[j].Position
+		}
+		return result[i].ID < result[j].ID
+	})
+	return result
+}
+
+// snapshot...TxManagerのrollbackのために今の状態をcopyする
+func (r *todoRepository) snapshot() func() {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	seq := r.seq
+	todos := make(map[uint]model.Todo, len(r.todos))
+	for k, v := range r.todos {
+		todos[k] = v
+	}
+	assignees := make(map[uint][]uint, len(r.assignees))
+	for k, v := range r.assignees {
+		assignees[k] = append([]uint{}, v...)
+	}
+
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.seq = seq
+		r.todos = todos
+		r.assignees = assignees
+	}
+}
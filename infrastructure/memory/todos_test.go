@@ -0,0 +1,194 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/domain/model"
+)
+
+var (
+	ctx = context.Background()
+
+	papa  = domain.Caller{MemberId: "1", FamilyId: "f1"}
+	mama  = domain.Caller{MemberId: "2", FamilyId: "f1"}
+	other = domain.Caller{MemberId: "3", FamilyId: "f2"}
+)
+
+func newTodo(caller domain.Caller, visibility model.Visibility) *model.Todo {
+	return &model.Todo{
+		Title:       "title",
+		Description: "description",
+		CreatedBy:   caller.MemberId,
+		FamilyId:    caller.FamilyId,
+		Visibility:  visibility,
+	}
+}
+
+func TestTodoCreateAndGet(t *testing.T) {
+	t.Parallel()
+	r := NewTodoRepository()
+
+	first := newTodo(papa, model.VisibilityFamily)
+	second := newTodo(papa, model.VisibilityFamily)
+	require.NoError(t, r.Create(ctx, first))
+	require.NoError(t, r.Create(ctx, second))
+	assert.Equal(t, uint(1), first.ID, "unexpected ID")
+	assert.Equal(t, uint(2), second.ID, "unexpected ID")
+	assert.False(t, first.CreatedAt.IsZero(), "CreatedAt should be set")
+	assert.False(t, first.UpdatedAt.IsZero(), "UpdatedAt should be set")
+
+	got, err := r.GetById(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, first.Title, got.Title)
+	assert.Equal(t, []uint{}, got.AssigneeIds)
+
+	_, err = r.GetById(ctx, "100")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = r.GetById(ctx, "abc")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestTodoUpdate(t *testing.T) {
+	t.Parallel()
+	r := NewTodoRepository().(*todoRepository)
+	now := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	r.now = func() time.Time { return now }
+
+	todo := newTodo(papa, model.VisibilityFamily)
+	require.NoError(t, r.Create(ctx, todo))
+
+	now = now.Add(time.Hour)
+	updated := model.Todo{Model: model.Model{ID: todo.ID}, Title: "updated", Visibility: model.VisibilityFamily}
+	require.NoError(t, r.Update(ctx, &updated))
+
+	got, err := r.GetById(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, "updated", got.Title)
+	assert.Equal(t, todo.CreatedAt, got.CreatedAt, "CreatedAt should be kept")
+	assert.Equal(t, now, got.UpdatedAt, "UpdatedAt should be updated")
+}
+
+func TestTodoListVisibility(t *testing.T) {
+	t.Parallel()
+	r := NewTodoRepository()
+	require.NoError(t, r.Create(ctx, newTodo(papa, model.VisibilityPrivate)))
+	require.NoError(t, r.Create(ctx, newTodo(papa, model.VisibilityFamily)))
+	require.NoError(t, r.Create(ctx, newTodo(mama, model.VisibilityPublic)))
+	require.NoError(t, r.Create(ctx, newTodo(other, model.VisibilityFamily)))
+	// 作成者とfamilyが空のtodo. 匿名のcallerのIDとも一致しない
+	require.NoError(t, r.Create(ctx, newTodo(domain.Caller{}, model.VisibilityPrivate)))
+
+	cases := []struct {
+		name   string
+		caller domain.Caller
+		want   []uint
+	}{
+		{"creator sees private", papa, []uint{1, 2, 3}},
+		{"family", mama, []uint{2, 3}},
+		{"other family", other, []uint{4}},
+		{"anonymous", domain.Caller{}, []uint{}},
+	}
+
+	for _, v := range cases {
+		todos, err := r.List(ctx, v.caller)
+		require.NoError(t, err, v.name)
+		ids := []uint{}
+		for _, todo := range todos {
+			ids = append(ids, todo.ID)
+		}
+		assert.Equal(t, v.want, ids, v.name)
+	}
+}
+
+func TestTodoAssigneesAndDelete(t *testing.T) {
+	t.Parallel()
+	r := NewTodoRepository()
+	todo := newTodo(papa, model.VisibilityFamily)
+	require.NoError(t, r.Create(ctx, todo))
+	require.NoError(t, r.Create(ctx, newTodo(papa, model.VisibilityFamily)))
+
+	todo.AssigneeIds = []uint{2}
+	require.NoError(t, r.SetAssignees(ctx, todo))
+
+	todos, err := r.ListByAssignee(ctx, papa, "2")
+	require.NoError(t, err)
+	require.Len(t, todos, 1)
+	assert.Equal(t, []uint{2}, todos[0].AssigneeIds)
+
+	// 返したsliceを書き換えても保存されている値は変わらない
+	todos[0].AssigneeIds[0] = 100
+	got, err := r.GetById(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, []uint{2}, got.AssigneeIds)
+
+	require.NoError(t, r.Delete(ctx, todo))
+	_, err = r.GetById(ctx, "1")
+	assert.ErrorIs(t, err, ErrNotFound)
+	todos, err = r.ListByAssignee(ctx, papa, "2")
+	require.NoError(t, err)
+	assert.Empty(t, todos)
+
+	assert.ErrorIs(t, r.SetAssignees(ctx, todo), ErrNotFound)
+}
+
+func TestTodoGetByShareToken(t *testing.T) {
+	t.Parallel()
+	r := NewTodoRepository()
+	public := newTodo(papa, model.VisibilityPublic)
+	public.ShareToken = "public-token"
+	family := newTodo(papa, model.VisibilityFamily)
+	family.ShareToken = "stale-token"
+	require.NoError(t, r.Create(ctx, public))
+	require.NoError(t, r.Create(ctx, family))
+
+	got, err := r.GetByShareToken(ctx, "public-token")
+	require.NoError(t, err)
+	assert.Equal(t, public.ID, got.ID)
+
+	_, err = r.GetByShareToken(ctx, "stale-token")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestTodoCanceledContext(t *testing.T) {
+	t.Parallel()
+	r := NewTodoRepository()
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	assert.ErrorIs(t, r.Create(canceled, newTodo(papa, model.VisibilityFamily)), context.Canceled)
+	_, err := r.List(canceled, papa)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	todos, err := r.List(ctx, papa)
+	require.NoError(t, err)
+	assert.Empty(t, todos, "canceled create should not be stored")
+}
+
+func TestTodoConcurrentCreate(t *testing.T) {
+	t.Parallel()
+	r := NewTodoRepository()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, r.Create(ctx, newTodo(papa, model.VisibilityFamily)))
+		}()
+	}
+	wg.Wait()
+
+	todos, err := r.List(ctx, papa)
+	require.NoError(t, err)
+	require.Len(t, todos, 50)
+	for i, v := range todos {
+		assert.Equal(t, uint(i+1), v.ID, "IDs should be unique and sequential")
+	}
+}
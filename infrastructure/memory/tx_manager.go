@@ -0,0 +1,70 @@
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"github.com/sioncojp/famili-api/domain/repository"
+)
+
+// txKey...contextにtransaction中であることを入れるためのkey
+type txKey struct{}
+
+// snapshotter...transactionの開始時点の状態を保存し、rollbackで戻せるrepository
+type snapshotter interface {
+	// snapshot...今の状態をcopyし、その状態に戻す関数を返す
+	snapshot() (restore func())
+}
+
+// txManager...メモリのrepositoryをまとめてrollbackする. transactionは1つずつ実行する
+// transactionの外からの書き込みはrollbackで消えることがあるので、ローカル開発やテストで使う
+type txManager struct {
+	mu    sync.Mutex
+	repos repository.Repositories
+}
+
+// NewTxManager...TxManager interfaceを返すことでgormの実装と差し替えられる
+// snapshotを取れないrepository(mockなど)はrollbackされずにそのまま渡す
+func NewTxManager(repos repository.Repositories) repository.TxManager {
+	return &txManager{repos: repos}
+}
+
+// Do...fnがerrorを返すかpanicしたら開始時点に戻す. 入れ子のDoはsavepointとして内側だけ戻す
+func (m *txManager) Do(ctx context.Context, fn repository.TxFunc) (err error) {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if ctx.Value(txKey{}) == nil {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		ctx = context.WithValue(ctx, txKey{}, true)
+	}
+
+	restore := m.snapshot()
+	panicked := true
+	defer func() {
+		if panicked || err != nil {
+			restore()
+		}
+	}()
+
+	err = fn(ctx, m.repos)
+	panicked = false
+	return err
+}
+
+// snapshot...全てのrepositoryのsnapshotを取る
+func (m *txManager) snapshot() func() {
+	var restores []func()
+	for _, v := range []interface{}{m.repos.Todos, m.repos.Members, m.repos.Outbox, m.repos.Changes, m.repos.SyncMutations, m.repos.Accounts} {
+		if s, ok := v.(snapshotter); ok {
+			restores = append(restores, s.snapshot())
+		}
+	}
+
+	return func() {
+		for _, restore := range restores {
+			restore()
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sioncojp/famili-api/domain/model"
+	"github.com/sioncojp/famili-api/domain/repository"
+)
+
+var errRollback = errors.New("rollback")
+
+func newTestTxManager() (repository.TxManager, repository.Repositories) {
+	repos := repository.Repositories{Todos: NewTodoRepository(), Members: NewMemberRepository(), Outbox: NewOutboxRepository()}
+	return NewTxManager(repos), repos
+}
+
+func countTodos(t *testing.T, repos repository.Repositories) int {
+	todos, err := repos.Todos.List(ctx, papa)
+	require.NoError(t, err)
+	return len(todos)
+}
+
+func TestTxManagerCommitAndRollback(t *testing.T) {
+	t.Parallel()
+	tx, repos := newTestTxManager()
+
+	err := tx.Do(ctx, func(ctx context.Context, r repository.Repositories) error {
+		require.NoError(t, r.Members.Create(ctx, &model.Member{Name: "papa", FamilyId: "f1"}))
+		return r.Todos.Create(ctx, newTodo(papa, model.VisibilityFamily))
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, countTodos(t, repos))
+
+	err = tx.Do(ctx, func(ctx context.Context, r repository.Repositories) error {
+		require.NoError(t, r.Members.Create(ctx, &model.Member{Name: "mama", FamilyId: "f1"}))
+		require.NoError(t, r.Todos.Create(ctx, newTodo(papa, model.VisibilityFamily)))
+		return errRollback
+	})
+	assert.ErrorIs(t, err, errRollback)
+	assert.Equal(t, 1, countTodos(t, repos), "todo should be rolled back")
+	members, err := repos.Members.List(context.Background(), "f1")
+	require.NoError(t, err)
+	assert.Len(t, members, 1, "member should be rolled back")
+
+	// rollbackしたIDは再利用される
+	todo := newTodo(papa, model.VisibilityFamily)
+	require.NoError(t, repos.Todos.Create(ctx, todo))
+	assert.Equal(t, uint(2), todo.ID)
+}
+
+func TestTxManagerRollbackOnPanic(t *testing.T) {
+	t.Parallel()
+	tx, repos := newTestTxManager()
+
+	assert.PanicsWithValue(t, "boom", func() {
+		_ = tx.Do(ctx, func(ctx context.Context, r repository.Repositories) error {
+			require.NoError(t, r.Todos.Create(ctx, newTodo(papa, model.VisibilityFamily)))
+			panic("boom")
+		})
+	})
+	assert.Equal(t, 0, countTodos(t, repos), "todo should be rolled back")
+
+	// panicの後もlockが解放されている
+	require.NoError(t, tx.Do(ctx, func(ctx context.Context, r repository.Repositories) error { return nil }))
+}
+
+func TestTxManagerNested(t *testing.T) {
+	t.Parallel()
+	tx, repos := newTestTxManager()
+
+	err := tx.Do(ctx, func(ctx context.Context, r repository.Repositories) error {
+		require.NoError(t, r.Todos.Create(ctx, newTodo(papa, model.VisibilityFamily)))
+
+		// 内側のrollbackはsavepointまで戻すだけ
+		err := tx.Do(ctx, func(ctx context.Context, r repository.Repositories) error {
+			require.NoError(t, r.Todos.Create(ctx, newTodo(papa, model.VisibilityFamily)))
+			return errRollback
+		})
+		assert.ErrorIs(t, err, errRollback)
+		assert.Equal(t, 1, countTodos(t, repos))
+
+		return tx.Do(ctx, func(ctx context.Context, r repository.Repositories) error {
+			return r.Todos.Create(ctx, newTodo(papa, model.VisibilityFamily))
+		})
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, countTodos(t, repos))
+
+	// 外側がrollbackすれば内側でcommitしたものも戻る
+	err = tx.Do(ctx, func(ctx context.Context, r repository.Repositories) error {
+		require.NoError(t, tx.Do(ctx, func(ctx context.Context, r repository.Repositories) error {
+			return r.Todos.Create(ctx, newTodo(papa, model.VisibilityFamily))
+		}))
+		return errRollback
+	})
+	assert.ErrorIs(t, err, errRollback)
+	assert.Equal(t, 2, countTodos(t, repos))
+}
+
+func TestTxManagerRollbackOutbox(t *testing.T) {
+	t.Parallel()
+	tx, repos := newTestTxManager()
+	todo := newTodo(papa, model.VisibilityFamily)
+
+	require.NoError(t, repos.Outbox.Add(ctx, todo.Events(model.EventTodoCreated)...))
+	err := tx.Do(ctx, func(ctx context.Context, r repository.Repositories) error {
+		// transactionの外で配信済みになったeventはrollbackで戻らない
+		require.NoError(t, r.Outbox.MarkDelivered(ctx, 1))
+		require.NoError(t, r.Outbox.Add(ctx, todo.Events(model.EventTodoUpdated)...))
+		return errRollback
+	})
+	assert.ErrorIs(t, err, errRollback)
+
+	events, err := repos.Outbox.Pending(ctx, time.Now(), 10)
+	require.NoError(t, err)
+	assert.Empty(t, events, "event added in the transaction should be rolled back")
+
+	require.NoError(t, repos.Outbox.Add(ctx, todo.Events(model.EventTodoDeleted)...))
+	events, err = repos.Outbox.Pending(ctx, time.Now(), 10)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, uint(2), events[0].ID, "rolled back ID should be reused")
+}
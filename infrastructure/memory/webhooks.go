@@ -0,0 +1,229 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/domain/model"
+	"github.com/sioncojp/famili-api/domain/repository"
+)
+
+// webhookRepository...プロセス内でwebhookと配信の記録を持つ
+type webhookRepository struct {
+	mu          sync.RWMutex
+	seq         sequence
+	webhooks    map[uint]model.Webhook
+	deliverySeq sequence
+	deliveries  map[uint]model.WebhookDelivery
+	now         func() time.Time
+}
+
+// NewWebhookRepository...Repository interfaceを返すことでserviceとメソッドを揃える
+func NewWebhookRepository() repository.WebhookRepository {
+	return &webhookRepository{
+		webhooks:   map[uint]model.Webhook{},
+		deliveries: map[uint]model.WebhookDelivery{},
+		now:        time.Now,
+	}
+}
+
+// GetById...IDからwebhookを取得する
+func (r *webhookRepository) GetById(ctx context.Context, id domain.Id) (model.Webhook, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	v, ok := parseId(id)
+	if !ok {
+		return model.Webhook{}, ErrNotFound
+	}
+	webhook, ok := r.webhooks[v]
+	if !ok {
+		return model.Webhook{}, ErrNotFound
+	}
+	return webhook, nil
+}
+
+// List...familyのwebhookを全て取得する
+func (r *webhookRepository) List(ctx context.Context, familyId domain.Id) ([]model.Webhook, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := []model.Webhook{}
+	for _, v := range r.webhooks {
+		if v.FamilyId == familyId {
+			result = append(result, v)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result, nil
+}
+
+// Create...webhookを作成する
+func (r *webhookRepository) Create(ctx context.Context, webhook *model.Webhook) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.webhooks[webhook.ID]; ok && webhook.ID != 0 {
+		return ErrDuplicateKey
+	}
+	webhook.ID = r.seq.next(webhook.ID)
+	touchCreate(&webhook.Model, r.now())
+	r.webhooks[webhook.ID] = r.stored(*webhook)
+	return nil
+}
+
+// Update...webhookを更新する. gormのSaveと同じく、存在しなければ作成する
+func (r *webhookRepository) Update(ctx context.Context, webhook *model.Webhook) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current, ok := r.webhooks[webhook.ID]
+	if !ok || webhook.ID == 0 {
+		webhook.ID = r.seq.next(webhook.ID)
+		touchCreate(&webhook.Model, r.now())
+	} else {
+		touchUpdate(&webhook.Model, current.Model, r.now())
+	}
+	r.webhooks[webhook.ID] = r.stored(*webhook)
+	return nil
+}
+
+// Delete...webhookを削除する. MySQLのON DELETE CASCADEと同じく配信の記録も消す
+func (r *webhookRepository) Delete(ctx context.Context, webhook *model.Webhook) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.webhooks, webhook.ID)
+	for id, v := range r.deliveries {
+		if v.WebhookId == webhook.ID {
+			delete(r.deliveries, id)
+		}
+	}
+	return nil
+}
+
+// RecordSuccess...連続失敗回数を0に戻す
+func (r *webhookRepository) RecordSuccess(ctx context.Context, id uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	webhook, ok := r.webhooks[id]
+	if !ok {
+		return nil
+	}
+	webhook.Failures = 0
+	r.webhooks[id] = webhook
+	return nil
+}
+
+// RecordFailure...連続失敗回数を増やし、disableAfter回以上なら無効にする
+func (r *webhookRepository) RecordFailure(ctx context.Context, id uint, disableAfter int, now time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	webhook, ok := r.webhooks[id]
+	if !ok {
+		return false, nil
+	}
+	webhook.Failures++
+	disabled := false
+	if webhook.Failures >= disableAfter && webhook.DisabledAt == nil {
+		webhook.DisabledAt = &now
+		disabled = true
+	}
+	r.webhooks[id] = webhook
+	return disabled, nil
+}
+
+// Enqueue...配信を追加する. MySQLのUNIQUE INDEXと同じく、同じwebhookとeventの配信は追加しない
+func (r *webhookRepository) Enqueue(ctx context.Context, deliveries ...model.WebhookDelivery) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, v := range deliveries {
+		if v.EventId != nil && r.enqueued(v.WebhookId, *v.EventId) {
+			continue
+		}
+		v.ID = r.deliverySeq.next(v.ID)
+		touchCreate(&v.Model, r.now())
+		r.deliveries[v.ID] = v
+	}
+	return nil
+}
+
+// enqueued...同じwebhookとeventの配信があるか
+func (r *webhookRepository) enqueued(webhookId, eventId uint) bool {
+	for _, v := range r.deliveries {
+		if v.WebhookId == webhookId && v.EventId != nil && *v.EventId == eventId {
+			return true
+		}
+	}
+	return false
+}
+
+// PendingDeliveries...pendingでNextAttemptAtを過ぎた配信を古い順にlimit件取得する
+func (r *webhookRepository) PendingDeliveries(ctx context.Context, now time.Time, limit int) ([]model.WebhookDelivery, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := []model.WebhookDelivery{}
+	for _, v := range r.deliveries {
+		if v.Status == model.DeliveryPending && !v.NextAttemptAt.After(now) {
+			result = append(result, v)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
+
+// SaveDelivery...配信の結果を保存する. IDが0なら追加する
+func (r *webhookRepository) SaveDelivery(ctx context.Context, delivery *model.WebhookDelivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current, ok := r.deliveries[delivery.ID]
+	if !ok || delivery.ID == 0 {
+		delivery.ID = r.deliverySeq.next(delivery.ID)
+		touchCreate(&delivery.Model, r.now())
+	} else {
+		touchUpdate(&delivery.Model, current.Model, r.now())
+	}
+	r.deliveries[delivery.ID] = *delivery
+	return nil
+}
+
+// ListDeliveries...webhookの配信を新しい順にlimit件取得する
+func (r *webhookRepository) ListDeliveries(ctx context.Context, webhookId uint, limit int) ([]model.WebhookDelivery, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := []model.WebhookDelivery{}
+	for _, v := range r.deliveries {
+		if v.WebhookId == webhookId {
+			result = append(result, v)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID > result[j].ID })
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
+
+// stored...平文のsecretは保存しない
+func (r *webhookRepository) stored(webhook model.Webhook) model.Webhook {
+	webhook.PlainSecret = ""
+	return webhook
+}
@@ -0,0 +1,147 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/sioncojp/famili-api/domain/model"
+	"github.com/sioncojp/famili-api/domain/repository"
+)
+
+const (
+	// retryBaseDelay, retryMaxDelay...配信に失敗したら1秒から倍々で待ち、10分で頭打ちにする
+	retryBaseDelay = time.Second
+	retryMaxDelay  = 10 * time.Minute
+
+	// sendTimeout...1つのeventを全てのsinkに送るまでの上限
+	sendTimeout = 10 * time.Second
+)
+
+// Sink...eventの配信先
+type Sink interface {
+	Name() string
+	Send(ctx context.Context, event model.Event) error
+}
+
+// Relay...outboxのeventを取り出してsinkに配信する
+// sinkに送ってから配信済みにするので、途中で落ちると同じeventをもう一度送る(at-least-once)
+// 1つでもsinkが失敗したらeventごとやり直すので、成功したsinkにも重複して届く
+// 複数台で動かしても、eventはClaimした1台だけが配信する. streamのsinkはその台の接続にしか届かない
+type Relay struct {
+	repo        repository.OutboxRepository
+	sinks       []Sink
+	batchSize   int
+	maxAttempts int
+	logger      *zap.Logger
+	now         func() time.Time
+}
+
+// NewRelay...batchSize件ずつ取り出してsinksに配信するRelayを作る. maxAttempts回失敗したeventはfailedにしてやめる
+func NewRelay(repo repository.OutboxRepository, sinks []Sink, batchSize, maxAttempts int, logger *zap.Logger) *Relay {
+	return &Relay{
+		repo:        repo,
+		sinks:       sinks,
+		batchSize:   batchSize,
+		maxAttempts: maxAttempts,
+		logger:      logger,
+		now:         time.Now,
+	}
+}
+
+// Run...ctxがcancelされるまでintervalごとにoutboxを見る. 1回でbatchSize件取れたら待たずに続ける
+func (r *Relay) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		n, err := r.RunOnce(ctx)
+		if err != nil && ctx.Err() == nil {
+			r.logger.Warn("outbox relay failed", zap.Error(err))
+		}
+		if err == nil && n >= r.batchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce...配信できるeventを1batch分配信し、取り出した件数を返す
+// 失敗したeventはbackoffして次の機会にやり直し、maxAttempts回目でfailedにする
+func (r *Relay) RunOnce(ctx context.Context) (int, error) {
+	events, err := r.repo.Claim(ctx, r.now(), r.lease(), r.batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, v := range events {
+		if err := r.send(ctx, v); err != nil {
+			if v.Attempts+1 >= r.maxAttempts {
+				r.logger.Error("outbox delivery gave up",
+					zap.Uint("event_id", v.ID),
+					zap.String("type", string(v.Type)),
+					zap.Int("attempts", v.Attempts+1),
+					zap.Error(err),
+				)
+				if err := r.repo.MarkDead(ctx, v.ID, err.Error()); err != nil {
+					return len(events), err
+				}
+				continue
+			}
+			retryAt := r.now().Add(backoff(v.Attempts + 1))
+			r.logger.Warn("outbox delivery failed",
+				zap.Uint("event_id", v.ID),
+				zap.String("type", string(v.Type)),
+				zap.Int("attempts", v.Attempts+1),
+				zap.Time("retry_at", retryAt),
+				zap.Error(err),
+			)
+			if err := r.repo.MarkFailed(ctx, v.ID, retryAt, err.Error()); err != nil {
+				return len(events), err
+			}
+			continue
+		}
+		if err := r.repo.MarkDelivered(ctx, v.ID); err != nil {
+			return len(events), err
+		}
+	}
+	return len(events), nil
+}
+
+// lease...Claimしたeventを他の台が取り出さない時間. batchの全てのeventがsendTimeoutまでかかっても配信し終わる
+// 配信中に落ちたら、leaseが切れた後に他の台がやり直す
+func (r *Relay) lease() time.Duration {
+	return sendTimeout * time.Duration(r.batchSize)
+}
+
+// send...eventを全てのsinkに送り、最初に失敗したsinkのerrorを返す
+func (r *Relay) send(ctx context.Context, event model.Event) error {
+	ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+
+	var first error
+	for _, s := range r.sinks {
+		if err := s.Send(ctx, event); err != nil && first == nil {
+			first = errors.Wrapf(err, "sink %s", s.Name())
+		}
+	}
+	return first
+}
+
+// backoff...attempts回目の失敗の後に待つ時間
+func backoff(attempts int) time.Duration {
+	delay := retryBaseDelay
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= retryMaxDelay {
+			return retryMaxDelay
+		}
+	}
+	return delay
+}
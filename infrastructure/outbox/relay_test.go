@@ -0,0 +1,170 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/sioncojp/famili-api/domain/model"
+	"github.com/sioncojp/famili-api/infrastructure/memory"
+)
+
+var ctx = context.Background()
+
+// flakySink...failures回失敗してから受け取る
+type flakySink struct {
+	failures int
+	received []model.Event
+}
+
+func (s *flakySink) Name() string {
+	return "flaky"
+}
+
+func (s *flakySink) Send(_ context.Context, event model.Event) error {
+	if s.failures > 0 {
+		s.failures--
+		return errors.New("unavailable")
+	}
+	s.received = append(s.received, event)
+	return nil
+}
+
+func TestBackoff(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, time.Second, backoff(1))
+	assert.Equal(t, 2*time.Second, backoff(2))
+	assert.Equal(t, 8*time.Second, backoff(4))
+	assert.Equal(t, retryMaxDelay, backoff(100))
+}
+
+func TestRelayRetry(t *testing.T) {
+	t.Parallel()
+	repo := memory.NewOutboxRepository()
+	todo := model.Todo{Model: model.Model{ID: 1}, FamilyId: "f1"}
+	require.NoError(t, repo.Add(ctx, todo.Events(model.EventTodoCreated, model.EventTodoDeleted)...))
+
+	ok := &flakySink{}
+	flaky := &flakySink{failures: 1}
+	relay := NewRelay(repo, []Sink{ok, flaky}, 10, 20, zap.NewNop())
+	now := time.Now()
+	relay.now = func() time.Time { return now }
+
+	// 1件目はflakyが失敗するのでやり直す. 成功したsinkにも重複して届く
+	n, err := relay.RunOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Len(t, ok.received, 2)
+	assert.Len(t, flaky.received, 1)
+	assert.Equal(t, model.EventTodoDeleted, flaky.received[0].Type)
+
+	// backoffの間は配信しない
+	n, err = relay.RunOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	now = now.Add(backoff(1))
+	n, err = relay.RunOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Len(t, ok.received, 3)
+	require.Len(t, flaky.received, 2)
+	assert.Equal(t, model.EventTodoCreated, flaky.received[1].Type)
+
+	events, err := repo.Pending(ctx, now.Add(time.Hour), 10)
+	require.NoError(t, err)
+	assert.Empty(t, events)
+}
+
+func TestRelayGiveUp(t *testing.T) {
+	t.Parallel()
+	repo := memory.NewOutboxRepository()
+	todo := model.Todo{Model: model.Model{ID: 1}, FamilyId: "f1"}
+	require.NoError(t, repo.Add(ctx, todo.Events(model.EventTodoCreated)...))
+
+	flaky := &flakySink{failures: 100}
+	relay := NewRelay(repo, []Sink{flaky}, 10, 3, zap.NewNop())
+	now := time.Now()
+	relay.now = func() time.Time { return now }
+
+	// maxAttempts回失敗したらfailedにして、もう取り出さない
+	for i := 1; i <= 3; i++ {
+		n, err := relay.RunOnce(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, n, "attempt %d", i)
+		now = now.Add(retryMaxDelay)
+	}
+	n, err := relay.RunOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+	assert.Equal(t, 97, flaky.failures)
+
+	events, err := repo.Pending(ctx, now.Add(time.Hour), 10)
+	require.NoError(t, err)
+	assert.Empty(t, events)
+}
+
+func TestRelayClaim(t *testing.T) {
+	t.Parallel()
+	repo := memory.NewOutboxRepository()
+	todo := model.Todo{Model: model.Model{ID: 1}, FamilyId: "f1"}
+	require.NoError(t, repo.Add(ctx, todo.Events(model.EventTodoCreated, model.EventTodoUpdated, model.EventTodoDeleted)...))
+
+	// 別の台がClaimしたeventはleaseの間取り出さない
+	now := time.Now()
+	claimed, err := repo.Claim(ctx, now, time.Minute, 2)
+	require.NoError(t, err)
+	require.Len(t, claimed, 2)
+
+	sink := &flakySink{}
+	relay := NewRelay(repo, []Sink{sink}, 10, 20, zap.NewNop())
+	relay.now = func() time.Time { return now }
+	n, err := relay.RunOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	require.Len(t, sink.received, 1)
+	assert.Equal(t, model.EventTodoDeleted, sink.received[0].Type)
+
+	// 配信済みにしないまま落ちたら、leaseが切れた後にやり直す
+	now = now.Add(time.Minute)
+	n, err = relay.RunOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Len(t, sink.received, 3)
+}
+
+func TestRelayRun(t *testing.T) {
+	t.Parallel()
+	repo := memory.NewOutboxRepository()
+	ch := make(chan model.Event)
+	relay := NewRelay(repo, []Sink{NewChannelSink(ch)}, 10, 20, zap.NewNop())
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		relay.Run(ctx, 10*time.Millisecond)
+		close(done)
+	}()
+
+	todo := model.Todo{Model: model.Model{ID: 1}, FamilyId: "f1"}
+	require.NoError(t, repo.Add(ctx, todo.Events(model.EventTodoCompleted)...))
+	select {
+	case got := <-ch:
+		assert.Equal(t, model.EventTodoCompleted, got.Type)
+		assert.Equal(t, uint(1), got.ID)
+	case <-time.After(time.Second):
+		t.Fatal("event was not relayed")
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("relay did not stop")
+	}
+}
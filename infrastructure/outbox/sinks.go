@@ -0,0 +1,103 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/sioncojp/famili-api/domain/model"
+)
+
+// logSink...eventをlogに出す. 配信先を用意する前の確認用
+type logSink struct {
+	logger *zap.Logger
+}
+
+// NewLogSink...eventをinfoで出すSink
+func NewLogSink(logger *zap.Logger) Sink {
+	return &logSink{logger}
+}
+
+func (s *logSink) Name() string {
+	return "log"
+}
+
+// Send...eventをlogに出す
+func (s *logSink) Send(_ context.Context, event model.Event) error {
+	s.logger.Info("todo event",
+		zap.Uint("event_id", event.ID),
+		zap.String("type", string(event.Type)),
+		zap.Uint("todo_id", event.TodoId),
+		zap.String("family_id", string(event.FamilyId)),
+	)
+	return nil
+}
+
+// httpSink...eventをJSONでPOSTする. 2xx以外は失敗としてやり直す
+type httpSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTPSink...urlにeventをPOSTするSink. 受け取る側はX-Famili-Event-Idで重複を除く
+func NewHTTPSink(url string, client *http.Client) Sink {
+	return &httpSink{url, client}
+}
+
+func (s *httpSink) Name() string {
+	return "http"
+}
+
+// Send...eventをPOSTする
+func (s *httpSink) Send(ctx context.Context, event model.Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Famili-Event-Id", strconv.FormatUint(uint64(event.ID), 10))
+	req.Header.Set("X-Famili-Event-Type", string(event.Type))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// channelSink...プロセス内のconsumerにchannelで渡す
+type channelSink struct {
+	ch chan<- model.Event
+}
+
+// NewChannelSink...chにeventを送るSink. consumerが受け取らずにtimeoutしたらやり直す
+func NewChannelSink(ch chan<- model.Event) Sink {
+	return &channelSink{ch}
+}
+
+func (s *channelSink) Name() string {
+	return "channel"
+}
+
+// Send...chにeventを送る
+func (s *channelSink) Send(ctx context.Context, event model.Event) error {
+	select {
+	case s.ch <- event:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
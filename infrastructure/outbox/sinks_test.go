@@ -0,0 +1,39 @@
+package outbox
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sioncojp/famili-api/domain/model"
+)
+
+func TestHTTPSink(t *testing.T) {
+	t.Parallel()
+	status := http.StatusNoContent
+	var got model.Event
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	sink := NewHTTPSink(server.URL, server.Client())
+	event := model.Event{ID: 3, Type: model.EventTodoUpdated, TodoId: 1, FamilyId: "f1", Todo: model.Todo{Title: "t"}}
+	require.NoError(t, sink.Send(ctx, event))
+	assert.Equal(t, "3", header.Get("X-Famili-Event-Id"))
+	assert.Equal(t, "todo.updated", header.Get("X-Famili-Event-Type"))
+	assert.Equal(t, "application/json", header.Get("Content-Type"))
+	assert.Equal(t, event.TodoId, got.TodoId)
+	assert.Equal(t, "t", got.Todo.Title)
+
+	// 2xx以外はやり直すためにerrorを返す
+	status = http.StatusBadGateway
+	assert.Error(t, sink.Send(ctx, event))
+}
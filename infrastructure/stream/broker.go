@@ -0,0 +1,174 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sioncojp/famili-api/domain/model"
+)
+
+// Message...streamに流すevent. IDはSSEのidとして返し、Last-Event-IDで続きから受け取れる
+type Message struct {
+	ID    string
+	Event model.Event
+}
+
+// Subscription...1つのstreamの購読. Cが閉じたら購読は終わる
+type Subscription struct {
+	// C...新しいmessage. 受け取りが遅れてbufferがあふれたか、Brokerを閉じたら閉じる
+	C <-chan Message
+
+	ch     chan Message
+	broker *Broker
+	closed bool
+}
+
+// Broker...outboxのeventをプロセス内のstreamに配る. outbox.Sinkとしてrelayに渡す
+// 直近のmessageをbufferSize件だけ残し、再接続したstreamにLast-Event-IDの続きから送り直す
+// 複数台で動かす場合、relayが配信した台につながっているstreamにしか届かない
+type Broker struct {
+	mu          sync.Mutex
+	epoch       string
+	seq         uint64
+	buffer      []Message
+	bufferSize  int
+	seen        map[uint]struct{}
+	subscribers map[*Subscription]struct{}
+	queueSize   int
+	closed      bool
+}
+
+// NewBroker...直近bufferSize件を残し、streamごとにqueueSize件まで受け取りを待つBrokerを作る
+func NewBroker(bufferSize, queueSize int) *Broker {
+	return &Broker{
+		// 再起動したらseqが戻るので、起動時刻をIDに含めて前のプロセスのIDと区別する
+		epoch:       strconv.FormatInt(time.Now().UnixNano(), 36),
+		bufferSize:  bufferSize,
+		seen:        map[uint]struct{}{},
+		subscribers: map[*Subscription]struct{}{},
+		queueSize:   queueSize,
+	}
+}
+
+func (b *Broker) Name() string {
+	return "stream"
+}
+
+// Send...eventをbufferに残して全てのstreamに配る
+// relayがやり直して同じeventが来ても、bufferに残っている間は重複して配らない
+// 受け取りが遅れてqueueがあふれたstreamは閉じる. clientはLast-Event-IDで再接続すればbufferから続きを受け取れる
+func (b *Broker) Send(_ context.Context, event model.Event) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil
+	}
+	if _, ok := b.seen[event.ID]; ok && event.ID != 0 {
+		return nil
+	}
+
+	b.seq++
+	msg := Message{ID: b.id(b.seq), Event: event}
+	b.buffer = append(b.buffer, msg)
+	b.seen[event.ID] = struct{}{}
+	if len(b.buffer) > b.bufferSize {
+		delete(b.seen, b.buffer[0].Event.ID)
+		b.buffer = b.buffer[1:]
+	}
+
+	for s := range b.subscribers {
+		select {
+		case s.ch <- msg:
+		default:
+			b.unsubscribe(s)
+		}
+	}
+	return nil
+}
+
+// Subscribe...購読を始め、lastEventIdより後のmessageを返す. lastEventIdが空なら何も返さない
+// lastEventIdが前のプロセスのものか、bufferから消えていて続きを返せなければokがfalseになる
+func (b *Broker) Subscribe(lastEventId string) (sub *Subscription, replay []Message, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan Message, b.queueSize)
+	sub = &Subscription{C: ch, ch: ch, broker: b}
+	if b.closed {
+		sub.closed = true
+		close(ch)
+		return sub, nil, true
+	}
+	b.subscribers[sub] = struct{}{}
+
+	if lastEventId == "" {
+		return sub, nil, true
+	}
+	seq, ok := b.parse(lastEventId)
+	if !ok || seq > b.seq {
+		return sub, nil, false
+	}
+	// bufferの先頭より前のmessageは消えている
+	first := b.seq - uint64(len(b.buffer)) + 1
+	if seq+1 < first {
+		return sub, nil, false
+	}
+	replay = append(replay, b.buffer[seq+1-first:]...)
+	return sub, replay, true
+}
+
+// Close...全ての購読を終わらせ、以降のeventを配らない. serverのshutdownで呼ぶ
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for s := range b.subscribers {
+		b.unsubscribe(s)
+	}
+}
+
+// Closed...Closeしたかどうか. 購読が閉じた理由がshutdownか受け取りの遅れかを見分ける
+func (b *Broker) Closed() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.closed
+}
+
+// Close...購読をやめる
+func (s *Subscription) Close() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	s.broker.unsubscribe(s)
+}
+
+// unsubscribe...購読を外してCを閉じる. b.muを持って呼ぶ
+func (b *Broker) unsubscribe(s *Subscription) {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	delete(b.subscribers, s)
+	close(s.ch)
+}
+
+// id...{epoch}-{seq}
+func (b *Broker) id(seq uint64) string {
+	return fmt.Sprintf("%s-%d", b.epoch, seq)
+}
+
+// parse...このプロセスが返したIDならseqを返す
+func (b *Broker) parse(id string) (uint64, bool) {
+	epoch, seq, found := strings.Cut(id, "-")
+	if !found || epoch != b.epoch {
+		return 0, false
+	}
+	v, err := strconv.ParseUint(seq, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return v, true
+}
@@ -0,0 +1,89 @@
+package stream
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sioncojp/famili-api/domain/model"
+)
+
+var ctx = context.Background()
+
+func event(id uint) model.Event {
+	return model.Event{ID: id, Type: model.EventTodoCreated, TodoId: id, FamilyId: "f1"}
+}
+
+func TestBrokerReplay(t *testing.T) {
+	t.Parallel()
+	b := NewBroker(3, 10)
+	for i := uint(1); i <= 5; i++ {
+		require.NoError(t, b.Send(ctx, event(i)))
+	}
+	// relayがやり直した同じeventは配らない
+	require.NoError(t, b.Send(ctx, event(5)))
+
+	// 最初の接続では送り直さない
+	sub, replay, ok := b.Subscribe("")
+	assert.True(t, ok)
+	assert.Empty(t, replay)
+	sub.Close()
+
+	// bufferに残っている続きを送り直す
+	sub, replay, ok = b.Subscribe(b.id(3))
+	assert.True(t, ok)
+	require.Len(t, replay, 2)
+	assert.Equal(t, uint(4), replay[0].Event.ID)
+	assert.Equal(t, b.id(5), replay[1].ID)
+	sub.Close()
+
+	sub, replay, ok = b.Subscribe(b.id(2))
+	assert.True(t, ok)
+	assert.Len(t, replay, 3)
+	sub.Close()
+
+	sub, replay, ok = b.Subscribe(b.id(5))
+	assert.True(t, ok)
+	assert.Empty(t, replay)
+	sub.Close()
+
+	// bufferから消えた、前のプロセスの、壊れたIDは続きを返せない
+	for _, id := range []string{b.id(1), "0-3", "x", b.id(100)} {
+		sub, replay, ok = b.Subscribe(id)
+		assert.False(t, ok, id)
+		assert.Empty(t, replay, id)
+		sub.Close()
+	}
+}
+
+func TestBrokerFanOut(t *testing.T) {
+	t.Parallel()
+	b := NewBroker(10, 1)
+	fast, _, _ := b.Subscribe("")
+	slow, _, _ := b.Subscribe("")
+	defer fast.Close()
+
+	require.NoError(t, b.Send(ctx, event(1)))
+	msg := <-fast.C
+	assert.Equal(t, uint(1), msg.Event.ID)
+
+	// 受け取らないstreamはqueueがあふれたら閉じる. 他のstreamには届き続ける
+	require.NoError(t, b.Send(ctx, event(2)))
+	msg = <-fast.C
+	assert.Equal(t, uint(2), msg.Event.ID)
+	<-slow.C
+	_, open := <-slow.C
+	assert.False(t, open)
+	slow.Close()
+
+	// Closeしたら全ての購読が終わり、新しい購読もすぐに終わる
+	b.Close()
+	_, open = <-fast.C
+	assert.False(t, open)
+	sub, _, _ := b.Subscribe("")
+	_, open = <-sub.C
+	assert.False(t, open)
+	require.NoError(t, b.Send(ctx, event(3)))
+}
@@ -0,0 +1,303 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/domain/model"
+	"github.com/sioncojp/famili-api/domain/repository"
+	"github.com/sioncojp/famili-api/utils/secure"
+)
+
+const (
+	// retryBaseDelay, retryMaxDelay...配信に失敗したら10秒から倍々で待ち、1時間で頭打ちにする
+	retryBaseDelay = 10 * time.Second
+	retryMaxDelay  = time.Hour
+
+	// lastErrorLength...last_errorのカラムの長さ
+	lastErrorLength = 255
+
+	// responseBodyLimit...接続を使い回すために読み捨てるresponse bodyの上限
+	responseBodyLimit = 64 << 10
+)
+
+var (
+	// errDisabled...webhookが無効になった後に残っていた配信
+	errDisabled = errors.New("webhook is disabled")
+	// errForbiddenAddress...loopbackやprivateなど、webhookで送らないaddress
+	errForbiddenAddress = errors.New("webhook address is not allowed")
+)
+
+// Options...配信をやり直す回数とwebhookを無効にするまでの回数
+type Options struct {
+	// MaxAttempts...1つの配信を試す回数. 超えたらfailedにする
+	MaxAttempts int
+	// DisableAfterFailures...webhookへの配信が連続でこの回数失敗したら無効にする
+	DisableAfterFailures int
+	// BatchSize...1回に取り出す配信の数
+	BatchSize int
+}
+
+// Deliverer...積まれた配信をwebhookに署名つきでPOSTし、結果を配信の記録に残す
+type Deliverer struct {
+	repo    repository.WebhookRepository
+	cipher  *secure.Cipher
+	client  *http.Client
+	options Options
+	logger  *zap.Logger
+	now     func() time.Time
+}
+
+// NewDeliverer...cipherで暗号化されたsecretで署名してclientで送るDelivererを作る
+func NewDeliverer(repo repository.WebhookRepository, cipher *secure.Cipher, client *http.Client, options Options, logger *zap.Logger) *Deliverer {
+	return &Deliverer{
+		repo:    repo,
+		cipher:  cipher,
+		client:  client,
+		options: options,
+		logger:  logger,
+		now:     time.Now,
+	}
+}
+
+// NewClient...redirectを追わないclient. 登録されたURL以外にeventを送らないように、3xxも失敗として扱う
+// allowPrivateNetworksがfalseなら、loopback, link-local, privateなどのaddressには接続しない
+// 登録した後にDNSで内部のaddressを向けられても送らないように、名前を引いた後のaddressを接続する直前に確かめる
+func NewClient(timeout time.Duration, allowPrivateNetworks bool) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if !allowPrivateNetworks {
+		dialer.Control = denyPrivateNetworks
+		// proxyを通すとproxyのaddressしか確かめられないので使わない
+		transport.Proxy = nil
+	}
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// denyPrivateNetworks...net.DialerのControl. 接続先が外に出ないaddressならerrForbiddenAddressを返す
+func denyPrivateNetworks(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return errors.Wrap(err, "split webhook address")
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return errors.Wrap(errForbiddenAddress, host)
+	}
+	return nil
+}
+
+// Run...ctxがcancelされるまでintervalごとに配信する. 1回でBatchSize件取れたら待たずに続ける
+func (d *Deliverer) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		n, err := d.RunOnce(ctx)
+		if err != nil && ctx.Err() == nil {
+			d.logger.Warn("webhook delivery failed", zap.Error(err))
+		}
+		if err == nil && n >= d.options.BatchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce...送れる配信を1batch分送り、取り出した件数を返す
+func (d *Deliverer) RunOnce(ctx context.Context) (int, error) {
+	deliveries, err := d.repo.PendingDeliveries(ctx, d.now(), d.options.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range deliveries {
+		if err := d.deliverPending(ctx, &deliveries[i]); err != nil {
+			return len(deliveries), err
+		}
+	}
+	return len(deliveries), nil
+}
+
+// Test...webhook.testのeventを1回だけ送り、配信の記録を返す. 失敗してもやり直さず、連続失敗回数にも数えない
+func (d *Deliverer) Test(ctx context.Context, webhook model.Webhook) (model.WebhookDelivery, error) {
+	payload, err := json.Marshal(model.Event{
+		Type:       model.EventWebhookTest,
+		FamilyId:   webhook.FamilyId,
+		OccurredAt: d.now(),
+	})
+	if err != nil {
+		return model.WebhookDelivery{}, err
+	}
+
+	delivery := model.WebhookDelivery{
+		WebhookId:     webhook.ID,
+		EventType:     model.EventWebhookTest,
+		Payload:       string(payload),
+		Status:        model.DeliveryFailed,
+		NextAttemptAt: d.now(),
+	}
+	// delivery idをheaderに入れるために先に記録する. pendingにするとRunOnceにも拾われるのでfailedで置いておく
+	if err := d.repo.SaveDelivery(ctx, &delivery); err != nil {
+		return delivery, err
+	}
+
+	if err := d.attempt(ctx, webhook, &delivery); err != nil {
+		delivery.Status = model.DeliveryFailed
+	}
+	return delivery, d.repo.SaveDelivery(ctx, &delivery)
+}
+
+// deliverPending...配信を1回試して結果を保存する. 失敗したらbackoffしてやり直すか、MaxAttemptsでfailedにする
+func (d *Deliverer) deliverPending(ctx context.Context, delivery *model.WebhookDelivery) error {
+	webhook, err := d.repo.GetById(ctx, domain.Id(strconv.FormatUint(uint64(delivery.WebhookId), 10)))
+	if errors.Is(err, domain.ErrNotFound) {
+		// 取り出した後にwebhookが削除された. 配信の記録もcascadeで消えている
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if webhook.Disabled() {
+		delivery.Status = model.DeliveryFailed
+		delivery.LastError = errDisabled.Error()
+		return d.repo.SaveDelivery(ctx, delivery)
+	}
+
+	if err := d.attempt(ctx, webhook, delivery); err != nil {
+		if delivery.Attempts >= d.options.MaxAttempts {
+			delivery.Status = model.DeliveryFailed
+		} else {
+			delivery.NextAttemptAt = d.now().Add(backoff(delivery.Attempts))
+		}
+		d.logger.Warn("webhook delivery failed",
+			zap.Uint("webhook_id", webhook.ID),
+			zap.Uint("delivery_id", delivery.ID),
+			zap.String("type", string(delivery.EventType)),
+			zap.Int("attempts", delivery.Attempts),
+			zap.String("status", string(delivery.Status)),
+			zap.Error(err),
+		)
+
+		disabled, err := d.repo.RecordFailure(ctx, webhook.ID, d.options.DisableAfterFailures, d.now())
+		if err != nil {
+			return err
+		}
+		if disabled {
+			d.logger.Warn("webhook disabled after repeated failures",
+				zap.Uint("webhook_id", webhook.ID),
+				zap.Int("failures", d.options.DisableAfterFailures),
+			)
+		}
+		return d.repo.SaveDelivery(ctx, delivery)
+	}
+
+	if err := d.repo.RecordSuccess(ctx, webhook.ID); err != nil {
+		return err
+	}
+	return d.repo.SaveDelivery(ctx, delivery)
+}
+
+// attempt...配信をPOSTし、attempts, status_code, last_errorを埋める. 2xxならdeliveredにする
+func (d *Deliverer) attempt(ctx context.Context, webhook model.Webhook, delivery *model.WebhookDelivery) error {
+	delivery.Attempts++
+	delivery.StatusCode = 0
+	status, err := d.post(ctx, webhook, delivery)
+	delivery.StatusCode = status
+	if err != nil {
+		delivery.LastError = truncate(err.Error(), lastErrorLength)
+		return err
+	}
+
+	now := d.now()
+	delivery.Status = model.DeliveryDelivered
+	delivery.DeliveredAt = &now
+	delivery.LastError = ""
+	return nil
+}
+
+// post...今のsecretと、rotate後の猶予中なら古いsecretでも署名してPOSTする
+func (d *Deliverer) post(ctx context.Context, webhook model.Webhook, delivery *model.WebhookDelivery) (int, error) {
+	now := d.now()
+	body := []byte(delivery.Payload)
+	signatures := make([]string, 0, 2)
+	for _, v := range webhook.Secrets(now) {
+		secret, err := d.cipher.Decrypt(v)
+		if err != nil {
+			return 0, errors.Wrap(err, "decrypt webhook secret")
+		}
+		signatures = append(signatures, Sign(secret, now.Unix(), body))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "famili-api-webhook")
+	req.Header.Set(HeaderSignature, strings.Join(signatures, ","))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set(HeaderWebhookId, strconv.FormatUint(uint64(webhook.ID), 10))
+	req.Header.Set(HeaderDeliveryId, strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set(HeaderEventType, string(delivery.EventType))
+	if delivery.EventId != nil {
+		req.Header.Set(HeaderEventId, strconv.FormatUint(uint64(*delivery.EventId), 10))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, responseBodyLimit))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, errors.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff...attempts回目の失敗の後に待つ時間
+func backoff(attempts int) time.Duration {
+	delay := retryBaseDelay
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= retryMaxDelay {
+			return retryMaxDelay
+		}
+	}
+	return delay
+}
+
+// truncate...n byteに収まるように切る. 途中で切れた文字は捨てる
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return strings.ToValidUTF8(s[:n], "")
+}
@@ -0,0 +1,344 @@
+package webhook
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/sioncojp/famili-api/domain/model"
+	"github.com/sioncojp/famili-api/domain/repository"
+	"github.com/sioncojp/famili-api/infrastructure/memory"
+	"github.com/sioncojp/famili-api/utils/secure"
+)
+
+var (
+	ctx     = context.Background()
+	testKey = base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+)
+
+// receiver...受け取ったリクエストを覚え、statusを返すwebhookの受け口
+type receiver struct {
+	mu       sync.Mutex
+	status   int
+	requests []*http.Request
+	bodies   []string
+}
+
+func (s *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	body, _ := io.ReadAll(r.Body)
+	s.requests = append(s.requests, r)
+	s.bodies = append(s.bodies, string(body))
+	w.WriteHeader(s.status)
+}
+
+// newReceiver...statusを返すhttptest.Server
+func newReceiver(t *testing.T, status int) (*receiver, *httptest.Server) {
+	r := &receiver{status: status}
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+	return r, server
+}
+
+// newWebhook...secretを暗号化してwebhookを登録する
+func newWebhook(t *testing.T, repo repository.WebhookRepository, cipher *secure.Cipher, url, secret string) *model.Webhook {
+	encrypted, err := cipher.Encrypt(secret)
+	require.NoError(t, err)
+	webhook := &model.Webhook{
+		FamilyId:   "f1",
+		CreatedBy:  "1",
+		URL:        url,
+		EventTypes: model.EventTypes{model.EventTodoCreated},
+		Secret:     encrypted,
+	}
+	require.NoError(t, repo.Create(ctx, webhook))
+	return webhook
+}
+
+func newDeliverer(t *testing.T, repo repository.WebhookRepository, options Options) (*Deliverer, *secure.Cipher) {
+	cipher, err := secure.NewCipher(testKey)
+	require.NoError(t, err)
+	return NewDeliverer(repo, cipher, NewClient(time.Second, true), options, zap.NewNop()), cipher
+}
+
+// dispatch...Delivererと同じ時計で配信を積む
+func dispatch(t *testing.T, d *Deliverer, events ...model.Event) {
+	dispatcher := NewDispatcher(d.repo)
+	dispatcher.now = d.now
+	for _, v := range events {
+		require.NoError(t, dispatcher.Send(ctx, v))
+	}
+}
+
+func TestSignature(t *testing.T) {
+	t.Parallel()
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"type":"todo.created"}`)
+	signature := Sign("whsec_a", now.Unix(), body)
+	assert.True(t, strings.HasPrefix(signature, "sha256="))
+
+	assert.NoError(t, Verify("whsec_a", signature, "1700000000", body, now, 5*time.Minute))
+	// rotate中は古いsecretの署名も並ぶ
+	assert.NoError(t, Verify("whsec_a", Sign("whsec_old", now.Unix(), body)+","+signature, "1700000000", body, now, 5*time.Minute))
+
+	assert.ErrorIs(t, Verify("whsec_b", signature, "1700000000", body, now, 5*time.Minute), ErrInvalidSignature)
+	assert.ErrorIs(t, Verify("whsec_a", signature, "1700000000", []byte(`{}`), now, 5*time.Minute), ErrInvalidSignature)
+	assert.ErrorIs(t, Verify("whsec_a", signature, "1700000000", body, now.Add(10*time.Minute), 5*time.Minute), ErrInvalidSignature)
+	assert.ErrorIs(t, Verify("whsec_a", signature, "x", body, now, 5*time.Minute), ErrInvalidSignature)
+}
+
+func TestBackoff(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, 10*time.Second, backoff(1))
+	assert.Equal(t, 20*time.Second, backoff(2))
+	assert.Equal(t, 80*time.Second, backoff(4))
+	assert.Equal(t, retryMaxDelay, backoff(100))
+}
+
+func TestDispatcher(t *testing.T) {
+	t.Parallel()
+	repo := memory.NewWebhookRepository()
+	subscribed := &model.Webhook{FamilyId: "f1", CreatedBy: "1", URL: "https://a.example.com", EventTypes: model.EventTypes{model.EventTodoCreated}}
+	other := &model.Webhook{FamilyId: "f1", CreatedBy: "2", URL: "https://b.example.com", EventTypes: model.EventTypes{model.EventTodoCreated, model.EventTodoDeleted}}
+	otherFamily := &model.Webhook{FamilyId: "f2", CreatedBy: "3", URL: "https://c.example.com", EventTypes: model.EventTypes{model.EventTodoCreated}}
+	for _, v := range []*model.Webhook{subscribed, other, otherFamily} {
+		require.NoError(t, repo.Create(ctx, v))
+	}
+	dispatcher := NewDispatcher(repo)
+
+	// familyで公開しているtodoはfamilyのwebhookに、privateなtodoは作成者のwebhookにだけ積む
+	family := model.Todo{Model: model.Model{ID: 1}, FamilyId: "f1", CreatedBy: "1", Visibility: model.VisibilityFamily}
+	private := model.Todo{Model: model.Model{ID: 2}, FamilyId: "f1", CreatedBy: "1", Visibility: model.VisibilityPrivate}
+	events := append(family.Events(model.EventTodoCreated, model.EventTodoDeleted), private.Events(model.EventTodoCreated)...)
+	for i := range events {
+		events[i].ID = uint(i + 1)
+		require.NoError(t, dispatcher.Send(ctx, events[i]))
+		// relayのやり直しで同じeventが来ても重複して積まない
+		require.NoError(t, dispatcher.Send(ctx, events[i]))
+	}
+
+	deliveries, err := repo.ListDeliveries(ctx, subscribed.ID, 10)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 2)
+	assert.Equal(t, uint(3), *deliveries[0].EventId)
+	assert.Equal(t, uint(1), *deliveries[1].EventId)
+	assert.Contains(t, deliveries[1].Payload, `"type":"todo.created"`)
+
+	deliveries, err = repo.ListDeliveries(ctx, other.ID, 10)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 2)
+	assert.Equal(t, model.EventTodoDeleted, deliveries[0].EventType)
+
+	deliveries, err = repo.ListDeliveries(ctx, otherFamily.ID, 10)
+	require.NoError(t, err)
+	assert.Empty(t, deliveries)
+}
+
+func TestDelivererSigned(t *testing.T) {
+	t.Parallel()
+	received, server := newReceiver(t, http.StatusNoContent)
+	repo := memory.NewWebhookRepository()
+	d, cipher := newDeliverer(t, repo, Options{MaxAttempts: 3, DisableAfterFailures: 5, BatchSize: 10})
+	now := time.Now()
+	d.now = func() time.Time { return now }
+
+	webhook := newWebhook(t, repo, cipher, server.URL, "whsec_old")
+	// rotateした後の猶予中は新旧両方のsecretで署名する
+	encrypted, err := cipher.Encrypt("whsec_new")
+	require.NoError(t, err)
+	webhook.Rotate(encrypted, now)
+	require.NoError(t, repo.Update(ctx, webhook))
+
+	dispatch(t, d, model.Event{ID: 7, Type: model.EventTodoCreated, FamilyId: "f1", Todo: model.Todo{FamilyId: "f1"}})
+	n, err := d.RunOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	require.Len(t, received.requests, 1)
+	r := received.requests[0]
+	assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+	assert.Equal(t, "7", r.Header.Get(HeaderEventId))
+	assert.Equal(t, "todo.created", r.Header.Get(HeaderEventType))
+	assert.NotEmpty(t, r.Header.Get(HeaderDeliveryId))
+	for _, secret := range []string{"whsec_new", "whsec_old"} {
+		assert.NoError(t, Verify(secret, r.Header.Get(HeaderSignature), r.Header.Get(HeaderTimestamp), []byte(received.bodies[0]), now, 5*time.Minute), secret)
+	}
+	assert.True(t, strings.HasPrefix(r.Header.Get(HeaderSignature), Sign("whsec_new", now.Unix(), []byte(received.bodies[0]))))
+
+	deliveries, err := repo.ListDeliveries(ctx, webhook.ID, 10)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, model.DeliveryDelivered, deliveries[0].Status)
+	assert.Equal(t, http.StatusNoContent, deliveries[0].StatusCode)
+	assert.Equal(t, 1, deliveries[0].Attempts)
+	assert.NotNil(t, deliveries[0].DeliveredAt)
+
+	// 猶予が過ぎたら新しいsecretだけで署名する
+	now = now.Add(model.WebhookSecretGrace + time.Second)
+	_, err = d.Test(ctx, *webhook)
+	require.NoError(t, err)
+	require.Len(t, received.requests, 2)
+	assert.NotContains(t, received.requests[1].Header.Get(HeaderSignature), ",")
+}
+
+func TestDelivererRetry(t *testing.T) {
+	t.Parallel()
+	received, server := newReceiver(t, http.StatusInternalServerError)
+	repo := memory.NewWebhookRepository()
+	d, cipher := newDeliverer(t, repo, Options{MaxAttempts: 2, DisableAfterFailures: 10, BatchSize: 10})
+	now := time.Now()
+	d.now = func() time.Time { return now }
+	webhook := newWebhook(t, repo, cipher, server.URL, "whsec_a")
+	dispatch(t, d, model.Event{ID: 1, Type: model.EventTodoCreated, FamilyId: "f1"})
+
+	// 失敗したらbackoffまで送らない
+	_, err := d.RunOnce(ctx)
+	require.NoError(t, err)
+	n, err := d.RunOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+	deliveries, err := repo.ListDeliveries(ctx, webhook.ID, 10)
+	require.NoError(t, err)
+	assert.Equal(t, model.DeliveryPending, deliveries[0].Status)
+	assert.Equal(t, "unexpected status 500", deliveries[0].LastError)
+	assert.Equal(t, now.Add(retryBaseDelay), deliveries[0].NextAttemptAt)
+
+	// MaxAttemptsまで失敗したらfailedにしてやめる
+	now = now.Add(retryBaseDelay)
+	_, err = d.RunOnce(ctx)
+	require.NoError(t, err)
+	deliveries, err = repo.ListDeliveries(ctx, webhook.ID, 10)
+	require.NoError(t, err)
+	assert.Equal(t, model.DeliveryFailed, deliveries[0].Status)
+	assert.Equal(t, 2, deliveries[0].Attempts)
+	assert.Len(t, received.requests, 2)
+
+	got, err := repo.GetById(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, 2, got.Failures)
+	assert.False(t, got.Disabled())
+
+	// 成功したら連続失敗回数を0に戻す
+	received.mu.Lock()
+	received.status = http.StatusOK
+	received.mu.Unlock()
+	dispatch(t, d, model.Event{ID: 2, Type: model.EventTodoCreated, FamilyId: "f1"})
+	_, err = d.RunOnce(ctx)
+	require.NoError(t, err)
+	got, err = repo.GetById(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, 0, got.Failures)
+}
+
+func TestDelivererDisable(t *testing.T) {
+	t.Parallel()
+	received, server := newReceiver(t, http.StatusServiceUnavailable)
+	repo := memory.NewWebhookRepository()
+	d, cipher := newDeliverer(t, repo, Options{MaxAttempts: 5, DisableAfterFailures: 2, BatchSize: 10})
+	webhook := newWebhook(t, repo, cipher, server.URL, "whsec_a")
+	for _, id := range []uint{1, 2, 3} {
+		dispatch(t, d, model.Event{ID: id, Type: model.EventTodoCreated, FamilyId: "f1"})
+	}
+
+	// 2回続けて失敗したら無効にし、残りの配信は送らずにfailedにする
+	n, err := d.RunOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.Len(t, received.requests, 2)
+
+	got, err := repo.GetById(ctx, "1")
+	require.NoError(t, err)
+	assert.True(t, got.Disabled())
+	deliveries, err := repo.ListDeliveries(ctx, webhook.ID, 10)
+	require.NoError(t, err)
+	assert.Equal(t, model.DeliveryFailed, deliveries[0].Status)
+	assert.Equal(t, errDisabled.Error(), deliveries[0].LastError)
+
+	// 無効になったwebhookにはeventを積まない
+	dispatch(t, d, model.Event{ID: 4, Type: model.EventTodoCreated, FamilyId: "f1"})
+	deliveries, err = repo.ListDeliveries(ctx, webhook.ID, 10)
+	require.NoError(t, err)
+	assert.Len(t, deliveries, 3)
+}
+
+func TestDelivererRedirect(t *testing.T) {
+	t.Parallel()
+	received, target := newReceiver(t, http.StatusOK)
+	redirect := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusFound))
+	t.Cleanup(redirect.Close)
+	repo := memory.NewWebhookRepository()
+	d, cipher := newDeliverer(t, repo, Options{MaxAttempts: 3, DisableAfterFailures: 5, BatchSize: 10})
+
+	// redirectは追わずに失敗として記録する. testはやり直さず、連続失敗回数にも数えない
+	webhook := newWebhook(t, repo, cipher, redirect.URL, "whsec_a")
+	delivery, err := d.Test(ctx, *webhook)
+	require.NoError(t, err)
+	assert.Equal(t, model.DeliveryFailed, delivery.Status)
+	assert.Equal(t, http.StatusFound, delivery.StatusCode)
+	assert.Nil(t, delivery.EventId)
+	assert.Empty(t, received.requests)
+
+	got, err := repo.GetById(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, 0, got.Failures)
+	pending, err := repo.PendingDeliveries(ctx, time.Now().Add(time.Hour), 10)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+}
+
+// TestDelivererPrivateNetwork...loopbackのURLは登録できても、接続する前に止めて失敗として記録する
+func TestDelivererPrivateNetwork(t *testing.T) {
+	t.Parallel()
+	received, target := newReceiver(t, http.StatusOK)
+	repo := memory.NewWebhookRepository()
+	cipher, err := secure.NewCipher(testKey)
+	require.NoError(t, err)
+	d := NewDeliverer(repo, cipher, NewClient(time.Second, false), Options{MaxAttempts: 3, DisableAfterFailures: 5, BatchSize: 10}, zap.NewNop())
+
+	webhook := newWebhook(t, repo, cipher, target.URL, "whsec_a")
+	delivery, err := d.Test(ctx, *webhook)
+	require.NoError(t, err)
+	assert.Equal(t, model.DeliveryFailed, delivery.Status)
+	assert.Contains(t, delivery.LastError, errForbiddenAddress.Error())
+	assert.Empty(t, received.requests)
+}
+
+func TestDenyPrivateNetworks(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		address string
+		denied  bool
+	}{
+		{"127.0.0.1:80", true},
+		{"[::1]:80", true},
+		{"10.1.2.3:443", true},
+		{"172.16.0.1:443", true},
+		{"192.168.1.1:443", true},
+		{"169.254.169.254:80", true},
+		{"[fe80::1]:80", true},
+		{"[fc00::1]:443", true},
+		{"0.0.0.0:80", true},
+		{"[::ffff:127.0.0.1]:80", true},
+		{"93.184.216.34:443", false},
+		{"[2606:4700::1111]:443", false},
+	}
+	for _, v := range cases {
+		err := denyPrivateNetworks("tcp", v.address, nil)
+		if v.denied {
+			assert.ErrorIs(t, err, errForbiddenAddress, v.address)
+		} else {
+			assert.NoError(t, err, v.address)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/sioncojp/famili-api/domain/model"
+	"github.com/sioncojp/famili-api/domain/repository"
+)
+
+// Dispatcher...outboxのeventを受け取るwebhookを探して配信を積む. outbox.Sinkとしてrelayに渡す
+// 実際の送信はDelivererが行うので、1つのwebhookが遅くても他のsinkやwebhookを待たせない
+type Dispatcher struct {
+	repo repository.WebhookRepository
+	now  func() time.Time
+}
+
+// NewDispatcher...repoに配信を積むDispatcherを作る
+func NewDispatcher(repo repository.WebhookRepository) *Dispatcher {
+	return &Dispatcher{repo: repo, now: time.Now}
+}
+
+func (d *Dispatcher) Name() string {
+	return "webhook"
+}
+
+// Send...eventを受け取るwebhookごとに配信を積む
+// relayがやり直しても、同じwebhookとeventの配信は1つしか積まれない
+func (d *Dispatcher) Send(ctx context.Context, event model.Event) error {
+	webhooks, err := d.repo.List(ctx, event.FamilyId)
+	if err != nil {
+		return err
+	}
+
+	var deliveries []model.WebhookDelivery
+	var payload []byte
+	for _, v := range webhooks {
+		if !v.Accepts(event) {
+			continue
+		}
+		if payload == nil {
+			if payload, err = json.Marshal(event); err != nil {
+				return err
+			}
+		}
+		eventId := event.ID
+		deliveries = append(deliveries, model.WebhookDelivery{
+			WebhookId:     v.ID,
+			EventId:       &eventId,
+			EventType:     event.Type,
+			Payload:       string(payload),
+			Status:        model.DeliveryPending,
+			NextAttemptAt: d.now(),
+		})
+	}
+	return d.repo.Enqueue(ctx, deliveries...)
+}
@@ -0,0 +1,58 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// HeaderSignature...`sha256=<hex>`をカンマ区切りで並べる. rotate中は新旧のsecretの署名が両方入る
+	HeaderSignature = "X-Famili-Signature"
+	// HeaderTimestamp...署名したunix時刻(秒). 受け取る側はずれが大きければ捨てる
+	HeaderTimestamp  = "X-Famili-Timestamp"
+	HeaderWebhookId  = "X-Famili-Webhook-Id"
+	HeaderDeliveryId = "X-Famili-Delivery-Id"
+	HeaderEventId    = "X-Famili-Event-Id"
+	HeaderEventType  = "X-Famili-Event-Type"
+
+	// signaturePrefix...署名のアルゴリズム
+	signaturePrefix = "sha256="
+)
+
+// ErrInvalidSignature...署名が一致しないか、timestampが古すぎる
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// Sign...`{timestamp}.{body}`をsecretでHMAC-SHA256した署名を返す
+// timestampも署名に含めるので、盗んだリクエストを後から送り直されても弾ける
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify...受け取る側の検証. signatureのどれかがsecretの署名と一致し、timestampがnowからtolerance以内ならnilを返す
+func Verify(secret, signature, timestamp string, body []byte, now time.Time, tolerance time.Duration) error {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if d := now.Sub(time.Unix(ts, 0)); d > tolerance || d < -tolerance {
+		return ErrInvalidSignature
+	}
+
+	expected := Sign(secret, ts, body)
+	for _, v := range strings.Split(signature, ",") {
+		if hmac.Equal([]byte(strings.TrimSpace(v)), []byte(expected)) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
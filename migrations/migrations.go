@@ -0,0 +1,10 @@
+// Package migrations...migrationのファイルをbinaryに埋め込む
+// MySQLは直下, SQLiteは sqlite/, PostgreSQLは postgres/ に同じversionで置く
+package migrations
+
+import "embed"
+
+// FS...migrationのファイル. utils/migrate でdriverごとのdirectoryを読む
+//
+//go:embed *.mysql sqlite/*.sqlite postgres/*.postgres
+var FS embed.FS
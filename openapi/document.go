@@ -0,0 +1,172 @@
+package openapi
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Version...このdocumentのOpenAPIのversion
+const Version = "3.1.0"
+
+// Document...OpenAPIのdocument. famili-apiで使うfieldだけ持つ
+type Document struct {
+	OpenAPI    string                `json:"openapi"`
+	Info       Info                  `json:"info"`
+	Paths      map[string]PathItem   `json:"paths"`
+	Components Components            `json:"components"`
+	Security   []SecurityRequirement `json:"security,omitempty"`
+	Tags       []Tag                 `json:"tags,omitempty"`
+}
+
+// Info...APIの名前とversion
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// Tag...operationをまとめる単位
+type Tag struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// PathItem...小文字のmethodごとのoperation
+type PathItem map[string]*Operation
+
+// Operation...1つのmethodとpathの組み合わせ
+type Operation struct {
+	OperationId string                `json:"operationId"`
+	Summary     string                `json:"summary"`
+	Description string                `json:"description,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]*Response  `json:"responses"`
+	Security    []SecurityRequirement `json:"security,omitempty"`
+	// Scopes...API keyで呼ぶときに必要なscope
+	Scopes []string `json:"x-famili-scopes,omitempty"`
+
+	// problem...errorをRFC 7807のproblemだけで返すversionのoperation
+	problem bool
+}
+
+// Parameter...path, query, headerのparameter
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// RequestBody...request body
+type RequestBody struct {
+	Required bool                 `json:"required,omitempty"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+// Response...statusごとのresponse
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// MediaType...Content-Typeごとのschema
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Components...$refで参照するschemaとsecurity scheme
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes"`
+}
+
+// SecurityScheme...認証の方法
+type SecurityScheme struct {
+	Type        string `json:"type"`
+	Scheme      string `json:"scheme,omitempty"`
+	Name        string `json:"name,omitempty"`
+	In          string `json:"in,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// SecurityRequirement...security schemeの名前とscope. 空ならどれも要らない
+type SecurityRequirement map[string][]string
+
+// Schema...JSON Schema 2020-12のうちfamili-apiで使うkeyword
+type Schema struct {
+	Ref         string        `json:"$ref,omitempty"`
+	Type        string        `json:"-"`
+	Format      string        `json:"format,omitempty"`
+	Description string        `json:"description,omitempty"`
+	Enum        []interface{} `json:"enum,omitempty"`
+	Const       interface{}   `json:"const,omitempty"`
+	// Nullable...nullも許す. 3.1なのでtypeに"null"を足して表す
+	Nullable             bool               `json:"-"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *bool              `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Minimum              *int64             `json:"minimum,omitempty"`
+	Maximum              *int64             `json:"maximum,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	MinProperties        *int               `json:"minProperties,omitempty"`
+}
+
+// MarshalJSON...Nullableならtypeを["string", "null"]のような配列にする
+func (s Schema) MarshalJSON() ([]byte, error) {
+	type schema Schema
+	v := struct {
+		Type interface{} `json:"type,omitempty"`
+		schema
+	}{schema: schema(s)}
+
+	switch {
+	case s.Type != "" && s.Nullable:
+		v.Type = []string{s.Type, "null"}
+	case s.Type != "":
+		v.Type = s.Type
+	}
+	return json.Marshal(v)
+}
+
+// Operation...methodとpathのoperationを返す. 無ければnil
+func (d *Document) Operation(method, path string) *Operation {
+	return d.Paths[path][method]
+}
+
+// Routes..."GET /v1/todos" の形で全てのoperationを並べて返す
+func (d *Document) Routes() []string {
+	routes := []string{}
+	for path, item := range d.Paths {
+		for method := range item {
+			routes = append(routes, strings.ToUpper(method)+" "+path)
+		}
+	}
+	sort.Strings(routes)
+	return routes
+}
+
+// Schema...$refならcomponentsのschemaを返す
+func (d *Document) Schema(s *Schema) *Schema {
+	for s != nil && s.Ref != "" {
+		s = d.Components.Schemas[s.Ref[len(schemaRefPrefix):]]
+	}
+	return s
+}
+
+// response...statusのresponse. 無ければ作る
+func (o *Operation) response(status int, description string) *Response {
+	key := strconv.Itoa(status)
+	if o.Responses[key] == nil {
+		o.Responses[key] = &Response{Description: description}
+	}
+	return o.Responses[key]
+}
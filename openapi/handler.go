@@ -0,0 +1,63 @@
+package openapi
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+)
+
+const (
+	// Path...documentを返すpath
+	Path = "/openapi.json"
+	// SwaggerUIPath...Swagger UIを出すpath
+	SwaggerUIPath = "/swagger"
+)
+
+// swaggerUI...swagger-uiはCDNから読む
+var swaggerUI = template.Must(template.New("swagger").Parse(`<!DOCTYPE html>
+<html lang="ja">
+<head>
+  <meta charset="utf-8">
+  <title>famili-api</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>
+    window.ui = SwaggerUIBundle({ url: "{{ . }}", dom_id: "#swagger-ui" });
+  </script>
+</body>
+</html>
+`))
+
+// Marshal...openapi/openapi.jsonと同じ形でdocumentをJSONにする
+func (d *Document) Marshal() ([]byte, error) {
+	b, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+// Handler...dを返す. 起動時に1回だけJSONにする
+func Handler(d *Document) http.HandlerFunc {
+	b, err := d.Marshal()
+	if err != nil {
+		panic(err)
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(b)
+	}
+}
+
+// SwaggerUI...Pathのdocumentを読むSwagger UIのページを返す
+func SwaggerUI() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		_ = swaggerUI.Execute(w, Path)
+	}
+}
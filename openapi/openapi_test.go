@@ -0,0 +1,90 @@
+package openapi
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sioncojp/famili-api/domain/model"
+)
+
+// TestGenerated...openapi/openapi.jsonがspec.goと一致しているか. 落ちたら make openapi/gen を流す
+func TestGenerated(t *testing.T) {
+	t.Parallel()
+	want, err := New().Marshal()
+	assert.NoError(t, err)
+	got, err := os.ReadFile("openapi.json")
+	assert.NoError(t, err)
+	assert.Equal(t, string(want), string(got))
+}
+
+func TestSchemaOf(t *testing.T) {
+	t.Parallel()
+	type embedded struct {
+		ID uint `json:"id"`
+	}
+	type sample struct {
+		embedded
+		Name       string           `json:"name"`
+		Note       string           `json:"note,omitempty"`
+		Secret     string           `json:"-"`
+		At         *time.Time       `json:"at"`
+		Visibility model.Visibility `json:"visibility"`
+		Tags       []string         `json:"tags"`
+		hidden     string
+	}
+
+	s := SchemaOf(sample{})
+	assert.Equal(t, "object", s.Type)
+	assert.ElementsMatch(t, []string{"id", "name", "note", "at", "visibility", "tags"}, keys(s.Properties))
+	assert.Equal(t, []string{"id", "name", "at", "visibility", "tags"}, s.Required)
+	assert.Equal(t, Int64(0), s.Properties["id"].Minimum)
+	assert.Equal(t, []interface{}{model.VisibilityPrivate, model.VisibilityFamily, model.VisibilityPublic}, s.Properties["visibility"].Enum)
+
+	b, err := json.Marshal(s.Properties["at"])
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"type": ["string", "null"], "format": "date-time"}`, string(b))
+
+	picked := s.Pick("name", "note", "unknown")
+	assert.ElementsMatch(t, []string{"name", "note"}, keys(picked.Properties))
+	assert.Equal(t, Bool(false), picked.AdditionalProperties)
+	assert.Empty(t, picked.Required)
+}
+
+func TestDocument(t *testing.T) {
+	t.Parallel()
+	d := New()
+
+	o := d.Operation("put", "/v1/todos/{id}")
+	if assert.NotNil(t, o) {
+		assert.Equal(t, []Parameter{{Name: "id", In: "path", Required: true, Schema: &Schema{Type: "integer", Minimum: Int64(1)}}}, o.Parameters)
+		assert.Equal(t, "TodoInput", o.RequestBody.Content[contentJSON].Schema.Ref[len(schemaRefPrefix):])
+		assert.Contains(t, o.Responses["404"].Content[contentJSON].Schema.Properties["error"].Enum, "todo_not_found")
+		assert.Contains(t, o.Responses["403"].Content[contentJSON].Schema.Properties["error"].Enum, errorInsufficientScope)
+	}
+
+	// 全ての$refがcomponentsにある
+	for path, item := range d.Paths {
+		for method, o := range item {
+			if o.RequestBody != nil {
+				assert.NotNil(t, d.Schema(o.RequestBody.Content[contentJSON].Schema), method+" "+path)
+			}
+		}
+	}
+	for name, s := range d.Components.Schemas {
+		for property, p := range s.Properties {
+			assert.NotNil(t, d.Schema(p), name+"."+property)
+		}
+	}
+}
+
+func keys(m map[string]*Schema) []string {
+	out := []string{}
+	for k := range m {
+		out = append(out, k)
+	}
+	return out
+}
@@ -0,0 +1,119 @@
+package openapi
+
+import (
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/sioncojp/famili-api/domain/model"
+)
+
+// schemaRefPrefix...componentsのschemaを参照するときの$refのprefix
+const schemaRefPrefix = "#/components/schemas/"
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// enums...stringの型ごとに取りうる値. SchemaOfがenumにする
+var enums = map[reflect.Type][]interface{}{
+	reflect.TypeOf(model.Visibility("")): {model.VisibilityPrivate, model.VisibilityFamily, model.VisibilityPublic},
+	reflect.TypeOf(model.EventType("")): {
+		model.EventTodoCreated, model.EventTodoUpdated, model.EventTodoCompleted, model.EventTodoDeleted, model.EventWebhookTest,
+	},
+	reflect.TypeOf(model.DeliveryStatus("")): {model.DeliveryPending, model.DeliveryDelivered, model.DeliveryFailed},
+	reflect.TypeOf(model.SyncStatus("")):     {model.SyncApplied, model.SyncConflict, model.SyncRejected},
+}
+
+// Ref...componentsのnameのschemaを参照する
+func Ref(name string) *Schema {
+	return &Schema{Ref: schemaRefPrefix + name}
+}
+
+// SchemaOf...vの型のJSONのschemaをencoding/jsonと同じ規則で作る
+// json:"-"は出さず、omitemptyでないfieldはrequiredにする. 埋め込んだstructのfieldは展開する
+func SchemaOf(v interface{}) *Schema {
+	return schemaOf(reflect.TypeOf(v))
+}
+
+func schemaOf(t reflect.Type) *Schema {
+	if t.Kind() == reflect.Ptr {
+		s := schemaOf(t.Elem())
+		s.Nullable = true
+		return s
+	}
+	if t == timeType {
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string", Enum: enums[t]}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Schema{Type: "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer", Minimum: Int64(0)}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice:
+		// nilのsliceはnullになる
+		return &Schema{Type: "array", Items: schemaOf(t.Elem()), Nullable: true}
+	case reflect.Array:
+		return &Schema{Type: "array", Items: schemaOf(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object"}
+	case reflect.Struct:
+		s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+		addFields(s, t)
+		return s
+	}
+	return &Schema{}
+}
+
+// addFields...tのexportされたfieldをpropertiesに足す
+func addFields(s *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options := tag, ""
+		if i := strings.Index(tag, ","); i >= 0 {
+			name, options = tag[:i], tag[i:]
+		}
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			addFields(s, f.Type)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		s.Properties[name] = schemaOf(f.Type)
+		if !strings.Contains(options, ",omitempty") {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+// Pick...objectのschemaからnamesのpropertyだけ残したcopyを作る. requestのbodyに使う
+// requiredは付け直すので、必要なら呼んだ側でrequiredを足す
+func (s *Schema) Pick(names ...string) *Schema {
+	out := &Schema{Type: "object", Properties: map[string]*Schema{}, AdditionalProperties: Bool(false)}
+	for _, v := range names {
+		if p, ok := s.Properties[v]; ok {
+			c := *p
+			out.Properties[v] = &c
+		}
+	}
+	return out
+}
+
+// Int, Int64, Bool...Schemaのpointerのfieldを書くため
+func Int(v int) *int       { return &v }
+func Int64(v int64) *int64 { return &v }
+func Bool(v bool) *bool    { return &v }
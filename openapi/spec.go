@@ -0,0 +1,651 @@
+package openapi
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	v1accounts "github.com/sioncojp/famili-api/application/v1/accounts"
+	v1admin "github.com/sioncojp/famili-api/application/v1/admin"
+	v1apikeys "github.com/sioncojp/famili-api/application/v1/apikeys"
+	v1members "github.com/sioncojp/famili-api/application/v1/members"
+	v1stream "github.com/sioncojp/famili-api/application/v1/stream"
+	v1sync "github.com/sioncojp/famili-api/application/v1/sync"
+	v1todos "github.com/sioncojp/famili-api/application/v1/todos"
+	v1webhooks "github.com/sioncojp/famili-api/application/v1/webhooks"
+	v1ws "github.com/sioncojp/famili-api/application/v1/ws"
+	v2todos "github.com/sioncojp/famili-api/application/v2/todos"
+	"github.com/sioncojp/famili-api/domain/model"
+	"github.com/sioncojp/famili-api/domain/repository"
+	httpresponse "github.com/sioncojp/famili-api/utils/http_response"
+)
+
+const (
+	// applicationのauth middlewareが返すerror message. applicationはこのpackageを使うのでimportできない
+	errorInvalidAPIKey     = "invalid_api_key"
+	errorInvalidSession    = "invalid_session"
+	errorInsufficientScope = "insufficient_scope"
+	errorAPIKeyNotAllowed  = "api_key_not_allowed"
+	errorAdminOnly         = "admin_only"
+	errorAuthRequired      = "authentication_required"
+
+	contentJSON        = "application/json"
+	contentEventStream = "text/event-stream"
+
+	tagTodos    = "todos"
+	tagSync     = "sync"
+	tagMembers  = "members"
+	tagAccounts = "accounts"
+	tagAdmin    = "admin"
+	tagAPIKeys  = "api-keys"
+	tagWebhooks = "webhooks"
+)
+
+// pathParam...pathの{name}
+var pathParam = regexp.MustCompile(`{([^}]+)}`)
+
+// New.../v1, /v2の全てのrouteのdocumentを作る. routerにrouteを足したらここにも足す
+// 足し忘れるとapplicationのTestOpenAPIRoutesが落ちる
+func New() *Document {
+	d := &Document{
+		OpenAPI: Version,
+		Info: Info{
+			Title:   "famili-api",
+			Version: "v2",
+			Description: "家族で共有するtodoのAPI. /v1のresponseは {\"ok\": true, ...} か {\"ok\": false, \"error\": ..., \"warn\": ...} で返る. " +
+				"Accept: application/problem+json を送るとerrorはRFC 7807のproblemで返り、typeは urn:famili-api:problem:{error} になる. " +
+				"/v2はenvelopeを付けずに返し、IDはstring, errorは常にproblemになる. " +
+				"廃止予定のversionはDeprecation(RFC 9745), Sunset(RFC 8594)のheaderを付けて返す. " +
+				"warn, title, reasonはX-Famili-Locale, Accept-Languageの順に見てja, enで返る. codeは言語によらない",
+		},
+		Paths: map[string]PathItem{},
+		Components: Components{
+			Schemas: schemas(),
+			SecuritySchemes: map[string]*SecurityScheme{
+				"bearer":     {Type: "http", Scheme: "bearer", Description: "API key(fam_...)か、POST /v1/loginのsession_token"},
+				"adminToken": {Type: "apiKey", In: "header", Name: "X-Famili-Admin-Token", Description: "[security] adminToken"},
+			},
+		},
+		Security: []SecurityRequirement{{"bearer": {}}},
+		Tags: []Tag{
+			{Name: tagTodos, Description: "todoの作成, 更新, 購読"},
+			{Name: tagSync, Description: "オフラインの端末との差分同期"},
+			{Name: tagMembers, Description: "familyのメンバー"},
+			{Name: tagAccounts, Description: "loginとTOTP. API keyでは呼べない"},
+			{Name: tagAdmin, Description: "管理用. X-Famili-Admin-Tokenが必要"},
+			{Name: tagAPIKeys, Description: "API keyの発行と無効化. API keyでは呼べない"},
+			{Name: tagWebhooks, Description: "outgoing webhook. API keyでは呼べない"},
+		},
+	}
+
+	todoPaths(d)
+	syncPaths(d)
+	memberPaths(d)
+	accountPaths(d)
+	adminPaths(d)
+	apiKeyPaths(d)
+	webhookPaths(d)
+	todoV2Paths(d)
+
+	// public, admin以外はbearerで認証していなければ401になる
+	for _, item := range d.Paths {
+		for _, o := range item {
+			if o.Security == nil {
+				o.fail(http.StatusUnauthorized, errorAuthRequired)
+			}
+		}
+	}
+	return d
+}
+
+// schemas...componentsのschema. modelのstructから作り、requestのbodyはvalidationの制約を足す
+func schemas() map[string]*Schema {
+	todo := SchemaOf(model.Todo{})
+	todoInput := todo.Pick("title", "description", "completed", "position", "visibility")
+	todoInput.Required = []string{"title", "description"}
+	todoInput.Properties["title"].MinLength, todoInput.Properties["title"].MaxLength = Int(1), Int(50)
+	todoInput.Properties["description"].MinLength, todoInput.Properties["description"].MaxLength = Int(1), Int(100)
+	todoInput.Properties["position"].Minimum = Int64(0)
+
+	member := SchemaOf(model.Member{})
+	memberInput := member.Pick("name")
+	memberInput.Required = []string{"name"}
+	memberInput.Properties["name"].MinLength, memberInput.Properties["name"].MaxLength = Int(1), Int(50)
+
+	apiKey := SchemaOf(model.APIKey{})
+	apiKey.Properties["scopes"].Items.Enum = scopes()
+	apiKeyInput := apiKey.Pick("name", "scopes")
+	apiKeyInput.Required = []string{"name"}
+
+	webhook := SchemaOf(model.Webhook{})
+	webhookInput := webhook.Pick("url", "event_types")
+	webhookInput.Required = []string{"url", "event_types"}
+	webhookInput.Properties["url"].Format = "uri"
+	webhookInput.Properties["url"].MaxLength = Int(255)
+	// webhook.testはPOST /v1/webhooks/{id}/testでしか送らないので登録できない
+	webhookInput.Properties["event_types"].Items = &Schema{Type: "string", Enum: []interface{}{
+		model.EventTodoCreated, model.EventTodoUpdated, model.EventTodoCompleted, model.EventTodoDeleted,
+	}}
+	webhookInput.Properties["enabled"] = &Schema{Type: "boolean", Description: "trueで無効になったwebhookを戻し、falseで止める. 省略したら変えない"}
+
+	cache := SchemaOf(repository.CacheStats{})
+	cache.Properties["enabled"] = &Schema{Type: "boolean", Description: "[cache] driverがnoneならfalse"}
+	cache.Required = append(cache.Required, "enabled")
+
+	// v2のIDはstringなので、v1のTodoとは別のschemaにする
+	todoV2 := SchemaOf(v2todos.Todo{})
+	todoV2.Properties["assignee_ids"].Nullable = false
+	todoV2Input := todoV2.Pick("title", "description", "completed", "position", "visibility")
+	todoV2Input.Required = []string{"title", "description"}
+	todoV2Input.Properties["title"].MinLength, todoV2Input.Properties["title"].MaxLength = Int(1), Int(50)
+	todoV2Input.Properties["description"].MinLength, todoV2Input.Properties["description"].MaxLength = Int(1), Int(100)
+	todoV2Input.Properties["position"].Minimum = Int64(0)
+
+	fieldError := SchemaOf(httpresponse.FieldError{})
+	fieldError.Properties["in"].Enum = []interface{}{InBody, InQuery, InPath}
+
+	return map[string]*Schema{
+		"FieldError":      fieldError,
+		"Problem":         problemSchema(),
+		"Todo":            todo,
+		"TodoInput":       todoInput,
+		"TodoV2":          todoV2,
+		"SharedTodo":      SchemaOf(v1todos.SharedTodo{}),
+		"TodoInputV2":     todoV2Input,
+		"Member":          member,
+		"MemberInput":     memberInput,
+		"Account":         SchemaOf(model.Account{}),
+		"APIKey":          apiKey,
+		"APIKeyInput":     apiKeyInput,
+		"Webhook":         webhook,
+		"WebhookInput":    webhookInput,
+		"WebhookDelivery": SchemaOf(model.WebhookDelivery{}),
+		"CacheStats":      cache,
+		"PoolStats":       SchemaOf(repository.PoolStats{}),
+		"Credentials": object([]string{"email", "password"}, map[string]*Schema{
+			"email":    {Type: "string", Format: "email"},
+			"password": {Type: "string"},
+		}),
+		"AccountInput": object([]string{"member_id", "email", "password"}, map[string]*Schema{
+			"member_id": {Type: "string", Description: "loginしているaccountと同じfamilyのメンバー"},
+			"email":     {Type: "string", Format: "email"},
+			"password":  {Type: "string", MinLength: Int(8), MaxLength: Int(72)},
+		}),
+		"AccountBootstrap": object([]string{"family_id", "name", "email", "password"}, map[string]*Schema{
+			"family_id": {Type: "string"},
+			"name":      {Type: "string", MinLength: Int(1), MaxLength: Int(50)},
+			"email":     {Type: "string", Format: "email"},
+			"password":  {Type: "string", MinLength: Int(8), MaxLength: Int(72)},
+		}),
+		"TOTPRequest": object(nil, map[string]*Schema{
+			"mfa_token":     {Type: "string", Description: "POST /v1/loginで返ったmfa_token"},
+			"code":          {Type: "string", Description: "認証アプリの6桁のcode"},
+			"recovery_code": {Type: "string", Description: "codeの代わりに1回だけ使えるrecovery code"},
+		}),
+		"Login": object([]string{"mfa_required"}, map[string]*Schema{
+			"session_token": {Type: "string"},
+			"mfa_required":  {Type: "boolean"},
+			"mfa_token":     {Type: "string"},
+		}),
+		"TOTPEnrollment": object([]string{"secret", "provisioning_uri"}, map[string]*Schema{
+			"secret":           {Type: "string"},
+			"provisioning_uri": {Type: "string", Description: "QRコードにして認証アプリで読み込む"},
+		}),
+		"SyncChange": object([]string{"todo_id", "deleted"}, map[string]*Schema{
+			"todo_id": {Type: "integer", Minimum: Int64(0)},
+			"deleted": {Type: "boolean", Description: "trueなら削除されたか見れなくなったtodoのtombstone"},
+			"todo":    Ref("Todo"),
+		}),
+		"SyncMutation": object([]string{"client_id", "op"}, map[string]*Schema{
+			"client_id":      {Type: "string", MinLength: Int(1), Description: "clientが振る変更のID. 同じIDを送り直しても1回しか反映しない"},
+			"op":             {Type: "string", Enum: []interface{}{v1sync.OpCreate, v1sync.OpUpdate, v1sync.OpDelete}},
+			"todo_id":        {Type: "integer", Minimum: Int64(0)},
+			"todo_client_id": {Type: "string", Description: "同じmemberがcreateしたときのclient_idでtodoを指定する"},
+			"client_time":    {Type: "string", Format: "date-time", Description: "update, deleteで必須. serverの最後の書き込みより後でなければconflict"},
+			"title":          {Type: "string"},
+			"description":    {Type: "string"},
+			"completed":      {Type: "boolean"},
+			"position":       {Type: "integer", Minimum: Int64(0)},
+			"visibility":     todo.Properties["visibility"],
+		}),
+		"SyncRequest": object(nil, map[string]*Schema{
+			"since":     {Type: "string", Description: "前の同期で返ったtoken. 省略したら全てのtodoを返す"},
+			"mutations": {Type: "array", Items: Ref("SyncMutation"), MaxItems: Int(100)},
+		}),
+		"SyncResult": object([]string{"client_id", "status"}, map[string]*Schema{
+			"client_id": {Type: "string"},
+			"status":    SchemaOf(model.SyncStatus("")),
+			"todo_id":   {Type: "integer", Minimum: Int64(0)},
+			"todo":      Ref("Todo"),
+			"deleted":   {Type: "boolean"},
+			"error":     {Type: "string"},
+			"warn":      {Type: "string"},
+		}),
+		"Sync": object([]string{"token", "has_more", "changes"}, map[string]*Schema{
+			"token":    {Type: "string", Description: "次の同期でsinceに渡す"},
+			"has_more": {Type: "boolean", Description: "trueならtokenを渡して続きを取る"},
+			"changes":  {Type: "array", Items: Ref("SyncChange")},
+			"results":  {Type: "array", Items: Ref("SyncResult")},
+		}),
+	}
+}
+
+func todoPaths(d *Document) {
+	notFound := []string{v1todos.ErrorMessageNotFound, v1todos.ErrorMessageInvalidProvided}
+
+	d.add(http.MethodGet, "/v1/todos", "listTodos", "見れるtodoの一覧. position, ID順", tagTodos).
+		scope(model.ScopeTodosRead).
+		query("assignee", "meか、メンバーのIDでassigneeを絞り込む", &Schema{Type: "string"}).
+		ok(http.StatusOK, "todos", &Schema{Type: "array", Items: Ref("Todo")}).
+		fail(http.StatusUnauthorized, v1todos.ErrorMessageUnidentified)
+	d.add(http.MethodPost, "/v1/todos", "createTodo", "todoを作る. completedはfalseで作る", tagTodos).
+		scope(model.ScopeTodosWrite).
+		body(Ref("TodoInput")).
+		ok(http.StatusCreated, "", nil).
+		fail(http.StatusBadRequest, v1todos.ErrorMessageMissingArgument, v1todos.ErrorValidation)
+	d.add(http.MethodGet, "/v1/todos/stream", "streamTodos", "todoの変更をSSEで受け取る", tagTodos).
+		scope(model.ScopeTodosRead).
+		header("Last-Event-ID", "再接続したときに、最後に受け取ったeventのID", &Schema{Type: "string"}).
+		stream().
+		fail(http.StatusUnauthorized, v1stream.ErrorMessageUnidentified).
+		fail(http.StatusInternalServerError, v1stream.ErrorMessageUnsupported)
+	d.add(http.MethodPut, "/v1/todos/{id}", "updateTodo", "todoを更新する. visibilityを省略したら今の値を引き継ぐ", tagTodos).
+		scope(model.ScopeTodosRead, model.ScopeTodosWrite).
+		body(Ref("TodoInput")).
+		ok(http.StatusOK, "", nil).
+		fail(http.StatusBadRequest, v1todos.ErrorMessageMissingArgument, v1todos.ErrorValidation).
+		fail(http.StatusNotFound, notFound...)
+	d.add(http.MethodDelete, "/v1/todos/{id}", "deleteTodo", "todoを削除する", tagTodos).
+		scope(model.ScopeTodosRead, model.ScopeTodosWrite).
+		ok(http.StatusOK, "", nil).
+		fail(http.StatusNotFound, notFound...)
+	d.add(http.MethodPut, "/v1/todos/{id}/assignees", "assignTodo", "todoのassigneeを置き換える", tagTodos).
+		scope(model.ScopeTodosRead, model.ScopeTodosWrite).
+		body(object([]string{"assignee_ids"}, map[string]*Schema{
+			"assignee_ids": {Type: "array", Items: &Schema{Type: "integer", Minimum: Int64(1)}},
+		})).
+		ok(http.StatusOK, "todo", Ref("Todo")).
+		fail(http.StatusBadRequest, v1todos.ErrorMessageMissingArgument, v1todos.ErrorMessageAssigneeInvalid, v1todos.ErrorValidation).
+		fail(http.StatusNotFound, notFound...)
+	d.add(http.MethodGet, "/v1/shared/{token}", "getSharedTodo", "share tokenで公開されているtodoを取得する. 認証は要らない", tagTodos).
+		public().
+		ok(http.StatusOK, "todo", Ref("SharedTodo")).
+		fail(http.StatusNotFound, v1todos.ErrorMessageNotFound)
+	d.add(http.MethodGet, "/v1/ws", "todoWebSocket", "WebSocketでtodoの変更を送り、変更とpresenceを受け取る", tagTodos).
+		scope(model.ScopeTodosRead).
+		upgrade().
+		fail(http.StatusUnauthorized, v1ws.ErrorMessageUnidentified)
+}
+
+func syncPaths(d *Document) {
+	d.add(http.MethodGet, "/v1/sync", "getSyncChanges", "sinceより後の変更を返す. sinceを省略したら見れる全てのtodoを返す", tagSync).
+		scope(model.ScopeTodosRead).
+		query("since", "前の同期で返ったtoken", &Schema{Type: "string"}).
+		query("limit", "返す変更の数. default 100", &Schema{Type: "integer", Minimum: Int64(1), Maximum: Int64(500)}).
+		ok(http.StatusOK, "sync", Ref("Sync")).
+		fail(http.StatusBadRequest, v1sync.ErrorMessageInvalidToken, v1sync.ErrorValidation).
+		fail(http.StatusUnauthorized, v1sync.ErrorMessageUnidentified)
+	d.add(http.MethodPost, "/v1/sync", "pushSyncMutations", "オフラインでの変更を1件ずつ反映し、結果とsinceより後の変更を返す", tagSync).
+		scope(model.ScopeTodosWrite).
+		body(Ref("SyncRequest")).
+		ok(http.StatusOK, "sync", Ref("Sync")).
+		fail(http.StatusBadRequest, v1sync.ErrorMessageMissingArgument, v1sync.ErrorMessageInvalidToken, v1sync.ErrorValidation).
+		fail(http.StatusUnauthorized, v1sync.ErrorMessageUnidentified).
+		fail(http.StatusNotFound, v1sync.ErrorMessageNotFound)
+}
+
+func memberPaths(d *Document) {
+	d.add(http.MethodGet, "/v1/members", "listMembers", "callerのfamilyのメンバー", tagMembers).
+		scope(model.ScopeMembersRead).
+		ok(http.StatusOK, "members", &Schema{Type: "array", Items: Ref("Member")})
+	d.add(http.MethodPost, "/v1/members", "createMember", "callerのfamilyにメンバーを作る", tagMembers).
+		scope(model.ScopeMembersWrite).
+		body(Ref("MemberInput")).
+		ok(http.StatusCreated, "member", Ref("Member")).
+		fail(http.StatusBadRequest, v1members.ErrorMessageMissingArgument, v1members.ErrorValidation)
+}
+
+func accountPaths(d *Document) {
+	login := func(o *Operation) *Operation {
+		return o.noAPIKey().public().
+			ok(http.StatusOK, "login", Ref("Login")).
+			fail(http.StatusBadRequest, v1accounts.ErrorMessageMissingArgument).
+			fail(http.StatusTooManyRequests, v1accounts.ErrorMessageTooManyAttempts).
+			fail(http.StatusServiceUnavailable, v1accounts.ErrorMessageGuardUnavailable)
+	}
+	login(d.add(http.MethodPost, "/v1/login", "login", "emailとpasswordでloginする. TOTPが有効ならmfa_tokenが返る", tagAccounts)).
+		body(Ref("Credentials")).
+		fail(http.StatusUnauthorized, v1accounts.ErrorMessageInvalidCredentials)
+	login(d.add(http.MethodPost, "/v1/login/totp", "loginTOTP", "mfa_tokenとcodeかrecovery_codeでloginする", tagAccounts)).
+		body(Ref("TOTPRequest")).
+		fail(http.StatusUnauthorized, v1accounts.ErrorMessageInvalidMFAToken, v1accounts.ErrorMessageInvalidTOTP)
+
+	d.add(http.MethodPost, "/v1/accounts", "createAccount", "loginしているaccountのfamilyのメンバーにaccountを作る", tagAccounts).
+		noAPIKey().
+		body(Ref("AccountInput")).
+		ok(http.StatusCreated, "account", Ref("Account")).
+		fail(http.StatusBadRequest, v1accounts.ErrorMessageMissingArgument, v1accounts.ErrorValidation).
+		fail(http.StatusUnauthorized, v1accounts.ErrorMessageUnauthenticated).
+		fail(http.StatusNotFound, v1accounts.ErrorMessageMemberNotFound, v1accounts.ErrorMessageInvalidProvided).
+		fail(http.StatusConflict, v1accounts.ErrorMessageEmailAlreadyTaken)
+
+	me := func(o *Operation) *Operation {
+		return o.noAPIKey().
+			fail(http.StatusUnauthorized, v1accounts.ErrorMessageUnauthenticated).
+			fail(http.StatusNotFound, v1accounts.ErrorMessageNotFound, v1accounts.ErrorMessageInvalidProvided)
+	}
+	code := object([]string{"code"}, map[string]*Schema{"code": {Type: "string"}})
+	// verify, disableのcodeもloginと同じくguardで数える
+	guarded := func(o *Operation) *Operation {
+		return me(o).
+			fail(http.StatusTooManyRequests, v1accounts.ErrorMessageTooManyAttempts).
+			fail(http.StatusServiceUnavailable, v1accounts.ErrorMessageGuardUnavailable)
+	}
+	me(d.add(http.MethodGet, "/v1/accounts/me", "getMe", "loginしているaccount", tagAccounts)).
+		ok(http.StatusOK, "account", Ref("Account"))
+	me(d.add(http.MethodPost, "/v1/accounts/me/totp", "enrollTOTP", "TOTPのsecretを作る. verifyするまで有効にならない", tagAccounts)).
+		ok(http.StatusOK, "totp", Ref("TOTPEnrollment")).
+		fail(http.StatusConflict, v1accounts.ErrorMessageTOTPAlreadyEnabled)
+	guarded(d.add(http.MethodPost, "/v1/accounts/me/totp/verify", "verifyTOTP", "codeを確かめてTOTPを有効にし、recovery codeを返す", tagAccounts)).
+		body(code).
+		ok(http.StatusOK, "recovery_codes", &Schema{Type: "array", Items: &Schema{Type: "string"}}).
+		fail(http.StatusBadRequest, v1accounts.ErrorMessageMissingArgument, v1accounts.ErrorMessageTOTPNotEnrolled).
+		fail(http.StatusUnauthorized, v1accounts.ErrorMessageInvalidTOTP).
+		fail(http.StatusConflict, v1accounts.ErrorMessageTOTPAlreadyEnabled)
+	guarded(d.add(http.MethodDelete, "/v1/accounts/me/totp", "disableTOTP", "codeを確かめてTOTPを無効にする", tagAccounts)).
+		body(code).
+		ok(http.StatusOK, "", nil).
+		fail(http.StatusBadRequest, v1accounts.ErrorMessageMissingArgument, v1accounts.ErrorMessageTOTPNotEnrolled).
+		fail(http.StatusUnauthorized, v1accounts.ErrorMessageInvalidTOTP)
+}
+
+func adminPaths(d *Document) {
+	admin := func(o *Operation) *Operation {
+		o.Security = []SecurityRequirement{{"adminToken": {}}}
+		return o.noAPIKey().fail(http.StatusForbidden, errorAdminOnly)
+	}
+	admin(d.add(http.MethodPost, "/v1/admin/accounts", "bootstrapAccount", "familyの最初のメンバーとaccountを作る", tagAdmin)).
+		body(Ref("AccountBootstrap")).
+		ok(http.StatusCreated, "account", Ref("Account")).
+		fail(http.StatusBadRequest, v1accounts.ErrorMessageMissingArgument, v1accounts.ErrorValidation).
+		fail(http.StatusNotFound, v1accounts.ErrorMessageInvalidProvided).
+		fail(http.StatusConflict, v1accounts.ErrorMessageEmailAlreadyTaken).
+		fail(http.StatusInternalServerError, v1accounts.ErrorMessageInvalidProvided)
+	admin(d.add(http.MethodPost, "/v1/admin/unlock", "unlockLogin", "emailかIPのloginのlockを解除する", tagAdmin)).
+		body(object(nil, map[string]*Schema{
+			"email": {Type: "string"},
+			"ip":    {Type: "string"},
+		})).
+		ok(http.StatusOK, "", nil).
+		fail(http.StatusBadRequest, v1admin.ErrorMessageMissingArgument).
+		fail(http.StatusServiceUnavailable, v1admin.ErrorMessageInvalidProvided)
+	admin(d.add(http.MethodGet, "/v1/admin/cache", "getCacheStats", "todoのcacheのhit/miss回数", tagAdmin)).
+		ok(http.StatusOK, "cache", Ref("CacheStats"))
+	admin(d.add(http.MethodGet, "/v1/admin/db", "getPoolStats", "DBのconnection poolの状態. primary, replicaの順", tagAdmin)).
+		ok(http.StatusOK, "pools", &Schema{Type: "array", Items: Ref("PoolStats")})
+}
+
+func apiKeyPaths(d *Document) {
+	d.add(http.MethodGet, "/v1/api-keys", "listAPIKeys", "callerのAPI key. 平文のkeyは返さない", tagAPIKeys).
+		noAPIKey().
+		ok(http.StatusOK, "api_keys", &Schema{Type: "array", Items: Ref("APIKey")}).
+		fail(http.StatusUnauthorized, v1apikeys.ErrorMessageUnidentified).
+		fail(http.StatusNotFound, v1apikeys.ErrorMessageInvalidProvided)
+	d.add(http.MethodPost, "/v1/api-keys", "createAPIKey", "API keyを発行する. login sessionが要る. 平文のkeyはこのresponseでしか返らない", tagAPIKeys).
+		noAPIKey().
+		body(Ref("APIKeyInput")).
+		ok(http.StatusCreated, "api_key", Ref("APIKey")).
+		fail(http.StatusBadRequest, v1apikeys.ErrorMessageMissingArgument, v1apikeys.ErrorValidation).
+		fail(http.StatusUnauthorized, v1apikeys.ErrorMessageUnauthenticated).
+		fail(http.StatusNotFound, v1apikeys.ErrorMessageInvalidProvided).
+		fail(http.StatusInternalServerError, v1apikeys.ErrorMessageInvalidProvided)
+	d.add(http.MethodDelete, "/v1/api-keys/{id}", "revokeAPIKey", "API keyを無効にする", tagAPIKeys).
+		noAPIKey().
+		ok(http.StatusOK, "", nil).
+		fail(http.StatusUnauthorized, v1apikeys.ErrorMessageUnidentified).
+		fail(http.StatusNotFound, v1apikeys.ErrorMessageNotFound, v1apikeys.ErrorMessageInvalidProvided)
+}
+
+func webhookPaths(d *Document) {
+	webhook := func(o *Operation) *Operation {
+		return o.noAPIKey().
+			fail(http.StatusUnauthorized, v1webhooks.ErrorMessageUnidentified).
+			fail(http.StatusNotFound, v1webhooks.ErrorMessageNotFound, v1webhooks.ErrorMessageInvalidProvided)
+	}
+	d.add(http.MethodGet, "/v1/webhooks", "listWebhooks", "callerのfamilyのwebhook", tagWebhooks).
+		noAPIKey().
+		ok(http.StatusOK, "webhooks", &Schema{Type: "array", Items: Ref("Webhook")}).
+		fail(http.StatusUnauthorized, v1webhooks.ErrorMessageUnidentified)
+	d.add(http.MethodPost, "/v1/webhooks", "createWebhook", "webhookを作る. secretはこのresponseとrotateでしか返らない", tagWebhooks).
+		noAPIKey().
+		body(Ref("WebhookInput")).
+		ok(http.StatusCreated, "webhook", Ref("Webhook")).
+		fail(http.StatusBadRequest, v1webhooks.ErrorMessageMissingArgument, v1webhooks.ErrorValidation).
+		fail(http.StatusUnauthorized, v1webhooks.ErrorMessageUnidentified).
+		fail(http.StatusInternalServerError, v1webhooks.ErrorMessageInvalidProvided)
+	webhook(d.add(http.MethodGet, "/v1/webhooks/{id}", "getWebhook", "webhookを取得する", tagWebhooks)).
+		ok(http.StatusOK, "webhook", Ref("Webhook"))
+	webhook(d.add(http.MethodPut, "/v1/webhooks/{id}", "updateWebhook", "webhookのurl, event_typesを変える", tagWebhooks)).
+		body(Ref("WebhookInput")).
+		ok(http.StatusOK, "webhook", Ref("Webhook")).
+		fail(http.StatusBadRequest, v1webhooks.ErrorMessageMissingArgument, v1webhooks.ErrorValidation)
+	webhook(d.add(http.MethodDelete, "/v1/webhooks/{id}", "deleteWebhook", "webhookと配信の記録を削除する", tagWebhooks)).
+		ok(http.StatusOK, "", nil)
+	webhook(d.add(http.MethodPost, "/v1/webhooks/{id}/rotate", "rotateWebhookSecret", "secretを作り直す. 古いsecretでも24時間は署名を続ける", tagWebhooks)).
+		ok(http.StatusOK, "webhook", Ref("Webhook")).
+		fail(http.StatusInternalServerError, v1webhooks.ErrorMessageInvalidProvided)
+	webhook(d.add(http.MethodPost, "/v1/webhooks/{id}/test", "testWebhook", "webhook.testのeventを1回だけ送り、配信の記録を返す", tagWebhooks)).
+		ok(http.StatusOK, "delivery", Ref("WebhookDelivery"))
+	webhook(d.add(http.MethodGet, "/v1/webhooks/{id}/deliveries", "listWebhookDeliveries", "配信の記録を新しい順に返す", tagWebhooks)).
+		query("limit", "返す件数. default 50", &Schema{Type: "integer", Minimum: Int64(1), Maximum: Int64(100)}).
+		ok(http.StatusOK, "deliveries", &Schema{Type: "array", Items: Ref("WebhookDelivery")}).
+		fail(http.StatusBadRequest, v1webhooks.ErrorValidation)
+}
+
+func todoV2Paths(d *Document) {
+	notFound := []string{v2todos.ErrorMessageNotFound}
+
+	d.addV2(http.MethodGet, "/v2/todos", "listTodosV2", "見れるtodoの一覧. position, ID順", tagTodos).
+		scope(model.ScopeTodosRead).
+		query("assignee", "meか、メンバーのIDでassigneeを絞り込む", &Schema{Type: "string"}).
+		json(http.StatusOK, object([]string{"todos"}, map[string]*Schema{
+			"todos": {Type: "array", Items: Ref("TodoV2")},
+		})).
+		fail(http.StatusUnauthorized, v2todos.ErrorMessageUnidentified)
+	d.addV2(http.MethodPost, "/v2/todos", "createTodoV2", "todoを作り、作ったtodoを返す. completedはfalseで作る", tagTodos).
+		scope(model.ScopeTodosWrite).
+		body(Ref("TodoInputV2")).
+		json(http.StatusCreated, Ref("TodoV2")).
+		fail(http.StatusBadRequest, v2todos.ErrorMessageMissingArgument, v2todos.ErrorValidation).
+		fail(http.StatusInternalServerError, v2todos.ErrorMessageInvalidProvided)
+	d.addV2(http.MethodGet, "/v2/todos/{id}", "getTodoV2", "todoを取得する", tagTodos).
+		scope(model.ScopeTodosRead).
+		json(http.StatusOK, Ref("TodoV2")).
+		fail(http.StatusNotFound, notFound...)
+	d.addV2(http.MethodPut, "/v2/todos/{id}", "updateTodoV2", "todoを更新し、更新したtodoを返す. positionとvisibilityを省略したら今の値を引き継ぐ", tagTodos).
+		scope(model.ScopeTodosRead, model.ScopeTodosWrite).
+		body(Ref("TodoInputV2")).
+		json(http.StatusOK, Ref("TodoV2")).
+		fail(http.StatusBadRequest, v2todos.ErrorMessageMissingArgument, v2todos.ErrorValidation).
+		fail(http.StatusNotFound, notFound...).
+		fail(http.StatusInternalServerError, v2todos.ErrorMessageInvalidProvided)
+	d.addV2(http.MethodDelete, "/v2/todos/{id}", "deleteTodoV2", "todoを削除する", tagTodos).
+		scope(model.ScopeTodosRead, model.ScopeTodosWrite).
+		noContent().
+		fail(http.StatusNotFound, notFound...)
+}
+
+// add...operationを足す. pathの{name}はpath parameterにし、どのrouteでも返るerrorを入れておく
+func (d *Document) add(method, path, id, summary, tag string) *Operation {
+	return d.register(method, path, &Operation{OperationId: id, Summary: summary, Tags: []string{tag}, Responses: map[string]*Response{}})
+}
+
+// addV2.../v2のoperationを足す. path parameterはstringで、errorはproblemだけで返す
+func (d *Document) addV2(method, path, id, summary, tag string) *Operation {
+	return d.register(method, path, &Operation{OperationId: id, Summary: summary, Tags: []string{tag}, Responses: map[string]*Response{}, problem: true})
+}
+
+func (d *Document) register(method, path string, o *Operation) *Operation {
+	for _, m := range pathParam.FindAllStringSubmatch(path, -1) {
+		schema := &Schema{Type: "integer", Minimum: Int64(1)}
+		switch {
+		case o.problem:
+			schema = &Schema{Type: "string", MinLength: Int(1)}
+		case m[1] == "token":
+			schema = &Schema{Type: "string"}
+		}
+		o.Parameters = append(o.Parameters, Parameter{Name: m[1], In: InPath, Required: true, Schema: schema})
+		o.fail(http.StatusBadRequest, httpresponse.ErrorMessageInvalidRequest)
+	}
+
+	if d.Paths[path] == nil {
+		d.Paths[path] = PathItem{}
+	}
+	d.Paths[path][strings.ToLower(method)] = o
+	return o.
+		fail(http.StatusUnauthorized, errorInvalidAPIKey, errorInvalidSession).
+		fail(http.StatusInternalServerError, httpresponse.ErrorMessageInternal).
+		fail(http.StatusServiceUnavailable, httpresponse.ErrorMessageUnavailable)
+}
+
+// scope...API keyで呼ぶときに必要なscope
+func (o *Operation) scope(scopes ...string) *Operation {
+	o.Scopes = append(o.Scopes, scopes...)
+	return o.fail(http.StatusForbidden, errorInsufficientScope)
+}
+
+// noAPIKey...API keyでは呼べない
+func (o *Operation) noAPIKey() *Operation {
+	return o.fail(http.StatusForbidden, errorAPIKeyNotAllowed)
+}
+
+// public...認証しなくても呼べる
+func (o *Operation) public() *Operation {
+	o.Security = []SecurityRequirement{{}}
+	return o
+}
+
+// query, header...parameterを足す. どちらも省略できる. queryはdocumentのschemaで確かめる
+func (o *Operation) query(name, description string, schema *Schema) *Operation {
+	o.Parameters = append(o.Parameters, Parameter{Name: name, In: InQuery, Description: description, Schema: schema})
+	return o.fail(http.StatusBadRequest, httpresponse.ErrorMessageInvalidRequest)
+}
+
+func (o *Operation) header(name, description string, schema *Schema) *Operation {
+	o.Parameters = append(o.Parameters, Parameter{Name: name, In: "header", Description: description, Schema: schema})
+	return o
+}
+
+// body...JSONのrequest body
+func (o *Operation) body(schema *Schema) *Operation {
+	o.RequestBody = &RequestBody{Required: true, Content: map[string]MediaType{contentJSON: {Schema: schema}}}
+	return o.fail(http.StatusBadRequest, httpresponse.ErrorMessageInvalidRequest)
+}
+
+// ok...httpresponse.OKのresponse. fieldが空なら {"ok": true} だけ返る
+func (o *Operation) ok(status int, field string, schema *Schema) *Operation {
+	envelope := object([]string{"ok"}, map[string]*Schema{"ok": {Type: "boolean", Const: true}})
+	if field != "" {
+		envelope.Properties[field] = schema
+		envelope.Required = append(envelope.Required, field)
+	}
+	o.response(status, http.StatusText(status)).Content = map[string]MediaType{contentJSON: {Schema: envelope}}
+	return o
+}
+
+// json...envelopeを付けないJSONのresponse
+func (o *Operation) json(status int, schema *Schema) *Operation {
+	o.response(status, http.StatusText(status)).Content = map[string]MediaType{contentJSON: {Schema: schema}}
+	return o
+}
+
+// noContent...bodyの無いresponse
+func (o *Operation) noContent() *Operation {
+	o.response(http.StatusNoContent, http.StatusText(http.StatusNoContent))
+	return o
+}
+
+// stream...SSEのresponse
+func (o *Operation) stream() *Operation {
+	o.response(http.StatusOK, "eventごとに id, event, data を送る").Content = map[string]MediaType{
+		contentEventStream: {Schema: &Schema{Type: "string"}},
+	}
+	return o
+}
+
+// upgrade...WebSocketにupgradeする
+func (o *Operation) upgrade() *Operation {
+	o.response(http.StatusSwitchingProtocols, "WebSocketに切り替える. messageは {\"type\": ..., \"id\": ...} のJSON")
+	o.response(http.StatusBadRequest, "WebSocketのhandshakeではない")
+	return o
+}
+
+// fail...httpresponse.Errorのresponse. 同じstatusならerrorのenumに足す
+// problemだけで返すoperationはproblemのtypeのenumに足す
+func (o *Operation) fail(status int, codes ...string) *Operation {
+	res := o.response(status, http.StatusText(status))
+	if o.problem {
+		media, ok := res.Content[httpresponse.ContentTypeProblem]
+		if !ok {
+			media = MediaType{Schema: problemSchema()}
+			res.Content = map[string]MediaType{httpresponse.ContentTypeProblem: media}
+		}
+		typeSchema := media.Schema.Properties["type"]
+		for _, v := range codes {
+			if !contains(typeSchema.Enum, httpresponse.ProblemTypePrefix+v) {
+				typeSchema.Enum = append(typeSchema.Enum, httpresponse.ProblemTypePrefix+v)
+			}
+		}
+		return o
+	}
+
+	media, ok := res.Content[contentJSON]
+	if !ok {
+		media = MediaType{Schema: object([]string{"ok", "error"}, map[string]*Schema{
+			"ok":    {Type: "boolean", Const: false},
+			"error": {Type: "string"},
+			"warn":  {Type: "string", Description: "validationのときは理由"},
+			"errors": {Type: "array", Items: Ref("FieldError"),
+				Description: "invalid_requestのときにfieldごとの理由. documentに合わないrequestはhandlerに届く前に弾く"},
+		})}
+		res.Content = map[string]MediaType{contentJSON: media, httpresponse.ContentTypeProblem: {Schema: Ref("Problem")}}
+	}
+
+	errorSchema := media.Schema.Properties["error"]
+	for _, v := range codes {
+		if !contains(errorSchema.Enum, v) {
+			errorSchema.Enum = append(errorSchema.Enum, v)
+		}
+	}
+	return o
+}
+
+// problemSchema...httpresponse.Problemのschema. operationごとにtypeのenumを足すので毎回作る
+func problemSchema() *Schema {
+	problem := SchemaOf(httpresponse.Problem{})
+	problem.Properties["type"].Format = "uri"
+	problem.Properties["instance"].Description = "request ID"
+	problem.Properties["errors"] = &Schema{Type: "array", Items: Ref("FieldError")}
+	return problem
+}
+
+// object...propertiesを持つobject. 知らないpropertyは許さない
+func object(required []string, properties map[string]*Schema) *Schema {
+	return &Schema{Type: "object", Properties: properties, Required: required, AdditionalProperties: Bool(false)}
+}
+
+// scopes...API keyのscope
+func scopes() []interface{} {
+	return []interface{}{model.ScopeTodosRead, model.ScopeTodosWrite, model.ScopeMembersRead, model.ScopeMembersWrite}
+}
+
+// contains...enumにvがあるか. enumはmodel.Visibilityなどの型のままなので文字列にして比べる
+func contains(values []interface{}, v string) bool {
+	for _, e := range values {
+		if fmt.Sprint(e) == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,305 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	httpresponse "github.com/sioncojp/famili-api/utils/http_response"
+	"github.com/sioncojp/famili-api/utils/i18n"
+)
+
+const (
+	// InBody, InQuery, InPath...FieldErrorのIn
+	InBody  = "body"
+	InQuery = "query"
+	InPath  = "path"
+)
+
+// Find...methodとpathのoperationと、path parameterの値を返す. 無ければnil
+// /v1/todos/streamと/v1/todos/{id}のように両方に合うなら、固定のsegmentが多い方を選ぶ
+func (d *Document) Find(method, path string) (*Operation, map[string]string) {
+	method = strings.ToLower(method)
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+
+	var (
+		found  *Operation
+		params map[string]string
+		best   = -1
+	)
+	for template, item := range d.Paths {
+		o, ok := item[method]
+		if !ok {
+			continue
+		}
+		values, literals, ok := matchPath(strings.Split(strings.Trim(template, "/"), "/"), segments)
+		if ok && literals > best {
+			found, params, best = o, values, literals
+		}
+	}
+	return found, params
+}
+
+// matchPath...templateのsegmentとpathのsegmentを比べる. {name}は何にでも合う
+func matchPath(template, segments []string) (map[string]string, int, bool) {
+	if len(template) != len(segments) {
+		return nil, 0, false
+	}
+	values, literals := map[string]string{}, 0
+	for i, v := range template {
+		if strings.HasPrefix(v, "{") && strings.HasSuffix(v, "}") {
+			if segments[i] == "" {
+				return nil, 0, false
+			}
+			values[v[1:len(v)-1]] = segments[i]
+			continue
+		}
+		if v != segments[i] {
+			return nil, 0, false
+		}
+		literals++
+	}
+	return values, literals, true
+}
+
+// ValidateRequest...path parameter, query, bodyがoperationのschemaに合うか確かめる. headerは見ない
+// queryはdocumentに無いものを無視し、bodyは知らないpropertyもerrorにする
+func (d *Document) ValidateRequest(o *Operation, params map[string]string, query url.Values, body []byte) []httpresponse.FieldError {
+	errs := []httpresponse.FieldError{}
+	for _, p := range o.Parameters {
+		switch p.In {
+		case InPath:
+			errs = append(errs, d.validateParameter(p, params[p.Name], true)...)
+		case InQuery:
+			if _, ok := query[p.Name]; ok {
+				errs = append(errs, d.validateParameter(p, query.Get(p.Name), p.Required)...)
+			} else if p.Required {
+				errs = append(errs, httpresponse.NewFieldError(InQuery, p.Name, i18n.Required, nil))
+			}
+		}
+	}
+
+	if o.RequestBody != nil {
+		errs = append(errs, d.validateBody(o.RequestBody.Content[contentJSON].Schema, body, o.RequestBody.Required)...)
+	}
+	return errs
+}
+
+// ValidateResponse...JSONのresponseがstatusとContent-Typeのschemaに合うか確かめる. testでhandlerとdocumentがずれていないか見るために使う
+func (d *Document) ValidateResponse(o *Operation, status int, contentType string, body []byte) []httpresponse.FieldError {
+	res, ok := o.Responses[strconv.Itoa(status)]
+	if !ok {
+		return []httpresponse.FieldError{{In: InBody, Reason: fmt.Sprintf("status %d is not documented", status)}}
+	}
+	if i := strings.Index(contentType, ";"); i >= 0 {
+		contentType = strings.TrimSpace(contentType[:i])
+	}
+	media, ok := res.Content[contentType]
+	if !ok {
+		if contentType == contentJSON || contentType == httpresponse.ContentTypeProblem {
+			return []httpresponse.FieldError{{In: InBody, Reason: fmt.Sprintf("%s is not documented for status %d", contentType, status)}}
+		}
+		return nil
+	}
+	return d.validateBody(media.Schema, body, true)
+}
+
+// validateParameter...path, queryの文字列をschemaの型にしてから確かめる
+func (d *Document) validateParameter(p Parameter, raw string, required bool) []httpresponse.FieldError {
+	if raw == "" {
+		if required {
+			return []httpresponse.FieldError{httpresponse.NewFieldError(p.In, p.Name, i18n.Required, nil)}
+		}
+		return nil
+	}
+
+	var v interface{} = raw
+	switch d.Schema(p.Schema).Type {
+	case "integer", "number":
+		v = json.Number(raw)
+	case "boolean":
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return []httpresponse.FieldError{httpresponse.NewFieldError(p.In, p.Name, i18n.TypeInvalid, map[string]interface{}{"type": "boolean"})}
+		}
+		v = b
+	}
+	return d.Validate(p.Schema, v, p.In, p.Name)
+}
+
+// validateBody...bodyをJSONとして読み、schemaで確かめる
+func (d *Document) validateBody(schema *Schema, body []byte, required bool) []httpresponse.FieldError {
+	if len(bytes.TrimSpace(body)) == 0 {
+		if required {
+			return []httpresponse.FieldError{httpresponse.NewFieldError(InBody, "", i18n.Required, nil)}
+		}
+		return nil
+	}
+
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return []httpresponse.FieldError{httpresponse.NewFieldError(InBody, "", i18n.JSONInvalid, nil)}
+	}
+	if dec.More() {
+		return []httpresponse.FieldError{httpresponse.NewFieldError(InBody, "", i18n.JSONMultiple, nil)}
+	}
+	return d.Validate(schema, v, InBody, "")
+}
+
+// Validate...json.DecoderでUseNumberしたvがschemaに合うか確かめる. fieldは "mutations[0].op" のようにつなげる
+func (d *Document) Validate(schema *Schema, v interface{}, in, field string) []httpresponse.FieldError {
+	s := d.Schema(schema)
+	if s == nil {
+		return nil
+	}
+	fail := func(key string, params map[string]interface{}) []httpresponse.FieldError {
+		return []httpresponse.FieldError{httpresponse.NewFieldError(in, field, key, params)}
+	}
+	typeInvalid := func() []httpresponse.FieldError {
+		return fail(i18n.TypeInvalid, map[string]interface{}{"type": s.Type})
+	}
+
+	if v == nil {
+		if s.Nullable || s.Type == "" {
+			return nil
+		}
+		return fail(i18n.NotNull, nil)
+	}
+	if s.Const != nil && v != s.Const {
+		return fail(i18n.Const, map[string]interface{}{"value": s.Const})
+	}
+
+	switch s.Type {
+	case "object":
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return typeInvalid()
+		}
+		return d.validateObject(s, m, in, field)
+	case "array":
+		a, ok := v.([]interface{})
+		if !ok {
+			return typeInvalid()
+		}
+		if s.MinItems != nil && len(a) < *s.MinItems {
+			return fail(i18n.ItemsTooFew, map[string]interface{}{"min": *s.MinItems})
+		}
+		if s.MaxItems != nil && len(a) > *s.MaxItems {
+			return fail(i18n.ItemsTooMany, map[string]interface{}{"max": *s.MaxItems})
+		}
+		errs := []httpresponse.FieldError{}
+		for i, e := range a {
+			errs = append(errs, d.Validate(s.Items, e, in, fmt.Sprintf("%s[%d]", field, i))...)
+		}
+		return errs
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			return typeInvalid()
+		}
+		n := utf8.RuneCountInString(str)
+		if s.MinLength != nil && n < *s.MinLength || s.MaxLength != nil && n > *s.MaxLength {
+			return fail(lengthKey(s), map[string]interface{}{"min": intOr(s.MinLength, 0), "max": intOr(s.MaxLength, 0)})
+		}
+		if s.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339, str); err != nil {
+				return fail(i18n.DateTime, nil)
+			}
+		}
+	case "integer", "number":
+		num, ok := v.(json.Number)
+		if !ok {
+			return typeInvalid()
+		}
+		if s.Type == "integer" {
+			i, err := num.Int64()
+			if err != nil {
+				return typeInvalid()
+			}
+			if s.Minimum != nil && i < *s.Minimum {
+				return fail(i18n.Min, map[string]interface{}{"threshold": *s.Minimum})
+			}
+			if s.Maximum != nil && i > *s.Maximum {
+				return fail(i18n.Max, map[string]interface{}{"threshold": *s.Maximum})
+			}
+		} else if _, err := num.Float64(); err != nil {
+			return typeInvalid()
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return typeInvalid()
+		}
+	}
+
+	if len(s.Enum) > 0 && !contains(s.Enum, fmt.Sprint(v)) {
+		values := make([]string, 0, len(s.Enum))
+		for _, e := range s.Enum {
+			values = append(values, fmt.Sprint(e))
+		}
+		return fail(i18n.EnumInvalid, map[string]interface{}{"values": strings.Join(values, ", ")})
+	}
+	return nil
+}
+
+// validateObject...requiredと知らないpropertyを確かめてから、propertyごとに確かめる. errorの順番はproperty名の順
+func (d *Document) validateObject(s *Schema, m map[string]interface{}, in, field string) []httpresponse.FieldError {
+	errs := []httpresponse.FieldError{}
+	if s.MinProperties != nil && len(m) < *s.MinProperties {
+		errs = append(errs, httpresponse.NewFieldError(in, field, i18n.PropertiesTooFew, map[string]interface{}{"min": *s.MinProperties}))
+	}
+	for _, name := range s.Required {
+		if _, ok := m[name]; !ok {
+			errs = append(errs, httpresponse.NewFieldError(in, join(field, name), i18n.Required, nil))
+		}
+	}
+
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p, ok := s.Properties[name]
+		if !ok {
+			if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				errs = append(errs, httpresponse.NewFieldError(in, join(field, name), i18n.UnknownField, nil))
+			}
+			continue
+		}
+		errs = append(errs, d.Validate(p, m[name], in, join(field, name))...)
+	}
+	return errs
+}
+
+// lengthKey...minLength, maxLengthのどちらが決まっているかで文を変える
+func lengthKey(s *Schema) string {
+	switch {
+	case s.MinLength == nil:
+		return i18n.LengthTooLong
+	case s.MaxLength == nil:
+		return i18n.LengthTooShort
+	}
+	return i18n.LengthOutOfRange
+}
+
+func join(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
+
+func intOr(v *int, or int) int {
+	if v == nil {
+		return or
+	}
+	return *v
+}
@@ -0,0 +1,134 @@
+package openapi
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	httpresponse "github.com/sioncojp/famili-api/utils/http_response"
+	"github.com/sioncojp/famili-api/utils/i18n"
+)
+
+func TestFind(t *testing.T) {
+	t.Parallel()
+	d := New()
+	tests := []struct {
+		method, path string
+		want         string
+		params       map[string]string
+	}{
+		{method: "GET", path: "/v1/todos/stream", want: "streamTodos", params: map[string]string{}},
+		{method: "PUT", path: "/v1/todos/3", want: "updateTodo", params: map[string]string{"id": "3"}},
+		{method: "PUT", path: "/v1/todos/3/assignees/", want: "assignTodo", params: map[string]string{"id": "3"}},
+		{method: "GET", path: "/v1/todos/3"},
+		{method: "GET", path: "/v1/unknown"},
+	}
+	for _, tt := range tests {
+		o, params := d.Find(tt.method, tt.path)
+		if tt.want == "" {
+			assert.Nil(t, o, tt.path)
+			continue
+		}
+		if assert.NotNil(t, o, tt.path) {
+			assert.Equal(t, tt.want, o.OperationId)
+			assert.Equal(t, tt.params, params)
+		}
+	}
+}
+
+func TestValidateRequest(t *testing.T) {
+	t.Parallel()
+	d := New()
+	tests := []struct {
+		name         string
+		method, path string
+		query        url.Values
+		body         string
+		want         []httpresponse.FieldError
+	}{
+		{
+			name: "valid", method: "POST", path: "/v1/todos",
+			body: `{"title": "牛乳", "description": "2本", "visibility": "private"}`,
+			want: []httpresponse.FieldError{},
+		},
+		{
+			name: "unknown field", method: "POST", path: "/v1/todos",
+			body: `{"titel": "牛乳", "description": "2本"}`,
+			want: []httpresponse.FieldError{
+				{In: InBody, Field: "title", Reason: "is required", Code: i18n.Required},
+				{In: InBody, Field: "titel", Reason: "is unknown field", Code: i18n.UnknownField},
+			},
+		},
+		{
+			name: "wrong type", method: "POST", path: "/v1/todos",
+			body: `{"title": 1, "description": "", "completed": "yes", "visibility": "secret"}`,
+			want: []httpresponse.FieldError{
+				{In: InBody, Field: "completed", Reason: "must be of type boolean", Code: i18n.TypeInvalid, Params: map[string]interface{}{"type": "boolean"}},
+				{In: InBody, Field: "description", Reason: "must be between 1 and 100 characters", Code: i18n.LengthOutOfRange, Params: map[string]interface{}{"min": 1, "max": 100}},
+				{In: InBody, Field: "title", Reason: "must be of type string", Code: i18n.TypeInvalid, Params: map[string]interface{}{"type": "string"}},
+				{In: InBody, Field: "visibility", Reason: "must be one of private, family, public", Code: i18n.EnumInvalid, Params: map[string]interface{}{"values": "private, family, public"}},
+			},
+		},
+		{
+			name: "body required", method: "POST", path: "/v1/members",
+			want: []httpresponse.FieldError{{In: InBody, Reason: "is required", Code: i18n.Required}},
+		},
+		{
+			name: "invalid json", method: "POST", path: "/v1/members", body: `{"name":`,
+			want: []httpresponse.FieldError{{In: InBody, Reason: "must be valid JSON", Code: i18n.JSONInvalid}},
+		},
+		{
+			name: "path", method: "DELETE", path: "/v1/todos/abc",
+			want: []httpresponse.FieldError{{In: InPath, Field: "id", Reason: "must be of type integer", Code: i18n.TypeInvalid, Params: map[string]interface{}{"type": "integer"}}},
+		},
+		{
+			name: "query", method: "GET", path: "/v1/sync", query: url.Values{"limit": {"501"}},
+			want: []httpresponse.FieldError{{In: InQuery, Field: "limit", Reason: "must be no greater than 500", Code: i18n.Max, Params: map[string]interface{}{"threshold": int64(500)}}},
+		},
+		{
+			name: "nested", method: "POST", path: "/v1/sync",
+			body: `{"mutations": [{"client_id": "a", "op": "create"}, {"client_id": "b", "op": "move", "todo_id": -1}]}`,
+			want: []httpresponse.FieldError{
+				{In: InBody, Field: "mutations[1].op", Reason: "must be one of create, update, delete", Code: i18n.EnumInvalid, Params: map[string]interface{}{"values": "create, update, delete"}},
+				{In: InBody, Field: "mutations[1].todo_id", Reason: "must be no less than 0", Code: i18n.Min, Params: map[string]interface{}{"threshold": int64(0)}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			o, params := d.Find(tt.method, tt.path)
+			if assert.NotNil(t, o) {
+				assert.Equal(t, tt.want, d.ValidateRequest(o, params, tt.query, []byte(tt.body)))
+			}
+		})
+	}
+}
+
+func TestValidateResponse(t *testing.T) {
+	t.Parallel()
+	d := New()
+	o := d.Operation("post", "/v1/members")
+
+	assert.Empty(t, d.ValidateResponse(o, 201, contentJSON, []byte(`{"ok": true, "member": {
+		"ID": 1, "CreatedAt": "2026-10-19T00:00:00Z", "UpdatedAt": "2026-10-19T00:00:00Z", "name": "taro", "family_id": "1"
+	}}`)))
+	assert.Empty(t, d.ValidateResponse(o, 400, "application/json; charset=utf-8", []byte(`{"ok": false, "error": "missing_argument"}`)))
+	assert.Equal(t,
+		[]httpresponse.FieldError{{
+			In: InBody, Field: "error", Reason: "must be one of invalid_request, missing_argument, missing_validation",
+			Code: i18n.EnumInvalid, Params: map[string]interface{}{"values": "invalid_request, missing_argument, missing_validation"},
+		}},
+		d.ValidateResponse(o, 400, contentJSON, []byte(`{"ok": false, "error": "todo_not_found"}`)),
+	)
+	assert.Equal(t,
+		[]httpresponse.FieldError{{In: InBody, Reason: "status 418 is not documented"}},
+		d.ValidateResponse(o, 418, contentJSON, nil),
+	)
+	assert.Empty(t, d.ValidateResponse(o, 400, httpresponse.ContentTypeProblem, []byte(`{
+		"type": "urn:famili-api:problem:missing_validation", "title": "Bad Request", "status": 400,
+		"errors": [{"in": "body", "field": "name", "reason": "is required"}]
+	}`)))
+}
@@ -2,10 +2,21 @@ package config
 
 // Config...Tomlで設定したConfigのstruct
 type AppConfig struct {
-	Server  ServerConfig    `toml:"server"`
-	Service ServiceConfig   `toml:"service"`
-	MySQL   DataStoreConfig `toml:"mysql"`
-	Log     LogConfig       `toml:"log"`
+	Server    ServerConfig    `toml:"server"`
+	Service   ServiceConfig   `toml:"service"`
+	DataStore DriverConfig    `toml:"datastore"`
+	MySQL     DataStoreConfig `toml:"mysql"`
+	Postgres  DataStoreConfig `toml:"postgres"`
+	SQLite    SQLiteConfig    `toml:"sqlite"`
+	Cache     CacheConfig     `toml:"cache"`
+	Outbox    OutboxConfig    `toml:"outbox"`
+	Webhook   WebhookConfig   `toml:"webhook"`
+	Stream    StreamConfig    `toml:"stream"`
+	WebSocket WebSocketConfig `toml:"websocket"`
+	Log       LogConfig       `toml:"log"`
+	Security  SecurityConfig  `toml:"security"`
+	// Versions...API versionごとの廃止予定. [versions.v1] のように書く
+	Versions map[string]VersionConfig `toml:"versions"`
 }
 
 // ServerConfig...serverを立ち上げるために使うもの
@@ -20,6 +31,8 @@ type ServerConfig struct {
 // ServiceConfig...Service内で使うもの
 type ServiceConfig struct {
 	Env string `toml:"env"`
+	// SwaggerUI...trueなら /swagger でSwagger UIを出す. envがproductionなら常にfalse
+	SwaggerUI bool `toml:"swaggerUI"`
 }
 
 // LogConfig...logのstruct
@@ -34,6 +47,17 @@ type LogConfig struct {
 	ErrorOutputPaths []string `toml:"errorOutputPaths"`
 }
 
+// DriverConfig...repositoryの保存先を選ぶ
+type DriverConfig struct {
+	// mysql, postgres, sqlite or memory. default: mysql
+	// memoryはプロセス内に持つので、再起動すると消える. ローカル開発やデモ用
+	Driver string `toml:"driver"`
+
+	// 起動時に未適用のmigrationを適用する. MySQL, PostgreSQLはadvisory lockを取るので、複数台で同時に起動しても1台だけが流す
+	// default: false. falseなら famili-api migrate up で流す
+	AutoMigrate bool `toml:"autoMigrate"`
+}
+
 // DataStoreConfig...redis/mysqlなどdatastoreのstruct
 type DataStoreConfig struct {
 	Url      string `toml:"url"`
@@ -41,4 +65,168 @@ type DataStoreConfig struct {
 	DbName   string `toml:"dbName"`
 	Username string `toml:"username"`
 	Password string `toml:"password"`
+
+	// postgresのみ. disable, require, verify-ca, verify-full. default: disable
+	SSLMode string `toml:"sslMode"`
+
+	// コネクションpoolの上限. default: 25
+	MaxOpenConns int `toml:"maxOpenConns"`
+
+	// 使っていないコネクションを残す数. default: 25
+	MaxIdleConns int `toml:"maxIdleConns"`
+
+	// コネクションを使い回す秒数. DBやproxyのtimeoutより短くする. default: 300
+	ConnMaxLifetimeSeconds int `toml:"connMaxLifetimeSeconds"`
+
+	// 起動時に接続できなかったときにやり直す回数. 1秒から倍々で待つ(最大30秒). -1ならやり直さない. default: 10
+	ConnectRetries int `toml:"connectRetries"`
+
+	// GetById, Listを振り分けるreplica. 空ならprimaryだけ使う
+	Replicas []ReplicaConfig `toml:"replicas"`
+
+	// 書き込んだcallerがprimaryから読む秒数. replicaの遅延より長くする. default: 5
+	StickySeconds int `toml:"stickySeconds"`
+
+	// primary, replicaのhealth checkの間隔(秒). default: 10
+	HealthCheckSeconds int `toml:"healthCheckSeconds"`
+
+	// Lazy...起動時に繋がらなくても開くだけにする. replicaを開くときに使い、configには書かない
+	Lazy bool `toml:"-"`
+}
+
+// ReplicaConfig...読み込み専用のreplica. dbName, username, passwordはprimaryと同じものを使う
+type ReplicaConfig struct {
+	Url string `toml:"url"`
+
+	// default: primaryと同じport
+	Port string `toml:"port"`
+}
+
+// SQLiteConfig...1家族だけでself-hostするときのSQLite
+type SQLiteConfig struct {
+	// DBファイルのpath. default: famili-api.db
+	Path string `toml:"path"`
+}
+
+// CacheConfig...todoのcache. GetById, List, ListByAssigneeの結果を持つ
+type CacheConfig struct {
+	// none, lru or redis. default: none
+	// lruはプロセス内に持つので、複数台で動かすならredisを使う
+	Driver string `toml:"driver"`
+
+	// lruで持つ件数. default: 1000
+	Size int `toml:"size"`
+
+	// cacheの有効期限(秒). default: 60
+	TTLSeconds int `toml:"ttlSeconds"`
+
+	// redisのときに使う. host:port
+	RedisAddr     string `toml:"redisAddr"`
+	RedisPassword string `toml:"redisPassword"`
+	RedisDB       int    `toml:"redisDB"`
+
+	// redisのkeyのprefix. default: famili-api:
+	KeyPrefix string `toml:"keyPrefix"`
+}
+
+// OutboxConfig...todoの変更eventをoutboxから配信するrelay
+type OutboxConfig struct {
+	// 配信先. log, http, webhook, stream or none. noneだけならrelayを動かさない. default: ["log", "webhook", "stream"]
+	Sinks []string `toml:"sinks"`
+
+	// httpのときにeventをPOSTするurl
+	HTTPUrl string `toml:"httpUrl"`
+
+	// httpのtimeout(秒). default: 5
+	HTTPTimeoutSeconds int `toml:"httpTimeoutSeconds"`
+
+	// outboxを見る間隔(ミリ秒). default: 1000
+	IntervalMillis int `toml:"intervalMillis"`
+
+	// 1回に取り出すevent数. default: 100
+	BatchSize int `toml:"batchSize"`
+
+	// 1つのeventを試す回数. 1秒から倍々で10分まで待ってやり直し、超えたらfailedにしてoutboxに残す. default: 20
+	MaxAttempts int `toml:"maxAttempts"`
+}
+
+// WebhookConfig.../v1/webhooks で登録されたURLへの配信. [outbox] sinksにwebhookがあるときだけ配信する
+type WebhookConfig struct {
+	// 1つの配信を試す回数. 10秒から倍々で待ってやり直す. default: 8
+	MaxAttempts int `toml:"maxAttempts"`
+
+	// 連続でこの回数配信に失敗したwebhookを無効にする. default: 15
+	DisableAfterFailures int `toml:"disableAfterFailures"`
+
+	// POSTのtimeout(秒). default: 10
+	TimeoutSeconds int `toml:"timeoutSeconds"`
+
+	// 配信を見る間隔(ミリ秒). default: 1000
+	IntervalMillis int `toml:"intervalMillis"`
+
+	// 1回に取り出す配信数. default: 50
+	BatchSize int `toml:"batchSize"`
+
+	// trueならloopback, link-local, privateのaddressにも送る. 手元で受け口を立てて試すときだけ使う. default: false
+	AllowPrivateNetworks bool `toml:"allowPrivateNetworks"`
+}
+
+// StreamConfig...GET /v1/todos/stream のSSE. [outbox] sinksにstreamがあるときだけeventが流れる
+type StreamConfig struct {
+	// Last-Event-IDで送り直すために残すevent数. default: 1000
+	BufferSize int `toml:"bufferSize"`
+
+	// 1つのstreamで送るのを待てるevent数. 超えたらstreamを閉じてclientに再接続させる. default: 64
+	QueueSize int `toml:"queueSize"`
+
+	// heartbeatのcommentを送る間隔(秒). default: 15
+	HeartbeatSeconds int `toml:"heartbeatSeconds"`
+
+	// 1回の書き込みの上限(秒). serverのWriteTimeoutの代わりに使う. default: 10
+	WriteTimeoutSeconds int `toml:"writeTimeoutSeconds"`
+}
+
+// WebSocketConfig.../v1/ws の接続ごとの制限. eventは[stream]と同じbrokerから受け取る
+type WebSocketConfig struct {
+	// 1つの接続から受け付ける1秒あたりのmessage数. default: 10
+	MessagesPerSecond float64 `toml:"messagesPerSecond"`
+
+	// 一度に受け付けられるmessage数. default: 20
+	Burst int `toml:"burst"`
+
+	// 1つの接続で送るのを待てるmessage数. 超えたら接続を閉じてclientに再接続させる. default: 64
+	QueueSize int `toml:"queueSize"`
+
+	// clientから届く1つのmessageの上限(byte). default: 4096
+	MaxMessageBytes int64 `toml:"maxMessageBytes"`
+
+	// pingを送る間隔(秒). default: 30
+	PingSeconds int `toml:"pingSeconds"`
+
+	// 1回の書き込みの上限(秒). default: 10
+	WriteTimeoutSeconds int `toml:"writeTimeoutSeconds"`
+}
+
+// SecurityConfig...暗号化や署名に使う鍵. ssm://で ParameterStoreから取得できる
+type SecurityConfig struct {
+	// TOTPとwebhookのsecretを暗号化するための鍵. base64でencodeした32byte
+	TOTPEncryptionKey string `toml:"totpEncryptionKey"`
+
+	// login sessionのtokenに署名するための鍵. base64でencodeした32byte以上
+	SessionSigningKey string `toml:"sessionSigningKey"`
+
+	// 管理用endpointを叩くためのtoken. 空なら管理用endpointは使えない
+	AdminToken string `toml:"adminToken"`
+
+	// X-Forwarded-For, X-Real-IPを信じるproxyのIPかCIDR. 空ならheaderは見ず、接続元のIPをclientのIPにする
+	TrustedProxies []string `toml:"trustedProxies"`
+}
+
+// VersionConfig...API versionの廃止予定. どちらもRFC 3339で書く
+type VersionConfig struct {
+	// 非推奨にした日時. 書けばDeprecation headerを返す
+	Deprecation string `toml:"deprecation"`
+
+	// 使えなくなる日時. 書けばSunset headerを返す
+	Sunset string `toml:"sunset"`
 }
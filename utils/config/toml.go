@@ -1,7 +1,10 @@
 package config
 
 import (
+	"encoding/base64"
+	"net"
 	"os"
+	"time"
 
 	"github.com/pkg/errors"
 	toml "github.com/sioncojp/tomlssm"
@@ -12,6 +15,73 @@ const (
 	ServerPort = "8080"
 	MySQLPort  = "3306"
 	LogLevel   = "info"
+
+	PostgresPort    = "5432"
+	PostgresSSLMode = "disable"
+	SQLitePath      = "famili-api.db"
+
+	// MaxOpenConns, MaxIdleConns, ConnMaxLifetimeSeconds, ConnectRetries...mysql, postgresのpoolと起動時のretry
+	MaxOpenConns           = 25
+	MaxIdleConns           = 25
+	ConnMaxLifetimeSeconds = 300
+	ConnectRetries         = 10
+
+	// StickySeconds, HealthCheckSeconds...replicaを使うときのdefault
+	StickySeconds      = 5
+	HealthCheckSeconds = 10
+
+	// DriverMySQL, DriverPostgres, DriverSQLite, DriverMemory...[datastore] driverに指定できる値
+	DriverMySQL    = "mysql"
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+	DriverMemory   = "memory"
+
+	// CacheNone, CacheLRU, CacheRedis...[cache] driverに指定できる値
+	CacheNone       = "none"
+	CacheLRU        = "lru"
+	CacheRedis      = "redis"
+	CacheSize       = 1000
+	CacheTTLSeconds = 60
+	CacheKeyPrefix  = "famili-api:"
+
+	// OutboxSinkNone, OutboxSinkLog, OutboxSinkHTTP, OutboxSinkWebhook, OutboxSinkStream...[outbox] sinksに指定できる値
+	OutboxSinkNone           = "none"
+	OutboxSinkLog            = "log"
+	OutboxSinkHTTP           = "http"
+	OutboxSinkWebhook        = "webhook"
+	OutboxSinkStream         = "stream"
+	OutboxHTTPTimeoutSeconds = 5
+	OutboxIntervalMillis     = 1000
+	OutboxBatchSize          = 100
+	OutboxMaxAttempts        = 20
+
+	WebhookMaxAttempts          = 8
+	WebhookDisableAfterFailures = 15
+	WebhookTimeoutSeconds       = 10
+	WebhookIntervalMillis       = 1000
+	WebhookBatchSize            = 50
+
+	StreamBufferSize          = 1000
+	StreamQueueSize           = 64
+	StreamHeartbeatSeconds    = 15
+	StreamWriteTimeoutSeconds = 10
+
+	WebSocketMessagesPerSecond   = 10
+	WebSocketBurst               = 20
+	WebSocketQueueSize           = 64
+	WebSocketMaxMessageBytes     = 4096
+	WebSocketPingSeconds         = 30
+	WebSocketWriteTimeoutSeconds = 10
+
+	// VersionV1, VersionV2...[versions]に書けるAPI version. application.VersionのNameと同じ
+	VersionV1 = "v1"
+	VersionV2 = "v2"
+
+	// EnvProduction...[service] envの本番の値
+	EnvProduction = "production"
+
+	// EncryptionKeyLength...AES-256の鍵の長さ
+	EncryptionKeyLength = 32
 )
 
 type ValidateFunc func(*AppConfig) error
@@ -37,10 +107,10 @@ func (c *AppConfig) Validate(validateFuncs ...ValidateFunc) error {
 		}
 	}
 
-	// エラーが1つでもあれば返す
+	// エラーが1つでもあれば返す. errors.Wrap(nil, ...)はnilなので、最初のエラーに後のエラーを重ねる
 	if len(errorCollector) > 0 {
-		var result error
-		for _, v := range errorCollector {
+		result := errorCollector[0]
+		for _, v := range errorCollector[1:] {
 			result = errors.Wrap(result, v.Error())
 		}
 
@@ -69,6 +139,22 @@ var ValidateServiceConfig ValidateFunc = func(c *AppConfig) error {
 	if v.Env == "" {
 		return errors.New("env is not set in validateService")
 	}
+	// 本番ではSwagger UIを出さない
+	if v.Env == EnvProduction {
+		c.Service.SwaggerUI = false
+	}
+	return nil
+}
+
+// ValidateDataStoreConfig...DataStore Structのvalidate
+var ValidateDataStoreConfig ValidateFunc = func(c *AppConfig) error {
+	switch c.DataStore.Driver {
+	case "":
+		c.DataStore.Driver = DriverMySQL
+	case DriverMySQL, DriverPostgres, DriverSQLite, DriverMemory:
+	default:
+		return errors.Errorf("unknown driver %q in validateDataStore", c.DataStore.Driver)
+	}
 	return nil
 }
 
@@ -79,9 +165,241 @@ var ValidateMySQLConfig ValidateFunc = func(c *AppConfig) error {
 		c.MySQL.Port = MySQLPort
 	}
 
+	validatePool(&c.MySQL)
+	return validateReplicas(&c.MySQL, "validateMySQL")
+}
+
+// ValidatePostgresConfig...Postgres Structのvalidate
+var ValidatePostgresConfig ValidateFunc = func(c *AppConfig) error {
+	v := c.Postgres
+	if v.Port == "" {
+		c.Postgres.Port = PostgresPort
+	}
+
+	switch v.SSLMode {
+	case "":
+		c.Postgres.SSLMode = PostgresSSLMode
+	case "disable", "require", "verify-ca", "verify-full":
+	default:
+		return errors.Errorf("unknown sslMode %q in validatePostgres", v.SSLMode)
+	}
+	validatePool(&c.Postgres)
+	return validateReplicas(&c.Postgres, "validatePostgres")
+}
+
+// validatePool...poolの上限と起動時のretryを初期化する
+func validatePool(v *DataStoreConfig) {
+	if v.MaxOpenConns <= 0 {
+		v.MaxOpenConns = MaxOpenConns
+	}
+	if v.MaxIdleConns <= 0 {
+		v.MaxIdleConns = MaxIdleConns
+	}
+	// idleがopenより多くても使われないので揃える
+	if v.MaxIdleConns > v.MaxOpenConns {
+		v.MaxIdleConns = v.MaxOpenConns
+	}
+	if v.ConnMaxLifetimeSeconds <= 0 {
+		v.ConnMaxLifetimeSeconds = ConnMaxLifetimeSeconds
+	}
+	if v.ConnectRetries < 0 {
+		v.ConnectRetries = 0
+	} else if v.ConnectRetries == 0 {
+		v.ConnectRetries = ConnectRetries
+	}
+}
+
+// validateReplicas...replicaのportをprimaryに揃え、stickyとhealth checkの間隔を初期化する
+func validateReplicas(v *DataStoreConfig, name string) error {
+	for i, r := range v.Replicas {
+		if r.Url == "" {
+			return errors.Errorf("url of replicas[%d] is not set in %s", i, name)
+		}
+		if r.Port == "" {
+			v.Replicas[i].Port = v.Port
+		}
+	}
+
+	if v.StickySeconds <= 0 {
+		v.StickySeconds = StickySeconds
+	}
+	if v.HealthCheckSeconds <= 0 {
+		v.HealthCheckSeconds = HealthCheckSeconds
+	}
+	return nil
+}
+
+// ValidateSQLiteConfig...SQLite Structのvalidate
+var ValidateSQLiteConfig ValidateFunc = func(c *AppConfig) error {
+	v := c.SQLite
+	if v.Path == "" {
+		c.SQLite.Path = SQLitePath
+	}
+	return nil
+}
+
+// ValidateCacheConfig...Cache Structのvalidate
+var ValidateCacheConfig ValidateFunc = func(c *AppConfig) error {
+	v := c.Cache
+	switch v.Driver {
+	case "":
+		c.Cache.Driver = CacheNone
+	case CacheNone, CacheLRU:
+	case CacheRedis:
+		if v.RedisAddr == "" {
+			return errors.New("redisAddr is not set in validateCache")
+		}
+	default:
+		return errors.Errorf("unknown driver %q in validateCache", v.Driver)
+	}
+
+	if v.Size <= 0 {
+		c.Cache.Size = CacheSize
+	}
+	if v.TTLSeconds <= 0 {
+		c.Cache.TTLSeconds = CacheTTLSeconds
+	}
+	if v.KeyPrefix == "" {
+		c.Cache.KeyPrefix = CacheKeyPrefix
+	}
+	return nil
+}
+
+// ValidateOutboxConfig...Outbox Structのvalidate
+var ValidateOutboxConfig ValidateFunc = func(c *AppConfig) error {
+	v := c.Outbox
+	if len(v.Sinks) == 0 {
+		c.Outbox.Sinks = []string{OutboxSinkLog, OutboxSinkWebhook, OutboxSinkStream}
+	}
+	for _, sink := range c.Outbox.Sinks {
+		switch sink {
+		case OutboxSinkNone, OutboxSinkLog, OutboxSinkWebhook, OutboxSinkStream:
+		case OutboxSinkHTTP:
+			if v.HTTPUrl == "" {
+				return errors.New("httpUrl is not set in validateOutbox")
+			}
+		default:
+			return errors.Errorf("unknown sink %q in validateOutbox", sink)
+		}
+	}
+
+	if v.HTTPTimeoutSeconds <= 0 {
+		c.Outbox.HTTPTimeoutSeconds = OutboxHTTPTimeoutSeconds
+	}
+	if v.IntervalMillis <= 0 {
+		c.Outbox.IntervalMillis = OutboxIntervalMillis
+	}
+	if v.BatchSize <= 0 {
+		c.Outbox.BatchSize = OutboxBatchSize
+	}
+	if v.MaxAttempts <= 0 {
+		c.Outbox.MaxAttempts = OutboxMaxAttempts
+	}
+	return nil
+}
+
+// ValidateWebhookConfig...Webhook Structのvalidate
+var ValidateWebhookConfig ValidateFunc = func(c *AppConfig) error {
+	v := c.Webhook
+	if v.MaxAttempts <= 0 {
+		c.Webhook.MaxAttempts = WebhookMaxAttempts
+	}
+	if v.DisableAfterFailures <= 0 {
+		c.Webhook.DisableAfterFailures = WebhookDisableAfterFailures
+	}
+	if v.TimeoutSeconds <= 0 {
+		c.Webhook.TimeoutSeconds = WebhookTimeoutSeconds
+	}
+	if v.IntervalMillis <= 0 {
+		c.Webhook.IntervalMillis = WebhookIntervalMillis
+	}
+	if v.BatchSize <= 0 {
+		c.Webhook.BatchSize = WebhookBatchSize
+	}
+	return nil
+}
+
+// ValidateStreamConfig...Stream Structのvalidate
+var ValidateStreamConfig ValidateFunc = func(c *AppConfig) error {
+	v := c.Stream
+	if v.BufferSize <= 0 {
+		c.Stream.BufferSize = StreamBufferSize
+	}
+	if v.QueueSize <= 0 {
+		c.Stream.QueueSize = StreamQueueSize
+	}
+	if v.HeartbeatSeconds <= 0 {
+		c.Stream.HeartbeatSeconds = StreamHeartbeatSeconds
+	}
+	if v.WriteTimeoutSeconds <= 0 {
+		c.Stream.WriteTimeoutSeconds = StreamWriteTimeoutSeconds
+	}
+	return nil
+}
+
+// ValidateWebSocketConfig...WebSocket Structのvalidate
+var ValidateWebSocketConfig ValidateFunc = func(c *AppConfig) error {
+	v := c.WebSocket
+	if v.MessagesPerSecond <= 0 {
+		c.WebSocket.MessagesPerSecond = WebSocketMessagesPerSecond
+	}
+	if v.Burst <= 0 {
+		c.WebSocket.Burst = WebSocketBurst
+	}
+	if v.QueueSize <= 0 {
+		c.WebSocket.QueueSize = WebSocketQueueSize
+	}
+	if v.MaxMessageBytes <= 0 {
+		c.WebSocket.MaxMessageBytes = WebSocketMaxMessageBytes
+	}
+	if v.PingSeconds <= 0 {
+		c.WebSocket.PingSeconds = WebSocketPingSeconds
+	}
+	if v.WriteTimeoutSeconds <= 0 {
+		c.WebSocket.WriteTimeoutSeconds = WebSocketWriteTimeoutSeconds
+	}
+	return nil
+}
+
+// ValidateVersionsConfig...Versions Mapのvalidate. 書いていないversionには廃止予定のheaderを付けない
+// [versions.v01]のような無いversionは書き間違いなのでerrorにする
+var ValidateVersionsConfig ValidateFunc = func(c *AppConfig) error {
+	if c.Versions == nil {
+		c.Versions = map[string]VersionConfig{}
+	}
+	for name, v := range c.Versions {
+		switch name {
+		case VersionV1, VersionV2:
+		default:
+			return errors.Errorf("unknown version %q in validateVersions", name)
+		}
+
+		deprecation, sunset, err := v.Dates()
+		if err != nil {
+			return errors.Wrapf(err, "versions.%s in validateVersions", name)
+		}
+		if !deprecation.IsZero() && !sunset.IsZero() && sunset.Before(deprecation) {
+			return errors.Errorf("versions.%s sunset must not be before deprecation in validateVersions", name)
+		}
+	}
 	return nil
 }
 
+// Dates...Deprecation, Sunsetをtimeにする. 空ならゼロ値
+func (v VersionConfig) Dates() (deprecation, sunset time.Time, err error) {
+	if v.Deprecation != "" {
+		if deprecation, err = time.Parse(time.RFC3339, v.Deprecation); err != nil {
+			return time.Time{}, time.Time{}, errors.Wrap(err, "deprecation")
+		}
+	}
+	if v.Sunset != "" {
+		if sunset, err = time.Parse(time.RFC3339, v.Sunset); err != nil {
+			return time.Time{}, time.Time{}, errors.Wrap(err, "sunset")
+		}
+	}
+	return deprecation, sunset, nil
+}
+
 // ValidateLogConfig...Log Structのvalidate
 var ValidateLogConfig ValidateFunc = func(c *AppConfig) error {
 	v := c.Log
@@ -90,3 +408,43 @@ var ValidateLogConfig ValidateFunc = func(c *AppConfig) error {
 	}
 	return nil
 }
+
+// ValidateSecurityConfig...Security Structのvalidate
+var ValidateSecurityConfig ValidateFunc = func(c *AppConfig) error {
+	v := c.Security
+	key, err := base64.StdEncoding.DecodeString(v.TOTPEncryptionKey)
+	if err != nil || len(key) != EncryptionKeyLength {
+		return errors.New("totpEncryptionKey must be base64 encoded 32 bytes in validateSecurity")
+	}
+
+	key, err = base64.StdEncoding.DecodeString(v.SessionSigningKey)
+	if err != nil || len(key) < EncryptionKeyLength {
+		return errors.New("sessionSigningKey must be base64 encoded 32 bytes or more in validateSecurity")
+	}
+
+	if _, err := v.TrustedProxyNets(); err != nil {
+		return errors.Wrap(err, "validateSecurity")
+	}
+	return nil
+}
+
+// TrustedProxyNets...trustedProxiesをCIDRにする. IPだけなら/32, /128として扱う
+func (c SecurityConfig) TrustedProxyNets() ([]*net.IPNet, error) {
+	result := make([]*net.IPNet, 0, len(c.TrustedProxies))
+	for _, v := range c.TrustedProxies {
+		if ip := net.ParseIP(v); ip != nil {
+			if ip4 := ip.To4(); ip4 != nil {
+				ip = ip4
+			}
+			bits := 8 * len(ip)
+			result = append(result, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, errors.Errorf("trustedProxies %q must be an IP or CIDR", v)
+		}
+		result = append(result, n)
+	}
+	return result, nil
+}
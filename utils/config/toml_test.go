@@ -49,3 +49,306 @@ password   = "password"
 		}
 	}
 }
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+	key := "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="
+
+	// どのvalidatorのerrorでも、他のvalidatorが通っていても返す
+	c := &AppConfig{}
+	err := c.Validate(ValidateServerConfig, ValidateSecurityConfig)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "totpEncryptionKey")
+	}
+	err = c.Validate(ValidateServiceConfig, ValidateSecurityConfig)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "totpEncryptionKey")
+		assert.Contains(t, err.Error(), "validateService")
+	}
+
+	c = &AppConfig{Service: ServiceConfig{Env: "development"}, Security: SecurityConfig{TOTPEncryptionKey: key, SessionSigningKey: key}}
+	assert.NoError(t, c.Validate(ValidateServerConfig, ValidateServiceConfig, ValidateSecurityConfig))
+}
+
+func TestValidateSecurityConfig(t *testing.T) {
+	t.Parallel()
+	key := "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="
+	cases := []struct {
+		name    string
+		config  SecurityConfig
+		wantErr bool
+	}{
+		{"ok", SecurityConfig{TOTPEncryptionKey: key, SessionSigningKey: key}, false},
+		{"empty", SecurityConfig{}, true},
+		{"short encryption key", SecurityConfig{TOTPEncryptionKey: "c2hvcnQ=", SessionSigningKey: key}, true},
+		{"not base64", SecurityConfig{TOTPEncryptionKey: key, SessionSigningKey: "ssm://not-resolved"}, true},
+		{"trusted proxies", SecurityConfig{TOTPEncryptionKey: key, SessionSigningKey: key, TrustedProxies: []string{"10.0.0.0/8", "192.0.2.1", "::1"}}, false},
+		{"invalid trusted proxy", SecurityConfig{TOTPEncryptionKey: key, SessionSigningKey: key, TrustedProxies: []string{"lb.example.com"}}, true},
+	}
+
+	for _, v := range cases {
+		c := &AppConfig{Security: v.config}
+		err := ValidateSecurityConfig(c)
+		if (err != nil) != v.wantErr {
+			t.Errorf("%s: want error %v got %v", v.name, v.wantErr, err)
+		}
+	}
+}
+
+func TestValidateServiceConfig(t *testing.T) {
+	t.Parallel()
+	assert.Error(t, ValidateServiceConfig(&AppConfig{}))
+
+	c := &AppConfig{Service: ServiceConfig{Env: "development", SwaggerUI: true}}
+	assert.NoError(t, ValidateServiceConfig(c))
+	assert.True(t, c.Service.SwaggerUI)
+
+	c = &AppConfig{Service: ServiceConfig{Env: EnvProduction, SwaggerUI: true}}
+	assert.NoError(t, ValidateServiceConfig(c))
+	assert.False(t, c.Service.SwaggerUI)
+}
+
+func TestValidateDataStoreConfig(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		name    string
+		driver  string
+		want    string
+		wantErr bool
+	}{
+		{"default", "", DriverMySQL, false},
+		{"mysql", "mysql", DriverMySQL, false},
+		{"postgres", "postgres", DriverPostgres, false},
+		{"sqlite", "sqlite", DriverSQLite, false},
+		{"memory", "memory", DriverMemory, false},
+		{"unknown", "redis", "redis", true},
+	}
+
+	for _, v := range cases {
+		c := &AppConfig{DataStore: DriverConfig{Driver: v.driver}}
+		err := ValidateDataStoreConfig(c)
+		if (err != nil) != v.wantErr {
+			t.Errorf("%s: want error %v got %v", v.name, v.wantErr, err)
+		}
+		assert.Equal(t, v.want, c.DataStore.Driver, v.name)
+	}
+}
+
+func TestValidatePostgresConfig(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		name        string
+		config      DataStoreConfig
+		wantPort    string
+		wantSSLMode string
+		wantErr     bool
+	}{
+		{"default", DataStoreConfig{}, PostgresPort, PostgresSSLMode, false},
+		{"custom", DataStoreConfig{Port: "15432", SSLMode: "verify-full"}, "15432", "verify-full", false},
+		{"unknown sslMode", DataStoreConfig{SSLMode: "on"}, PostgresPort, "on", true},
+	}
+
+	for _, v := range cases {
+		c := &AppConfig{Postgres: v.config}
+		err := ValidatePostgresConfig(c)
+		if (err != nil) != v.wantErr {
+			t.Errorf("%s: want error %v got %v", v.name, v.wantErr, err)
+		}
+		assert.Equal(t, v.wantPort, c.Postgres.Port, v.name)
+		assert.Equal(t, v.wantSSLMode, c.Postgres.SSLMode, v.name)
+	}
+}
+
+func TestValidateCacheConfig(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		name       string
+		config     CacheConfig
+		wantDriver string
+		wantSize   int
+		wantErr    bool
+	}{
+		{"default", CacheConfig{}, CacheNone, CacheSize, false},
+		{"lru", CacheConfig{Driver: CacheLRU, Size: 10}, CacheLRU, 10, false},
+		{"redis", CacheConfig{Driver: CacheRedis, RedisAddr: "localhost:6379"}, CacheRedis, CacheSize, false},
+		{"redis without addr", CacheConfig{Driver: CacheRedis}, CacheRedis, 0, true},
+		{"unknown driver", CacheConfig{Driver: "memcached"}, "memcached", 0, true},
+	}
+
+	for _, v := range cases {
+		c := &AppConfig{Cache: v.config}
+		err := ValidateCacheConfig(c)
+		if (err != nil) != v.wantErr {
+			t.Errorf("%s: want error %v got %v", v.name, v.wantErr, err)
+		}
+		if v.wantErr {
+			continue
+		}
+		assert.Equal(t, v.wantDriver, c.Cache.Driver, v.name)
+		assert.Equal(t, v.wantSize, c.Cache.Size, v.name)
+		assert.Equal(t, CacheTTLSeconds, c.Cache.TTLSeconds, v.name)
+		assert.Equal(t, CacheKeyPrefix, c.Cache.KeyPrefix, v.name)
+	}
+}
+
+func TestValidateOutboxConfig(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		name      string
+		config    OutboxConfig
+		wantSinks []string
+		wantErr   bool
+	}{
+		{"default", OutboxConfig{}, []string{OutboxSinkLog, OutboxSinkWebhook, OutboxSinkStream}, false},
+		{"empty", OutboxConfig{Sinks: []string{}}, []string{OutboxSinkLog, OutboxSinkWebhook, OutboxSinkStream}, false},
+		{"none", OutboxConfig{Sinks: []string{OutboxSinkNone}}, []string{OutboxSinkNone}, false},
+		{"http", OutboxConfig{Sinks: []string{OutboxSinkLog, OutboxSinkHTTP}, HTTPUrl: "http://localhost/events"}, []string{OutboxSinkLog, OutboxSinkHTTP}, false},
+		{"http without url", OutboxConfig{Sinks: []string{OutboxSinkHTTP}}, nil, true},
+		{"unknown sink", OutboxConfig{Sinks: []string{"kafka"}}, nil, true},
+	}
+
+	for _, v := range cases {
+		c := &AppConfig{Outbox: v.config}
+		err := ValidateOutboxConfig(c)
+		if (err != nil) != v.wantErr {
+			t.Errorf("%s: want error %v got %v", v.name, v.wantErr, err)
+		}
+		if v.wantErr {
+			continue
+		}
+		assert.Equal(t, v.wantSinks, c.Outbox.Sinks, v.name)
+		assert.Equal(t, OutboxHTTPTimeoutSeconds, c.Outbox.HTTPTimeoutSeconds, v.name)
+		assert.Equal(t, OutboxIntervalMillis, c.Outbox.IntervalMillis, v.name)
+		assert.Equal(t, OutboxBatchSize, c.Outbox.BatchSize, v.name)
+		assert.Equal(t, OutboxMaxAttempts, c.Outbox.MaxAttempts, v.name)
+	}
+}
+
+func TestValidateWebhookConfig(t *testing.T) {
+	t.Parallel()
+	c := &AppConfig{}
+	assert.NoError(t, ValidateWebhookConfig(c))
+	assert.Equal(t, WebhookConfig{
+		MaxAttempts:          WebhookMaxAttempts,
+		DisableAfterFailures: WebhookDisableAfterFailures,
+		TimeoutSeconds:       WebhookTimeoutSeconds,
+		IntervalMillis:       WebhookIntervalMillis,
+		BatchSize:            WebhookBatchSize,
+	}, c.Webhook)
+
+	c = &AppConfig{Webhook: WebhookConfig{MaxAttempts: 3, DisableAfterFailures: 5}}
+	assert.NoError(t, ValidateWebhookConfig(c))
+	assert.Equal(t, 3, c.Webhook.MaxAttempts)
+	assert.Equal(t, 5, c.Webhook.DisableAfterFailures)
+}
+
+func TestValidateStreamConfig(t *testing.T) {
+	t.Parallel()
+	c := &AppConfig{Stream: StreamConfig{BufferSize: 10}}
+	assert.NoError(t, ValidateStreamConfig(c))
+	assert.Equal(t, StreamConfig{
+		BufferSize:          10,
+		QueueSize:           StreamQueueSize,
+		HeartbeatSeconds:    StreamHeartbeatSeconds,
+		WriteTimeoutSeconds: StreamWriteTimeoutSeconds,
+	}, c.Stream)
+}
+
+func TestValidateWebSocketConfig(t *testing.T) {
+	t.Parallel()
+	c := &AppConfig{WebSocket: WebSocketConfig{MessagesPerSecond: 0.5}}
+	assert.NoError(t, ValidateWebSocketConfig(c))
+	assert.Equal(t, WebSocketConfig{
+		MessagesPerSecond:   0.5,
+		Burst:               WebSocketBurst,
+		QueueSize:           WebSocketQueueSize,
+		MaxMessageBytes:     WebSocketMaxMessageBytes,
+		PingSeconds:         WebSocketPingSeconds,
+		WriteTimeoutSeconds: WebSocketWriteTimeoutSeconds,
+	}, c.WebSocket)
+}
+
+func TestValidateVersionsConfig(t *testing.T) {
+	t.Parallel()
+	c := &AppConfig{}
+	assert.NoError(t, ValidateVersionsConfig(c))
+	assert.Equal(t, map[string]VersionConfig{}, c.Versions)
+
+	// 書いた日時だけを使う
+	c = &AppConfig{Versions: map[string]VersionConfig{"v1": {Deprecation: "2026-10-19T00:00:00Z"}}}
+	assert.NoError(t, ValidateVersionsConfig(c))
+	assert.Equal(t, map[string]VersionConfig{"v1": {Deprecation: "2026-10-19T00:00:00Z"}}, c.Versions)
+
+	cases := []struct {
+		name string
+		v    VersionConfig
+	}{
+		{"invalid deprecation", VersionConfig{Deprecation: "2026-10-19"}},
+		{"invalid sunset", VersionConfig{Sunset: "tomorrow"}},
+		{"sunset before deprecation", VersionConfig{Deprecation: "2026-10-19T00:00:00Z", Sunset: "2026-01-01T00:00:00Z"}},
+	}
+	for _, v := range cases {
+		c := &AppConfig{Versions: map[string]VersionConfig{"v1": v.v}}
+		assert.Error(t, ValidateVersionsConfig(c), v.name)
+	}
+
+	// 無いversionは書き間違いとしてerrorにする
+	c = &AppConfig{Versions: map[string]VersionConfig{"v01": {Deprecation: "2026-10-19T00:00:00Z"}}}
+	assert.Error(t, ValidateVersionsConfig(c))
+}
+
+func TestValidateReplicas(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		name      string
+		replicas  []ReplicaConfig
+		wantPorts []string
+		wantErr   bool
+	}{
+		{"none", nil, nil, false},
+		{"default port", []ReplicaConfig{{Url: "db-replica1"}, {Url: "db-replica2", Port: "13306"}}, []string{MySQLPort, "13306"}, false},
+		{"empty url", []ReplicaConfig{{Port: "3306"}}, nil, true},
+	}
+
+	for _, v := range cases {
+		c := &AppConfig{MySQL: DataStoreConfig{Replicas: v.replicas}}
+		err := ValidateMySQLConfig(c)
+		if (err != nil) != v.wantErr {
+			t.Errorf("%s: want error %v got %v", v.name, v.wantErr, err)
+		}
+		if v.wantErr {
+			continue
+		}
+		var ports []string
+		for _, r := range c.MySQL.Replicas {
+			ports = append(ports, r.Port)
+		}
+		assert.Equal(t, v.wantPorts, ports, v.name)
+		assert.Equal(t, StickySeconds, c.MySQL.StickySeconds, v.name)
+		assert.Equal(t, HealthCheckSeconds, c.MySQL.HealthCheckSeconds, v.name)
+	}
+}
+
+func TestValidatePool(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		name        string
+		config      DataStoreConfig
+		wantOpen    int
+		wantIdle    int
+		wantRetries int
+	}{
+		{"default", DataStoreConfig{}, MaxOpenConns, MaxIdleConns, ConnectRetries},
+		{"idle is capped by open", DataStoreConfig{MaxOpenConns: 5, MaxIdleConns: 10}, 5, 5, ConnectRetries},
+		{"no retry", DataStoreConfig{ConnectRetries: -1}, MaxOpenConns, MaxIdleConns, 0},
+	}
+
+	for _, v := range cases {
+		c := &AppConfig{MySQL: v.config}
+		assert.NoError(t, ValidateMySQLConfig(c), v.name)
+		assert.Equal(t, v.wantOpen, c.MySQL.MaxOpenConns, v.name)
+		assert.Equal(t, v.wantIdle, c.MySQL.MaxIdleConns, v.name)
+		assert.Equal(t, ConnMaxLifetimeSeconds, c.MySQL.ConnMaxLifetimeSeconds, v.name)
+		assert.Equal(t, v.wantRetries, c.MySQL.ConnectRetries, v.name)
+	}
+}
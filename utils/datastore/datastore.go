@@ -0,0 +1,65 @@
+package datastore
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/sioncojp/famili-api/utils/config"
+	"github.com/sioncojp/famili-api/utils/log"
+)
+
+const (
+	// connectBaseDelay, connectMaxDelay...起動時のretryは1秒から倍々で待ち、30秒で頭打ちにする
+	connectBaseDelay = time.Second
+	connectMaxDelay  = 30 * time.Second
+)
+
+// sleep...テストで待たないように差し替える
+var sleep = time.Sleep
+
+// Open...dialectorでgormを開き、poolを設定する
+// c.Lazyならpingもretryもせず、繋がるかどうかはhealth checkに任せる
+func Open(dialector gorm.Dialector, c *config.DataStoreConfig) (*gorm.DB, error) {
+	var db *gorm.DB
+	var err error
+	if c.Lazy {
+		db, err = gorm.Open(dialector, &gorm.Config{DisableAutomaticPing: true})
+	} else {
+		db, err = connect(dialector, c)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(c.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(c.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(time.Duration(c.ConnMaxLifetimeSeconds) * time.Second)
+
+	return db, nil
+}
+
+// connect...DBがcontainerの起動直後などでまだ繋がらないときは、ConnectRetries回までbackoffしながらやり直す
+func connect(dialector gorm.Dialector, c *config.DataStoreConfig) (*gorm.DB, error) {
+	delay := connectBaseDelay
+	for i := 0; ; i++ {
+		db, err := gorm.Open(dialector, &gorm.Config{})
+		if err == nil {
+			return db, nil
+		}
+		if i >= c.ConnectRetries {
+			return nil, err
+		}
+
+		log.Log.Warnf("could not connect to %s:%s, retry in %s (%d/%d): %v", c.Url, c.Port, delay, i+1, c.ConnectRetries, err)
+		sleep(delay)
+		delay *= 2
+		if delay > connectMaxDelay {
+			delay = connectMaxDelay
+		}
+	}
+}
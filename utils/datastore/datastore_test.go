@@ -0,0 +1,92 @@
+package datastore
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+
+	"github.com/sioncojp/famili-api/utils/config"
+	"github.com/sioncojp/famili-api/utils/log"
+)
+
+// flakyDialector...最初のfails回だけ接続に失敗する
+type flakyDialector struct {
+	gorm.Dialector
+	fails int
+}
+
+func (d *flakyDialector) Initialize(db *gorm.DB) error {
+	if d.fails > 0 {
+		d.fails--
+		return errors.New("connection refused")
+	}
+	return d.Dialector.Initialize(db)
+}
+
+func TestOpen(t *testing.T) {
+	log.Log = zap.NewNop().Sugar()
+	var slept []time.Duration
+	sleep = func(d time.Duration) { slept = append(slept, d) }
+	defer func() { sleep = time.Sleep }()
+
+	cases := []struct {
+		name      string
+		fails     int
+		retries   int
+		wantErr   bool
+		wantSleep []time.Duration
+	}{
+		{"connected", 0, 10, false, nil},
+		{"retry", 2, 10, false, []time.Duration{time.Second, 2 * time.Second}},
+		{"give up", 3, 2, true, []time.Duration{time.Second, 2 * time.Second}},
+		{"max delay", 7, 10, false, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second, 30 * time.Second, 30 * time.Second}},
+	}
+
+	for _, v := range cases {
+		slept = nil
+		db, _, err := sqlmock.New()
+		require.NoError(t, err)
+		dialector := &flakyDialector{
+			Dialector: mysql.New(mysql.Config{Conn: db, SkipInitializeWithVersion: true}),
+			fails:     v.fails,
+		}
+		c := &config.DataStoreConfig{MaxOpenConns: 5, MaxIdleConns: 2, ConnMaxLifetimeSeconds: 60, ConnectRetries: v.retries}
+
+		g, err := Open(dialector, c)
+		assert.Equal(t, v.wantSleep, slept, v.name)
+		if v.wantErr {
+			assert.Error(t, err, v.name)
+			db.Close()
+			continue
+		}
+		require.NoError(t, err, v.name)
+		sqlDB, err := g.DB()
+		require.NoError(t, err)
+		assert.Equal(t, 5, sqlDB.Stats().MaxOpenConnections, v.name)
+		db.Close()
+	}
+}
+
+func TestOpenLazy(t *testing.T) {
+	log.Log = zap.NewNop().Sugar()
+
+	// 繋がらなくてもpingもretryもせずに開く
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	require.NoError(t, err)
+	defer db.Close()
+	c := &config.DataStoreConfig{MaxOpenConns: 5, ConnectRetries: 10, Lazy: true}
+
+	g, err := Open(mysql.New(mysql.Config{Conn: db, SkipInitializeWithVersion: true}), c)
+	require.NoError(t, err)
+	sqlDB, err := g.DB()
+	require.NoError(t, err)
+	assert.Equal(t, 5, sqlDB.Stats().MaxOpenConnections)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
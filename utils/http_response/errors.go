@@ -0,0 +1,72 @@
+package httpresponse
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/pkg/errors"
+
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/utils/i18n"
+)
+
+const (
+	ErrorMessageInvalidRequest = "invalid_request"
+	ErrorMessageNotFound       = "not_found"
+	ErrorMessageConflict       = "conflict"
+	ErrorMessageUnavailable    = "service_unavailable"
+	ErrorMessageInternal       = "internal_error"
+)
+
+// Messages...statusごとのerror message. 指定の無いstatusはdefaultMessagesを使う
+type Messages map[int]string
+
+var defaultMessages = Messages{
+	http.StatusBadRequest:          ErrorMessageInvalidRequest,
+	http.StatusNotFound:            ErrorMessageNotFound,
+	http.StatusConflict:            ErrorMessageConflict,
+	http.StatusServiceUnavailable:  ErrorMessageUnavailable,
+	http.StatusInternalServerError: ErrorMessageInternal,
+}
+
+// StatusFromError...domainのerrorをHTTP statusにする. どれでもなければ500
+func StatusFromError(err error) int {
+	switch {
+	case domain.IsValidation(err):
+		return http.StatusBadRequest
+	case errors.Is(err, domain.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, domain.ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, domain.ErrUnavailable):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// FromError...errをStatusFromErrorのstatusで返す. messagesでhandlerごとのerror messageに差し替えられる
+// validationのときだけwarnに理由を入れる. それ以外はDBのerrorなどをclientに見せない
+// FormatProblemならvalidation.Errorsをfieldごとのerrorsにする
+func FromError(w http.ResponseWriter, r *http.Request, err error, messages Messages) {
+	status, message, warn := Describe(r.Context(), err, messages)
+	if status == http.StatusBadRequest {
+		Validation(w, r, message, err)
+		return
+	}
+	Error(w, r, status, message, warn)
+}
+
+// Describe...FromErrorが返すstatus, error message, warnを返す. WebSocketなどHTTPのresponse以外で同じerrorを返すときに使う
+// warnはctxのi18nの言語にする
+func Describe(ctx context.Context, err error, messages Messages) (status int, message, warn string) {
+	status = StatusFromError(err)
+	message, ok := messages[status]
+	if !ok {
+		message = defaultMessages[status]
+	}
+	if status == http.StatusBadRequest {
+		warn = i18n.Translate(i18n.FromContext(ctx), err).Error()
+	}
+	return status, message, warn
+}
@@ -0,0 +1,196 @@
+package httpresponse
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5/middleware"
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sioncojp/famili-api/domain"
+	"github.com/sioncojp/famili-api/utils/i18n"
+)
+
+func TestFromError(t *testing.T) {
+	t.Parallel()
+	messages := Messages{http.StatusNotFound: "todo_not_found"}
+	cases := []struct {
+		name           string
+		err            error
+		httpStatusCode int
+		want           string
+	}{
+		{"not found", errors.Wrap(domain.ErrNotFound, "get todo"), http.StatusNotFound, `{"ok":false,"error":"todo_not_found"}`},
+		{"conflict", domain.ErrConflict, http.StatusConflict, `{"ok":false,"error":"conflict"}`},
+		{"unavailable", domain.ErrUnavailable, http.StatusServiceUnavailable, `{"ok":false,"error":"service_unavailable"}`},
+		{
+			"validation",
+			domain.NewValidationError(validation.Errors{"title": errors.New("is required")}),
+			http.StatusBadRequest,
+			`{"ok":false,"error":"invalid_request","warn":"title: is required."}`,
+		},
+		{"unknown", errors.New("Error 1146: Table 'famili-api.todos' doesn't exist"), http.StatusInternalServerError, `{"ok":false,"error":"internal_error"}`},
+	}
+
+	for _, v := range cases {
+		v := v
+		t.Run(v.name, func(tt *testing.T) {
+			tt.Parallel()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			w := httptest.NewRecorder()
+			FromError(w, r, v.err, messages)
+			assert.Equal(tt, v.httpStatusCode, w.Result().StatusCode)
+			assert.JSONEq(tt, v.want, w.Body.String())
+		})
+	}
+}
+
+func TestInvalid(t *testing.T) {
+	t.Parallel()
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	w := httptest.NewRecorder()
+	Invalid(w, r, []FieldError{
+		{In: "body", Field: "titel", Reason: "is unknown field"},
+		{In: "body", Reason: "is required"},
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+	assert.JSONEq(t, `{
+		"ok": false,
+		"error": "invalid_request",
+		"warn": "titel: is unknown field; is required",
+		"errors": [{"in": "body", "field": "titel", "reason": "is unknown field"}, {"in": "body", "field": "", "reason": "is required"}]
+	}`, w.Body.String())
+}
+
+func TestProblem(t *testing.T) {
+	t.Parallel()
+	validationErr := domain.NewValidationError(validation.Errors{
+		"title":       errors.New("is required"),
+		"event_types": validation.Errors{"10": errors.New("is unknown"), "2": errors.New("is unknown")},
+	})
+	cases := []struct {
+		name  string
+		write func(w http.ResponseWriter, r *http.Request)
+		want  string
+	}{
+		{
+			name:  "error",
+			write: func(w http.ResponseWriter, r *http.Request) { Error(w, r, http.StatusNotFound, "todo_not_found", "") },
+			want:  `{"type": "urn:famili-api:problem:todo_not_found", "title": "Todo not found", "status": 404, "instance": "req-1"}`,
+		},
+		{
+			name:  "validation",
+			write: func(w http.ResponseWriter, r *http.Request) { FromError(w, r, validationErr, nil) },
+			want: `{"type": "urn:famili-api:problem:invalid_request", "title": "The request is invalid", "status": 400, "instance": "req-1",
+				"detail": "event_types: (10: is unknown; 2: is unknown.); title: is required.",
+				"errors": [
+					{"in": "body", "field": "event_types[2]", "reason": "is unknown"},
+					{"in": "body", "field": "event_types[10]", "reason": "is unknown"},
+					{"in": "body", "field": "title", "reason": "is required"}
+				]}`,
+		},
+		{
+			name: "invalid",
+			write: func(w http.ResponseWriter, r *http.Request) {
+				Invalid(w, r, []FieldError{{In: "query", Field: "limit", Reason: "must be an integer"}})
+			},
+			want: `{"type": "urn:famili-api:problem:invalid_request", "title": "The request is invalid", "status": 400, "instance": "req-1",
+				"detail": "limit: must be an integer", "errors": [{"in": "query", "field": "limit", "reason": "must be an integer"}]}`,
+		},
+	}
+
+	for _, v := range cases {
+		v := v
+		t.Run(v.name, func(tt *testing.T) {
+			tt.Parallel()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Accept", ContentTypeProblem)
+			r = r.WithContext(context.WithValue(r.Context(), middleware.RequestIDKey, "req-1"))
+			w := httptest.NewRecorder()
+			WithFormat(FormatLegacy)(http.HandlerFunc(v.write)).ServeHTTP(w, r)
+			assert.Equal(tt, ContentTypeProblem, w.Header().Get("Content-Type"))
+			assert.JSONEq(tt, v.want, w.Body.String())
+		})
+	}
+}
+
+func TestLocalized(t *testing.T) {
+	t.Parallel()
+	validationErr := domain.NewValidationError(validation.Errors{
+		"title":       validation.Validate("", validation.Required),
+		"description": validation.Validate("abc", validation.RuneLength(1, 2)),
+	})
+	cases := []struct {
+		name   string
+		accept string
+		write  func(w http.ResponseWriter, r *http.Request)
+		want   string
+	}{
+		{
+			name:  "legacy",
+			write: func(w http.ResponseWriter, r *http.Request) { FromError(w, r, validationErr, nil) },
+			want:  `{"ok": false, "error": "invalid_request", "warn": "description: 1文字以上2文字以下にしてください; title: 必須です."}`,
+		},
+		{
+			name:   "problem",
+			accept: ContentTypeProblem,
+			write:  func(w http.ResponseWriter, r *http.Request) { Validation(w, r, "missing_validation", validationErr) },
+			want: `{"type": "urn:famili-api:problem:missing_validation", "title": "入力が正しくありません", "status": 400,
+				"detail": "description: 1文字以上2文字以下にしてください; title: 必須です.",
+				"errors": [
+					{"in": "body", "field": "description", "reason": "1文字以上2文字以下にしてください", "code": "validation_length_out_of_range"},
+					{"in": "body", "field": "title", "reason": "必須です", "code": "validation_required"}
+				]}`,
+		},
+		{
+			name: "invalid",
+			write: func(w http.ResponseWriter, r *http.Request) {
+				Invalid(w, r, []FieldError{NewFieldError("query", "limit", i18n.Min, map[string]interface{}{"threshold": 1})})
+			},
+			want: `{"ok": false, "error": "invalid_request", "warn": "limit: 1以上にしてください",
+				"errors": [{"in": "query", "field": "limit", "reason": "1以上にしてください", "code": "validation_min_greater_equal_than_required"}]}`,
+		},
+	}
+
+	for _, v := range cases {
+		v := v
+		t.Run(v.name, func(tt *testing.T) {
+			tt.Parallel()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Accept", v.accept)
+			r = r.WithContext(i18n.NewContext(r.Context(), i18n.Ja))
+			w := httptest.NewRecorder()
+			WithFormat(FormatLegacy)(http.HandlerFunc(v.write)).ServeHTTP(w, r)
+			assert.Equal(tt, http.StatusBadRequest, w.Result().StatusCode)
+			assert.JSONEq(tt, v.want, w.Body.String())
+		})
+	}
+}
+
+func TestWithFormat(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		name   string
+		format Format
+		accept string
+		want   Format
+	}{
+		{"legacy", FormatLegacy, "application/json", FormatLegacy},
+		{"legacy accepts problem", FormatLegacy, "application/problem+json, application/json", FormatProblem},
+		{"problem", FormatProblem, "", FormatProblem},
+	}
+	for _, v := range cases {
+		var got Format
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept", v.accept)
+		WithFormat(v.format)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = FormatFromContext(r.Context())
+		})).ServeHTTP(httptest.NewRecorder(), r)
+		assert.Equal(t, v.want, got, v.name)
+	}
+	assert.Equal(t, FormatLegacy, FormatFromContext(context.Background()))
+}
@@ -2,8 +2,11 @@ package httpresponse
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/go-chi/render"
+
+	"github.com/sioncojp/famili-api/utils/i18n"
 )
 
 // HttpRespondOK...2xx ~ 3xxのときに返す
@@ -17,8 +20,18 @@ func OK(w http.ResponseWriter, r *http.Request, statusCode int, field string, va
 	render.JSON(w, r, response)
 }
 
-// HttpRespondError...4xx < 5xxのときに返すエラー
+// JSON.../v2からのresponse. {"ok": true} で包まずにvalueをそのまま返す
+func JSON(w http.ResponseWriter, r *http.Request, statusCode int, value interface{}) {
+	render.Status(r, statusCode)
+	render.JSON(w, r, value)
+}
+
+// HttpRespondError...4xx < 5xxのときに返すエラー. FormatProblemならwarnをdetailにしたproblemで返す
 func Error(w http.ResponseWriter, r *http.Request, statusCode int, errorMessage, warn string) {
+	if FormatFromContext(r.Context()) == FormatProblem {
+		writeProblem(w, NewProblem(r, statusCode, errorMessage, warn, nil))
+		return
+	}
 	response := make(map[string]interface{})
 	response["ok"] = false
 	response["error"] = errorMessage
@@ -28,3 +41,76 @@ func Error(w http.ResponseWriter, r *http.Request, statusCode int, errorMessage,
 	render.Status(r, statusCode)
 	render.JSON(w, r, response)
 }
+
+// FieldError...requestのどこが不正か. Inはbody, query, path
+// Codeはi18nのkeyで、返すときにParamsで埋めたrequestの言語の文をReasonにする
+type FieldError struct {
+	In     string                 `json:"in"`
+	Field  string                 `json:"field"`
+	Reason string                 `json:"reason"`
+	Code   string                 `json:"code,omitempty"`
+	Params map[string]interface{} `json:"-"`
+}
+
+// NewFieldError...keyのenの文をReasonにしたFieldError
+func NewFieldError(in, field, key string, params map[string]interface{}) FieldError {
+	reason, _ := i18n.T(i18n.En, key, params)
+	return FieldError{In: in, Field: field, Reason: reason, Code: key, Params: params}
+}
+
+// String..."title: is required" の形にする. fieldが無ければreasonだけ
+func (e FieldError) String() string {
+	if e.Field == "" {
+		return e.Reason
+	}
+	return e.Field + ": " + e.Reason
+}
+
+// Invalid...requestが不正なときに400で返す. warnにはerrorsをつなげたものを入れる
+func Invalid(w http.ResponseWriter, r *http.Request, errors []FieldError) {
+	fields(w, r, ErrorMessageInvalidRequest, errors)
+}
+
+// Validation...modelのValidateを通らなかったときに400で返す. errのvalidation.Errorsをfieldごとのerrorにする
+// warnはrequestの言語にする
+func Validation(w http.ResponseWriter, r *http.Request, errorMessage string, err error) {
+	lang := i18n.FromContext(r.Context())
+	warn := i18n.Translate(lang, err).Error()
+	if FormatFromContext(r.Context()) == FormatProblem {
+		writeProblem(w, NewProblem(r, http.StatusBadRequest, errorMessage, warn, localize(lang, FieldErrors(err))))
+		return
+	}
+	Error(w, r, http.StatusBadRequest, errorMessage, warn)
+}
+
+// localize...CodeのあるFieldErrorのReasonをlangの文にする
+func localize(lang i18n.Lang, errors []FieldError) []FieldError {
+	out := make([]FieldError, len(errors))
+	for i, v := range errors {
+		if message, ok := i18n.T(lang, v.Code, v.Params); ok {
+			v.Reason = message
+		}
+		out[i] = v
+	}
+	return out
+}
+
+// fields...fieldごとのerrorを400で返す. legacyでもerrorsを付ける
+func fields(w http.ResponseWriter, r *http.Request, errorMessage string, errors []FieldError) {
+	errors = localize(i18n.FromContext(r.Context()), errors)
+	warns := make([]string, 0, len(errors))
+	for _, v := range errors {
+		warns = append(warns, v.String())
+	}
+	if FormatFromContext(r.Context()) == FormatProblem {
+		writeProblem(w, NewProblem(r, http.StatusBadRequest, errorMessage, strings.Join(warns, "; "), errors))
+		return
+	}
+	response := make(map[string]interface{})
+	response["ok"] = false
+	response["error"] = errorMessage
+	response["warn"] = strings.Join(warns, "; ")
+	response["errors"] = errors
+	render.Status(r, http.StatusBadRequest)
+	render.JSON(w, r, response)
+}
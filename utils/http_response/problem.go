@@ -0,0 +1,145 @@
+package httpresponse
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5/middleware"
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pkg/errors"
+
+	"github.com/sioncojp/famili-api/utils/i18n"
+)
+
+const (
+	// ContentTypeProblem...RFC 7807のContent-Type
+	ContentTypeProblem = "application/problem+json"
+	// ProblemTypePrefix...problemのtypeはこれにerror messageを付けたURN
+	ProblemTypePrefix = "urn:famili-api:problem:"
+)
+
+// Format...errorのresponseの形
+type Format int
+
+const (
+	// FormatLegacy...{"ok": false, "error": ..., "warn": ...}
+	FormatLegacy Format = iota
+	// FormatProblem...RFC 7807のapplication/problem+json
+	FormatProblem
+)
+
+type formatKey struct{}
+
+// Problem...RFC 7807のproblem details. errorsはfieldごとの理由
+type Problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Errors   []FieldError `json:"errors,omitempty"`
+}
+
+// WithFormat...API versionごとにerrorのresponseの形を決めるmiddleware
+// FormatLegacyでも、Accept: application/problem+json を送ったclientにはproblemで返す
+func WithFormat(f Format) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			format := f
+			if strings.Contains(r.Header.Get("Accept"), ContentTypeProblem) {
+				format = FormatProblem
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), formatKey{}, format)))
+		})
+	}
+}
+
+// FormatFromContext...WithFormatを通っていなければFormatLegacy
+func FormatFromContext(ctx context.Context) Format {
+	f, _ := ctx.Value(formatKey{}).(Format)
+	return f
+}
+
+// NewProblem...error messageをtypeにし、instanceにはrequest IDを入れる
+// titleはerror messageのrequestの言語の文. catalogに無ければstatusの文
+func NewProblem(r *http.Request, statusCode int, errorMessage, detail string, fields []FieldError) Problem {
+	title, ok := i18n.T(i18n.FromContext(r.Context()), errorMessage, nil)
+	if !ok {
+		title = http.StatusText(statusCode)
+	}
+	return Problem{
+		Type:     ProblemTypePrefix + errorMessage,
+		Title:    title,
+		Status:   statusCode,
+		Detail:   detail,
+		Instance: middleware.GetReqID(r.Context()),
+		Errors:   fields,
+	}
+}
+
+// writeProblem...application/problem+jsonで返す. render.JSONはContent-Typeを上書きするので使わない
+func writeProblem(w http.ResponseWriter, p Problem) {
+	b, err := json.Marshal(p)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", ContentTypeProblem)
+	w.WriteHeader(p.Status)
+	_, _ = w.Write(b)
+}
+
+// FieldErrors...errに入っているozzo-validationのvalidation.Errorsをfieldごとにする. 入れ子は "mutations[0].op" のようにつなげる
+func FieldErrors(err error) []FieldError {
+	var errs validation.Errors
+	if !errors.As(err, &errs) {
+		return nil
+	}
+	return appendFieldErrors(nil, "", errs)
+}
+
+func appendFieldErrors(out []FieldError, parent string, errs validation.Errors) []FieldError {
+	keys := make([]string, 0, len(errs))
+	for k := range errs {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, errA := strconv.Atoi(keys[i])
+		b, errB := strconv.Atoi(keys[j])
+		if errA == nil && errB == nil {
+			return a < b
+		}
+		return keys[i] < keys[j]
+	})
+
+	for _, k := range keys {
+		field := k
+		switch {
+		case isIndex(k):
+			field = parent + "[" + k + "]"
+		case parent != "":
+			field = parent + "." + k
+		}
+
+		var nested validation.Errors
+		if errors.As(errs[k], &nested) {
+			out = appendFieldErrors(out, field, nested)
+			continue
+		}
+		e := FieldError{In: "body", Field: field, Reason: errs[k].Error()}
+		if v, ok := errs[k].(validation.Error); ok {
+			e.Code, e.Params = v.Code(), v.Params()
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+func isIndex(k string) bool {
+	_, err := strconv.Atoi(k)
+	return err == nil
+}
@@ -0,0 +1,184 @@
+package i18n
+
+// validationのkey. ozzo-validationのruleが返すcodeと、famili-apiで足したcode
+// paramsはtext/templateで埋める. ozzo-validationのruleはmin, max, thresholdを入れる
+const (
+	Required         = "validation_required"
+	LengthOutOfRange = "validation_length_out_of_range"
+	LengthTooLong    = "validation_length_too_long"
+	LengthTooShort   = "validation_length_too_short"
+	Min              = "validation_min_greater_equal_than_required"
+	Max              = "validation_max_less_equal_than_required"
+	In               = "validation_in_invalid"
+
+	Between           = "validation_between"
+	EnumInvalid       = "validation_enum_invalid"
+	VisibilityInvalid = "validation_visibility_invalid"
+	EventTypeUnknown  = "validation_event_type_unknown"
+	ScopeUnknown      = "validation_scope_unknown"
+	EmailInvalid      = "validation_email_invalid"
+	URLInvalid        = "validation_is_url"
+	NotFuture         = "validation_not_future"
+	Duplicate         = "validation_duplicate"
+	ItemsTooFew       = "validation_items_too_few"
+	ItemsTooMany      = "validation_items_too_many"
+	ItemsOutOfRange   = "validation_items_out_of_range"
+	UnknownField      = "validation_unknown_field"
+	TypeInvalid       = "validation_type_invalid"
+	NotNull           = "validation_not_null"
+	Const             = "validation_const"
+	DateTime          = "validation_date_time"
+	PropertiesTooFew  = "validation_properties_too_few"
+	JSONInvalid       = "validation_json_invalid"
+	JSONMultiple      = "validation_json_multiple"
+	BodyUnreadable    = "validation_body_unreadable"
+	BodyTooLarge      = "validation_body_too_large"
+)
+
+// catalog...言語ごとの文. httpresponseのerror messageはproblemのtitleにする
+var catalog = map[Lang]map[string]string{
+	En: {
+		Required:          "is required",
+		LengthOutOfRange:  "must be between {{.min}} and {{.max}} characters",
+		LengthTooLong:     "must be no more than {{.max}} characters",
+		LengthTooShort:    "must be no less than {{.min}} characters",
+		Min:               "must be no less than {{.threshold}}",
+		Max:               "must be no greater than {{.threshold}}",
+		In:                "must be a valid value",
+		Between:           "must be between {{.min}} and {{.max}}",
+		EnumInvalid:       "must be one of {{.values}}",
+		VisibilityInvalid: "must be private, family or public",
+		EventTypeUnknown:  "is unknown event type",
+		ScopeUnknown:      "is unknown scope",
+		EmailInvalid:      "is invalid email",
+		URLInvalid:        "must be http or https url",
+		NotFuture:         "must not be in the future",
+		Duplicate:         "contains {{.value}} twice",
+		ItemsTooFew:       "must have at least {{.min}} items",
+		ItemsTooMany:      "must have at most {{.max}} items",
+		ItemsOutOfRange:   "must have {{.min}} to {{.max}} items",
+		UnknownField:      "is unknown field",
+		TypeInvalid:       "must be of type {{.type}}",
+		NotNull:           "must not be null",
+		Const:             "must be {{.value}}",
+		DateTime:          "must be RFC 3339 date-time",
+		PropertiesTooFew:  "must have at least {{.min}} properties",
+		JSONInvalid:       "must be valid JSON",
+		JSONMultiple:      "must be a single JSON value",
+		BodyUnreadable:    "could not be read",
+		BodyTooLarge:      "must be no larger than {{.max}} bytes",
+
+		"invalid_request":               "The request is invalid",
+		"not_found":                     "Not found",
+		"conflict":                      "Conflicts with existing data",
+		"service_unavailable":           "Service is temporarily unavailable",
+		"internal_error":                "Internal error",
+		"missing_argument":              "The request body could not be read",
+		"missing_validation":            "Validation failed",
+		"caller_not_identified":         "The caller could not be identified",
+		"authentication_required":       "Authentication is required",
+		"invalid_api_key":               "The API key is invalid",
+		"invalid_session":               "The session is invalid or expired",
+		"insufficient_scope":            "The API key does not have the required scope",
+		"api_key_not_allowed":           "API keys cannot call this endpoint",
+		"admin_only":                    "Only administrators can call this endpoint",
+		"todo_not_found":                "Todo not found",
+		"invalid_todo_provided":         "Todo could not be processed",
+		"assignee_not_found":            "Assignee not found",
+		"invalid_member_provided":       "Member could not be processed",
+		"member_not_found":              "Member not found",
+		"account_not_found":             "Account not found",
+		"invalid_account_provided":      "Account could not be processed",
+		"email_already_taken":           "The email is already taken",
+		"invalid_credentials":           "The email or password is incorrect",
+		"login_required":                "Login is required",
+		"too_many_attempts":             "Too many failed attempts. Try again later",
+		"login_temporarily_unavailable": "Login is temporarily unavailable",
+		"invalid_mfa_token":             "The MFA token is invalid or expired",
+		"invalid_totp_code":             "The code is incorrect",
+		"totp_already_enabled":          "TOTP is already enabled",
+		"totp_not_enrolled":             "TOTP is not enrolled",
+		"invalid_unlock_provided":       "The lock could not be released",
+		"api_key_not_found":             "API key not found",
+		"invalid_api_key_provided":      "API key could not be processed",
+		"webhook_not_found":             "Webhook not found",
+		"invalid_webhook_provided":      "Webhook could not be processed",
+		"streaming_unsupported":         "Streaming is not supported",
+		"invalid_sync_token":            "The sync token is invalid",
+		"invalid_message":               "The message is invalid",
+		"already_subscribed":            "Already subscribed",
+		"rate_limited":                  "Too many messages",
+	},
+	Ja: {
+		Required:          "必須です",
+		LengthOutOfRange:  "{{.min}}文字以上{{.max}}文字以下にしてください",
+		LengthTooLong:     "{{.max}}文字以下にしてください",
+		LengthTooShort:    "{{.min}}文字以上にしてください",
+		Min:               "{{.threshold}}以上にしてください",
+		Max:               "{{.threshold}}以下にしてください",
+		In:                "正しい値にしてください",
+		Between:           "{{.min}}以上{{.max}}以下にしてください",
+		EnumInvalid:       "{{.values}}のどれかにしてください",
+		VisibilityInvalid: "private, family, publicのどれかにしてください",
+		EventTypeUnknown:  "対応していないevent typeです",
+		ScopeUnknown:      "対応していないscopeです",
+		EmailInvalid:      "メールアドレスの形式が正しくありません",
+		URLInvalid:        "httpかhttpsのURLにしてください",
+		NotFuture:         "未来の時刻にはできません",
+		Duplicate:         "{{.value}}が重複しています",
+		ItemsTooFew:       "{{.min}}件以上にしてください",
+		ItemsTooMany:      "{{.max}}件以下にしてください",
+		ItemsOutOfRange:   "{{.min}}件以上{{.max}}件以下にしてください",
+		UnknownField:      "定義されていない項目です",
+		TypeInvalid:       "{{.type}}型にしてください",
+		NotNull:           "nullにはできません",
+		Const:             "{{.value}}にしてください",
+		DateTime:          "RFC 3339の日時にしてください",
+		PropertiesTooFew:  "{{.min}}個以上の項目が必要です",
+		JSONInvalid:       "JSONとして読めません",
+		JSONMultiple:      "JSONの値は1つにしてください",
+		BodyUnreadable:    "読み込めませんでした",
+		BodyTooLarge:      "{{.max}}byte以下にしてください",
+
+		"invalid_request":               "リクエストが正しくありません",
+		"not_found":                     "見つかりません",
+		"conflict":                      "既存のデータと衝突しています",
+		"service_unavailable":           "一時的に利用できません",
+		"internal_error":                "サーバーでエラーが起きました",
+		"missing_argument":              "リクエストのbodyを読めません",
+		"missing_validation":            "入力が正しくありません",
+		"caller_not_identified":         "リクエストしたメンバーがわかりません",
+		"authentication_required":       "認証してください",
+		"invalid_api_key":               "API keyが正しくありません",
+		"invalid_session":               "sessionが正しくないか、期限が切れています",
+		"insufficient_scope":            "API keyに必要なscopeがありません",
+		"api_key_not_allowed":           "API keyでは呼べません",
+		"admin_only":                    "管理者だけが呼べます",
+		"todo_not_found":                "todoが見つかりません",
+		"invalid_todo_provided":         "todoを処理できませんでした",
+		"assignee_not_found":            "assigneeが見つかりません",
+		"invalid_member_provided":       "メンバーを処理できませんでした",
+		"member_not_found":              "メンバーが見つかりません",
+		"account_not_found":             "accountが見つかりません",
+		"invalid_account_provided":      "accountを処理できませんでした",
+		"email_already_taken":           "このメールアドレスは使われています",
+		"invalid_credentials":           "メールアドレスかパスワードが違います",
+		"login_required":                "loginしてください",
+		"too_many_attempts":             "失敗が続いたので、しばらく待ってからやり直してください",
+		"login_temporarily_unavailable": "一時的にloginできません",
+		"invalid_mfa_token":             "MFA tokenが正しくないか、期限が切れています",
+		"invalid_totp_code":             "codeが違います",
+		"totp_already_enabled":          "TOTPはもう有効です",
+		"totp_not_enrolled":             "TOTPが登録されていません",
+		"invalid_unlock_provided":       "lockを解除できませんでした",
+		"api_key_not_found":             "API keyが見つかりません",
+		"invalid_api_key_provided":      "API keyを処理できませんでした",
+		"webhook_not_found":             "webhookが見つかりません",
+		"invalid_webhook_provided":      "webhookを処理できませんでした",
+		"streaming_unsupported":         "streamingに対応していません",
+		"invalid_sync_token":            "sync tokenが正しくありません",
+		"invalid_message":               "messageが正しくありません",
+		"already_subscribed":            "もう購読しています",
+		"rate_limited":                  "messageが多すぎます",
+	},
+}
@@ -0,0 +1,123 @@
+package i18n
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pkg/errors"
+)
+
+// Lang...messageの言語
+type Lang string
+
+const (
+	En Lang = "en"
+	Ja Lang = "ja"
+	// Default...指定が無いか、対応していない言語のとき. 今までのmessageに合わせて英語
+	Default = En
+)
+
+type langKey struct{}
+
+// NewContext...ctxにlangを入れる
+func NewContext(ctx context.Context, lang Lang) context.Context {
+	return context.WithValue(ctx, langKey{}, lang)
+}
+
+// FromContext...NewContextで入れたlang. 無ければDefault
+func FromContext(ctx context.Context) Lang {
+	if lang, ok := ctx.Value(langKey{}).(Lang); ok {
+		return lang
+	}
+	return Default
+}
+
+// Supported..."ja-JP"のようなtagを対応している言語にする. primary subtagだけを見る
+func Supported(tag string) (Lang, bool) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if i := strings.IndexAny(tag, "-_"); i >= 0 {
+		tag = tag[:i]
+	}
+	lang := Lang(tag)
+	if _, ok := catalog[lang]; !ok {
+		return "", false
+	}
+	return lang, true
+}
+
+// ParseAcceptLanguage...Accept-Languageのうち対応している言語でqが一番大きいもの. 同じqなら先に書かれた方
+func ParseAcceptLanguage(header string) (Lang, bool) {
+	type candidate struct {
+		lang Lang
+		q    float64
+	}
+	candidates := []candidate{}
+	for _, part := range strings.Split(header, ",") {
+		tag, q := part, 1.0
+		if i := strings.Index(part, ";"); i >= 0 {
+			tag = part[:i]
+			if v := strings.TrimSpace(part[i+1:]); strings.HasPrefix(v, "q=") {
+				f, err := strconv.ParseFloat(v[2:], 64)
+				if err != nil {
+					continue
+				}
+				q = f
+			}
+		}
+		if lang, ok := Supported(tag); ok && q > 0 {
+			candidates = append(candidates, candidate{lang, q})
+		}
+	}
+	if len(candidates) == 0 {
+		return "", false
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].q > candidates[j].q })
+	return candidates[0].lang, true
+}
+
+// T...keyのlangの文をparamsで埋める. langに無ければenの文を使い、それも無ければfalse
+func T(lang Lang, key string, params map[string]interface{}) (string, bool) {
+	message, ok := catalog[lang][key]
+	if !ok {
+		if message, ok = catalog[En][key]; !ok {
+			return "", false
+		}
+	}
+	if len(params) == 0 || !strings.Contains(message, "{{") {
+		return message, true
+	}
+
+	var b bytes.Buffer
+	if err := template.Must(template.New(key).Parse(message)).Execute(&b, params); err != nil {
+		return message, true
+	}
+	return b.String(), true
+}
+
+// NewError...keyのenの文をmessageにしたvalidation.Error. catalogにある独自のcodeをruleのErrorObjectに渡す
+func NewError(key string) validation.Error {
+	return validation.NewError(key, catalog[En][key])
+}
+
+// Translate...errに入っているvalidation.Errorをlangの文にする. validation.Errorsなら中を全て訳し、codeの無いerrorはそのまま
+func Translate(lang Lang, err error) error {
+	var errs validation.Errors
+	if errors.As(err, &errs) {
+		out := make(validation.Errors, len(errs))
+		for k, v := range errs {
+			out[k] = Translate(lang, v)
+		}
+		return out
+	}
+	if e, ok := err.(validation.Error); ok {
+		if message, ok := T(lang, e.Code(), e.Params()); ok {
+			return validation.NewError(e.Code(), message)
+		}
+	}
+	return err
+}
@@ -0,0 +1,90 @@
+package i18n
+
+import (
+	"context"
+	"testing"
+	"text/template"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAcceptLanguage(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		header string
+		want   Lang
+		ok     bool
+	}{
+		{"", "", false},
+		{"ja", Ja, true},
+		{"ja-JP,ja;q=0.9,en-US;q=0.8", Ja, true},
+		{"en;q=0.5, ja;q=0.8", Ja, true},
+		{"fr-FR, en;q=0.1", En, true},
+		{"en, ja", En, true},
+		{"ja;q=0", "", false},
+		{"ja;q=abc, en", En, true},
+		{"fr, de", "", false},
+	}
+	for _, v := range cases {
+		got, ok := ParseAcceptLanguage(v.header)
+		assert.Equal(t, v.ok, ok, v.header)
+		assert.Equal(t, v.want, got, v.header)
+	}
+}
+
+func TestContext(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, Default, FromContext(context.Background()))
+	assert.Equal(t, Ja, FromContext(NewContext(context.Background(), Ja)))
+}
+
+func TestT(t *testing.T) {
+	t.Parallel()
+	got, ok := T(Ja, LengthOutOfRange, map[string]interface{}{"min": 1, "max": 50})
+	assert.True(t, ok)
+	assert.Equal(t, "1文字以上50文字以下にしてください", got)
+
+	got, ok = T(En, LengthOutOfRange, map[string]interface{}{"min": 1, "max": 50})
+	assert.True(t, ok)
+	assert.Equal(t, "must be between 1 and 50 characters", got)
+
+	got, ok = T(Lang("fr"), Required, nil)
+	assert.True(t, ok)
+	assert.Equal(t, "is required", got)
+
+	_, ok = T(Ja, "unknown_key", nil)
+	assert.False(t, ok)
+}
+
+// TestCatalog...全ての言語に同じkeyがあり、templateとして読めるか
+func TestCatalog(t *testing.T) {
+	t.Parallel()
+	for lang, messages := range catalog {
+		assert.Len(t, messages, len(catalog[En]), lang)
+		for key, message := range messages {
+			_, ok := catalog[En][key]
+			assert.True(t, ok, "%s: %s is not in en", lang, key)
+			_, err := template.New(key).Parse(message)
+			assert.NoError(t, err, "%s: %s", lang, key)
+		}
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	t.Parallel()
+	err := validation.Errors{
+		"title":       validation.Validate("", validation.Required),
+		"description": validation.Validate("abcdef", validation.RuneLength(1, 5)),
+		"position":    validation.Validate(-1, validation.Min(0)),
+		"visibility":  validation.Validate("x", validation.In("a").ErrorObject(NewError(VisibilityInvalid))),
+		"order":       validation.Errors{"0": NewError(Duplicate).SetParams(map[string]interface{}{"value": 3})},
+		"note":        errors.New("is plain"),
+	}
+	assert.Equal(t, "description: must be between 1 and 5 characters; note: is plain; order: (0: contains 3 twice.); "+
+		"position: must be no less than 0; title: is required; visibility: must be private, family or public.", Translate(En, err).Error())
+	assert.Equal(t, "description: 1文字以上5文字以下にしてください; note: is plain; order: (0: 3が重複しています.); "+
+		"position: 0以上にしてください; title: 必須です; visibility: private, family, publicのどれかにしてください.", Translate(Ja, err).Error())
+	assert.NoError(t, Translate(Ja, nil))
+}
@@ -0,0 +1,401 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"hash/crc32"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/sioncojp/famili-api/migrations"
+	"github.com/sioncojp/famili-api/utils/config"
+)
+
+const (
+	// NilVersion...まだ何もmigrateしていないversion. force -1 で初期状態に戻せる
+	NilVersion int64 = -1
+
+	// lockName...MySQLのGET_LOCK, PostgreSQLのpg_advisory_lockに使う名前
+	lockName = "famili-api:migrate"
+
+	// lockTimeoutSeconds...他のprocessがmigrateしているときに待つ秒数
+	lockTimeoutSeconds = 300
+)
+
+// fileRegexp...{version}_{name}.{up|down}.{ext}. go-migrate/migrateと同じ形式
+var fileRegexp = regexp.MustCompile(`^([0-9]+)_(.*)\.(up|down)\.(mysql|sqlite|postgres)$`)
+
+// ErrDirty...前回のmigrationが途中で失敗している. 直してから force で版を合わせる
+var ErrDirty = errors.New("database is dirty")
+
+// orphanCondition...20261019100000_add_visibility_to_todos より前に作られ、作成者とfamilyが空のままのtodo
+// 空のIDは誰のcallerとも一致しないので、Claimするまで誰にも見えない
+const orphanCondition = "created_by = '' AND family_id = ''"
+
+// Migration...versionごとのup/downのファイル
+type Migration struct {
+	Version int64
+	Name    string
+	up      string
+	down    string
+}
+
+// Status...DBのversionと、適用済み/未適用のmigration
+type Status struct {
+	Version int64
+	Dirty   bool
+	Applied []Migration
+	Pending []Migration
+}
+
+// Migrator...埋め込んだmigrationをDBに適用する
+// versionは go-migrate/migrate と同じ schema_migrations(version, dirty) に持つので、今までのDBにもそのまま使える
+type Migrator struct {
+	db         *sql.DB
+	driver     string
+	migrations []Migration
+	fsys       fs.FS
+	logger     *zap.Logger
+}
+
+// New...driverに応じたdirectoryのmigrationを読み込む. memoryはmigrationがないのでerrorを返す
+func New(db *sql.DB, driver string, logger *zap.Logger) (*Migrator, error) {
+	var dir string
+	switch driver {
+	case config.DriverMySQL:
+		dir = "."
+	case config.DriverSQLite:
+		dir = "sqlite"
+	case config.DriverPostgres:
+		dir = "postgres"
+	default:
+		return nil, errors.Errorf("driver %q has no migrations", driver)
+	}
+
+	fsys, err := fs.Sub(migrations.FS, dir)
+	if err != nil {
+		return nil, err
+	}
+	list, err := load(fsys, driver)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, driver: driver, migrations: list, fsys: fsys, logger: logger}, nil
+}
+
+// load...fsys直下のdriverのファイルをversion順に並べる
+func load(fsys fs.FS, driver string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	index := map[int64]int{}
+	var list []Migration
+	for _, v := range entries {
+		m := fileRegexp.FindStringSubmatch(v.Name())
+		if v.IsDir() || m == nil || m[4] != driver {
+			continue
+		}
+		version, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse version of %s", v.Name())
+		}
+
+		i, ok := index[version]
+		if !ok {
+			i = len(list)
+			index[version] = i
+			list = append(list, Migration{Version: version, Name: m[2]})
+		}
+		if m[3] == "up" {
+			list[i].up = v.Name()
+		} else {
+			list[i].down = v.Name()
+		}
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	for _, v := range list {
+		if v.up == "" || v.down == "" {
+			return nil, errors.Errorf("migration %d_%s needs both up and down", v.Version, v.Name)
+		}
+	}
+	return list, nil
+}
+
+// Up...未適用のmigrationを全て適用し、適用した数を返す
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	applied := 0
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		version, err := m.clean(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, v := range m.migrations {
+			if v.Version <= version {
+				continue
+			}
+			if err := m.run(ctx, conn, v.up, v.Version); err != nil {
+				return err
+			}
+			m.logger.Info("migrated up", zap.Int64("version", v.Version), zap.String("name", v.Name))
+			applied++
+		}
+		return m.warnOrphans(ctx, conn)
+	})
+	return applied, err
+}
+
+// Claim...作成者とfamilyが空のtodoを、memberIdのメンバーとそのfamilyのものにし、変えた数を返す
+// visibilityを追加する前からあるtodoは、これを流すまで誰にも見えない
+func (m *Migrator) Claim(ctx context.Context, memberId uint64) (int64, error) {
+	var claimed int64
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		var familyId string
+		err := conn.QueryRowContext(ctx, m.rebind("SELECT family_id FROM members WHERE id = ?"), memberId).Scan(&familyId)
+		if errors.Is(err, sql.ErrNoRows) {
+			return errors.Errorf("member %d not found", memberId)
+		}
+		if err != nil {
+			return errors.Wrap(err, "read member")
+		}
+		if familyId == "" {
+			return errors.Errorf("member %d has no family", memberId)
+		}
+
+		result, err := conn.ExecContext(ctx,
+			m.rebind("UPDATE todos SET created_by = ?, family_id = ? WHERE "+orphanCondition),
+			strconv.FormatUint(memberId, 10), familyId,
+		)
+		if err != nil {
+			return errors.Wrap(err, "claim todos")
+		}
+		claimed, err = result.RowsAffected()
+		return err
+	})
+	return claimed, err
+}
+
+// warnOrphans...Claimしていないtodoが残っていれば、claimを流すようにlogに出す
+func (m *Migrator) warnOrphans(ctx context.Context, conn *sql.Conn) error {
+	if len(m.migrations) == 0 {
+		return nil
+	}
+	var orphans int64
+	if err := conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM todos WHERE "+orphanCondition).Scan(&orphans); err != nil {
+		return errors.Wrap(err, "count todos without a member")
+	}
+	if orphans > 0 {
+		m.logger.Warn("todos without a member are hidden from everyone. run `famili-api migrate claim MEMBER_ID` to give them to a member and the member's family",
+			zap.Int64("todos", orphans))
+	}
+	return nil
+}
+
+// Down...適用済みのmigrationをsteps個戻し、戻した数を返す
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	reverted := 0
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		version, err := m.clean(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for ; reverted < steps && version != NilVersion; reverted++ {
+			i := m.find(version)
+			if i < 0 {
+				return errors.Errorf("version %d is not in migrations", version)
+			}
+			prev := NilVersion
+			if i > 0 {
+				prev = m.migrations[i-1].Version
+			}
+			if err := m.run(ctx, conn, m.migrations[i].down, prev); err != nil {
+				return err
+			}
+			m.logger.Info("migrated down", zap.Int64("version", version), zap.String("name", m.migrations[i].Name))
+			version = prev
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Status...DBのversionと、適用済み/未適用のmigrationを返す
+func (m *Migrator) Status(ctx context.Context) (Status, error) {
+	var status Status
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		var err error
+		status.Version, status.Dirty, err = m.version(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, v := range m.migrations {
+			if v.Version <= status.Version {
+				status.Applied = append(status.Applied, v)
+			} else {
+				status.Pending = append(status.Pending, v)
+			}
+		}
+		return nil
+	})
+	return status, err
+}
+
+// Force...migrationを実行せずにversionを書き換え、dirtyを消す. 失敗したmigrationを手で直した後に使う
+func (m *Migrator) Force(ctx context.Context, version int64) error {
+	if version != NilVersion && m.find(version) < 0 {
+		return errors.Errorf("version %d is not in migrations", version)
+	}
+	return m.locked(ctx, func(conn *sql.Conn) error {
+		return m.setVersion(ctx, conn, version, false)
+	})
+}
+
+// find...versionのindexを返す. なければ-1
+func (m *Migrator) find(version int64) int {
+	for i, v := range m.migrations {
+		if v.Version == version {
+			return i
+		}
+	}
+	return -1
+}
+
+// run...fileを実行してversionを進める. 実行中に落ちたらdirtyのまま残る
+func (m *Migrator) run(ctx context.Context, conn *sql.Conn, file string, version int64) error {
+	body, err := fs.ReadFile(m.fsys, file)
+	if err != nil {
+		return err
+	}
+	if err := m.setVersion(ctx, conn, version, true); err != nil {
+		return err
+	}
+	if query := strings.TrimSpace(string(body)); query != "" {
+		if _, err := conn.ExecContext(ctx, query); err != nil {
+			return errors.Wrapf(err, "migrate %s", file)
+		}
+	}
+	return m.setVersion(ctx, conn, version, false)
+}
+
+// locked...1つのconnectionでlockを取ってからfnを実行する
+// MySQL, PostgreSQLのadvisory lockはsessionに紐づくので、lockとmigrationを同じconnectionで行う. SQLiteはファイル1つなのでlockしない
+func (m *Migrator) locked(ctx context.Context, fn func(conn *sql.Conn) error) (err error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	switch m.driver {
+	case config.DriverMySQL:
+		var got sql.NullInt64
+		if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", lockName, lockTimeoutSeconds).Scan(&got); err != nil {
+			return errors.Wrap(err, "get migration lock")
+		}
+		if got.Int64 != 1 {
+			return errors.Errorf("could not get migration lock %q in %d seconds", lockName, lockTimeoutSeconds)
+		}
+		defer func() {
+			if _, e := conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", lockName); e != nil && err == nil {
+				err = errors.Wrap(e, "release migration lock")
+			}
+		}()
+	case config.DriverPostgres:
+		key := int64(crc32.ChecksumIEEE([]byte(lockName)))
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", key); err != nil {
+			return errors.Wrap(err, "get migration lock")
+		}
+		defer func() {
+			if _, e := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", key); e != nil && err == nil {
+				err = errors.Wrap(e, "release migration lock")
+			}
+		}()
+	}
+
+	if _, err := conn.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS schema_migrations (version bigint NOT NULL PRIMARY KEY, dirty boolean NOT NULL)"); err != nil {
+		return errors.Wrap(err, "create schema_migrations")
+	}
+	return fn(conn)
+}
+
+// clean...dirtyでなければ今のversionを返す
+func (m *Migrator) clean(ctx context.Context, conn *sql.Conn) (int64, error) {
+	version, dirty, err := m.version(ctx, conn)
+	if err != nil {
+		return 0, err
+	}
+	if dirty {
+		return 0, errors.Wrapf(ErrDirty, "version %d", version)
+	}
+	return version, nil
+}
+
+// version...schema_migrationsのversionを返す. 行がなければNilVersion
+func (m *Migrator) version(ctx context.Context, conn *sql.Conn) (int64, bool, error) {
+	var version int64
+	var dirty bool
+	err := conn.QueryRowContext(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&version, &dirty)
+	if errors.Is(err, sql.ErrNoRows) {
+		return NilVersion, false, nil
+	}
+	if err != nil {
+		return 0, false, errors.Wrap(err, "read schema_migrations")
+	}
+	return version, dirty, nil
+}
+
+// setVersion...schema_migrationsを1行だけにしてversionを書き込む
+func (m *Migrator) setVersion(ctx context.Context, conn *sql.Conn, version int64, dirty bool) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM schema_migrations"); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "write schema_migrations")
+	}
+	if version != NilVersion || dirty {
+		if _, err := tx.ExecContext(ctx, m.insertVersion(), version, dirty); err != nil {
+			tx.Rollback()
+			return errors.Wrap(err, "write schema_migrations")
+		}
+	}
+	return tx.Commit()
+}
+
+// insertVersion...schema_migrationsに書き込むquery
+func (m *Migrator) insertVersion() string {
+	return m.rebind("INSERT INTO schema_migrations (version, dirty) VALUES (?, ?)")
+}
+
+// rebind...PostgreSQLだけplaceholderが違うので、?を$1, $2, ...にする
+func (m *Migrator) rebind(query string) string {
+	if m.driver != config.DriverPostgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r != '?' {
+			b.WriteRune(r)
+			continue
+		}
+		n++
+		b.WriteString("$" + strconv.Itoa(n))
+	}
+	return b.String()
+}
+
+// String...status表示用. 20220303230750_create_todos_table
+func (v Migration) String() string {
+	return fmt.Sprintf("%d_%s", v.Version, v.Name)
+}
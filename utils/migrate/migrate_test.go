@@ -0,0 +1,255 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/sioncojp/famili-api/utils/config"
+	"github.com/sioncojp/famili-api/utils/log"
+	"github.com/sioncojp/famili-api/utils/sqlite"
+)
+
+// newSQLite...一時ディレクトリに空のSQLiteのDBを作る
+func newSQLite(t *testing.T) *sql.DB {
+	log.Log = zap.NewNop().Sugar()
+	handler, err := sqlite.NewSQLiteHandler(&config.SQLiteConfig{Path: filepath.Join(t.TempDir(), "famili-api.db")})
+	require.NoError(t, err)
+	db, err := handler.DB()
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestLoad(t *testing.T) {
+	for _, driver := range []string{config.DriverMySQL, config.DriverSQLite, config.DriverPostgres} {
+		m, err := New(nil, driver, zap.NewNop())
+		require.NoError(t, err, driver)
+		require.NotEmpty(t, m.migrations, driver)
+		assert.Equal(t, int64(20220303230750), m.migrations[0].Version, driver)
+		assert.Equal(t, "create_todos_table", m.migrations[0].Name, driver)
+	}
+
+	_, err := New(nil, config.DriverMemory, zap.NewNop())
+	assert.Error(t, err)
+}
+
+func TestSQLite(t *testing.T) {
+	ctx := context.Background()
+	db := newSQLite(t)
+	m, err := New(db, config.DriverSQLite, zap.NewNop())
+	require.NoError(t, err)
+	latest := m.migrations[len(m.migrations)-1].Version
+
+	status, err := m.Status(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, NilVersion, status.Version)
+	assert.Len(t, status.Pending, len(m.migrations))
+
+	// up...全て適用される. 2回目は何もしない
+	n, err := m.Up(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, len(m.migrations), n)
+	_, err = db.Exec("INSERT INTO todos (title, description, completed) VALUES ('t', 'd', false)")
+	require.NoError(t, err)
+
+	n, err = m.Up(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	status, err = m.Status(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, latest, status.Version)
+	assert.False(t, status.Dirty)
+	assert.Len(t, status.Applied, len(m.migrations))
+	assert.Empty(t, status.Pending)
+
+	// down...1つ戻すと、最後のmigrationだけ未適用になる
+	n, err = m.Down(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	status, err = m.Status(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, m.migrations[len(m.migrations)-2].Version, status.Version)
+	assert.Len(t, status.Pending, 1)
+
+	// 全て戻すとtableがなくなる
+	n, err = m.Down(ctx, len(m.migrations)+1)
+	require.NoError(t, err)
+	assert.Equal(t, len(m.migrations)-1, n)
+	status, err = m.Status(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, NilVersion, status.Version)
+	_, err = db.Exec("SELECT 1 FROM todos")
+	assert.Error(t, err)
+}
+
+func TestDirty(t *testing.T) {
+	ctx := context.Background()
+	db := newSQLite(t)
+	m, err := New(db, config.DriverSQLite, zap.NewNop())
+	require.NoError(t, err)
+	first := m.migrations[0].Version
+
+	// 途中で落ちたmigrationはdirtyのまま残り、forceするまでup/downできない
+	_, err = db.Exec("CREATE TABLE schema_migrations (version bigint NOT NULL PRIMARY KEY, dirty boolean NOT NULL)")
+	require.NoError(t, err)
+	_, err = db.Exec("INSERT INTO schema_migrations (version, dirty) VALUES (?, ?)", first, true)
+	require.NoError(t, err)
+
+	_, err = m.Up(ctx)
+	assert.True(t, errors.Is(err, ErrDirty))
+	_, err = m.Down(ctx, 1)
+	assert.True(t, errors.Is(err, ErrDirty))
+
+	assert.Error(t, m.Force(ctx, 1))
+	require.NoError(t, m.Force(ctx, NilVersion))
+	status, err := m.Status(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, NilVersion, status.Version)
+	assert.False(t, status.Dirty)
+
+	n, err := m.Up(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, len(m.migrations), n)
+}
+
+func TestMySQLLock(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	m, err := New(db, config.DriverMySQL, zap.NewNop())
+	require.NoError(t, err)
+	latest := m.migrations[len(m.migrations)-1].Version
+
+	// 他のprocessがlockを持っている間は待ち、取れたら最新なので何もしない
+	mock.ExpectQuery(`SELECT GET_LOCK\(\?, \?\)`).WithArgs(lockName, lockTimeoutSeconds).
+		WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(1))
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS schema_migrations`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT version, dirty FROM schema_migrations`).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "dirty"}).AddRow(latest, false))
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM todos`).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectExec(`SELECT RELEASE_LOCK\(\?\)`).WithArgs(lockName).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	n, err := m.Up(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	// timeoutまでlockが取れなければmigrationしない
+	mock.ExpectQuery(`SELECT GET_LOCK\(\?, \?\)`).WithArgs(lockName, lockTimeoutSeconds).
+		WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(0))
+
+	_, err = m.Up(ctx)
+	assert.Error(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMySQLUp(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	m, err := New(db, config.DriverMySQL, zap.NewNop())
+	require.NoError(t, err)
+	prev := m.migrations[len(m.migrations)-2].Version
+	latest := m.migrations[len(m.migrations)-1].Version
+
+	// dirtyにしてから流し、成功したらdirtyを消す
+	mock.ExpectQuery(`SELECT GET_LOCK`).WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(1))
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS schema_migrations`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT version, dirty FROM schema_migrations`).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "dirty"}).AddRow(prev, false))
+	for _, dirty := range []bool{true, false} {
+		mock.ExpectBegin()
+		mock.ExpectExec(`DELETE FROM schema_migrations`).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`INSERT INTO schema_migrations \(version, dirty\) VALUES \(\?, \?\)`).
+			WithArgs(latest, dirty).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		if dirty {
+			// 最新のmigrationのファイル
+			mock.ExpectExec(`.+`).WillReturnResult(sqlmock.NewResult(0, 0))
+		}
+	}
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM todos`).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectExec(`SELECT RELEASE_LOCK`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	n, err := m.Up(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestClaim(t *testing.T) {
+	ctx := context.Background()
+	db := newSQLite(t)
+	m, err := New(db, config.DriverSQLite, zap.NewNop())
+	require.NoError(t, err)
+
+	// visibilityを追加する前のDBにtodoがある
+	_, err = m.Up(ctx)
+	require.NoError(t, err)
+	_, err = m.Down(ctx, len(m.migrations)-1)
+	require.NoError(t, err)
+	_, err = db.Exec("INSERT INTO todos (title, description, completed) VALUES ('old', 'd', false), ('old2', 'd', true)")
+	require.NoError(t, err)
+
+	// upしても作成者とfamilyは空のままで、残っていることをwarnする
+	core, logs := observer.New(zap.WarnLevel)
+	m.logger = zap.New(core)
+	_, err = m.Up(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, logs.FilterField(zap.Int64("todos", 2)).Len())
+
+	_, err = db.Exec("INSERT INTO members (name, family_id) VALUES ('a', 'f1'), ('b', '')")
+	require.NoError(t, err)
+	_, err = db.Exec("INSERT INTO todos (title, description, completed, created_by, family_id) VALUES ('new', 'd', false, '2', 'f2')")
+	require.NoError(t, err)
+
+	_, err = m.Claim(ctx, 99)
+	assert.Error(t, err)
+	// familyの無いメンバーに渡すとやはり誰にも見えない
+	_, err = m.Claim(ctx, 2)
+	assert.Error(t, err)
+
+	n, err := m.Claim(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+
+	rows, err := db.Query("SELECT title, created_by, family_id, visibility FROM todos ORDER BY id")
+	require.NoError(t, err)
+	defer rows.Close()
+	var got [][4]string
+	for rows.Next() {
+		var v [4]string
+		require.NoError(t, rows.Scan(&v[0], &v[1], &v[2], &v[3]))
+		got = append(got, v)
+	}
+	require.NoError(t, rows.Err())
+	assert.Equal(t, [][4]string{
+		{"old", "1", "f1", "family"},
+		{"old2", "1", "f1", "family"},
+		{"new", "2", "f2", "family"},
+	}, got)
+
+	// 2回目は何も変えない
+	n, err = m.Claim(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), n)
+}
+
+func TestRebind(t *testing.T) {
+	q := "UPDATE todos SET created_by = ?, family_id = ? WHERE id = ?"
+	assert.Equal(t, q, (&Migrator{driver: config.DriverMySQL}).rebind(q))
+	assert.Equal(t, "UPDATE todos SET created_by = $1, family_id = $2 WHERE id = $3", (&Migrator{driver: config.DriverPostgres}).rebind(q))
+}
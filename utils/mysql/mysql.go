@@ -7,10 +7,11 @@ import (
 	"gorm.io/gorm"
 
 	"github.com/sioncojp/famili-api/utils/config"
+	"github.com/sioncojp/famili-api/utils/datastore"
 	"github.com/sioncojp/famili-api/utils/log"
 )
 
-// NewMySQLHandler...MySQLとコネクションする
+// NewMySQLHandler...MySQLとコネクションする. 繋がるまでConnectRetries回やり直す
 func NewMySQLHandler(c *config.DataStoreConfig) (*gorm.DB, error) {
 	log.Log.Debug("new infrastructure MySQLHandler")
 	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
@@ -20,10 +21,6 @@ func NewMySQLHandler(c *config.DataStoreConfig) (*gorm.DB, error) {
 		c.Port,
 		c.DbName,
 	)
-	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
-	if err != nil {
-		return nil, err
-	}
-
-	return db, nil
+	// LazyならSELECT VERSION()で繋ぎに行かない
+	return datastore.Open(mysql.New(mysql.Config{DSN: dsn, SkipInitializeWithVersion: c.Lazy}), c)
 }
@@ -0,0 +1,26 @@
+package postgres
+
+import (
+	"fmt"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+
+	"github.com/sioncojp/famili-api/utils/config"
+	"github.com/sioncojp/famili-api/utils/datastore"
+	"github.com/sioncojp/famili-api/utils/log"
+)
+
+// NewPostgresHandler...PostgreSQLとコネクションする. 繋がるまでConnectRetries回やり直す
+func NewPostgresHandler(c *config.DataStoreConfig) (*gorm.DB, error) {
+	log.Log.Debug("new infrastructure PostgresHandler")
+	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
+		c.Url,
+		c.Port,
+		c.Username,
+		c.Password,
+		c.DbName,
+		c.SSLMode,
+	)
+	return datastore.Open(postgres.Open(dsn), c)
+}
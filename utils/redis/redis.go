@@ -0,0 +1,32 @@
+package redis
+
+import (
+	"context"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+
+	"github.com/sioncojp/famili-api/utils/config"
+	"github.com/sioncojp/famili-api/utils/log"
+)
+
+// pingTimeout...起動時の疎通確認を待つ時間
+const pingTimeout = 5 * time.Second
+
+// NewRedisClient...Redisとコネクションする. 起動時に繋がらなければerrorにする
+func NewRedisClient(c *config.CacheConfig) (*goredis.Client, error) {
+	log.Log.Debug("new infrastructure RedisClient")
+	client := goredis.NewClient(&goredis.Options{
+		Addr:     c.RedisAddr,
+		Password: c.RedisPassword,
+		DB:       c.RedisDB,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return client, nil
+}
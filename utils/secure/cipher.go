@@ -0,0 +1,63 @@
+package secure
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+
+	"github.com/pkg/errors"
+)
+
+// Cipher...DBに保存する秘密情報をAES-256-GCMで暗号化する
+type Cipher struct {
+	aead cipher.AEAD
+}
+
+// NewCipher...base64でencodeされた32byteの鍵からCipherを作る
+func NewCipher(encodedKey string) (*Cipher, error) {
+	key, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode encryption key")
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "aes.NewCipher")
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrap(err, "cipher.NewGCM")
+	}
+	return &Cipher{aead}, nil
+}
+
+// Encrypt...nonceを先頭につけてbase64で返す
+func (c *Cipher) Encrypt(plaintext string) (string, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", errors.Wrap(err, "generate nonce")
+	}
+
+	sealed := c.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt...Encryptした値を元に戻す
+func (c *Cipher) Decrypt(ciphertext string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", errors.Wrap(err, "decode ciphertext")
+	}
+
+	size := c.aead.NonceSize()
+	if len(sealed) < size {
+		return "", errors.New("ciphertext too short")
+	}
+
+	plaintext, err := c.aead.Open(nil, sealed[:size], sealed[size:], nil)
+	if err != nil {
+		return "", errors.Wrap(err, "aead.Open")
+	}
+	return string(plaintext), nil
+}
@@ -0,0 +1,72 @@
+package secure
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testKey = base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+
+func TestCipher(t *testing.T) {
+	t.Parallel()
+	c, err := NewCipher(testKey)
+	require.NoError(t, err)
+
+	encrypted, err := c.Encrypt("JBSWY3DPEHPK3PXP")
+	require.NoError(t, err)
+	assert.NotContains(t, encrypted, "JBSWY3DPEHPK3PXP")
+
+	decrypted, err := c.Decrypt(encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "JBSWY3DPEHPK3PXP", decrypted)
+
+	// 改ざんされていたら復号できない
+	sealed, _ := base64.StdEncoding.DecodeString(encrypted)
+	sealed[len(sealed)-1] ^= 0xff
+	_, err = c.Decrypt(base64.StdEncoding.EncodeToString(sealed))
+	assert.Error(t, err)
+}
+
+func TestSigner(t *testing.T) {
+	t.Parallel()
+	s, err := NewSigner(testKey)
+	require.NoError(t, err)
+
+	token, err := s.Sign(Claims{AccountId: 1, MemberId: "1", FamilyId: "f1", Purpose: PurposeSession}, time.Hour)
+	require.NoError(t, err)
+
+	claims, err := s.Verify(token, PurposeSession)
+	require.NoError(t, err)
+	assert.Equal(t, uint(1), claims.AccountId)
+	assert.Equal(t, "f1", claims.FamilyId)
+
+	cases := []struct {
+		name    string
+		token   string
+		purpose string
+	}{
+		{"other purpose", token, PurposeMFA},
+		{"tampered", strings.Replace(token, ".", "x.", 1), PurposeSession},
+		{"no signature", strings.Split(token, ".")[0], PurposeSession},
+	}
+	for _, v := range cases {
+		_, err := s.Verify(v.token, v.purpose)
+		assert.ErrorIs(t, err, ErrInvalidToken, v.name)
+	}
+
+	// 短い鍵は受け付けない
+	for _, v := range []string{"", base64.StdEncoding.EncodeToString([]byte("short"))} {
+		_, err := NewSigner(v)
+		assert.Error(t, err, v)
+	}
+
+	expired, err := s.Sign(Claims{AccountId: 1, Purpose: PurposeSession}, -time.Second)
+	require.NoError(t, err)
+	_, err = s.Verify(expired, PurposeSession)
+	assert.ErrorIs(t, err, ErrInvalidToken, "expired")
+}
@@ -0,0 +1,95 @@
+package secure
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// PurposeSession...loginが完了したsession
+	PurposeSession = "session"
+	// PurposeMFA...passwordは確認済みで、TOTPのstep-up待ち
+	PurposeMFA = "mfa"
+)
+
+// SigningKeyLength...HMAC-SHA256の鍵の最小の長さ
+const SigningKeyLength = 32
+
+var ErrInvalidToken = errors.New("invalid token")
+
+// Claims...tokenに含める情報
+type Claims struct {
+	AccountId uint   `json:"aid"`
+	MemberId  string `json:"mid"`
+	FamilyId  string `json:"fid"`
+	Purpose   string `json:"pur"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// Signer...HMAC-SHA256で署名したtokenを発行、検証する. DBに状態を持たない
+type Signer struct {
+	key []byte
+}
+
+// NewSigner...base64でencodeされたSigningKeyLength byte以上の鍵からSignerを作る
+// 短い鍵(空の鍵も)を通すと誰でもtokenを作れてしまうのでerrorにする
+func NewSigner(encodedKey string) (*Signer, error) {
+	key, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode signing key")
+	}
+	if len(key) < SigningKeyLength {
+		return nil, errors.Errorf("signing key must be %d bytes or more", SigningKeyLength)
+	}
+	return &Signer{key}, nil
+}
+
+// Sign...claimsにttlをつけて <payload>.<signature> の形式で返す
+func (s *Signer) Sign(claims Claims, ttl time.Duration) (string, error) {
+	claims.ExpiresAt = time.Now().Add(ttl).Unix()
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", errors.Wrap(err, "marshal claims")
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + s.signature(encoded), nil
+}
+
+// Verify...署名、用途、期限を検証してclaimsを返す
+func (s *Signer) Verify(token, purpose string) (Claims, error) {
+	var claims Claims
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return claims, ErrInvalidToken
+	}
+	if !hmac.Equal([]byte(parts[1]), []byte(s.signature(parts[0]))) {
+		return claims, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return claims, ErrInvalidToken
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return claims, ErrInvalidToken
+	}
+
+	if claims.Purpose != purpose || time.Now().Unix() >= claims.ExpiresAt {
+		return claims, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+func (s *Signer) signature(payload string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
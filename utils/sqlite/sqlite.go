@@ -0,0 +1,31 @@
+package sqlite
+
+import (
+	"fmt"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/sioncojp/famili-api/utils/config"
+	"github.com/sioncojp/famili-api/utils/log"
+)
+
+// NewSQLiteHandler...SQLiteのファイルを開く. pure GoなのでCGO_ENABLED=0のままbuildできる
+func NewSQLiteHandler(c *config.SQLiteConfig) (*gorm.DB, error) {
+	log.Log.Debug("new infrastructure SQLiteHandler")
+	// ON DELETE CASCADEを効かせるためにforeign_keysを有効にする
+	dsn := fmt.Sprintf("file:%s?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)", c.Path)
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLiteは書き込みが1つずつなので、コネクションも1つにして database is locked を避ける
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(1)
+
+	return db, nil
+}
@@ -0,0 +1,24 @@
+package utils
+
+import (
+	"testing"
+)
+
+func TestMakeSecureToken(t *testing.T) {
+	t.Parallel()
+	token1, err := MakeSecureToken(32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token2, err := MakeSecureToken(32)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token1 == token2 {
+		t.Error("not random token")
+	}
+	if len(token1) != 43 {
+		t.Errorf("unexpected token length: %d", len(token1))
+	}
+}